@@ -0,0 +1,24 @@
+package assets
+
+import (
+	"home-broker/core"
+)
+
+// AssetUseCases represents the assets use cases.
+type AssetUseCases struct {
+	db AssetDBInterface
+}
+
+// NewAssetUseCases returns a new AssetUseCases.
+func NewAssetUseCases(db AssetDBInterface) AssetUseCases {
+	return AssetUseCases{db: db}
+}
+
+// GetAsset returns an asset by ID.
+// A nil entity will be returned if it does not exist.
+func (uc AssetUseCases) GetAsset(assetID AssetID) (*Asset, error) {
+	if assetID == "" {
+		return nil, core.NewErrValidation("Invalid asset ID.")
+	}
+	return uc.db.GetByID(assetID)
+}
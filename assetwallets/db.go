@@ -3,6 +3,7 @@ package assetwallets
 import (
 	"errors"
 	"home-broker/assets"
+	"home-broker/core"
 	"home-broker/users"
 )
 
@@ -12,6 +13,9 @@ var (
 
 	// ErrAssetWalletAlreadyExists happens when asset wallet record already exists.
 	ErrAssetWalletAlreadyExists = errors.New("asset wallet already exists")
+
+	// ErrInsufficientAssets happens when the available balance does not cover a hold.
+	ErrInsufficientAssets = errors.New("insufficient assets")
 )
 
 // AssetWalletDBInterface is an interface that handles database commands for Wallet entity.
@@ -28,4 +32,27 @@ type AssetWalletDBInterface interface {
 	// IncBalanceByUserIDAssetID must increment or decrement the balance field by a user ID and asset ID.
 	// An updated entity will be returned or nil if it does not exist.
 	IncBalanceByUserIDAssetID(userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit) (*AssetWallet, error)
+
+	// HoldAssets must reserve assets of an asset wallet if the available balance (balance - held) covers them.
+	// The following errors can happen: ErrInsufficientAssets.
+	HoldAssets(userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit) error
+
+	// HoldPendingAssets must reserve assets of an asset wallet if the balance plus the pending assets
+	// (balance + pending - held) cover them (ex: the bracket exits that sell the assets bought by their entry).
+	// The following errors can happen: ErrInsufficientAssets.
+	HoldPendingAssets(userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit) error
+
+	// ReleaseAssets must release held assets of an asset wallet and remove "debit" from its balance at the same time,
+	// if the balance still covers the assets held after the release (balance - debit >= held - amount).
+	// The following errors can happen: ErrInsufficientAssets.
+	ReleaseAssets(userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit, debit assets.AssetUnit) error
+
+	// ReleasePendingAssets must release held assets like ReleaseAssets, but the pending assets must cover
+	// the held ones too (balance + pending - debit >= held - amount), so the assets held by HoldPendingAssets
+	// can be sold before they are settled. The balance is negative until the pending assets are settled.
+	// The following errors can happen: ErrInsufficientAssets.
+	ReleasePendingAssets(userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit, debit assets.AssetUnit) error
+
+	// WithTx must return a copy of the handler that runs its commands inside a transaction (see core.UnitOfWork).
+	WithTx(tx core.Tx) AssetWalletDBInterface
 }
@@ -10,11 +10,16 @@ import (
 type AssetWalletID int64
 
 // AssetWallet represents an user entity wallet for assets.
+// The balance includes the assets held by open selling orders.
+// Only the available assets can be sold or withdrawn (transferred out).
 type AssetWallet struct {
 	ID        AssetWalletID    `json:"id"`
 	UserID    users.UserID     `json:"user_id"`
 	AssetID   assets.AssetID   `json:"asset_id"`
-	Balance   assets.AssetUnit `json:"balance"`
+	Balance   assets.AssetUnit `json:"balance"`   // Settled assets. Usable for selling and withdrawal when not held.
+	Held      assets.AssetUnit `json:"held"`      // Assets reserved by open selling orders. Not usable for selling or withdrawal.
+	Available assets.AssetUnit `json:"available"` // Assets that can be sold by new orders (balance - held). Usable for selling and withdrawal.
+	Pending   assets.AssetUnit `json:"pending"`   // Assets of trades not settled yet (see settlements). Not usable for selling or withdrawal.
 	CreatedAt time.Time        `json:"created_at"`
 	UpdatedAt time.Time        `json:"updated_at"`
 	DeletedAt time.Time        `json:"-"`
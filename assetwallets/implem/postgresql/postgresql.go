@@ -2,9 +2,11 @@ package postgresql
 
 import (
 	"errors"
+	"fmt"
 	"home-broker/assets"
 	assetspostgresql "home-broker/assets/implem/postgresql"
 	"home-broker/assetwallets"
+	"home-broker/core"
 	"home-broker/core/implem/postgresql"
 	"home-broker/users"
 	userspostgresql "home-broker/users/implem/postgresql"
@@ -23,6 +25,8 @@ type AssetWalletModel struct {
 	AssetID   assets.AssetID `gorm:"uniqueIndex:idx_assetwallet_userasset;not null"`
 	Asset     assetspostgresql.AssetModel
 	Balance   assets.AssetUnit `gorm:"not null;index:,sort:desc"` // Mind the money.MoneyDecimalPlaces.
+	Held      assets.AssetUnit `gorm:"not null;default:0"`        // Assets reserved by open selling orders.
+	Pending   assets.AssetUnit `gorm:"not null;default:0"`        // Assets of trades not settled yet.
 	CreatedAt time.Time        `gorm:"not null;index:,sort:desc"`
 	UpdatedAt time.Time        `gorm:"not null;index:,sort:desc"`
 	DeletedAt gorm.DeletedAt   `gorm:"index:,sort:desc"`
@@ -45,6 +49,11 @@ func NewAssetWalletDB(db postgresql.DB) AssetWalletDB {
 	return AssetWalletDB{db: db}
 }
 
+// WithTx returns a copy of the AssetWalletDB that runs its commands inside a transaction.
+func (assetWalletDB AssetWalletDB) WithTx(tx core.Tx) assetwallets.AssetWalletDBInterface {
+	return NewAssetWalletDB(assetWalletDB.db.WithTx(tx))
+}
+
 // ToEntity returns a Wallet entity from the ORM model.
 func (AssetWalletDB) ToEntity(model AssetWalletModel) assetwallets.AssetWallet {
 	// "model.DeletedAt" is not a Time object. It is a struct with Time and Valid fields.
@@ -58,6 +67,9 @@ func (AssetWalletDB) ToEntity(model AssetWalletModel) assetwallets.AssetWallet {
 		UserID:    model.UserID,
 		AssetID:   model.AssetID,
 		Balance:   model.Balance,
+		Held:      model.Held,
+		Available: model.Balance - model.Held,
+		Pending:   model.Pending,
 		CreatedAt: model.CreatedAt,
 		UpdatedAt: model.UpdatedAt,
 		DeletedAt: deletedAt,
@@ -76,6 +88,8 @@ func (AssetWalletDB) ToModel(entity assetwallets.AssetWallet) AssetWalletModel {
 		UserID:    entity.UserID,
 		AssetID:   entity.AssetID,
 		Balance:   entity.Balance,
+		Held:      entity.Held,
+		Pending:   entity.Pending,
 		CreatedAt: entity.CreatedAt,
 		UpdatedAt: entity.UpdatedAt,
 		DeletedAt: deletedAt,
@@ -143,3 +157,117 @@ func (assetWalletDB AssetWalletDB) IncBalanceByUserIDAssetID(userID users.UserID
 	entity, err := assetWalletDB.GetByUserIDAssetID(userID, assetID)
 	return entity, err
 }
+
+// HoldAssets reserves assets of an asset wallet.
+// The assets are only held if the available balance (balance - held) covers them.
+// The following errors can happen: ErrInsufficientAssets.
+func (assetWalletDB AssetWalletDB) HoldAssets(userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit) error {
+	res := assetWalletDB.db.GetDB().
+		Table("assetwallet").
+		Where(`"user_id"=? AND "asset_id"=? AND "deleted_at" IS NULL AND "balance"-"held">=?`, userID, assetID, amount).
+		Updates(map[string]interface{}{
+			"held":       gorm.Expr(`"held"+?`, amount),
+			"updated_at": time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: User ID %d, Asset ID %s", assetwallets.ErrInsufficientAssets, userID, assetID)
+	}
+	return nil
+}
+
+// HoldPendingAssets reserves assets of an asset wallet, including the pending ones.
+// The assets are only held if the balance plus the pending assets (balance + pending - held) cover them.
+// The following errors can happen: ErrInsufficientAssets.
+func (assetWalletDB AssetWalletDB) HoldPendingAssets(userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit) error {
+	res := assetWalletDB.db.GetDB().
+		Table("assetwallet").
+		Where(`"user_id"=? AND "asset_id"=? AND "deleted_at" IS NULL AND "balance"+"pending"-"held">=?`, userID, assetID, amount).
+		Updates(map[string]interface{}{
+			"held":       gorm.Expr(`"held"+?`, amount),
+			"updated_at": time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: User ID %d, Asset ID %s", assetwallets.ErrInsufficientAssets, userID, assetID)
+	}
+	return nil
+}
+
+// ReleaseAssets releases held assets of an asset wallet.
+// The "debit" is removed from the balance at the same time (ex: the amount of a trade).
+// The balance must still cover the assets held after the release (balance - debit >= held - amount).
+// The following errors can happen: ErrInsufficientAssets.
+func (assetWalletDB AssetWalletDB) ReleaseAssets(userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit, debit assets.AssetUnit) error {
+	return assetWalletDB.releaseAssets(`"balance"-?>="held"-?`, userID, assetID, amount, debit)
+}
+
+// ReleasePendingAssets releases held assets of an asset wallet like ReleaseAssets, but the pending assets
+// cover the held ones too (balance + pending - debit >= held - amount, see HoldPendingAssets).
+// The balance becomes negative when the debit sells pending assets, until they are settled (see SettlePendingAssets).
+// The following errors can happen: ErrInsufficientAssets.
+func (assetWalletDB AssetWalletDB) ReleasePendingAssets(userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit, debit assets.AssetUnit) error {
+	return assetWalletDB.releaseAssets(`"balance"+"pending"-?>="held"-?`, userID, assetID, amount, debit)
+}
+
+// releaseAssets releases held assets and removes "debit" from the balance if the "guard" condition is true.
+func (assetWalletDB AssetWalletDB) releaseAssets(guard string, userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit, debit assets.AssetUnit) error {
+	res := assetWalletDB.db.GetDB().
+		Table("assetwallet").
+		Where(`"user_id"=? AND "asset_id"=? AND "deleted_at" IS NULL AND `+guard, userID, assetID, debit, amount).
+		Updates(map[string]interface{}{
+			"held":       gorm.Expr(`"held"-?`, amount),
+			"balance":    gorm.Expr(`"balance"-?`, debit),
+			"updated_at": time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: User ID %d, Asset ID %s", assetwallets.ErrInsufficientAssets, userID, assetID)
+	}
+	return nil
+}
+
+// AddPendingAssets adds the assets of a trade not settled yet to an asset wallet inside a transaction.
+// The following errors can happen: ErrAssetWalletDoesNotExist.
+func AddPendingAssets(tx *gorm.DB, userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit) error {
+	res := tx.
+		Table("assetwallet").
+		Where(`"user_id"=? AND "asset_id"=? AND "deleted_at" IS NULL`, userID, assetID).
+		Updates(map[string]interface{}{
+			"pending":    gorm.Expr(`"pending"+?`, amount),
+			"updated_at": time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: User ID %d, Asset ID %s", assetwallets.ErrAssetWalletDoesNotExist, userID, assetID)
+	}
+	return nil
+}
+
+// SettlePendingAssets moves pending assets of an asset wallet to its balance inside a transaction (ex: on the settlement date).
+// The following errors can happen: ErrAssetWalletDoesNotExist.
+func SettlePendingAssets(tx *gorm.DB, userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit) error {
+	res := tx.
+		Table("assetwallet").
+		Where(`"user_id"=? AND "asset_id"=? AND "deleted_at" IS NULL`, userID, assetID).
+		Updates(map[string]interface{}{
+			"pending":    gorm.Expr(`"pending"-?`, amount),
+			"balance":    gorm.Expr(`"balance"+?`, amount),
+			"updated_at": time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: User ID %d, Asset ID %s", assetwallets.ErrAssetWalletDoesNotExist, userID, assetID)
+	}
+	return nil
+}
@@ -23,6 +23,11 @@ func NewAssetWalletUseCases(db AssetWalletDBInterface, userUC users.UserUseCases
 	return AssetWalletUseCases{db: db, userUC: userUC}
 }
 
+// WithTx returns a copy of the use cases whose asset wallet commands run inside a transaction (see core.UnitOfWork).
+func (uc AssetWalletUseCases) WithTx(tx core.Tx) AssetWalletUseCases {
+	return AssetWalletUseCases{db: uc.db.WithTx(tx), userUC: uc.userUC}
+}
+
 // GetAssetWallet returns an asset wallet by an user ID and asset ID.
 // A new empty wallet is created if the wallet does not exist.
 // In this case the user is also created because a missing wallet can be a missing user as well.
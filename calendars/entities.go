@@ -0,0 +1,246 @@
+package calendars
+
+import (
+	"fmt"
+	"home-broker/assets"
+	"sort"
+	"time"
+)
+
+type (
+	// SessionPhase represents a trading session phase of an exchange.
+	// Use the value of SessionPhasePreOpen, SessionPhaseContinuous, SessionPhaseClosingAuction
+	// or SessionPhaseClosed to set this data type.
+	SessionPhase string
+)
+
+const (
+	// SessionPhasePreOpen is the opening auction. Orders are accepted, but not matched.
+	SessionPhasePreOpen SessionPhase = "pre_open"
+
+	// SessionPhaseContinuous is the continuous trading. Orders are matched as soon as they cross.
+	SessionPhaseContinuous SessionPhase = "continuous"
+
+	// SessionPhaseClosingAuction is the closing auction. Orders are accepted, but not matched.
+	SessionPhaseClosingAuction SessionPhase = "closing_auction"
+
+	// SessionPhaseClosed is when the exchange does not accept orders.
+	SessionPhaseClosed SessionPhase = "closed"
+
+	// clockLayout is the layout of the sessions start and end times.
+	clockLayout = "15:04"
+)
+
+// Session is a phase inside of a trading day.
+// Start and End are wall clock times ("HH:MM") in the calendar time zone.
+// The End is not included in the session.
+type Session struct {
+	Phase SessionPhase `json:"phase"`
+	Start string       `json:"start"`
+	End   string       `json:"end"`
+	start time.Duration
+	end   time.Duration
+}
+
+// NewSession returns a new Session.
+func NewSession(phase SessionPhase, start string, end string) (Session, error) {
+	session := Session{Phase: phase, Start: start, End: end}
+	startTime, err := time.Parse(clockLayout, start)
+	if err != nil {
+		return Session{}, fmt.Errorf("invalid session start %q: %w", start, err)
+	}
+	endTime, err := time.Parse(clockLayout, end)
+	if err != nil {
+		return Session{}, fmt.Errorf("invalid session end %q: %w", end, err)
+	}
+	session.start = time.Duration(startTime.Hour())*time.Hour + time.Duration(startTime.Minute())*time.Minute
+	session.end = time.Duration(endTime.Hour())*time.Hour + time.Duration(endTime.Minute())*time.Minute
+	if session.end <= session.start {
+		return Session{}, fmt.Errorf("session %v ends before it starts", phase)
+	}
+	return session, nil
+}
+
+// Holiday is a day without trading.
+// A zero Year means that the holiday happens every year (ex: Christmas).
+type Holiday struct {
+	Name  string     `json:"name"`
+	Year  int        `json:"year"`
+	Month time.Month `json:"month"`
+	Day   int        `json:"day"`
+}
+
+// Calendar is the trading calendar of an exchange.
+// A calendar without sessions is always in the continuous phase (ex: 24/7 venues).
+type Calendar struct {
+	ExchangeID assets.ExchangeID `json:"exchange_id"`
+	TimeZone   string            `json:"time_zone"` // IANA name (ex: "America/Sao_Paulo")
+	Sessions   []Session         `json:"sessions"`  // sorted by start time
+	Holidays   []Holiday         `json:"holidays"`
+	Weekends   bool              `json:"weekends"` // true if it trades on saturdays and sundays
+	// SettlementDays is the settlement cycle in trading days (ex: 2 for T+2). Zero settles on the trade day.
+	SettlementDays int `json:"settlement_days"`
+	location       *time.Location
+}
+
+// NewCalendar returns a new Calendar.
+// Sessions must not overlap. The time outside of the sessions is SessionPhaseClosed.
+func NewCalendar(exchangeID assets.ExchangeID, timeZone string, sessions []Session, holidays []Holiday, weekends bool) (Calendar, error) {
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return Calendar{}, err
+	}
+	sorted := make([]Session, len(sessions))
+	copy(sorted, sessions)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start < sorted[j].start })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].start < sorted[i-1].end {
+			return Calendar{}, fmt.Errorf("sessions %v and %v overlap", sorted[i-1].Phase, sorted[i].Phase)
+		}
+	}
+	return Calendar{
+		ExchangeID: exchangeID,
+		TimeZone:   timeZone,
+		Sessions:   sorted,
+		Holidays:   holidays,
+		Weekends:   weekends,
+		location:   location,
+	}, nil
+}
+
+// Location returns the calendar time zone.
+func (c Calendar) Location() *time.Location {
+	if c.location == nil {
+		return time.UTC
+	}
+	return c.location
+}
+
+// IsHoliday returns true if the day of "t" (in the calendar time zone) is a holiday.
+func (c Calendar) IsHoliday(t time.Time) bool {
+	local := t.In(c.Location())
+	for _, holiday := range c.Holidays {
+		if holiday.Month == local.Month() && holiday.Day == local.Day() && (holiday.Year == 0 || holiday.Year == local.Year()) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTradingDay returns true if the day of "t" (in the calendar time zone) has trading sessions.
+func (c Calendar) IsTradingDay(t time.Time) bool {
+	local := t.In(c.Location())
+	if !c.Weekends && (local.Weekday() == time.Saturday || local.Weekday() == time.Sunday) {
+		return false
+	}
+	return !c.IsHoliday(local)
+}
+
+// PhaseAt returns the session phase at "t".
+func (c Calendar) PhaseAt(t time.Time) SessionPhase {
+	if len(c.Sessions) == 0 {
+		return SessionPhaseContinuous
+	}
+	if !c.IsTradingDay(t) {
+		return SessionPhaseClosed
+	}
+	// The wall clock, not the time since midnight (a day with a DST change has 23 or 25 hours).
+	local := t.In(c.Location())
+	clock := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second
+	for _, session := range c.Sessions {
+		if clock >= session.start && clock < session.end {
+			return session.Phase
+		}
+	}
+	return SessionPhaseClosed
+}
+
+// AddTradingDays returns the date "n" trading days after the day of "t" (ex: the T+2 settlement date).
+// The returned time is the midnight of that day in the calendar time zone.
+func (c Calendar) AddTradingDays(t time.Time, n int) time.Time {
+	local := t.In(c.Location())
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, c.Location())
+	for n > 0 {
+		day = day.AddDate(0, 0, 1)
+		if c.IsTradingDay(day) {
+			n--
+		}
+	}
+	return day
+}
+
+// SettlementDate returns the date that a trade made at "t" settles (see SettlementDays and AddTradingDays).
+func (c Calendar) SettlementDate(t time.Time) time.Time {
+	return c.AddTradingDays(t, c.SettlementDays)
+}
+
+// AcceptsOrders returns true if the phase accepts new orders.
+func (phase SessionPhase) AcceptsOrders() bool {
+	return phase != SessionPhaseClosed
+}
+
+// mustNewSession returns a new Session or panics. It is used by the built-in calendars.
+func mustNewSession(phase SessionPhase, start string, end string) Session {
+	session, err := NewSession(phase, start, end)
+	if err != nil {
+		panic(err)
+	}
+	return session
+}
+
+// DefaultCalendars returns the built-in exchange calendars.
+// The holidays are the fixed-date ones. Moving holidays (ex: Carnival) must be added for each year.
+func DefaultCalendars() ([]Calendar, error) {
+	b3, err := NewCalendar(
+		"B3",
+		"America/Sao_Paulo",
+		[]Session{
+			mustNewSession(SessionPhasePreOpen, "09:45", "10:00"),
+			mustNewSession(SessionPhaseContinuous, "10:00", "16:55"),
+			mustNewSession(SessionPhaseClosingAuction, "16:55", "17:00"),
+		},
+		[]Holiday{
+			{Name: "Confraternização Universal", Month: time.January, Day: 1},
+			{Name: "Tiradentes", Month: time.April, Day: 21},
+			{Name: "Dia do Trabalho", Month: time.May, Day: 1},
+			{Name: "Independência do Brasil", Month: time.September, Day: 7},
+			{Name: "Nossa Senhora Aparecida", Month: time.October, Day: 12},
+			{Name: "Finados", Month: time.November, Day: 2},
+			{Name: "Proclamação da República", Month: time.November, Day: 15},
+			{Name: "Natal", Month: time.December, Day: 25},
+		},
+		false,
+	)
+	if err != nil {
+		return nil, err
+	}
+	b3.SettlementDays = 2
+	usSessions := []Session{
+		mustNewSession(SessionPhasePreOpen, "09:28", "09:30"),
+		mustNewSession(SessionPhaseContinuous, "09:30", "15:55"),
+		mustNewSession(SessionPhaseClosingAuction, "15:55", "16:00"),
+	}
+	usHolidays := []Holiday{
+		{Name: "New Year's Day", Month: time.January, Day: 1},
+		{Name: "Juneteenth", Month: time.June, Day: 19},
+		{Name: "Independence Day", Month: time.July, Day: 4},
+		{Name: "Christmas Day", Month: time.December, Day: 25},
+	}
+	nasdaq, err := NewCalendar("NASDAQ", "America/New_York", usSessions, usHolidays, false)
+	if err != nil {
+		return nil, err
+	}
+	nyse, err := NewCalendar("NYSE", "America/New_York", usSessions, usHolidays, false)
+	if err != nil {
+		return nil, err
+	}
+	// The US markets settle at T+1 since May 2024.
+	nasdaq.SettlementDays = 1
+	nyse.SettlementDays = 1
+	// The Vibranium exchange used by the development environment never closes.
+	vibr, err := NewCalendar("VIBR", "UTC", nil, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	return []Calendar{b3, nasdaq, nyse, vibr}, nil
+}
@@ -0,0 +1,156 @@
+package calendars_test
+
+import (
+	"home-broker/calendars"
+	"testing"
+	"time"
+)
+
+func getB3Calendar(t *testing.T) calendars.Calendar {
+	defaults, err := calendars.DefaultCalendars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, calendar := range defaults {
+		if calendar.ExchangeID == "B3" {
+			return calendar
+		}
+	}
+	t.Fatal("B3 calendar not found")
+	return calendars.Calendar{}
+}
+
+func TestNewSession_InvalidTimes_Error(t *testing.T) {
+	testTable := []struct {
+		test  string
+		start string
+		end   string
+	}{
+		{test: "InvalidStart", start: "9h", end: "10:00"},
+		{test: "InvalidEnd", start: "09:00", end: "25:00"},
+		{test: "EndBeforeStart", start: "10:00", end: "09:00"},
+	}
+	for _, table := range testTable {
+		t.Run(table.test, func(t *testing.T) {
+			_, err := calendars.NewSession(calendars.SessionPhaseContinuous, table.start, table.end)
+			if err == nil {
+				t.Errorf("an error was expected to happen")
+			}
+		})
+	}
+}
+
+func TestNewCalendar_OverlappingSessions_Error(t *testing.T) {
+	s1, _ := calendars.NewSession(calendars.SessionPhasePreOpen, "09:00", "10:00")
+	s2, _ := calendars.NewSession(calendars.SessionPhaseContinuous, "09:30", "17:00")
+	_, err := calendars.NewCalendar("X", "UTC", []calendars.Session{s2, s1}, nil, false)
+	if err == nil {
+		t.Errorf("an error was expected to happen")
+	}
+}
+
+func TestCalendarPhaseAt(t *testing.T) {
+	calendar := getB3Calendar(t)
+	location := calendar.Location()
+	testTable := []struct {
+		test     string
+		time     time.Time
+		expected calendars.SessionPhase
+	}{
+		{test: "BeforePreOpen", time: time.Date(2020, 9, 21, 9, 44, 59, 0, location), expected: calendars.SessionPhaseClosed},
+		{test: "PreOpen", time: time.Date(2020, 9, 21, 9, 45, 0, 0, location), expected: calendars.SessionPhasePreOpen},
+		{test: "Continuous", time: time.Date(2020, 9, 21, 10, 0, 0, 0, location), expected: calendars.SessionPhaseContinuous},
+		{test: "ClosingAuction", time: time.Date(2020, 9, 21, 16, 59, 59, 0, location), expected: calendars.SessionPhaseClosingAuction},
+		{test: "AfterClose", time: time.Date(2020, 9, 21, 17, 0, 0, 0, location), expected: calendars.SessionPhaseClosed},
+		{test: "Saturday", time: time.Date(2020, 9, 19, 12, 0, 0, 0, location), expected: calendars.SessionPhaseClosed},
+		{test: "Holiday", time: time.Date(2020, 9, 7, 12, 0, 0, 0, location), expected: calendars.SessionPhaseClosed},
+		// 13:00 UTC is 10:00 in Sao Paulo.
+		{test: "OtherTimeZone", time: time.Date(2020, 9, 21, 13, 0, 0, 0, time.UTC), expected: calendars.SessionPhaseContinuous},
+	}
+	for _, table := range testTable {
+		t.Run(table.test, func(t *testing.T) {
+			phase := calendar.PhaseAt(table.time)
+			if phase != table.expected {
+				t.Errorf("phase is %v, expected %v", phase, table.expected)
+			}
+		})
+	}
+}
+
+func TestCalendarPhaseAt_DSTDays_WallClock(t *testing.T) {
+	session, err := calendars.NewSession(calendars.SessionPhaseContinuous, "09:30", "16:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendar, err := calendars.NewCalendar("X", "America/New_York", []calendars.Session{session}, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	location := calendar.Location()
+	testTable := []struct {
+		test     string
+		time     time.Time
+		expected calendars.SessionPhase
+	}{
+		// 2020-03-08 has 23 hours (02:00 becomes 03:00).
+		{test: "SpringForwardOpen", time: time.Date(2020, 3, 8, 9, 30, 0, 0, location), expected: calendars.SessionPhaseContinuous},
+		{test: "SpringForwardClose", time: time.Date(2020, 3, 8, 16, 0, 0, 0, location), expected: calendars.SessionPhaseClosed},
+		// 2020-11-01 has 25 hours (02:00 becomes 01:00).
+		{test: "FallBackBeforeOpen", time: time.Date(2020, 11, 1, 9, 29, 59, 0, location), expected: calendars.SessionPhaseClosed},
+		{test: "FallBackLastSecond", time: time.Date(2020, 11, 1, 15, 59, 59, 0, location), expected: calendars.SessionPhaseContinuous},
+	}
+	for _, table := range testTable {
+		t.Run(table.test, func(t *testing.T) {
+			phase := calendar.PhaseAt(table.time)
+			if phase != table.expected {
+				t.Errorf("phase is %v, expected %v", phase, table.expected)
+			}
+		})
+	}
+}
+
+func TestCalendarPhaseAt_NoSessions_AlwaysContinuous(t *testing.T) {
+	calendar, err := calendars.NewCalendar("X", "UTC", nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	phase := calendar.PhaseAt(time.Date(2020, 9, 19, 3, 0, 0, 0, time.UTC))
+	if phase != calendars.SessionPhaseContinuous {
+		t.Errorf("phase is %v, expected %v", phase, calendars.SessionPhaseContinuous)
+	}
+}
+
+func TestCalendarSettlementDate(t *testing.T) {
+	calendar := getB3Calendar(t)
+	location := calendar.Location()
+	// B3 settles at T+2.
+	day := calendar.SettlementDate(time.Date(2020, 9, 24, 15, 0, 0, 0, location))
+	expected := time.Date(2020, 9, 28, 0, 0, 0, 0, location)
+	if !day.Equal(expected) {
+		t.Errorf("day is %v, expected %v", day, expected)
+	}
+}
+
+func TestCalendarAddTradingDays(t *testing.T) {
+	calendar := getB3Calendar(t)
+	location := calendar.Location()
+	testTable := []struct {
+		test     string
+		time     time.Time
+		days     int
+		expected time.Time
+	}{
+		{test: "MidWeek", time: time.Date(2020, 9, 21, 15, 0, 0, 0, location), days: 2, expected: time.Date(2020, 9, 23, 0, 0, 0, 0, location)},
+		{test: "OverWeekend", time: time.Date(2020, 9, 24, 15, 0, 0, 0, location), days: 2, expected: time.Date(2020, 9, 28, 0, 0, 0, 0, location)},
+		{test: "OverHoliday", time: time.Date(2020, 9, 3, 15, 0, 0, 0, location), days: 2, expected: time.Date(2020, 9, 8, 0, 0, 0, 0, location)},
+		{test: "Zero", time: time.Date(2020, 9, 21, 15, 0, 0, 0, location), days: 0, expected: time.Date(2020, 9, 21, 0, 0, 0, 0, location)},
+	}
+	for _, table := range testTable {
+		t.Run(table.test, func(t *testing.T) {
+			day := calendar.AddTradingDays(table.time, table.days)
+			if !day.Equal(table.expected) {
+				t.Errorf("day is %v, expected %v", day, table.expected)
+			}
+		})
+	}
+}
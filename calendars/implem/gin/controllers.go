@@ -0,0 +1,50 @@
+package calendarsgin
+
+import (
+	"home-broker/assets"
+	"home-broker/calendars"
+	"home-broker/core"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CalendarController represents an exchange calendar controller.
+type CalendarController struct {
+	uc calendars.CalendarUseCases
+}
+
+// NewCalendarController creates a new CalendarController.
+func NewCalendarController(uc calendars.CalendarUseCases) CalendarController {
+	return CalendarController{uc: uc}
+}
+
+// CalendarResponse is the GetCalendar response.
+type CalendarResponse struct {
+	Calendar *calendars.Calendar    `json:"calendar"`
+	Phase    calendars.SessionPhase `json:"phase"` // current session phase
+}
+
+// GetCalendar returns the calendar and the current session phase of an exchange.
+func (calendarC CalendarController) GetCalendar(c *gin.Context) {
+	exchangeID := assets.ExchangeID(c.Param("exchange_id"))
+	calendar, err := calendarC.uc.GetCalendar(exchangeID)
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	if calendar == nil {
+		c.Error(core.NewAPIError("Not found", 404))
+		return
+	}
+	c.JSON(http.StatusOK, CalendarResponse{
+		Calendar: calendar,
+		Phase:    calendar.PhaseAt(time.Now()),
+	})
+}
@@ -0,0 +1,26 @@
+package calendarsgin
+
+import (
+	"home-broker/calendars"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CalendarRouter represents an exchange calendars router.
+type CalendarRouter struct {
+	uc calendars.CalendarUseCases
+}
+
+// NewCalendarRouter creates a new Router.
+func NewCalendarRouter(uc calendars.CalendarUseCases) CalendarRouter {
+	return CalendarRouter{uc: uc}
+}
+
+// SetupRouter setups exchange calendars router.
+func (wr CalendarRouter) SetupRouter(router *gin.Engine) {
+	calendarC := NewCalendarController(wr.uc)
+	v1 := router.Group("/api/v1/calendars")
+	{
+		v1.GET(":exchange_id/", calendarC.GetCalendar)
+	}
+}
@@ -0,0 +1,62 @@
+package calendars
+
+import (
+	"home-broker/assets"
+	"home-broker/core"
+	"time"
+)
+
+// CalendarUseCases represents the exchange calendar use cases.
+type CalendarUseCases struct {
+	calendars map[assets.ExchangeID]Calendar
+}
+
+// NewCalendarUseCases returns a new CalendarUseCases.
+func NewCalendarUseCases(calendars []Calendar) CalendarUseCases {
+	uc := CalendarUseCases{calendars: make(map[assets.ExchangeID]Calendar)}
+	for _, calendar := range calendars {
+		uc.calendars[calendar.ExchangeID] = calendar
+	}
+	return uc
+}
+
+// GetCalendar returns the calendar of an exchange.
+// A nil calendar will be returned if the exchange is unknown.
+func (uc CalendarUseCases) GetCalendar(exchangeID assets.ExchangeID) (*Calendar, error) {
+	if exchangeID == "" {
+		return nil, core.NewErrValidation("Invalid exchange ID.")
+	}
+	calendar, ok := uc.calendars[exchangeID]
+	if !ok {
+		return nil, nil
+	}
+	return &calendar, nil
+}
+
+// GetPhase returns the session phase of an exchange at "t".
+// Exchanges without a calendar are always in the continuous phase.
+func (uc CalendarUseCases) GetPhase(exchangeID assets.ExchangeID, t time.Time) SessionPhase {
+	calendar, ok := uc.calendars[exchangeID]
+	if !ok {
+		return SessionPhaseContinuous
+	}
+	return calendar.PhaseAt(t)
+}
+
+// CheckOrdersAllowed returns an ErrValidation if the exchange does not accept orders at "t".
+func (uc CalendarUseCases) CheckOrdersAllowed(exchangeID assets.ExchangeID, t time.Time) error {
+	if !uc.GetPhase(exchangeID, t).AcceptsOrders() {
+		return core.NewErrValidation("The exchange is closed.")
+	}
+	return nil
+}
+
+// SettlementDate returns the date that a trade made at "t" on an exchange settles (see Calendar.SettlementDate).
+// Exchanges without a calendar settle on the trade day.
+func (uc CalendarUseCases) SettlementDate(exchangeID assets.ExchangeID, t time.Time) time.Time {
+	calendar, ok := uc.calendars[exchangeID]
+	if !ok {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return calendar.SettlementDate(t)
+}
@@ -2,12 +2,18 @@ package cmd
 
 import (
 	"fmt"
+	"home-broker/assets"
 	"home-broker/assetwallets"
+	"home-broker/calendars"
 	"home-broker/config"
+	"home-broker/core"
 	"home-broker/core/implem/postgresql"
 	"home-broker/orders"
 	"log"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 
@@ -23,9 +29,27 @@ import (
 	assetwalletsginserver "home-broker/assetwallets/implem/gin"
 	assetwalletspostgresql "home-broker/assetwallets/implem/postgresql"
 
+	ordersfake "home-broker/orders/implem/fake"
+	ordersfix "home-broker/orders/implem/fix"
 	ordersginserver "home-broker/orders/implem/gin"
+	ordershttp "home-broker/orders/implem/http"
 	orderspostgresql "home-broker/orders/implem/postgresql"
 
+	assetspostgresql "home-broker/assets/implem/postgresql"
+	calendarsginserver "home-broker/calendars/implem/gin"
+
+	"home-broker/pricebands"
+	pricebandsginserver "home-broker/pricebands/implem/gin"
+	pricebandspostgresql "home-broker/pricebands/implem/postgresql"
+
+	"home-broker/fees"
+	feesginserver "home-broker/fees/implem/gin"
+	feespostgresql "home-broker/fees/implem/postgresql"
+
+	"home-broker/settlements"
+	settlementsginserver "home-broker/settlements/implem/gin"
+	settlementspostgresql "home-broker/settlements/implem/postgresql"
+
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cobra"
 )
@@ -51,11 +75,23 @@ func init() {
 	// is called directly, e.g.:
 	apiCmd.Flags().StringP("orderbook-host", "o", "http://localhost:8081", "The order book host API for a specific asset. (ex: \"http://localhost:8081\"")
 	apiCmd.MarkFlagRequired("orderbook-host")
+	apiCmd.Flags().StringSlice("exchange-client", []string{"B3=fake", "NASDAQ=fake", "NYSE=fake", "VIBR=fake"}, "The client used for each exchange (EXCHANGE_ID=CLIENT). Clients: fake, an HTTP host (ex: VIBR=http://localhost:8082) or a FIX 4.4 acceptor (ex: B3=fix://host:9876?sender=HB&target=B3).")
+	apiCmd.Flags().Duration("outbox-interval", time.Second, "Interval between deliveries of the new orders to the exchange.")
+	apiCmd.Flags().Duration("orderbook-interval", time.Second, "Interval between retries of the updates queued to the order books.")
+	apiCmd.Flags().String("event-bus", "memory", "The event bus of the order events: \"memory\" (inside of the process) or \"postgresql\" (shared by the processes of the database).")
+	apiCmd.Flags().Duration("settlement-interval", time.Minute, "Interval between runs of the job that settles the trades on their settlement date.")
 }
 
 func runAPIServer(cmd *cobra.Command, args []string) {
 	pgConfig := config.NewPostgreSQLConfigFromViper(viper.GetViper())
 	ginConfig := config.NewGinConfigFromViper(viper.GetViper())
+	webhookConfig := config.NewWebhookConfigFromViper(viper.GetViper(), ginConfig.Mode)
+	if err := webhookConfig.CheckExchangeSecret(); err != nil {
+		log.Fatal(err)
+	}
+	if err := webhookConfig.CheckOrderBookSecret(); err != nil {
+		log.Fatal(err)
+	}
 
 	orderBookHost, err := apiCmd.Flags().GetString("orderbook-host")
 	if err != nil {
@@ -65,6 +101,35 @@ func runAPIServer(cmd *cobra.Command, args []string) {
 		log.Fatal("The order book host must have http:// or https://")
 	}
 
+	outboxInterval, err := apiCmd.Flags().GetDuration("outbox-interval")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	orderBookInterval, err := apiCmd.Flags().GetDuration("orderbook-interval")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	settlementInterval, err := apiCmd.Flags().GetDuration("settlement-interval")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	eventBusDriver, err := apiCmd.Flags().GetString("event-bus")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	exchangeClientSpecs, err := apiCmd.Flags().GetStringSlice("exchange-client")
+	if err != nil {
+		log.Fatal(err)
+	}
+	exchangeClients, err := newExchangeClients(exchangeClientSpecs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	mainDB := postgresql.NewDB(pgConfig.Host, pgConfig.Port, pgConfig.User, pgConfig.Password, pgConfig.Name)
 	err = mainDB.Open()
 	if err != nil {
@@ -73,15 +138,62 @@ func runAPIServer(cmd *cobra.Command, args []string) {
 
 	mainDB.GetDB().AutoMigrate()
 
+	eventBus, err := newEventBus(eventBusDriver, mainDB)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	userDB := userspostgresql.NewUserDB(mainDB)
 	walletDB := walletspostgresql.NewWalletDB(mainDB)
 	assetWalletDB := assetwalletspostgresql.NewAssetWalletDB(mainDB)
-	orderDB := orderspostgresql.NewOrderDB(mainDB)
+	orderDB := orderspostgresql.NewOrderDB(mainDB, walletDB, assetWalletDB)
+	priceBandDB := pricebandspostgresql.NewPriceBandDB(mainDB)
+	feeDB := feespostgresql.NewFeeDB(mainDB)
+	settlementDB := settlementspostgresql.NewSettlementDB(mainDB)
+	assetDB := assetspostgresql.NewAssetDB(mainDB)
+
+	exchangeCalendars, err := calendars.DefaultCalendars()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	userUC := users.NewUserUseCases(userDB)
 	walletUC := wallets.NewWalletUseCases(walletDB, userUC)
 	assetWalletUC := assetwallets.NewAssetWalletUseCases(assetWalletDB, userUC)
-	orderUC := orders.NewOrderUseCases(orderDB, walletUC, assetWalletUC, orderBookHost)
+	assetUC := assets.NewAssetUseCases(assetDB)
+	priceBandUC := pricebands.NewPriceBandUseCases(priceBandDB)
+	feeUC := fees.NewFeeUseCases(feeDB, assetUC, userUC)
+	calendarUC := calendars.NewCalendarUseCases(exchangeCalendars)
+	settlementUC := settlements.NewSettlementUseCases(settlementDB, assetUC, calendarUC)
+	orderUC := orders.NewOrderUseCases(orderDB, mainDB, walletUC, assetWalletUC, assetUC, priceBandUC, feeUC, settlementUC, calendarUC, exchangeClients, orderBookHost, core.NewWebhookSigner(webhookConfig.OrderBookSecret), eventBus)
+
+	// Some exchanges send the order updates on the same connection of the orders (ex: FIX).
+	for _, client := range exchangeClients {
+		source, ok := client.(orders.ExchangeUpdateSource)
+		if ok {
+			go orderUC.RunUpdateSource(source, make(chan struct{}))
+		}
+	}
+
+	// The new orders, cancels and order book updates are delivered by the consumers of their events.
+	err = orderUC.SubscribeEvents()
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = eventBus.Subscribe(orders.TopicOrderTrades, "trade-notifications", logOrderTrade)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The orders are saved as "pending" and delivered to the exchange in background.
+	// The dispatcher retries the failed deliveries and the messages whose events were lost.
+	go orderUC.RunOutboxDispatcher(outboxInterval, make(chan struct{}))
+
+	// The updates are queued and forwarded to the order books in background, in order per asset.
+	go orderUC.RunOrderBookForwarder(orderBookInterval, make(chan struct{}))
+
+	// The funds and assets of the trades are pending until their settlement date (ex: T+2).
+	go settlementUC.RunSettlementJob(settlementInterval, make(chan struct{}))
 
 	if ginConfig.Mode == "release" {
 		gin.SetMode(gin.ReleaseMode)
@@ -96,8 +208,102 @@ func runAPIServer(cmd *cobra.Command, args []string) {
 	assetwalletRouter := assetwalletsginserver.NewAssetWalletRouter(assetWalletUC)
 	assetwalletRouter.SetupRouter(router)
 
-	orderRouter := ordersginserver.NewOrderRouter(orderUC)
+	webhookVerifier := core.NewWebhookVerifier(core.NewWebhookSigner(webhookConfig.ExchangeSecret), webhookConfig.Window, core.NewMemoryNonceStore())
+	orderRouter := ordersginserver.NewOrderRouter(orderUC, webhookVerifier)
 	orderRouter.SetupRouter(router)
 
+	priceBandRouter := pricebandsginserver.NewPriceBandRouter(priceBandUC)
+	priceBandRouter.SetupRouter(router)
+
+	feeRouter := feesginserver.NewFeeRouter(feeUC)
+	feeRouter.SetupRouter(router)
+
+	calendarRouter := calendarsginserver.NewCalendarRouter(calendarUC)
+	calendarRouter.SetupRouter(router)
+
+	settlementRouter := settlementsginserver.NewSettlementRouter(settlementUC)
+	settlementRouter.SetupRouter(router)
+
 	router.Run(fmt.Sprintf(":%d", ginConfig.Port))
 }
+
+// newExchangeClients creates the exchange clients from "EXCHANGE_ID=CLIENT" specs.
+func newExchangeClients(specs []string) (orders.ExchangeClients, error) {
+	clients := orders.ExchangeClients{}
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid exchange client %q (expected EXCHANGE_ID=CLIENT)", spec)
+		}
+		exchangeID := assets.ExchangeID(parts[0])
+		switch {
+		case parts[1] == "fake":
+			clients[exchangeID] = ordersfake.NewExchangeClient()
+		case strings.HasPrefix(parts[1], "http"):
+			clients[exchangeID] = ordershttp.NewExchangeClient(parts[1])
+		case strings.HasPrefix(parts[1], "fix://"):
+			client, err := newFIXExchangeClient(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			client.Start()
+			clients[exchangeID] = client
+		default:
+			return nil, fmt.Errorf("unknown exchange client %q for %s", parts[1], exchangeID)
+		}
+	}
+	return clients, nil
+}
+
+// newFIXExchangeClient creates a FIX exchange client from a "fix://HOST:PORT?sender=ID&target=ID&heartbeat=30s&reset=false" URL.
+func newFIXExchangeClient(rawURL string) (*ordersfix.ExchangeClient, error) {
+	fixURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	query := fixURL.Query()
+	config := ordersfix.SessionConfig{
+		Addr:         fixURL.Host,
+		SenderCompID: query.Get("sender"),
+		TargetCompID: query.Get("target"),
+	}
+	if config.Addr == "" || config.SenderCompID == "" || config.TargetCompID == "" {
+		return nil, fmt.Errorf("invalid FIX client %q (expected fix://HOST:PORT?sender=ID&target=ID)", rawURL)
+	}
+	if query.Get("heartbeat") != "" {
+		config.HeartBtInt, err = time.ParseDuration(query.Get("heartbeat"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if query.Get("reset") != "" {
+		config.ResetOnLogon, err = strconv.ParseBool(query.Get("reset"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ordersfix.NewExchangeClient(config, 10*time.Second), nil
+}
+
+// newEventBus creates the event bus of a driver: "memory" or "postgresql".
+func newEventBus(driver string, db postgresql.DB) (core.EventBus, error) {
+	switch driver {
+	case "memory":
+		return core.NewMemoryEventBus(time.Second), nil
+	case "postgresql":
+		return postgresql.NewEventBus(db), nil
+	}
+	return nil, fmt.Errorf("unknown event bus %q (expected memory or postgresql)", driver)
+}
+
+// logOrderTrade logs the trade notifications (see orders.TopicOrderTrades).
+func logOrderTrade(event core.Event) error {
+	trade := orders.OrderTradeEvent{}
+	err := event.Decode(&trade)
+	if err != nil {
+		return err
+	}
+	log.Printf("trade notification: user %v %v %v of %v at %v (order %v %v)\n", trade.UserID, trade.Type,
+		trade.Execution.Amount, trade.AssetID, trade.Execution.Price, trade.OrderID, trade.Status)
+	return nil
+}
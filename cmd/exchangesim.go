@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"home-broker/assets"
+	"home-broker/config"
+	"home-broker/core"
+	coregin "home-broker/core/implem/gin"
+	"home-broker/exchangesim"
+	exchangesimgin "home-broker/exchangesim/implem/gin"
+	"home-broker/money"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// exchangeSimCmd represents the exchange-sim command
+var exchangeSimCmd = &cobra.Command{
+	Use:   "exchange-sim",
+	Short: "Starts a local exchange simulator",
+	Long: `Starts a local exchange to develop against.
+It accepts orders over HTTP, matches them and sends the order book updates to the API webhook.
+Use it on the API with "--exchange-client VIBR=http://localhost:8082".`,
+	Run: startExchangeSim,
+}
+
+func init() {
+	rootCmd.AddCommand(exchangeSimCmd)
+	exchangeSimCmd.Flags().StringSlice("asset", []string{"VIBR"}, "The asset IDs traded on the simulator.")
+	exchangeSimCmd.Flags().String("webhook-host", "http://localhost:8080", "The API host that receives the order updates (ex: \"http://localhost:8080\").")
+	exchangeSimCmd.Flags().Duration("webhook-delay", 200*time.Millisecond, "Latency of the order updates.")
+	exchangeSimCmd.Flags().Int64("mid-price", 100000000, "Initial price of the synthetic orders ($100.00 = 100000000).")
+	exchangeSimCmd.Flags().Duration("flow-interval", time.Second, "Interval between synthetic third-party orders for each asset. Zero disables them.")
+	exchangeSimCmd.Flags().Int64("seed", 0, "Random seed of the synthetic orders. Zero uses the current time.")
+}
+
+func startExchangeSim(cmd *cobra.Command, args []string) {
+	ginConfig := config.NewGinConfigFromViper(viper.GetViper())
+	webhookConfig := config.NewWebhookConfigFromViper(viper.GetViper(), ginConfig.Mode)
+	if err := webhookConfig.CheckExchangeSecret(); err != nil {
+		log.Fatal(err)
+	}
+	assetIDs, err := cmd.Flags().GetStringSlice("asset")
+	if err != nil {
+		log.Fatal(err)
+	}
+	webhookHost, err := cmd.Flags().GetString("webhook-host")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !strings.HasPrefix(webhookHost, "http") {
+		log.Fatal("The webhook host must have http:// or https://")
+	}
+	webhookDelay, err := cmd.Flags().GetDuration("webhook-delay")
+	if err != nil {
+		log.Fatal(err)
+	}
+	midPrice, err := cmd.Flags().GetInt64("mid-price")
+	if err != nil {
+		log.Fatal(err)
+	}
+	flowInterval, err := cmd.Flags().GetDuration("flow-interval")
+	if err != nil {
+		log.Fatal(err)
+	}
+	seed, err := cmd.Flags().GetInt64("seed")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	exchangeAssetIDs := make([]assets.AssetID, 0, len(assetIDs))
+	for _, assetID := range assetIDs {
+		exchangeAssetIDs = append(exchangeAssetIDs, assets.AssetID(assetID))
+	}
+	exchange := exchangesim.NewExchange(exchangeAssetIDs)
+	exchangeSimUC := exchangesim.NewExchangeSimUseCases(exchange, fmt.Sprintf("%s/api/v1/orders/webhook/", webhookHost), core.NewWebhookSigner(webhookConfig.ExchangeSecret))
+
+	stop := make(chan struct{})
+	go exchangeSimUC.RunWebhookSender(webhookDelay, stop)
+	if flowInterval > 0 {
+		for i, assetID := range exchangeAssetIDs {
+			go exchangeSimUC.RunOrderFlow(assetID, money.Money(midPrice), flowInterval, seed+int64(i), stop)
+		}
+	}
+
+	router := gin.Default()
+	router.Use(coregin.MiddlewareAPIError())
+
+	exchangeSimRouter := exchangesimgin.NewExchangeSimRouter(exchangeSimUC)
+	exchangeSimRouter.SetupRouter(router)
+
+	router.Run(fmt.Sprintf(":%d", ginConfig.Port))
+}
@@ -7,7 +7,11 @@ import (
 	"home-broker/core/implem/postgresql"
 
 	assetwalletspostgresql "home-broker/assetwallets/implem/postgresql"
+	feespostgresql "home-broker/fees/implem/postgresql"
 	orderspostgresql "home-broker/orders/implem/postgresql"
+	"home-broker/pricebands"
+	pricebandspostgresql "home-broker/pricebands/implem/postgresql"
+	settlementspostgresql "home-broker/settlements/implem/postgresql"
 	userspostgresql "home-broker/users/implem/postgresql"
 	walletspostgresql "home-broker/wallets/implem/postgresql"
 	"log"
@@ -28,6 +32,12 @@ var migrateCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
+		log.Println("applying EventModel...")
+		mainDB.GetDB().AutoMigrate(&postgresql.EventModel{})
+
+		log.Println("applying EventGroupModel...")
+		mainDB.GetDB().AutoMigrate(&postgresql.EventGroupModel{})
+
 		log.Println("applying AssetModel...")
 		mainDB.GetDB().AutoMigrate(&assetspostgresql.AssetModel{})
 
@@ -40,9 +50,39 @@ var migrateCmd = &cobra.Command{
 		log.Println("applying AssetWalletModel...")
 		mainDB.GetDB().AutoMigrate(&assetwalletspostgresql.AssetWalletModel{})
 
+		log.Println("applying OrderGroupModel...")
+		mainDB.GetDB().AutoMigrate(&orderspostgresql.OrderGroupModel{})
+
 		log.Println("applying OrderModel...")
 		mainDB.GetDB().AutoMigrate(&orderspostgresql.OrderModel{})
 
+		log.Println("applying OutboxMessageModel...")
+		mainDB.GetDB().AutoMigrate(&orderspostgresql.OutboxMessageModel{})
+
+		log.Println("applying OrderBookMessageModel...")
+		mainDB.GetDB().AutoMigrate(&orderspostgresql.OrderBookMessageModel{})
+
+		log.Println("applying ExecutionModel...")
+		mainDB.GetDB().AutoMigrate(&orderspostgresql.ExecutionModel{})
+
+		log.Println("applying OrderStatusChangeModel...")
+		mainDB.GetDB().AutoMigrate(&orderspostgresql.OrderStatusChangeModel{})
+
+		log.Println("applying OrderReplaceModel...")
+		mainDB.GetDB().AutoMigrate(&orderspostgresql.OrderReplaceModel{})
+
+		log.Println("applying PriceBandModel...")
+		mainDB.GetDB().AutoMigrate(&pricebandspostgresql.PriceBandModel{})
+
+		log.Println("applying FeeScheduleModel...")
+		mainDB.GetDB().AutoMigrate(&feespostgresql.FeeScheduleModel{})
+
+		log.Println("applying UserTierModel...")
+		mainDB.GetDB().AutoMigrate(&feespostgresql.UserTierModel{})
+
+		log.Println("applying SettlementModel...")
+		mainDB.GetDB().AutoMigrate(&settlementspostgresql.SettlementModel{})
+
 		log.Println("inserting initial Assets data...")
 		assets := []assets.Asset{
 			assets.Asset{ID: "VIBR", Name: "Vibranium", ExchangeID: "VIBR"},
@@ -65,6 +105,25 @@ var migrateCmd = &cobra.Command{
 			}
 		}
 
+		log.Println("inserting initial PriceBands data...")
+		priceBandDB := pricebandspostgresql.NewPriceBandDB(mainDB)
+		for _, asset := range assets {
+			pb, err := priceBandDB.GetByAssetID(asset.ID)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if pb == nil {
+				log.Printf("\tinserting %s...\n", asset.ID)
+				// 10% around the last trade.
+				_, err = priceBandDB.Upsert(pricebands.NewPriceBand(asset.ID, pricebands.ReferenceTypeLastTrade, 1000))
+				if err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				log.Printf("\t%s already inserted\n", asset.ID)
+			}
+		}
+
 		log.Println("done")
 	},
 }
@@ -3,11 +3,15 @@ package cmd
 import (
 	"fmt"
 	"home-broker/assets"
+	"home-broker/calendars"
 	"home-broker/config"
+	"home-broker/core"
 	coregin "home-broker/core/implem/gin"
+	"home-broker/core/implem/postgresql"
 	"home-broker/orderbooks"
 	orderbooksgin "home-broker/orderbooks/implem/gin"
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cobra"
@@ -25,24 +29,107 @@ var orderbookCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(orderbookCmd)
 	orderbookCmd.Flags().String("asset", "VIBR", "The asset ID this Order Book must handle.")
+	orderbookCmd.Flags().String("exchange", "VIBR", "The exchange ID of the asset. Its calendar switches the order book phases.")
+	orderbookCmd.Flags().Int64("breaker-threshold", 1000, "Price movement (basis points) that halts the matching. Zero disables the circuit breaker.")
+	orderbookCmd.Flags().Duration("breaker-window", 5*time.Minute, "Time window used by the circuit breaker.")
+	orderbookCmd.Flags().Duration("breaker-cooldown", 5*time.Minute, "Time the matching stays halted. Zero waits for an admin resume.")
+	orderbookCmd.Flags().String("event-bus", "memory", "The event bus of the trades: \"memory\" (inside of the process) or \"postgresql\" (shared by the processes of the database).")
 }
 
 func startOrderBook(cmd *cobra.Command, args []string) {
 	ginConfig := config.NewGinConfigFromViper(viper.GetViper())
+	webhookConfig := config.NewWebhookConfigFromViper(viper.GetViper(), ginConfig.Mode)
+	if err := webhookConfig.CheckOrderBookSecret(); err != nil {
+		log.Fatal(err)
+	}
+	adminConfig := config.NewAdminConfigFromViper(viper.GetViper(), ginConfig.Mode)
+	if err := adminConfig.CheckToken(); err != nil {
+		log.Fatal(err)
+	}
 	assetID, err := cmd.Flags().GetString("asset")
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	breakerThreshold, err := cmd.Flags().GetInt64("breaker-threshold")
+	if err != nil {
+		log.Fatal(err)
+	}
+	breakerWindow, err := cmd.Flags().GetDuration("breaker-window")
+	if err != nil {
+		log.Fatal(err)
+	}
+	breakerCooldown, err := cmd.Flags().GetDuration("breaker-cooldown")
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	orderBook := orderbooks.NewOrderBook(assets.AssetID(assetID))
-	orderBookUC := orderbooks.NewOrderBookUseCases(orderBook)
+	if breakerThreshold > 0 {
+		orderBook.CircuitBreaker = orderbooks.NewCircuitBreaker(breakerThreshold, breakerWindow, breakerCooldown)
+	}
+	eventBusDriver, err := cmd.Flags().GetString("event-bus")
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The order book uses the database only to share the events.
+	db := postgresql.DB{}
+	if eventBusDriver == "postgresql" {
+		pgConfig := config.NewPostgreSQLConfigFromViper(viper.GetViper())
+		db = postgresql.NewDB(pgConfig.Host, pgConfig.Port, pgConfig.User, pgConfig.Password, pgConfig.Name)
+		err = db.Open()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	eventBus, err := newEventBus(eventBusDriver, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	orderBookUC := orderbooks.NewOrderBookUseCases(orderBook, eventBus)
+
+	// The trades are not requested to the exchange yet (the exchange sends the "traded" updates by itself).
+	_, err = eventBus.Subscribe(orderbooks.TopicTrades, "trade-requests", logTrade)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	exchangeID, err := cmd.Flags().GetString("exchange")
+	if err != nil {
+		log.Fatal(err)
+	}
+	exchangeCalendars, err := calendars.DefaultCalendars()
+	if err != nil {
+		log.Fatal(err)
+	}
+	calendar, err := calendars.NewCalendarUseCases(exchangeCalendars).GetCalendar(assets.ExchangeID(exchangeID))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if calendar != nil {
+		go orderBookUC.RunSessionScheduler(*calendar, time.Second, make(chan struct{}))
+	} else {
+		log.Printf("No calendar for exchange \"%v\". The order book phase will not change by schedule.", exchangeID)
+	}
 
 	router := gin.Default()
 	router.Use(coregin.MiddlewareAPIError())
 
-	orderBookRouter := orderbooksgin.NewOrderBookRouter(orderBook.AssetID, orderBookUC)
+	webhookVerifier := core.NewWebhookVerifier(core.NewWebhookSigner(webhookConfig.OrderBookSecret), webhookConfig.Window, core.NewMemoryNonceStore())
+	orderBookRouter := orderbooksgin.NewOrderBookRouter(orderBook.AssetID, orderBookUC, webhookVerifier, adminConfig.Token)
 	orderBookRouter.SetupRouter(router)
 
 	log.Printf("\n\n#\n# IMPORTANT: You must execute only one instance of the Order Book for asset \"%v\"\n#\n", assetID)
 	router.Run(fmt.Sprintf(":%d", ginConfig.Port))
 }
+
+// logTrade logs the matches of the order book (see orderbooks.TopicTrades).
+func logTrade(event core.Event) error {
+	trade := orderbooks.TradeEvent{}
+	err := event.Decode(&trade)
+	if err != nil {
+		return err
+	}
+	log.Printf("trade request: buy %v - sell %v - %vqty (auction %v)\n", trade.BuyOrder.ID, trade.SellOrder.ID, trade.Amount, trade.Auction)
+	return nil
+}
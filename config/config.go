@@ -2,6 +2,9 @@
 package config
 
 import (
+	"errors"
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -67,3 +70,77 @@ func NewGinConfigFromViper(v *viper.Viper) GinConfig {
 	}
 	return c
 }
+
+// webhookDebugSecret is the secret of the webhooks not configured in the debug mode (see GinConfig).
+const webhookDebugSecret = "123456"
+
+// WebhookConfig holds the configurations of the signed webhooks.
+// Each hop has its own secret, so the exchange cannot sign the updates of the order books.
+type WebhookConfig struct {
+	ExchangeSecret  string        // Exchange → API. Shared by the exchange and the API.
+	OrderBookSecret string        // API → order book. Shared by the API and the order books.
+	Window          time.Duration // Accepted difference between the webhook timestamp and the current time.
+}
+
+// NewWebhookConfigFromViper creates a new WebhookConfig from viper.
+// The secrets not set get a development value in the "debug" mode, otherwise they stay empty (see CheckExchangeSecret).
+func NewWebhookConfigFromViper(v *viper.Viper, mode string) WebhookConfig {
+	c := WebhookConfig{
+		ExchangeSecret:  viper.GetString("EXCHANGEWEBHOOKSECRET"),
+		OrderBookSecret: viper.GetString("ORDERBOOKWEBHOOKSECRET"),
+		Window:          viper.GetDuration("WEBHOOKWINDOW"),
+	}
+	if mode == "debug" {
+		if c.ExchangeSecret == "" {
+			c.ExchangeSecret = webhookDebugSecret
+		}
+		if c.OrderBookSecret == "" {
+			c.OrderBookSecret = webhookDebugSecret
+		}
+	}
+	if c.Window <= 0 {
+		c.Window = 5 * time.Minute
+	}
+	return c
+}
+
+// CheckExchangeSecret returns an error if the secret of the exchange webhooks is not set.
+func (c WebhookConfig) CheckExchangeSecret() error {
+	if c.ExchangeSecret == "" {
+		return errors.New("the environment variable EXCHANGEWEBHOOKSECRET must be set")
+	}
+	return nil
+}
+
+// CheckOrderBookSecret returns an error if the secret of the order book webhooks is not set.
+func (c WebhookConfig) CheckOrderBookSecret() error {
+	if c.OrderBookSecret == "" {
+		return errors.New("the environment variable ORDERBOOKWEBHOOKSECRET must be set")
+	}
+	return nil
+}
+
+// AdminConfig holds the configurations of the admin commands of the order books (ex: halt and resume).
+type AdminConfig struct {
+	Token string // Bearer token of the admin requests.
+}
+
+// NewAdminConfigFromViper creates a new AdminConfig from viper.
+// The token gets a development value in the "debug" mode if it is not set, otherwise it stays empty (see CheckToken).
+func NewAdminConfigFromViper(v *viper.Viper, mode string) AdminConfig {
+	c := AdminConfig{
+		Token: viper.GetString("ORDERBOOKADMINTOKEN"),
+	}
+	if mode == "debug" && c.Token == "" {
+		c.Token = webhookDebugSecret
+	}
+	return c
+}
+
+// CheckToken returns an error if the token of the admin commands is not set.
+func (c AdminConfig) CheckToken() error {
+	if c.Token == "" {
+		return errors.New("the environment variable ORDERBOOKADMINTOKEN must be set")
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitBreaker stops the calls to a remote service after many failures in a row.
+// While open the calls are refused. After the cooldown one call is allowed (half-open):
+// a success closes the breaker and a failure opens it again.
+type CircuitBreaker struct {
+	mu        *sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+// NewCircuitBreaker creates a new CircuitBreaker that opens after "threshold" failures in a row, for "cooldown".
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{mu: &sync.Mutex{}, threshold: threshold, cooldown: cooldown}
+}
+
+// Allow returns false if the breaker is open at "now".
+func (b *CircuitBreaker) Allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !now.Before(b.openUntil)
+}
+
+// Success records a successful call. The breaker closes.
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+// Failure records a failed call at "now". The breaker opens when the failures in a row reach the threshold
+// (or on the failure of the half-open call).
+func (b *CircuitBreaker) Failure(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
@@ -0,0 +1,43 @@
+package core_test
+
+import (
+	"home-broker/core"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := core.NewCircuitBreaker(3, time.Minute)
+
+	breaker.Failure(now)
+	breaker.Failure(now)
+	if !breaker.Allow(now) {
+		t.Errorf("the breaker must be closed before the threshold")
+	}
+	breaker.Success()
+	breaker.Failure(now)
+	breaker.Failure(now)
+	if !breaker.Allow(now) {
+		t.Errorf("a success must reset the failures")
+	}
+
+	breaker.Failure(now)
+	if breaker.Allow(now.Add(time.Second)) {
+		t.Errorf("the breaker must be open on the threshold")
+	}
+	if !breaker.Allow(now.Add(time.Minute)) {
+		t.Errorf("the breaker must be half-open after the cooldown")
+	}
+
+	// A failure of the half-open call opens the breaker again.
+	halfOpen := now.Add(time.Minute)
+	breaker.Failure(halfOpen)
+	if breaker.Allow(halfOpen.Add(time.Second)) {
+		t.Errorf("the breaker must open again on a half-open failure")
+	}
+	breaker.Success()
+	if !breaker.Allow(halfOpen.Add(time.Second)) {
+		t.Errorf("the breaker must close on a success")
+	}
+}
@@ -12,3 +12,16 @@ type DBInterface interface {
 	// GetDB must returns a pointer to a database connection. It is ORM specific.
 	GetDB() *interface{}
 }
+
+// Tx is a database transaction started by a UnitOfWork. It is ORM specific.
+type Tx interface{}
+
+// UnitOfWork is an interface that runs database commands of many packages in the same transaction.
+// The DB interfaces join the transaction with their WithTx method.
+type UnitOfWork interface {
+
+	// Do must run "fn" inside a transaction.
+	// The transaction must be committed if "fn" returns nil, otherwise it must be rolled back.
+	// The error returned by "fn" is returned as it is.
+	Do(fn func(tx Tx) error) error
+}
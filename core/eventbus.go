@@ -0,0 +1,235 @@
+package core
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// EventID represents the Event ID type.
+type EventID int64
+
+// Event is a message published on a topic of an EventBus.
+type Event struct {
+	ID        EventID         `json:"id"`
+	Topic     string          `json:"topic"`
+	Key       string          `json:"key"` // Ex: the asset ID of an order event.
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewEvent creates a new Event with the JSON of a payload.
+func NewEvent(topic string, key string, payload interface{}) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Topic: topic, Key: key, Payload: data, CreatedAt: time.Now()}, nil
+}
+
+// Decode reads the payload of the event into "v".
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// EventHandler handles an event of a subscription.
+// An error means that the event was not handled and it must be delivered again.
+type EventHandler func(event Event) error
+
+// Subscription is a consumer of an EventBus.
+type Subscription interface {
+	// Close must stop the delivery of the events to the consumer.
+	Close()
+}
+
+// EventBus delivers the events published on a topic to its consumer groups.
+// Each group receives once all the events published after the group was created (at least once, the handlers
+// must be idempotent). The consumers of the same group share its events: each event is handled by one of them.
+// The events of a group are handled in the order they were published. A failed event is delivered again
+// after a delay and the next events of the group wait for it.
+type EventBus interface {
+	// Publish must publish an event with the JSON of "payload" on a topic.
+	Publish(topic string, key string, payload interface{}) error
+
+	// Subscribe must add a consumer to a group of a topic. The group is created if it does not exist.
+	Subscribe(topic string, group string, handler EventHandler) (Subscription, error)
+}
+
+// SubscriptionFunc is a Subscription closed by a function.
+type SubscriptionFunc func()
+
+// Close stops the subscription.
+func (f SubscriptionFunc) Close() {
+	f()
+}
+
+// MemoryEventBus is an EventBus that keeps the events in memory.
+// It works only inside of a process: the events not handled yet are lost on a restart,
+// and a group is removed (with its events) when its last consumer is closed.
+type MemoryEventBus struct {
+	mu         *sync.Mutex
+	lastID     EventID
+	groups     map[string]map[string]*memoryEventGroup // by topic and group
+	retryDelay time.Duration
+}
+
+// NewMemoryEventBus creates a new MemoryEventBus that delivers a failed event again after "retryDelay".
+func NewMemoryEventBus(retryDelay time.Duration) *MemoryEventBus {
+	return &MemoryEventBus{
+		mu:         &sync.Mutex{},
+		groups:     map[string]map[string]*memoryEventGroup{},
+		retryDelay: retryDelay,
+	}
+}
+
+// Publish publishes an event on a topic.
+func (bus *MemoryEventBus) Publish(topic string, key string, payload interface{}) error {
+	event, err := NewEvent(topic, key, payload)
+	if err != nil {
+		return err
+	}
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.lastID++
+	event.ID = bus.lastID
+	for _, group := range bus.groups[topic] {
+		group.push(event)
+	}
+	return nil
+}
+
+// Subscribe adds a consumer to a group of a topic.
+func (bus *MemoryEventBus) Subscribe(topic string, group string, handler EventHandler) (Subscription, error) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if bus.groups[topic] == nil {
+		bus.groups[topic] = map[string]*memoryEventGroup{}
+	}
+	g, ok := bus.groups[topic][group]
+	if !ok {
+		g = newMemoryEventGroup(topic, group)
+		bus.groups[topic][group] = g
+		go g.run(bus.retryDelay)
+	}
+	consumer := &handler
+	g.add(consumer)
+	return SubscriptionFunc(func() {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		if g.remove(consumer) && bus.groups[topic][group] == g {
+			delete(bus.groups[topic], group)
+		}
+	}), nil
+}
+
+// memoryEventGroup holds the events of a group of a MemoryEventBus not handled yet.
+type memoryEventGroup struct {
+	mu        *sync.Mutex
+	topic     string
+	name      string
+	events    []Event
+	consumers []*EventHandler
+	turn      int
+	signal    chan struct{}
+	stop      chan struct{}
+}
+
+// newMemoryEventGroup creates a new memoryEventGroup.
+func newMemoryEventGroup(topic string, name string) *memoryEventGroup {
+	return &memoryEventGroup{
+		mu:     &sync.Mutex{},
+		topic:  topic,
+		name:   name,
+		signal: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+}
+
+// push adds an event to the group and wakes up its delivery.
+func (g *memoryEventGroup) push(event Event) {
+	g.mu.Lock()
+	g.events = append(g.events, event)
+	g.mu.Unlock()
+	g.wakeUp()
+}
+
+// wakeUp wakes up the delivery of the group.
+func (g *memoryEventGroup) wakeUp() {
+	select {
+	case g.signal <- struct{}{}:
+	default:
+		// The delivery was already woken up.
+	}
+}
+
+// add adds a consumer to the group.
+func (g *memoryEventGroup) add(consumer *EventHandler) {
+	g.mu.Lock()
+	g.consumers = append(g.consumers, consumer)
+	g.mu.Unlock()
+	g.wakeUp()
+}
+
+// remove removes a consumer from the group.
+// It returns true if it was the last consumer: the group is stopped.
+func (g *memoryEventGroup) remove(consumer *EventHandler) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, c := range g.consumers {
+		if c == consumer {
+			g.consumers = append(g.consumers[:i], g.consumers[i+1:]...)
+			if len(g.consumers) == 0 {
+				close(g.stop)
+				return true
+			}
+			break
+		}
+	}
+	return false
+}
+
+// next returns the oldest event of the group and the consumer of its turn.
+// It returns false if there are no events or consumers.
+func (g *memoryEventGroup) next() (Event, EventHandler, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.events) == 0 || len(g.consumers) == 0 {
+		return Event{}, nil, false
+	}
+	g.turn = (g.turn + 1) % len(g.consumers)
+	return g.events[0], *g.consumers[g.turn], true
+}
+
+// done removes the oldest event of the group (handled).
+func (g *memoryEventGroup) done() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.events = g.events[1:]
+}
+
+// run delivers the events of the group, in order, until the group is stopped.
+func (g *memoryEventGroup) run(retryDelay time.Duration) {
+	for {
+		event, handler, ok := g.next()
+		if !ok {
+			select {
+			case <-g.stop:
+				return
+			case <-g.signal:
+			}
+			continue
+		}
+		err := handler(event)
+		if err != nil {
+			log.Printf("error to handle the event %v of %v (group %v): %v\n", event.ID, g.topic, g.name, err)
+			select {
+			case <-g.stop:
+				return
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+		g.done()
+	}
+}
@@ -0,0 +1,144 @@
+package core_test
+
+import (
+	"errors"
+	"home-broker/core"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventRecorder records the events handled by the consumers of a test.
+type eventRecorder struct {
+	mu     *sync.Mutex
+	events []string
+	done   chan struct{}
+}
+
+func newEventRecorder() *eventRecorder {
+	return &eventRecorder{mu: &sync.Mutex{}, done: make(chan struct{}, 100)}
+}
+
+func (r *eventRecorder) handler(name string) core.EventHandler {
+	return func(event core.Event) error {
+		payload := ""
+		err := event.Decode(&payload)
+		if err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.events = append(r.events, name+":"+payload)
+		r.mu.Unlock()
+		r.done <- struct{}{}
+		return nil
+	}
+}
+
+func (r *eventRecorder) wait(t *testing.T, count int) []string {
+	for i := 0; i < count; i++ {
+		select {
+		case <-r.done:
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for %d events", count)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.events...)
+}
+
+func TestMemoryEventBusGroups(t *testing.T) {
+	bus := core.NewMemoryEventBus(time.Millisecond)
+	recorder := newEventRecorder()
+	// The group "a" has two consumers and the group "b" has one.
+	_, err := bus.Subscribe("trades", "a", recorder.handler("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bus.Subscribe("trades", "a", recorder.handler("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subB, err := bus.Subscribe("trades", "b", recorder.handler("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subB.Close()
+
+	for _, payload := range []string{"1", "2", "3"} {
+		err = bus.Publish("trades", "VIBR", payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = bus.Publish("other", "VIBR", "4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := recorder.wait(t, 6)
+	got := map[string][]string{}
+	for _, event := range events {
+		got[event[:1]] = append(got[event[:1]], event[2:])
+	}
+	for _, group := range []string{"a", "b"} {
+		if len(got[group]) != 3 || got[group][0] != "1" || got[group][1] != "2" || got[group][2] != "3" {
+			t.Errorf("events of the group %v are %v, expected [1 2 3]", group, got[group])
+		}
+	}
+}
+
+func TestMemoryEventBusRetry(t *testing.T) {
+	bus := core.NewMemoryEventBus(time.Millisecond)
+	recorder := newEventRecorder()
+	handler := recorder.handler("a")
+	failures := 2
+	sub, err := bus.Subscribe("trades", "a", func(event core.Event) error {
+		if string(event.Payload) == `"1"` && failures > 0 {
+			failures--
+			return errors.New("failed")
+		}
+		return handler(event)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	bus.Publish("trades", "VIBR", "1")
+	bus.Publish("trades", "VIBR", "2")
+
+	// The failed event is retried and the next one waits for it.
+	events := recorder.wait(t, 2)
+	if len(events) != 2 || events[0] != "a:1" || events[1] != "a:2" {
+		t.Errorf("events are %v, expected [a:1 a:2]", events)
+	}
+	if failures != 0 {
+		t.Errorf("failures left are %d, expected 0", failures)
+	}
+}
+
+func TestMemoryEventBusClose(t *testing.T) {
+	bus := core.NewMemoryEventBus(time.Millisecond)
+	recorder := newEventRecorder()
+	sub, err := bus.Subscribe("trades", "a", recorder.handler("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish("trades", "VIBR", "1")
+	recorder.wait(t, 1)
+	sub.Close()
+
+	// The events published without consumers are not delivered to a new group.
+	bus.Publish("trades", "VIBR", "2")
+	sub, err = bus.Subscribe("trades", "a", recorder.handler("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	bus.Publish("trades", "VIBR", "3")
+	events := recorder.wait(t, 1)
+	if len(events) != 2 || events[1] != "a:3" {
+		t.Errorf("events are %v, expected [a:1 a:3]", events)
+	}
+}
@@ -1,7 +1,12 @@
 package coregin
 
 import (
+	"bytes"
+	"crypto/subtle"
 	"home-broker/core"
+	"io/ioutil"
+	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,3 +28,47 @@ func MiddlewareAPIError() gin.HandlerFunc {
 		c.Abort()
 	}
 }
+
+// MiddlewareWebhookSignature rejects the webhooks without a valid signature, timestamp and nonce
+// (see core.WebhookVerifier). The body is kept to be read by the handlers.
+func MiddlewareWebhookSignature(verifier core.WebhookVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Error(core.NewAPIError("Invalid body.", 400))
+			c.Abort()
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+		err = verifier.Verify(
+			c.GetHeader(core.WebhookSignatureHeader),
+			c.GetHeader(core.WebhookTimestampHeader),
+			c.GetHeader(core.WebhookNonceHeader),
+			body,
+			time.Now(),
+		)
+		if err != nil {
+			log.Printf("webhook rejected from %s: %v\n", c.ClientIP(), err)
+			c.Error(core.NewAPIError("Invalid webhook signature.", 401))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// MiddlewareAdminToken rejects the admin requests without the "Authorization: Bearer <token>" header.
+// Every request is rejected if the token is empty.
+func MiddlewareAdminToken(token string) gin.HandlerFunc {
+	expected := []byte("Bearer " + token)
+	return func(c *gin.Context) {
+		received := []byte(c.GetHeader("Authorization"))
+		if token == "" || subtle.ConstantTimeCompare(received, expected) != 1 {
+			log.Printf("admin request rejected from %s\n", c.ClientIP())
+			c.Error(core.NewAPIError("Invalid admin token.", 401))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,380 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"home-broker/core"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// eventChannel is the LISTEN/NOTIFY channel of the new events. The payload of a notification is the topic.
+	eventChannel = "events"
+
+	// eventBatchSize is the number of events of a group read on each query.
+	eventBatchSize = 100
+
+	// eventPollInterval is the interval between reads of the groups without notifications
+	// (ex: the events of a failed handler or of a lost notification).
+	eventPollInterval = 5 * time.Second
+
+	// eventLease is how long a group is hidden from the consumers of other processes while its events are handled.
+	eventLease = 30 * time.Second
+
+	// eventRetryDelay is the wait before a failed event is delivered again.
+	eventRetryDelay = time.Second
+
+	// eventPruneInterval is the interval between deletions of the old events.
+	eventPruneInterval = time.Hour
+
+	// eventRetention is how long an event handled by all the groups of its topic is kept.
+	eventRetention = 24 * time.Hour
+)
+
+// EventModel is the ORM version of core.Event.
+type EventModel struct {
+	gorm.Model
+	ID        core.EventID   `gorm:"primaryKey;autoIncrement:true"`
+	Topic     string         `gorm:"not null;index"`
+	Key       string         `gorm:"not null"`
+	Payload   string         `gorm:"type:text;not null"`
+	TxID      int64          `gorm:"not null;default:0;index"` // The transaction that published the event (txid_current).
+	CreatedAt time.Time      `gorm:"not null;index:,sort:desc"`
+	UpdatedAt time.Time      `gorm:"not null;index:,sort:desc"`
+	DeletedAt gorm.DeletedAt `gorm:"index:,sort:desc"`
+}
+
+// TableName returns the real table name of Event.
+// It is used by GORM to perfom operations on event table (queries, migrations, etc.).
+func (EventModel) TableName() string {
+	return "event"
+}
+
+// EventGroupModel is the position of a consumer group on a topic.
+type EventGroupModel struct {
+	gorm.Model
+	ID          int64          `gorm:"primaryKey;autoIncrement:true"`
+	Topic       string         `gorm:"not null;uniqueIndex:idx_eventgroup_topicname"`
+	Name        string         `gorm:"not null;uniqueIndex:idx_eventgroup_topicname"`
+	LastTxID    int64          `gorm:"not null;default:0"` // The transaction of the last handled event.
+	LastEventID core.EventID   `gorm:"not null"`           // The last handled event.
+	LockedUntil time.Time      `gorm:"not null"`
+	CreatedAt   time.Time      `gorm:"not null;index:,sort:desc"`
+	UpdatedAt   time.Time      `gorm:"not null;index:,sort:desc"`
+	DeletedAt   gorm.DeletedAt `gorm:"index:,sort:desc"`
+}
+
+// TableName returns the real table name of the event groups.
+// It is used by GORM to perfom operations on event group table (queries, migrations, etc.).
+func (EventGroupModel) TableName() string {
+	return "eventgroup"
+}
+
+// EventBus is a core.EventBus that saves the events on the event table.
+// The consumers are woken up by LISTEN/NOTIFY, so the groups can be shared by many processes.
+// A new group starts after the last event of its topic.
+//
+// The IDs of the events are not committed in order (a transaction can commit the ID 10 before the ID 9),
+// so the position of a group is the transaction of its last event and its ID. An event is delivered only after
+// all the transactions that started before it are finished (txid_snapshot_xmin): the events committed later
+// always come after the position. A long transaction on the database delays the delivery until it ends.
+type EventBus struct {
+	db      DB
+	mu      *sync.Mutex
+	listen  *sync.Once
+	signals map[string]map[chan struct{}]bool // by topic
+}
+
+// NewEventBus creates a new EventBus.
+func NewEventBus(db DB) *EventBus {
+	return &EventBus{
+		db:      db,
+		mu:      &sync.Mutex{},
+		listen:  &sync.Once{},
+		signals: map[string]map[chan struct{}]bool{},
+	}
+}
+
+// ToEntity returns an Event entity from the ORM model.
+func (EventBus) ToEntity(model EventModel) core.Event {
+	return core.Event{
+		ID:        model.ID,
+		Topic:     model.Topic,
+		Key:       model.Key,
+		Payload:   []byte(model.Payload),
+		CreatedAt: model.CreatedAt,
+	}
+}
+
+// ToModel returns a GORM model from an event entity.
+func (EventBus) ToModel(entity core.Event) EventModel {
+	return EventModel{
+		ID:        entity.ID,
+		Topic:     entity.Topic,
+		Key:       entity.Key,
+		Payload:   string(entity.Payload),
+		CreatedAt: entity.CreatedAt,
+	}
+}
+
+// Publish saves an event on a topic and notifies its consumers.
+// The notification is sent when the event is committed.
+func (bus *EventBus) Publish(topic string, key string, payload interface{}) error {
+	event, err := core.NewEvent(topic, key, payload)
+	if err != nil {
+		return err
+	}
+	model := bus.ToModel(event)
+	return bus.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		err := tx.Raw("SELECT txid_current()").Row().Scan(&model.TxID)
+		if err != nil {
+			return err
+		}
+		res := tx.Create(&model)
+		if res.Error != nil {
+			return res.Error
+		}
+		return tx.Exec("SELECT pg_notify(?, ?)", eventChannel, topic).Error
+	})
+}
+
+// Subscribe adds a consumer to a group of a topic.
+// The consumer runs in background until the subscription is closed.
+func (bus *EventBus) Subscribe(topic string, group string, handler core.EventHandler) (core.Subscription, error) {
+	err := bus.createGroup(topic, group)
+	if err != nil {
+		return nil, err
+	}
+	bus.listen.Do(func() {
+		go bus.runListener()
+		go bus.runPruner()
+	})
+
+	signal := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	bus.mu.Lock()
+	if bus.signals[topic] == nil {
+		bus.signals[topic] = map[chan struct{}]bool{}
+	}
+	bus.signals[topic][signal] = true
+	bus.mu.Unlock()
+
+	go bus.runConsumer(topic, group, handler, signal, stop)
+	return core.SubscriptionFunc(func() {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		if bus.signals[topic][signal] {
+			delete(bus.signals[topic], signal)
+			close(stop)
+		}
+	}), nil
+}
+
+// eventPosition is the position of a group: the transaction and the ID of its last handled event.
+type eventPosition struct {
+	TxID int64
+	ID   core.EventID
+}
+
+// createGroup creates a group of a topic after its last event, if the group does not exist.
+func (bus *EventBus) createGroup(topic string, group string) error {
+	return bus.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		last := eventPosition{}
+		res := tx.Model(&EventModel{}).
+			Select(`"tx_id","id"`).
+			Where(`"topic"=?`, topic).
+			Order(`"tx_id" DESC,"id" DESC`).
+			Limit(1).
+			Scan(&last)
+		if res.Error != nil {
+			return res.Error
+		}
+		model := EventGroupModel{Topic: topic, Name: group, LastTxID: last.TxID, LastEventID: last.ID}
+		return tx.
+			Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "topic"}, {Name: "name"}},
+				DoNothing: true,
+			}).
+			Create(&model).Error
+	})
+}
+
+// notify wakes up the consumers of a topic.
+func (bus *EventBus) notify(topic string) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	for signal := range bus.signals[topic] {
+		select {
+		case signal <- struct{}{}:
+		default:
+			// The consumer was already woken up.
+		}
+	}
+}
+
+// runListener listens to the notifications of the new events, reconnecting on errors.
+func (bus *EventBus) runListener() {
+	for {
+		err := bus.listenNotifications()
+		log.Printf("error to listen to the event notifications: %v\n", err)
+		time.Sleep(eventRetryDelay)
+	}
+}
+
+// listenNotifications wakes up the consumers of the topics notified on a dedicated connection.
+// It returns when the connection fails.
+func (bus *EventBus) listenNotifications() error {
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, bus.db.DSN())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+	_, err = conn.Exec(ctx, "LISTEN "+eventChannel)
+	if err != nil {
+		return err
+	}
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		bus.notify(notification.Payload)
+	}
+}
+
+// runConsumer handles the events of a group when notified, or on every eventPollInterval, until "stop" is closed.
+func (bus *EventBus) runConsumer(topic string, group string, handler core.EventHandler, signal <-chan struct{}, stop <-chan struct{}) {
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+	for {
+		err := bus.HandleEvents(topic, group, handler)
+		if err != nil {
+			log.Printf("error to handle the events of %v (group %v): %v\n", topic, group, err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-signal:
+		}
+	}
+}
+
+// HandleEvents delivers the events of a group not handled yet to "handler", in order.
+// Nothing is done if the group is claimed by another consumer or waiting for a retry.
+// A failed event stops the delivery and it is delivered again after eventRetryDelay.
+// The events of the transactions not finished yet are delivered on a later call (see EventBus).
+func (bus *EventBus) HandleEvents(topic string, group string, handler core.EventHandler) error {
+	last, claimed, err := bus.claimGroup(topic, group, time.Now())
+	if err != nil || !claimed {
+		return err
+	}
+	for {
+		models := []EventModel{}
+		res := bus.db.GetDB().
+			Where(`"topic"=? AND ("tx_id","id")>(?,?) AND "tx_id"<txid_snapshot_xmin(txid_current_snapshot())`, topic, last.TxID, last.ID).
+			Order(`"tx_id","id"`).
+			Limit(eventBatchSize).
+			Find(&models)
+		if res.Error != nil {
+			return bus.releaseGroup(topic, group, last, time.Now().Add(eventRetryDelay), res.Error)
+		}
+		for _, model := range models {
+			err = handler(bus.ToEntity(model))
+			if err != nil {
+				return bus.releaseGroup(topic, group, last, time.Now().Add(eventRetryDelay), err)
+			}
+			last = eventPosition{TxID: model.TxID, ID: model.ID}
+			// The lease is renewed after each event.
+			err = bus.releaseGroup(topic, group, last, time.Now().Add(eventLease), nil)
+			if err != nil {
+				return err
+			}
+		}
+		if len(models) < eventBatchSize {
+			return bus.releaseGroup(topic, group, last, time.Time{}, nil)
+		}
+	}
+}
+
+// claimGroup reserves a group for eventLease if it is free at "now".
+// It returns the position of the group.
+func (bus *EventBus) claimGroup(topic string, group string, now time.Time) (eventPosition, bool, error) {
+	model := EventGroupModel{}
+	claimed := false
+	err := bus.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		res := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(`"topic"=? AND "name"=?`, topic, group).
+			Take(&model)
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if res.Error != nil {
+			return res.Error
+		}
+		if model.LockedUntil.After(now) {
+			return nil
+		}
+		res = tx.Model(&model).Updates(map[string]interface{}{
+			"locked_until": now.Add(eventLease),
+			"updated_at":   now,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		claimed = true
+		return nil
+	})
+	if err != nil {
+		return eventPosition{}, false, err
+	}
+	return eventPosition{TxID: model.LastTxID, ID: model.LastEventID}, claimed, nil
+}
+
+// releaseGroup saves the position of a group and reserves it until "until" (zero frees the group).
+// It returns "cause" (the error that stopped the delivery), if any.
+func (bus *EventBus) releaseGroup(topic string, group string, last eventPosition, until time.Time, cause error) error {
+	res := bus.db.GetDB().
+		Model(&EventGroupModel{}).
+		Where(`"topic"=? AND "name"=?`, topic, group).
+		Updates(map[string]interface{}{
+			"last_tx_id":    last.TxID,
+			"last_event_id": last.ID,
+			"locked_until":  until,
+			"updated_at":    time.Now(),
+		})
+	if cause != nil {
+		return cause
+	}
+	return res.Error
+}
+
+// runPruner deletes the old events on every eventPruneInterval.
+func (bus *EventBus) runPruner() {
+	ticker := time.NewTicker(eventPruneInterval)
+	defer ticker.Stop()
+	for {
+		_, err := bus.PruneEvents(time.Now().Add(-eventRetention))
+		if err != nil {
+			log.Printf("error to delete the old events: %v\n", err)
+		}
+		<-ticker.C
+	}
+}
+
+// PruneEvents deletes the events created before "before" that were handled by all the groups of their topic.
+// It returns the number of deleted events.
+func (bus *EventBus) PruneEvents(before time.Time) (int64, error) {
+	res := bus.db.GetDB().Exec(`DELETE FROM "event" WHERE "created_at"<? AND NOT EXISTS (`+
+		`SELECT 1 FROM "eventgroup" WHERE "eventgroup"."topic"="event"."topic" AND `+
+		`("event"."tx_id","event"."id")>("eventgroup"."last_tx_id","eventgroup"."last_event_id"))`, before)
+	return res.RowsAffected, res.Error
+}
@@ -32,11 +32,15 @@ func NewDB(host string, port int, user string, password string, dbName string) D
 	}
 }
 
+// DSN returns the connection string of the database.
+func (db DB) DSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		db.Host, db.Port, db.User, db.Password, db.DBName, db.SSLMode)
+}
+
 // Open connects to the database.
 func (db *DB) Open() error {
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		db.Host, db.Port, db.User, db.Password, db.DBName, db.SSLMode)
-	gormDB, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	gormDB, err := gorm.Open(postgres.Open(db.DSN()), &gorm.Config{})
 	db.SetDB(gormDB)
 	return err
 }
@@ -50,3 +54,17 @@ func (db *DB) SetDB(gormDB *gorm.DB) {
 func (db DB) GetDB() *gorm.DB {
 	return db.gormDB
 }
+
+// Do runs "fn" inside a transaction (see core.UnitOfWork).
+// If the DB is already inside a transaction (see WithTx), a savepoint is used instead.
+func (db DB) Do(fn func(tx core.Tx) error) error {
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		return fn(tx)
+	})
+}
+
+// WithTx returns a copy of the DB that runs its commands inside a transaction started by Do.
+func (db DB) WithTx(tx core.Tx) DB {
+	db.SetDB(tx.(*gorm.DB))
+	return db
+}
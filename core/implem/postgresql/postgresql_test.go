@@ -1,10 +1,14 @@
 package postgresql_test
 
 import (
+	"home-broker/core"
 	"home-broker/core/implem/postgresql"
 	postgresqltests "home-broker/tests/postgresql"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
 )
 
 func TestNewDB(t *testing.T) {
@@ -14,3 +18,114 @@ func TestNewDB(t *testing.T) {
 		t.Errorf("received %v, expected %v", db, &expected)
 	}
 }
+
+func TestEventBusPublish(t *testing.T) {
+	db, mock, err := postgresqltests.GetMockedDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := postgresql.NewEventBus(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT txid_current\(\)`).
+		WillReturnRows(mock.NewRows([]string{"txid_current"}).AddRow(500))
+	mock.ExpectQuery(`INSERT INTO "event" \("created_at","updated_at","deleted_at","topic","key","payload","tx_id"\) VALUES \(\$1,\$2,\$3,\$4,\$5,\$6,\$7\) RETURNING "id"`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "orderbooks.trades", "VIBR", `{"amount":100}`, 500).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(`SELECT pg_notify\(\$1, \$2\)`).
+		WithArgs("events", "orderbooks.trades").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err = bus.Publish("orderbooks.trades", "VIBR", map[string]int{"amount": 100})
+	if err != nil {
+		t.Error(err)
+	}
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEventBusHandleEvents(t *testing.T) {
+	db, mock, err := postgresqltests.GetMockedDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := postgresql.NewEventBus(db)
+	now := time.Now()
+	groupColumns := []string{"id", "topic", "name", "last_tx_id", "last_event_id", "locked_until", "created_at", "updated_at", "deleted_at"}
+	eventColumns := []string{"id", "topic", "key", "payload", "tx_id", "created_at", "updated_at", "deleted_at"}
+
+	// The group is claimed, the events after the last handled one are delivered and the group is released.
+	// The event 11 was committed after the event 12 (by an older transaction), so the events are read by transaction.
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "eventgroup" WHERE \("topic"=\$1 AND "name"=\$2\) AND "eventgroup"\."deleted_at" IS NULL LIMIT 1 FOR UPDATE`).
+		WithArgs("orders.trades", "notifications").
+		WillReturnRows(mock.NewRows(groupColumns).AddRow(1, "orders.trades", "notifications", 500, 10, time.Time{}, now, now, nil))
+	mock.ExpectExec(`UPDATE "eventgroup" SET "locked_until"=\$1,"updated_at"=\$2 WHERE "id" = \$3`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT \* FROM "event" WHERE \("topic"=\$1 AND \("tx_id","id"\)>\(\$2,\$3\) AND "tx_id"<txid_snapshot_xmin\(txid_current_snapshot\(\)\)\) AND "event"\."deleted_at" IS NULL ORDER BY "tx_id","id" LIMIT 100`).
+		WithArgs("orders.trades", 500, 10).
+		WillReturnRows(mock.NewRows(eventColumns).
+			AddRow(12, "orders.trades", "VIBR", `"first"`, 501, now, now, nil).
+			AddRow(11, "orders.trades", "VIBR", `"second"`, 502, now, now, nil))
+	for _, position := range [][2]int{{12, 501}, {11, 502}} {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "eventgroup" SET "last_event_id"=\$1,"last_tx_id"=\$2,"locked_until"=\$3,"updated_at"=\$4 WHERE "topic"=\$5 AND "name"=\$6`).
+			WithArgs(position[0], position[1], sqlmock.AnyArg(), sqlmock.AnyArg(), "orders.trades", "notifications").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "eventgroup" SET "last_event_id"=\$1,"last_tx_id"=\$2,"locked_until"=\$3,"updated_at"=\$4 WHERE "topic"=\$5 AND "name"=\$6`).
+		WithArgs(11, 502, time.Time{}, sqlmock.AnyArg(), "orders.trades", "notifications").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	handled := []string{}
+	err = bus.HandleEvents("orders.trades", "notifications", func(event core.Event) error {
+		payload := ""
+		err := event.Decode(&payload)
+		handled = append(handled, payload)
+		return err
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if len(handled) != 2 || handled[0] != "first" || handled[1] != "second" {
+		t.Errorf("handled events are %v, expected [first second]", handled)
+	}
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEventBusPruneEvents(t *testing.T) {
+	db, mock, err := postgresqltests.GetMockedDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := postgresql.NewEventBus(db)
+	before := time.Now().Add(-24 * time.Hour)
+
+	// Only the events behind the position of all the groups of their topic are deleted.
+	mock.ExpectExec(`DELETE FROM "event" WHERE "created_at"<\$1 AND NOT EXISTS \(SELECT 1 FROM "eventgroup" WHERE "eventgroup"\."topic"="event"\."topic" AND \("event"\."tx_id","event"\."id"\)>\("eventgroup"\."last_tx_id","eventgroup"\."last_event_id"\)\)`).
+		WithArgs(before).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	deleted, err := bus.PruneEvents(before)
+	if err != nil {
+		t.Error(err)
+	}
+	if deleted != 3 {
+		t.Errorf("%d events deleted, expected 3", deleted)
+	}
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookSignatureHeader is the header with the HMAC-SHA256 (hex) of the timestamp, nonce and body.
+	WebhookSignatureHeader = "X-Webhook-Signature"
+
+	// WebhookTimestampHeader is the header with the time (Unix seconds) that the webhook was signed.
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+
+	// WebhookNonceHeader is the header with an unique value of each webhook.
+	WebhookNonceHeader = "X-Webhook-Nonce"
+)
+
+var (
+	// ErrWebhookSignature happens when the signature of a webhook is missing or does not match its body.
+	ErrWebhookSignature = errors.New("invalid webhook signature")
+
+	// ErrWebhookExpired happens when the timestamp of a webhook is out of the accepted window.
+	ErrWebhookExpired = errors.New("webhook timestamp out of the window")
+
+	// ErrWebhookReplayed happens when the nonce of a webhook was already used.
+	ErrWebhookReplayed = errors.New("webhook nonce already used")
+)
+
+// WebhookSigner signs webhooks with a secret shared by the sender and the receiver.
+type WebhookSigner struct {
+	secret []byte
+}
+
+// NewWebhookSigner creates a new WebhookSigner.
+func NewWebhookSigner(secret string) WebhookSigner {
+	return WebhookSigner{secret: []byte(secret)}
+}
+
+// Sign returns the signature of a webhook body.
+// The timestamp and the nonce are signed too, so they cannot be changed by a replay.
+func (s WebhookSigner) Sign(timestamp int64, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest sets the signature headers of a webhook request with a new nonce.
+// The body must be the same one sent on the request.
+func (s WebhookSigner) SignRequest(req *http.Request, body []byte) error {
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	timestamp := time.Now().Unix()
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookNonceHeader, nonce)
+	req.Header.Set(WebhookSignatureHeader, s.Sign(timestamp, nonce, body))
+	return nil
+}
+
+// NonceStore is an interface that keeps the nonces of the received webhooks.
+type NonceStore interface {
+	// Add must save a nonce until "expiresAt".
+	// It must return false if the nonce was already saved and did not expire.
+	Add(nonce string, expiresAt time.Time) bool
+}
+
+// MemoryNonceStore is a NonceStore that keeps the nonces in memory (one process).
+// It does not stop the replays sent to another replica of the receiver, or sent after a restart
+// (inside of the time window). Those need a NonceStore shared by the replicas (ex: a database table).
+type MemoryNonceStore struct {
+	mu     *sync.Mutex
+	nonces map[string]time.Time
+}
+
+// NewMemoryNonceStore creates a new MemoryNonceStore.
+func NewMemoryNonceStore() MemoryNonceStore {
+	return MemoryNonceStore{mu: &sync.Mutex{}, nonces: map[string]time.Time{}}
+}
+
+// Add saves a nonce until "expiresAt". It returns false if the nonce was already saved and did not expire.
+// The expired nonces are removed on each call.
+func (store MemoryNonceStore) Add(nonce string, expiresAt time.Time) bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	now := time.Now()
+	for n, e := range store.nonces {
+		if !e.After(now) {
+			delete(store.nonces, n)
+		}
+	}
+	if _, ok := store.nonces[nonce]; ok {
+		return false
+	}
+	store.nonces[nonce] = expiresAt
+	return true
+}
+
+// WebhookVerifier verifies the signature, timestamp and nonce of the received webhooks.
+type WebhookVerifier struct {
+	signer WebhookSigner
+	window time.Duration
+	nonces NonceStore
+}
+
+// NewWebhookVerifier creates a new WebhookVerifier.
+// Webhooks signed more than "window" before or after the current time are rejected.
+func NewWebhookVerifier(signer WebhookSigner, window time.Duration, nonces NonceStore) WebhookVerifier {
+	return WebhookVerifier{signer: signer, window: window, nonces: nonces}
+}
+
+// Verify checks a received webhook.
+// The nonce is saved only after the signature is checked, so unsigned requests cannot block it.
+// The following errors can happen: ErrWebhookSignature, ErrWebhookExpired, ErrWebhookReplayed.
+func (v WebhookVerifier) Verify(signature string, timestamp string, nonce string, body []byte, now time.Time) error {
+	if signature == "" || timestamp == "" || nonce == "" {
+		return ErrWebhookSignature
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrWebhookSignature
+	}
+	expected := v.signer.Sign(unix, nonce, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrWebhookSignature
+	}
+	signedAt := time.Unix(unix, 0)
+	if signedAt.Before(now.Add(-v.window)) || signedAt.After(now.Add(v.window)) {
+		return ErrWebhookExpired
+	}
+	// After "window" the timestamp is rejected, so the nonce does not need to be kept.
+	if !v.nonces.Add(nonce, signedAt.Add(v.window)) {
+		return ErrWebhookReplayed
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package core_test
+
+import (
+	"errors"
+	"home-broker/core"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWebhookVerifierVerify(t *testing.T) {
+	signer := core.NewWebhookSigner("secret")
+	now := time.Now()
+	body := []byte(`{"action":"traded"}`)
+	timestamp := now.Unix()
+	testTable := []struct {
+		test      string
+		signature string
+		timestamp int64
+		nonce     string
+		body      []byte
+		expected  error
+	}{
+		{test: "Valid", signature: signer.Sign(timestamp, "n1", body), timestamp: timestamp, nonce: "n1", body: body, expected: nil},
+		{test: "Replayed", signature: signer.Sign(timestamp, "n1", body), timestamp: timestamp, nonce: "n1", body: body, expected: core.ErrWebhookReplayed},
+		{test: "ChangedBody", signature: signer.Sign(timestamp, "n2", body), timestamp: timestamp, nonce: "n2", body: []byte(`{"action":"deleted"}`), expected: core.ErrWebhookSignature},
+		{test: "ChangedNonce", signature: signer.Sign(timestamp, "n3", body), timestamp: timestamp, nonce: "n4", body: body, expected: core.ErrWebhookSignature},
+		{test: "OtherSecret", signature: core.NewWebhookSigner("other").Sign(timestamp, "n5", body), timestamp: timestamp, nonce: "n5", body: body, expected: core.ErrWebhookSignature},
+		{test: "Missing", signature: "", timestamp: timestamp, nonce: "n6", body: body, expected: core.ErrWebhookSignature},
+		{test: "TooOld", signature: signer.Sign(timestamp-600, "n7", body), timestamp: timestamp - 600, nonce: "n7", body: body, expected: core.ErrWebhookExpired},
+		{test: "TooNew", signature: signer.Sign(timestamp+600, "n8", body), timestamp: timestamp + 600, nonce: "n8", body: body, expected: core.ErrWebhookExpired},
+	}
+	verifier := core.NewWebhookVerifier(signer, 5*time.Minute, core.NewMemoryNonceStore())
+	for _, table := range testTable {
+		t.Run(table.test, func(t *testing.T) {
+			err := verifier.Verify(table.signature, strconv.FormatInt(table.timestamp, 10), table.nonce, table.body, now)
+			if !errors.Is(err, table.expected) {
+				t.Errorf("err is %v, expected %v", err, table.expected)
+			}
+		})
+	}
+}
+
+func TestWebhookSignerSignRequest(t *testing.T) {
+	signer := core.NewWebhookSigner("secret")
+	verifier := core.NewWebhookVerifier(signer, 5*time.Minute, core.NewMemoryNonceStore())
+	body := []byte(`{"action":"traded"}`)
+	req, err := http.NewRequest(http.MethodPost, "http://localhost/webhook/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = signer.SignRequest(req, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = verifier.Verify(req.Header.Get(core.WebhookSignatureHeader), req.Header.Get(core.WebhookTimestampHeader), req.Header.Get(core.WebhookNonceHeader), body, time.Now())
+	if err != nil {
+		t.Errorf("err is %v, expected nil", err)
+	}
+}
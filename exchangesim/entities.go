@@ -0,0 +1,257 @@
+package exchangesim
+
+import (
+	"errors"
+	"fmt"
+	"home-broker/assets"
+	"home-broker/money"
+	"home-broker/orderbooks"
+	"home-broker/orders"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownAsset happens when the asset is not traded on the simulated exchange.
+	ErrUnknownAsset = errors.New("asset is not traded on this exchange")
+
+	// ErrOrderNotFound happens when the order does not exist on the simulated exchange.
+	ErrOrderNotFound = errors.New("order not found")
+
+	// ErrOrderNotOpen happens when the order is not in the book anymore (traded or canceled).
+	ErrOrderNotOpen = errors.New("order is not open")
+)
+
+// Order is an order inside of the simulated exchange.
+type Order struct {
+	ID            orders.ExternalOrderID `json:"id"`              // ID generated by the exchange.
+	ClientOrderID string                 `json:"client_order_id"` // ID sent by the client. Empty for synthetic orders.
+	AssetID       assets.AssetID         `json:"asset_id"`
+	Type          orders.OrderType       `json:"type"`
+	Price         money.Money            `json:"price"`
+	Amount        assets.AssetUnit       `json:"amount"`    // Original amount.
+	Remaining     assets.AssetUnit       `json:"remaining"` // Amount still in the book.
+	Status        orders.OrderStatus     `json:"status"`
+	Timestamp     time.Time              `json:"timestamp"`
+}
+
+// Open returns true if the order is still in the book.
+func (o Order) Open() bool {
+	return (o.Status == orders.OrderStatusAccepted || o.Status == orders.OrderStatusPartiallyFilled) && o.Remaining > 0
+}
+
+// Exchange is a simulated exchange with a matching book for each asset.
+// All the orders can match, not only the ones from the home broker.
+type Exchange struct {
+	mux          sync.Mutex
+	books        map[assets.AssetID]*orderbooks.OrderBook
+	orders       map[orders.ExternalOrderID]*Order
+	clientOrders map[string]orders.ExternalOrderID
+	lastID       int64
+	lastTradeID  int64
+	now          func() time.Time
+}
+
+// NewExchange creates a new simulated Exchange trading the assets.
+func NewExchange(assetIDs []assets.AssetID) *Exchange {
+	ex := &Exchange{
+		books:        make(map[assets.AssetID]*orderbooks.OrderBook),
+		orders:       make(map[orders.ExternalOrderID]*Order),
+		clientOrders: make(map[string]orders.ExternalOrderID),
+		now:          time.Now,
+	}
+	for _, assetID := range assetIDs {
+		ex.books[assetID] = orderbooks.NewOrderBook(assetID)
+	}
+	return ex
+}
+
+// AssetIDs returns the assets traded on the exchange.
+func (ex *Exchange) AssetIDs() []assets.AssetID {
+	assetIDs := make([]assets.AssetID, 0, len(ex.books))
+	for assetID := range ex.books {
+		assetIDs = append(assetIDs, assetID)
+	}
+	return assetIDs
+}
+
+// Submit adds a new order and matches it.
+// It returns the order and the market data updates generated by it (trades first, then the added remainder).
+// A repeated client order ID returns the original order without updates.
+// The following errors can happen: ErrUnknownAsset.
+func (ex *Exchange) Submit(clientOrderID string, assetID assets.AssetID, orderType orders.OrderType, price money.Money, amount assets.AssetUnit) (Order, []orders.ExternalUpdate, error) {
+	ex.mux.Lock()
+	defer ex.mux.Unlock()
+	if clientOrderID != "" {
+		id, ok := ex.clientOrders[clientOrderID]
+		if ok {
+			return *ex.orders[id], nil, nil
+		}
+	}
+	return ex.submit(clientOrderID, assetID, orderType, price, amount)
+}
+
+// submit adds a new order. The exchange must be locked.
+func (ex *Exchange) submit(clientOrderID string, assetID assets.AssetID, orderType orders.OrderType, price money.Money, amount assets.AssetUnit) (Order, []orders.ExternalUpdate, error) {
+	book, ok := ex.books[assetID]
+	if !ok {
+		return Order{}, nil, ErrUnknownAsset
+	}
+	ex.lastID++
+	order := &Order{
+		ID:            orders.ExternalOrderID(fmt.Sprintf("SIM-%d", ex.lastID)),
+		ClientOrderID: clientOrderID,
+		AssetID:       assetID,
+		Type:          orderType,
+		Price:         price,
+		Amount:        amount,
+		Remaining:     amount,
+		Status:        orders.OrderStatusAccepted,
+		Timestamp:     ex.now(),
+	}
+	ex.orders[order.ID] = order
+	if clientOrderID != "" {
+		ex.clientOrders[clientOrderID] = order.ID
+	}
+
+	// Every order is "mine" for the exchange, so any crossing orders match.
+	tradeRequest := book.AddOrder(orderbooks.Order{
+		Mine:      true,
+		ID:        order.ID,
+		AssetID:   assetID,
+		Price:     price,
+		Amount:    amount,
+		Type:      orderType,
+		Timestamp: order.Timestamp,
+	})
+	updates := make([]orders.ExternalUpdate, 0)
+	for tradeRequest != nil {
+		updates = append(updates, ex.trade(book, order.ID, *tradeRequest)...)
+		tradeRequest = book.Match()
+	}
+	if order.Remaining > 0 {
+		updates = append(updates, ex.update(*order, order.Remaining, order.Price, orders.ExternalUpdateActionAdded))
+	}
+	return *order, updates, nil
+}
+
+// trade executes a match at the price of the resting order.
+func (ex *Exchange) trade(book *orderbooks.OrderBook, incomingID orders.ExternalOrderID, tradeRequest orderbooks.TradeRequest) []orders.ExternalUpdate {
+	resting := tradeRequest.InterestOrder
+	if resting.ID == incomingID {
+		resting = tradeRequest.InterestedOrder
+	}
+	price := resting.Price
+	amount := tradeRequest.Amount
+
+	ex.lastTradeID++
+	tradeID := orders.ExternalTradeID(fmt.Sprintf("SIM-T-%d", ex.lastTradeID))
+	updates := make([]orders.ExternalUpdate, 0, 2)
+	for _, bookOrder := range []orderbooks.Order{tradeRequest.InterestedOrder, tradeRequest.InterestOrder} {
+		book.DecOrderAmount(orderbooks.Order{ID: bookOrder.ID, Amount: amount})
+		order := ex.orders[bookOrder.ID]
+		order.Remaining -= amount
+		order.Status = orders.OrderStatusPartiallyFilled
+		if order.Remaining <= 0 {
+			order.Status = orders.OrderStatusFilled
+		}
+		update := ex.update(*order, amount, price, orders.ExternalUpdateActionTraded)
+		update.TradeID = tradeID
+		update.Liquidity = orders.LiquidityTaker
+		if bookOrder.ID == resting.ID {
+			update.Liquidity = orders.LiquidityMaker
+		}
+		updates = append(updates, update)
+	}
+	book.RecordTrade(price, ex.now())
+	return updates
+}
+
+// Cancel removes an open order from the book.
+// The following errors can happen: ErrOrderNotFound, ErrOrderNotOpen.
+func (ex *Exchange) Cancel(id orders.ExternalOrderID) (Order, []orders.ExternalUpdate, error) {
+	ex.mux.Lock()
+	defer ex.mux.Unlock()
+	return ex.cancel(id)
+}
+
+// cancel removes an open order from the book. The exchange must be locked.
+func (ex *Exchange) cancel(id orders.ExternalOrderID) (Order, []orders.ExternalUpdate, error) {
+	order, ok := ex.orders[id]
+	if !ok {
+		return Order{}, nil, ErrOrderNotFound
+	}
+	if !order.Open() {
+		return *order, nil, ErrOrderNotOpen
+	}
+	ex.books[order.AssetID].RemoveOrder(orderbooks.Order{ID: order.ID})
+	order.Status = orders.OrderStatusCanceled
+	update := ex.update(*order, order.Remaining, order.Price, orders.ExternalUpdateActionDeleted)
+	return *order, []orders.ExternalUpdate{update}, nil
+}
+
+// Replace cancels an open order and submits a new one with the new price and amount.
+// The new order loses the time priority and has a new ID.
+// The following errors can happen: ErrOrderNotFound, ErrOrderNotOpen.
+func (ex *Exchange) Replace(id orders.ExternalOrderID, price money.Money, amount assets.AssetUnit) (Order, []orders.ExternalUpdate, error) {
+	ex.mux.Lock()
+	defer ex.mux.Unlock()
+	old, updates, err := ex.cancel(id)
+	if err != nil {
+		return old, nil, err
+	}
+	// The client order ID moves to the new order.
+	order, newUpdates, err := ex.submit(old.ClientOrderID, old.AssetID, old.Type, price, amount)
+	return order, append(updates, newUpdates...), err
+}
+
+// GetOrder returns an order by ID.
+// A nil order will be returned if it does not exist.
+func (ex *Exchange) GetOrder(id orders.ExternalOrderID) *Order {
+	ex.mux.Lock()
+	defer ex.mux.Unlock()
+	order, ok := ex.orders[id]
+	if !ok {
+		return nil
+	}
+	copy := *order
+	return &copy
+}
+
+// OpenSyntheticOrders returns the IDs of the open orders without client order ID (synthetic flow).
+func (ex *Exchange) OpenSyntheticOrders(assetID assets.AssetID) []orders.ExternalOrderID {
+	ex.mux.Lock()
+	defer ex.mux.Unlock()
+	ids := make([]orders.ExternalOrderID, 0)
+	for _, order := range ex.orders {
+		if order.AssetID == assetID && order.ClientOrderID == "" && order.Open() {
+			ids = append(ids, order.ID)
+		}
+	}
+	return ids
+}
+
+// LastTradePrice returns the last trade price of an asset (zero without trades).
+func (ex *Exchange) LastTradePrice(assetID assets.AssetID) money.Money {
+	ex.mux.Lock()
+	defer ex.mux.Unlock()
+	book, ok := ex.books[assetID]
+	if !ok {
+		return 0
+	}
+	return book.LastTradePrice
+}
+
+// update returns the market data update of an order.
+func (ex *Exchange) update(order Order, amount assets.AssetUnit, price money.Money, action string) orders.ExternalUpdate {
+	return orders.ExternalUpdate{
+		ID:            order.ID,
+		AssetID:       order.AssetID,
+		Price:         price,
+		Amount:        amount,
+		Type:          order.Type,
+		Timestamp:     ex.now(),
+		Action:        action,
+		ClientOrderID: order.ClientOrderID,
+	}
+}
@@ -0,0 +1,123 @@
+package exchangesim_test
+
+import (
+	"home-broker/assets"
+	"home-broker/exchangesim"
+	"home-broker/orders"
+	"testing"
+)
+
+func TestExchangeSubmit_Match_TradesAtRestingPrice(t *testing.T) {
+	ex := exchangesim.NewExchange([]assets.AssetID{"VIBR"})
+	sell, updates, err := ex.Submit("", "VIBR", orders.OrderTypeSell, 100, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || updates[0].Action != orders.ExternalUpdateActionAdded {
+		t.Fatalf("an added update was expected, received %v", updates)
+	}
+
+	buy, updates, err := ex.Submit("1", "VIBR", orders.OrderTypeBuy, 110, 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two trades (one for each side) and the remainder added to the book.
+	if len(updates) != 3 {
+		t.Fatalf("3 updates were expected, received %v", updates)
+	}
+	for _, update := range updates[:2] {
+		if update.Action != orders.ExternalUpdateActionTraded || update.Price != 100 || update.Amount != 10 {
+			t.Errorf("a trade of 10 at 100 was expected, received %v", update)
+		}
+	}
+	if updates[2].Action != orders.ExternalUpdateActionAdded || updates[2].ID != buy.ID || updates[2].Amount != 5 {
+		t.Errorf("the remainder of the buy was expected, received %v", updates[2])
+	}
+	if updates[0].TradeID == "" || updates[0].TradeID != updates[1].TradeID {
+		t.Errorf("the same trade ID was expected on both sides, received %v and %v", updates[0].TradeID, updates[1].TradeID)
+	}
+	for _, update := range updates[:2] {
+		expected := orders.LiquidityTaker
+		if update.ID == sell.ID {
+			expected = orders.LiquidityMaker // the sell was resting on the book
+		}
+		if update.Liquidity != expected {
+			t.Errorf("liquidity of %v is %v, expected %v", update.ID, update.Liquidity, expected)
+		}
+		if update.ID == buy.ID && update.ClientOrderID != "1" {
+			t.Errorf("client order ID of %v is %q, expected \"1\"", update.ID, update.ClientOrderID)
+		}
+	}
+	if buy.Remaining != 5 || buy.Status != orders.OrderStatusPartiallyFilled {
+		t.Errorf("remaining is %v (%v), expected 5 (partially_filled)", buy.Remaining, buy.Status)
+	}
+	if sell := ex.GetOrder(sell.ID); sell.Remaining != 0 || sell.Status != orders.OrderStatusFilled {
+		t.Errorf("the sell order was expected to be fully traded, received %v", sell)
+	}
+	if ex.LastTradePrice("VIBR") != 100 {
+		t.Errorf("last trade price is %v, expected 100", ex.LastTradePrice("VIBR"))
+	}
+}
+
+func TestExchangeSubmit_RepeatedClientOrderID_ReturnsOriginal(t *testing.T) {
+	ex := exchangesim.NewExchange([]assets.AssetID{"VIBR"})
+	first, _, _ := ex.Submit("1", "VIBR", orders.OrderTypeBuy, 100, 10)
+	second, updates, err := ex.Submit("1", "VIBR", orders.OrderTypeBuy, 100, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID || len(updates) != 0 {
+		t.Errorf("the original order without updates was expected, received %v %v", second, updates)
+	}
+}
+
+func TestExchangeSubmit_UnknownAsset_Error(t *testing.T) {
+	ex := exchangesim.NewExchange([]assets.AssetID{"VIBR"})
+	_, _, err := ex.Submit("", "XPTO", orders.OrderTypeBuy, 100, 10)
+	if err != exchangesim.ErrUnknownAsset {
+		t.Errorf("received %v, expected %v", err, exchangesim.ErrUnknownAsset)
+	}
+}
+
+func TestExchangeCancel(t *testing.T) {
+	ex := exchangesim.NewExchange([]assets.AssetID{"VIBR"})
+	order, _, _ := ex.Submit("", "VIBR", orders.OrderTypeBuy, 100, 10)
+	canceled, updates, err := ex.Cancel(order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if canceled.Status != orders.OrderStatusCanceled {
+		t.Errorf("status is %v, expected %v", canceled.Status, orders.OrderStatusCanceled)
+	}
+	if len(updates) != 1 || updates[0].Action != orders.ExternalUpdateActionDeleted {
+		t.Errorf("a deleted update was expected, received %v", updates)
+	}
+	_, _, err = ex.Cancel(order.ID)
+	if err != exchangesim.ErrOrderNotOpen {
+		t.Errorf("received %v, expected %v", err, exchangesim.ErrOrderNotOpen)
+	}
+	_, _, err = ex.Cancel("SIM-999")
+	if err != exchangesim.ErrOrderNotFound {
+		t.Errorf("received %v, expected %v", err, exchangesim.ErrOrderNotFound)
+	}
+	// The canceled order must not match.
+	_, updates, _ = ex.Submit("", "VIBR", orders.OrderTypeSell, 90, 10)
+	if len(updates) != 1 || updates[0].Action != orders.ExternalUpdateActionAdded {
+		t.Errorf("only an added update was expected, received %v", updates)
+	}
+}
+
+func TestExchangeReplace(t *testing.T) {
+	ex := exchangesim.NewExchange([]assets.AssetID{"VIBR"})
+	order, _, _ := ex.Submit("1", "VIBR", orders.OrderTypeBuy, 100, 10)
+	replaced, updates, err := ex.Replace(order.ID, 105, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced.ID == order.ID || replaced.Price != 105 || replaced.Amount != 20 || replaced.ClientOrderID != "1" {
+		t.Errorf("a new order with the new price and amount was expected, received %v", replaced)
+	}
+	if len(updates) != 2 || updates[0].Action != orders.ExternalUpdateActionDeleted || updates[1].Action != orders.ExternalUpdateActionAdded {
+		t.Errorf("deleted and added updates were expected, received %v", updates)
+	}
+}
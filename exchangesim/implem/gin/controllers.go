@@ -0,0 +1,94 @@
+package exchangesimgin
+
+import (
+	"home-broker/assets"
+	"home-broker/core"
+	"home-broker/exchangesim"
+	"home-broker/money"
+	"home-broker/orders"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	apiErrorInvalidJSON = core.NewAPIError("Invalid JSON.", 400)
+	apiErrorNotFound    = core.NewAPIError("Not found", 404)
+)
+
+// ExchangeSimController represents a simulated exchange controller.
+type ExchangeSimController struct {
+	uc exchangesim.ExchangeSimUseCases
+}
+
+// NewExchangeSimController creates a new ExchangeSimController.
+func NewExchangeSimController(uc exchangesim.ExchangeSimUseCases) ExchangeSimController {
+	return ExchangeSimController{uc: uc}
+}
+
+// SubmitOrderJSON is the JSON received on SubmitOrder.
+type SubmitOrderJSON struct {
+	ClientOrderID string           `json:"client_order_id"`
+	AssetID       assets.AssetID   `json:"asset_id"`
+	Type          orders.OrderType `json:"type"`
+	Price         money.Money      `json:"price"`
+	Amount        assets.AssetUnit `json:"amount"`
+}
+
+// ReplaceOrderJSON is the JSON received on ReplaceOrder.
+type ReplaceOrderJSON struct {
+	Price  money.Money      `json:"price"`
+	Amount assets.AssetUnit `json:"amount"`
+}
+
+// SubmitOrder adds an order on the exchange.
+func (exchangeC ExchangeSimController) SubmitOrder(c *gin.Context) {
+	var json SubmitOrderJSON
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.Error(apiErrorInvalidJSON)
+		return
+	}
+	order, err := exchangeC.uc.SubmitOrder(json.ClientOrderID, json.AssetID, json.Type, json.Price, json.Amount)
+	exchangeC.orderResponse(c, order, err)
+}
+
+// GetOrder returns an order.
+func (exchangeC ExchangeSimController) GetOrder(c *gin.Context) {
+	order := exchangeC.uc.GetOrder(orders.ExternalOrderID(c.Param("order_id")))
+	exchangeC.orderResponse(c, order, nil)
+}
+
+// CancelOrder cancels an order.
+func (exchangeC ExchangeSimController) CancelOrder(c *gin.Context) {
+	order, err := exchangeC.uc.CancelOrder(orders.ExternalOrderID(c.Param("order_id")))
+	exchangeC.orderResponse(c, order, err)
+}
+
+// ReplaceOrder changes the price and amount of an order.
+func (exchangeC ExchangeSimController) ReplaceOrder(c *gin.Context) {
+	var json ReplaceOrderJSON
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.Error(apiErrorInvalidJSON)
+		return
+	}
+	order, err := exchangeC.uc.ReplaceOrder(orders.ExternalOrderID(c.Param("order_id")), json.Price, json.Amount)
+	exchangeC.orderResponse(c, order, err)
+}
+
+// orderResponse writes an order or an error.
+func (exchangeC ExchangeSimController) orderResponse(c *gin.Context, order *exchangesim.Order, err error) {
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	if order == nil {
+		c.Error(apiErrorNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
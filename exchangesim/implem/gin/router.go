@@ -0,0 +1,29 @@
+package exchangesimgin
+
+import (
+	"home-broker/exchangesim"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExchangeSimRouter represents a simulated exchange router.
+type ExchangeSimRouter struct {
+	uc exchangesim.ExchangeSimUseCases
+}
+
+// NewExchangeSimRouter creates a new Router.
+func NewExchangeSimRouter(uc exchangesim.ExchangeSimUseCases) ExchangeSimRouter {
+	return ExchangeSimRouter{uc: uc}
+}
+
+// SetupRouter setups the simulated exchange router.
+func (wr ExchangeSimRouter) SetupRouter(router *gin.Engine) {
+	exchangeC := NewExchangeSimController(wr.uc)
+	v1 := router.Group("/api/v1/exchange/orders")
+	{
+		v1.POST("/", exchangeC.SubmitOrder)
+		v1.GET(":order_id/", exchangeC.GetOrder)
+		v1.PUT(":order_id/", exchangeC.ReplaceOrder)
+		v1.DELETE(":order_id/", exchangeC.CancelOrder)
+	}
+}
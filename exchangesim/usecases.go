@@ -0,0 +1,215 @@
+package exchangesim
+
+import (
+	"bytes"
+	"encoding/json"
+	"home-broker/assets"
+	"home-broker/core"
+	"home-broker/money"
+	"home-broker/orders"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	// updatesBufferSize is the number of market data updates waiting to be sent.
+	updatesBufferSize = 10000
+
+	// oneUnit is 1.000000 in the AssetUnit precision.
+	oneUnit assets.AssetUnit = 1000000
+)
+
+// ExchangeSimUseCases represents the simulated exchange use cases.
+type ExchangeSimUseCases struct {
+	exchange   *Exchange
+	webhookURL string
+	signer     core.WebhookSigner
+	updates    chan orders.ExternalUpdate
+}
+
+// NewExchangeSimUseCases returns a new ExchangeSimUseCases.
+// The market data updates are sent to "webhookURL" (the API orders webhook) by RunWebhookSender,
+// signed by "signer".
+func NewExchangeSimUseCases(exchange *Exchange, webhookURL string, signer core.WebhookSigner) ExchangeSimUseCases {
+	return ExchangeSimUseCases{
+		exchange:   exchange,
+		webhookURL: webhookURL,
+		signer:     signer,
+		updates:    make(chan orders.ExternalUpdate, updatesBufferSize),
+	}
+}
+
+// SubmitOrder adds a new order on the exchange.
+// A repeated client order ID returns the original order.
+func (uc ExchangeSimUseCases) SubmitOrder(clientOrderID string, assetID assets.AssetID, orderType orders.OrderType, price money.Money, amount assets.AssetUnit) (*Order, error) {
+	if assetID == "" {
+		return nil, core.NewErrValidation("Invalid asset ID.")
+	}
+	if orderType != orders.OrderTypeBuy && orderType != orders.OrderTypeSell {
+		return nil, core.NewErrValidation("Invalid type.")
+	}
+	if price <= 0 {
+		return nil, core.NewErrValidation("Invalid price.")
+	}
+	if amount <= 0 {
+		return nil, core.NewErrValidation("Invalid amount.")
+	}
+	order, updates, err := uc.exchange.Submit(clientOrderID, assetID, orderType, price, amount)
+	if err == ErrUnknownAsset {
+		return nil, core.NewErrValidation("Asset is not traded on this exchange.")
+	}
+	if err != nil {
+		return nil, err
+	}
+	uc.publish(updates)
+	return &order, nil
+}
+
+// CancelOrder cancels an open order.
+// A nil order will be returned if it does not exist.
+func (uc ExchangeSimUseCases) CancelOrder(id orders.ExternalOrderID) (*Order, error) {
+	order, updates, err := uc.exchange.Cancel(id)
+	return uc.orderResponse(order, updates, err)
+}
+
+// ReplaceOrder changes the price and amount of an open order.
+// The returned order has a new ID. A nil order will be returned if it does not exist.
+func (uc ExchangeSimUseCases) ReplaceOrder(id orders.ExternalOrderID, price money.Money, amount assets.AssetUnit) (*Order, error) {
+	if price <= 0 {
+		return nil, core.NewErrValidation("Invalid price.")
+	}
+	if amount <= 0 {
+		return nil, core.NewErrValidation("Invalid amount.")
+	}
+	order, updates, err := uc.exchange.Replace(id, price, amount)
+	return uc.orderResponse(order, updates, err)
+}
+
+// GetOrder returns an order by ID.
+// A nil order will be returned if it does not exist.
+func (uc ExchangeSimUseCases) GetOrder(id orders.ExternalOrderID) *Order {
+	return uc.exchange.GetOrder(id)
+}
+
+// orderResponse publishes the updates of a cancel or replace and translates its errors.
+func (uc ExchangeSimUseCases) orderResponse(order Order, updates []orders.ExternalUpdate, err error) (*Order, error) {
+	switch err {
+	case nil:
+	case ErrOrderNotFound:
+		return nil, nil
+	case ErrOrderNotOpen:
+		return nil, core.NewErrValidation("Order is not open.")
+	default:
+		return nil, err
+	}
+	uc.publish(updates)
+	return &order, nil
+}
+
+// publish queues market data updates to be sent by RunWebhookSender.
+func (uc ExchangeSimUseCases) publish(updates []orders.ExternalUpdate) {
+	for _, update := range updates {
+		uc.updates <- update
+	}
+}
+
+// RunWebhookSender sends the market data updates to the webhook, in order, until "stop" is closed.
+// Each update waits "delay" after its timestamp, like the latency of a market data feed.
+// This also gives time to the API to save the external ID returned on the submit.
+func (uc ExchangeSimUseCases) RunWebhookSender(delay time.Duration, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case update := <-uc.updates:
+			wait := time.Until(update.Timestamp.Add(delay))
+			if wait > 0 {
+				time.Sleep(wait)
+			}
+			err := uc.sendWebhook(update)
+			if err != nil {
+				log.Printf("error to send the update %v %v: %v\n", update.Action, update.ID, err)
+			}
+		}
+	}
+}
+
+// sendWebhook posts a signed market data update to the webhook.
+func (uc ExchangeSimUseCases) sendWebhook(update orders.ExternalUpdate) error {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, uc.webhookURL, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	err = uc.signer.SignRequest(req, body)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("webhook response %d for %v %v\n", resp.StatusCode, update.Action, update.ID)
+	}
+	return nil
+}
+
+// RunOrderFlow generates third-party orders for an asset on every interval until "stop" is closed.
+// The prices are around the last trade ("midPrice" before the first trade), so they cross and trade.
+// Some of the synthetic orders are canceled later.
+func (uc ExchangeSimUseCases) RunOrderFlow(assetID assets.AssetID, midPrice money.Money, interval time.Duration, seed int64, stop <-chan struct{}) {
+	rng := rand.New(rand.NewSource(seed))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		err := uc.generateOrder(assetID, midPrice, rng)
+		if err != nil {
+			log.Printf("error to generate an order for %v: %v\n", assetID, err)
+		}
+	}
+}
+
+// generateOrder submits or cancels a random third-party order.
+func (uc ExchangeSimUseCases) generateOrder(assetID assets.AssetID, midPrice money.Money, rng *rand.Rand) error {
+	if rng.Intn(5) == 0 {
+		// 20% of the events are cancels.
+		ids := uc.exchange.OpenSyntheticOrders(assetID)
+		if len(ids) > 0 {
+			_, err := uc.CancelOrder(ids[rng.Intn(len(ids))])
+			return err
+		}
+	}
+	reference := uc.exchange.LastTradePrice(assetID)
+	if reference <= 0 {
+		reference = midPrice
+	}
+	// Up to 1% (10 ticks of 0.1%) around the reference price.
+	tick := reference / 1000
+	if tick <= 0 {
+		tick = 1
+	}
+	price := reference + money.Money(rng.Intn(21)-10)*tick
+	if price <= 0 {
+		price = tick
+	}
+	orderType := orders.OrderType(orders.OrderTypeBuy)
+	if rng.Intn(2) == 0 {
+		orderType = orders.OrderTypeSell
+	}
+	amount := assets.AssetUnit(rng.Intn(100)+1) * oneUnit
+	_, err := uc.SubmitOrder("", assetID, orderType, price, amount)
+	return err
+}
@@ -0,0 +1,29 @@
+package fees
+
+import (
+	"home-broker/assets"
+	"home-broker/users"
+)
+
+// FeeDBInterface is an interface that handles database commands for FeeSchedule entity and the user tiers.
+type FeeDBInterface interface {
+	// GetSchedule must return the fee schedule of an asset and tier (exact match, empty values included).
+	// A nil entity will be returned if it does not exist.
+	GetSchedule(assetID assets.AssetID, tier Tier) (*FeeSchedule, error)
+
+	// GetSchedules must return the fee schedules that can apply to an asset and tier:
+	// the ones of the asset or of all assets (empty), and of the tier or of all tiers (empty).
+	GetSchedules(assetID assets.AssetID, tier Tier) ([]FeeSchedule, error)
+
+	// Upsert must insert a new fee schedule or update the existing one of the same asset and tier.
+	// A nil entity will be returned if an error occurs.
+	Upsert(entity FeeSchedule) (*FeeSchedule, error)
+
+	// GetUserTier must return the tier of an user.
+	// An empty tier will be returned if the user has no tier.
+	GetUserTier(userID users.UserID) (Tier, error)
+
+	// SetUserTier must set the tier of an user.
+	// The following errors can happen: ErrUserDoesNotExist.
+	SetUserTier(userID users.UserID, tier Tier) error
+}
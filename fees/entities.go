@@ -0,0 +1,178 @@
+package fees
+
+import (
+	"home-broker/assets"
+	"home-broker/money"
+	"time"
+)
+
+type (
+	// FeeType represents how a fee component is computed.
+	// Use the value of FeeTypeFixed, FeeTypePercentage, FeeTypeTiered, FeeTypeMakerTaker or FeeTypePassThrough to set this data type.
+	FeeType string
+
+	// Tier represents a group of users charged with the same fees (ex: "default", "vip").
+	Tier string
+)
+
+const (
+	// FeeTypeFixed is a fixed amount charged on each trade.
+	FeeTypeFixed FeeType = "fixed"
+
+	// FeeTypePercentage is a percentage (basis points) of the trade value.
+	FeeTypePercentage FeeType = "percentage"
+
+	// FeeTypeTiered is a percentage (basis points) that depends on the bracket of the trade value.
+	// The rate of the bracket is applied to the whole value.
+	FeeTypeTiered FeeType = "tiered"
+
+	// FeeTypeMakerTaker is a percentage (basis points) that depends on the trade liquidity.
+	// The maker is the order that was on the book, the taker is the order that matched it.
+	FeeTypeMakerTaker FeeType = "maker_taker"
+
+	// FeeTypePassThrough is the fee charged by the exchange, passed through to the user.
+	// The basis points are used when the exchange does not report the fee of the trade.
+	FeeTypePassThrough FeeType = "pass_through"
+
+	// TierDefault is the tier of the users without a tier.
+	TierDefault Tier = "default"
+
+	// BasisPointsBase is the value of 100% in basis points.
+	BasisPointsBase int64 = 10000
+)
+
+// FeeBracket is a range of trade values of a tiered fee.
+type FeeBracket struct {
+	UpTo        money.Money `json:"up_to"` // Highest trade value of the bracket. Zero means no limit (the last bracket).
+	BasisPoints int64       `json:"basis_points"`
+}
+
+// FeeComponent is one of the fees charged on a trade (ex: the brokerage fee or the exchange fee).
+type FeeComponent struct {
+	Name             string       `json:"name"` // Ex: "brokerage", "exchange".
+	Type             FeeType      `json:"type"`
+	Amount           money.Money  `json:"amount,omitempty"`             // Fixed fee.
+	BasisPoints      int64        `json:"basis_points,omitempty"`       // Percentage and pass-through fees. Ex: 25 = 0.25%.
+	MakerBasisPoints int64        `json:"maker_basis_points,omitempty"` // Maker/taker fee.
+	TakerBasisPoints int64        `json:"taker_basis_points,omitempty"` // Maker/taker fee.
+	Brackets         []FeeBracket `json:"brackets,omitempty"`           // Tiered fee, sorted by UpTo.
+}
+
+// FeeSchedule holds the fees charged on the trades of an asset for a tier of users.
+// An empty AssetID matches all the assets and an empty Tier matches all the tiers (see SelectSchedule).
+type FeeSchedule struct {
+	AssetID    assets.AssetID `json:"asset_id"`
+	Tier       Tier           `json:"tier"`
+	Components []FeeComponent `json:"components"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  time.Time      `json:"-"`
+}
+
+// NewFeeSchedule returns a new FeeSchedule.
+func NewFeeSchedule(assetID assets.AssetID, tier Tier, components []FeeComponent) FeeSchedule {
+	return FeeSchedule{AssetID: assetID, Tier: tier, Components: components}
+}
+
+// Trade holds the data of a trade used to compute its fees.
+type Trade struct {
+	Value               money.Money // Price * amount (see money.Notional).
+	Maker               bool        // The order was on the book (it added liquidity).
+	ExchangeFee         money.Money // Fee charged by the exchange.
+	ExchangeFeeReported bool        // The exchange reported the ExchangeFee.
+}
+
+// fromBasisPoints returns "basisPoints" of a value.
+func fromBasisPoints(value money.Money, basisPoints int64) money.Money {
+	v := int64(value)
+	// Splitting the multiplication avoids an int64 overflow with big values.
+	return money.Money((v/BasisPointsBase)*basisPoints + (v%BasisPointsBase)*basisPoints/BasisPointsBase)
+}
+
+// bracketBasisPoints returns the basis points of the bracket of a trade value.
+func (c FeeComponent) bracketBasisPoints(value money.Money) int64 {
+	for _, bracket := range c.Brackets {
+		if bracket.UpTo == 0 || value <= bracket.UpTo {
+			return bracket.BasisPoints
+		}
+	}
+	if len(c.Brackets) == 0 {
+		return 0
+	}
+	// Values above the last bracket use its rate.
+	return c.Brackets[len(c.Brackets)-1].BasisPoints
+}
+
+// Fee returns the fee of a trade.
+func (c FeeComponent) Fee(trade Trade) money.Money {
+	switch c.Type {
+	case FeeTypeFixed:
+		return c.Amount
+	case FeeTypePercentage:
+		return fromBasisPoints(trade.Value, c.BasisPoints)
+	case FeeTypeTiered:
+		return fromBasisPoints(trade.Value, c.bracketBasisPoints(trade.Value))
+	case FeeTypeMakerTaker:
+		if trade.Maker {
+			return fromBasisPoints(trade.Value, c.MakerBasisPoints)
+		}
+		return fromBasisPoints(trade.Value, c.TakerBasisPoints)
+	case FeeTypePassThrough:
+		if trade.ExchangeFeeReported {
+			return trade.ExchangeFee
+		}
+		return fromBasisPoints(trade.Value, c.BasisPoints)
+	}
+	return 0
+}
+
+// MaxFee returns the highest fee of a trade value, whatever the liquidity is (ex: to hold the funds of an order).
+func (c FeeComponent) MaxFee(value money.Money) money.Money {
+	maker := c.Fee(Trade{Value: value, Maker: true})
+	taker := c.Fee(Trade{Value: value})
+	if maker > taker {
+		return maker
+	}
+	return taker
+}
+
+// Fee returns the sum of the fees of a trade.
+func (s FeeSchedule) Fee(trade Trade) money.Money {
+	var fee money.Money
+	for _, component := range s.Components {
+		fee += component.Fee(trade)
+	}
+	return fee
+}
+
+// MaxFee returns the sum of the highest fees of a trade value (see FeeComponent.MaxFee).
+func (s FeeSchedule) MaxFee(value money.Money) money.Money {
+	var fee money.Money
+	for _, component := range s.Components {
+		fee += component.MaxFee(value)
+	}
+	return fee
+}
+
+// SelectSchedule returns the most specific schedule of an asset and tier:
+// the one of the asset and tier, then the one of the asset (all tiers), then the one of the tier (all assets)
+// and then the one of all the assets and tiers. It returns nil if none of the schedules matches.
+func SelectSchedule(schedules []FeeSchedule, assetID assets.AssetID, tier Tier) *FeeSchedule {
+	candidates := []struct {
+		assetID assets.AssetID
+		tier    Tier
+	}{
+		{assetID, tier},
+		{assetID, ""},
+		{"", tier},
+		{"", ""},
+	}
+	for _, candidate := range candidates {
+		for i := range schedules {
+			if schedules[i].AssetID == candidate.assetID && schedules[i].Tier == candidate.tier {
+				return &schedules[i]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package fees_test
+
+import (
+	"home-broker/fees"
+	"home-broker/money"
+	"testing"
+)
+
+func TestFeeComponentFee(t *testing.T) {
+	brackets := []fees.FeeBracket{
+		{UpTo: 1000000000, BasisPoints: 50}, // up to $1,000.00: 0.5%
+		{UpTo: 0, BasisPoints: 20},          // above: 0.2%
+	}
+	testTable := []struct {
+		test      string
+		component fees.FeeComponent
+		trade     fees.Trade
+		expected  money.Money
+	}{
+		{test: "Fixed", component: fees.FeeComponent{Type: fees.FeeTypeFixed, Amount: 2500000}, trade: fees.Trade{Value: 100000000}, expected: 2500000},
+		{test: "Percentage", component: fees.FeeComponent{Type: fees.FeeTypePercentage, BasisPoints: 25}, trade: fees.Trade{Value: 100000000}, expected: 250000},
+		{test: "PercentageBigValue", component: fees.FeeComponent{Type: fees.FeeTypePercentage, BasisPoints: 25}, trade: fees.Trade{Value: 900000000000000000}, expected: 2250000000000000},
+		{test: "TieredFirstBracket", component: fees.FeeComponent{Type: fees.FeeTypeTiered, Brackets: brackets}, trade: fees.Trade{Value: 1000000000}, expected: 5000000},
+		{test: "TieredLastBracket", component: fees.FeeComponent{Type: fees.FeeTypeTiered, Brackets: brackets}, trade: fees.Trade{Value: 2000000000}, expected: 4000000},
+		{test: "Maker", component: fees.FeeComponent{Type: fees.FeeTypeMakerTaker, MakerBasisPoints: 10, TakerBasisPoints: 30}, trade: fees.Trade{Value: 100000000, Maker: true}, expected: 100000},
+		{test: "Taker", component: fees.FeeComponent{Type: fees.FeeTypeMakerTaker, MakerBasisPoints: 10, TakerBasisPoints: 30}, trade: fees.Trade{Value: 100000000}, expected: 300000},
+		{test: "PassThroughReported", component: fees.FeeComponent{Type: fees.FeeTypePassThrough, BasisPoints: 5}, trade: fees.Trade{Value: 100000000, ExchangeFee: 12345, ExchangeFeeReported: true}, expected: 12345},
+		{test: "PassThroughNotReported", component: fees.FeeComponent{Type: fees.FeeTypePassThrough, BasisPoints: 5}, trade: fees.Trade{Value: 100000000}, expected: 50000},
+		{test: "InvalidType", component: fees.FeeComponent{Type: "invalid", Amount: 2500000}, trade: fees.Trade{Value: 100000000}, expected: 0},
+	}
+	for _, table := range testTable {
+		t.Run(table.test, func(t *testing.T) {
+			fee := table.component.Fee(table.trade)
+			if fee != table.expected {
+				t.Errorf("fee is %v, expected %v", fee, table.expected)
+			}
+		})
+	}
+}
+
+func TestFeeScheduleFee(t *testing.T) {
+	schedule := fees.NewFeeSchedule("VIBR", fees.TierDefault, []fees.FeeComponent{
+		{Name: "brokerage", Type: fees.FeeTypeFixed, Amount: 1000000},
+		{Name: "exchange", Type: fees.FeeTypeMakerTaker, MakerBasisPoints: 10, TakerBasisPoints: 30},
+	})
+	fee := schedule.Fee(fees.Trade{Value: 100000000, Maker: true})
+	if fee != 1100000 {
+		t.Errorf("fee is %v, expected %v", fee, 1100000)
+	}
+	// The highest fee is the taker one.
+	maxFee := schedule.MaxFee(100000000)
+	if maxFee != 1300000 {
+		t.Errorf("max fee is %v, expected %v", maxFee, 1300000)
+	}
+	noFees := fees.NewFeeSchedule("VIBR", fees.TierDefault, nil)
+	if noFees.Fee(fees.Trade{Value: 100000000}) != 0 || noFees.MaxFee(100000000) != 0 {
+		t.Errorf("a schedule without components must have no fees")
+	}
+}
+
+func TestSelectSchedule(t *testing.T) {
+	all := fees.NewFeeSchedule("", "", nil)
+	tier := fees.NewFeeSchedule("", "vip", nil)
+	asset := fees.NewFeeSchedule("VIBR", "", nil)
+	assetTier := fees.NewFeeSchedule("VIBR", "vip", nil)
+	testTable := []struct {
+		test      string
+		schedules []fees.FeeSchedule
+		expected  *fees.FeeSchedule
+	}{
+		{test: "AssetAndTier", schedules: []fees.FeeSchedule{all, tier, asset, assetTier}, expected: &assetTier},
+		{test: "Asset", schedules: []fees.FeeSchedule{all, tier, asset}, expected: &asset},
+		{test: "Tier", schedules: []fees.FeeSchedule{all, tier}, expected: &tier},
+		{test: "All", schedules: []fees.FeeSchedule{all}, expected: &all},
+		{test: "None", schedules: []fees.FeeSchedule{}, expected: nil},
+	}
+	for _, table := range testTable {
+		t.Run(table.test, func(t *testing.T) {
+			selected := fees.SelectSchedule(table.schedules, "VIBR", "vip")
+			if table.expected == nil {
+				if selected != nil {
+					t.Errorf("schedule is %v, expected nil", *selected)
+				}
+				return
+			}
+			if selected == nil || selected.AssetID != table.expected.AssetID || selected.Tier != table.expected.Tier {
+				t.Errorf("schedule is %v, expected %v", selected, *table.expected)
+			}
+		})
+	}
+}
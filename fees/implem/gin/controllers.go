@@ -0,0 +1,143 @@
+package feesgin
+
+import (
+	"home-broker/assets"
+	"home-broker/core"
+	"home-broker/fees"
+	"home-broker/users"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	apiErrorInvalidJSON   = core.NewAPIError("Invalid JSON.", 400)
+	apiErrorInvalidUserID = core.NewAPIError("Invalid user ID.", 400)
+)
+
+// FeeController represents a fee controller.
+type FeeController struct {
+	uc fees.FeeUseCases
+}
+
+// NewFeeController creates a new FeeController.
+func NewFeeController(uc fees.FeeUseCases) FeeController {
+	return FeeController{uc: uc}
+}
+
+// SetScheduleJSON is the JSON received on SetSchedule.
+type SetScheduleJSON struct {
+	AssetID    assets.AssetID      `json:"asset_id"`
+	Tier       fees.Tier           `json:"tier"`
+	Components []fees.FeeComponent `json:"components"`
+}
+
+// SetUserTierJSON is the JSON received on SetUserTier.
+type SetUserTierJSON struct {
+	Tier fees.Tier `json:"tier"`
+}
+
+// UserFeesJSON is the JSON returned by GetUserFees.
+type UserFeesJSON struct {
+	UserID   users.UserID      `json:"user_id"`
+	AssetID  assets.AssetID    `json:"asset_id,omitempty"`
+	Tier     fees.Tier         `json:"tier"`
+	Schedule *fees.FeeSchedule `json:"schedule,omitempty"`
+}
+
+// GetSchedule returns the fee schedule of an asset and tier (query "asset_id" and "tier").
+// Empty values are the schedules of all the assets or tiers.
+func (feeC FeeController) GetSchedule(c *gin.Context) {
+	entity, err := feeC.uc.GetSchedule(assets.AssetID(c.Query("asset_id")), fees.Tier(c.Query("tier")))
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	if entity == nil {
+		c.Error(core.NewAPIError("Not found", 404))
+		return
+	}
+	c.JSON(http.StatusOK, entity)
+}
+
+// SetSchedule creates or changes the fee schedule of an asset and tier.
+func (feeC FeeController) SetSchedule(c *gin.Context) {
+	var json SetScheduleJSON
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.Error(apiErrorInvalidJSON)
+		return
+	}
+	entity, err := feeC.uc.SetSchedule(json.AssetID, json.Tier, json.Components)
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, entity)
+}
+
+// GetUserFees returns the tier of an user and the fee schedule applied to its trades of an asset (query "asset_id").
+func (feeC FeeController) GetUserFees(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.Error(apiErrorInvalidUserID)
+		return
+	}
+	json := UserFeesJSON{UserID: users.UserID(userID), AssetID: assets.AssetID(c.Query("asset_id"))}
+	json.Tier, err = feeC.uc.GetUserTier(json.UserID)
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	json.Schedule, err = feeC.uc.GetUserSchedule(json.UserID, json.AssetID)
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, json)
+}
+
+// SetUserTier changes the tier of an user.
+func (feeC FeeController) SetUserTier(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.Error(apiErrorInvalidUserID)
+		return
+	}
+	var json SetUserTierJSON
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.Error(apiErrorInvalidJSON)
+		return
+	}
+	err = feeC.uc.SetUserTier(users.UserID(userID), json.Tier)
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, UserFeesJSON{UserID: users.UserID(userID), Tier: json.Tier})
+}
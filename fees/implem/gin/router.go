@@ -0,0 +1,29 @@
+package feesgin
+
+import (
+	"home-broker/fees"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FeeRouter represents a fees router.
+type FeeRouter struct {
+	uc fees.FeeUseCases
+}
+
+// NewFeeRouter creates a new Router.
+func NewFeeRouter(uc fees.FeeUseCases) FeeRouter {
+	return FeeRouter{uc: uc}
+}
+
+// SetupRouter setups fees router.
+func (wr FeeRouter) SetupRouter(router *gin.Engine) {
+	feeC := NewFeeController(wr.uc)
+	v1 := router.Group("/api/v1/fees")
+	{
+		v1.GET("schedules/", feeC.GetSchedule)
+		v1.PUT("schedules/", feeC.SetSchedule)
+		v1.GET("users/:user_id/", feeC.GetUserFees)
+		v1.PUT("users/:user_id/", feeC.SetUserTier)
+	}
+}
@@ -0,0 +1,218 @@
+package postgresql
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"home-broker/assets"
+	"home-broker/core/implem/postgresql"
+	"home-broker/fees"
+	"home-broker/users"
+	userspostgresql "home-broker/users/implem/postgresql"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FeeComponents is the ORM version of the components of a fee schedule.
+// They are saved as JSON.
+type FeeComponents []fees.FeeComponent
+
+// Value returns the JSON of the components to be saved.
+func (components FeeComponents) Value() (driver.Value, error) {
+	if components == nil {
+		components = FeeComponents{}
+	}
+	data, err := json.Marshal(components)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan reads the components from their JSON.
+func (components *FeeComponents) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	case nil:
+		*components = FeeComponents{}
+		return nil
+	default:
+		return fmt.Errorf("invalid fee components: %v", value)
+	}
+	return json.Unmarshal(data, components)
+}
+
+// FeeScheduleModel is the ORM version of FeeSchedule entity.
+// The AssetID is not a foreign key because an empty value means all the assets.
+type FeeScheduleModel struct {
+	gorm.Model
+	ID         int64          `gorm:"primaryKey;autoIncrement:true"`
+	AssetID    assets.AssetID `gorm:"not null;default:'';uniqueIndex:idx_feeschedule_assettier"`
+	Tier       fees.Tier      `gorm:"not null;default:'';uniqueIndex:idx_feeschedule_assettier"`
+	Components FeeComponents  `gorm:"type:text;not null"`
+	CreatedAt  time.Time      `gorm:"not null;index:,sort:desc"`
+	UpdatedAt  time.Time      `gorm:"not null;index:,sort:desc"`
+	DeletedAt  gorm.DeletedAt `gorm:"index:,sort:desc"`
+}
+
+// TableName returns the real table name of FeeSchedule.
+// It is used by GORM to perfom operations on fee schedule table (queries, migrations, etc.).
+func (FeeScheduleModel) TableName() string {
+	return "feeschedule"
+}
+
+// UserTierModel is the ORM version of the tier of an user.
+type UserTierModel struct {
+	gorm.Model
+	ID        int64        `gorm:"primaryKey;autoIncrement:true"`
+	UserID    users.UserID `gorm:"unique;not null"`
+	User      userspostgresql.UserModel
+	Tier      fees.Tier      `gorm:"not null"`
+	CreatedAt time.Time      `gorm:"not null;index:,sort:desc"`
+	UpdatedAt time.Time      `gorm:"not null;index:,sort:desc"`
+	DeletedAt gorm.DeletedAt `gorm:"index:,sort:desc"`
+}
+
+// TableName returns the real table name of the user tiers.
+// It is used by GORM to perfom operations on user tier table (queries, migrations, etc.).
+func (UserTierModel) TableName() string {
+	return "usertier"
+}
+
+// FeeDB handles database commands for fee schedule and user tier tables.
+type FeeDB struct {
+	fees.FeeDBInterface
+	db postgresql.DB
+}
+
+// NewFeeDB creates a new FeeDB.
+func NewFeeDB(db postgresql.DB) FeeDB {
+	return FeeDB{db: db}
+}
+
+// ToEntity returns a FeeSchedule entity from the ORM model.
+func (FeeDB) ToEntity(model FeeScheduleModel) fees.FeeSchedule {
+	// "model.DeletedAt" is not a Time object. It is a struct with Time and Valid fields.
+	deletedAt := time.Time{} // A "time.Time" with zero value represents a "null".
+	if model.DeletedAt.Valid {
+		// "model.DeletedAt" is not a "null" value.
+		deletedAt = model.DeletedAt.Time
+	}
+	entity := fees.FeeSchedule{
+		AssetID:    model.AssetID,
+		Tier:       model.Tier,
+		Components: []fees.FeeComponent(model.Components),
+		CreatedAt:  model.CreatedAt,
+		UpdatedAt:  model.UpdatedAt,
+		DeletedAt:  deletedAt,
+	}
+	return entity
+}
+
+// ToModel returns a GORM model from a fee schedule entity.
+func (FeeDB) ToModel(entity fees.FeeSchedule) FeeScheduleModel {
+	deletedAt := gorm.DeletedAt{Time: entity.DeletedAt}
+	if !entity.DeletedAt.IsZero() {
+		deletedAt.Valid = true
+	}
+	model := FeeScheduleModel{
+		AssetID:    entity.AssetID,
+		Tier:       entity.Tier,
+		Components: FeeComponents(entity.Components),
+		CreatedAt:  entity.CreatedAt,
+		UpdatedAt:  entity.UpdatedAt,
+		DeletedAt:  deletedAt,
+	}
+	return model
+}
+
+// GetSchedule returns the fee schedule of an asset and tier (exact match, empty values included).
+// A nil entity will be returned if it does not exist.
+func (feeDB FeeDB) GetSchedule(assetID assets.AssetID, tier fees.Tier) (*fees.FeeSchedule, error) {
+	model := FeeScheduleModel{}
+	res := feeDB.db.GetDB().Where(`"asset_id"=? AND "tier"=?`, assetID, tier).Take(&model)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	entity := feeDB.ToEntity(model)
+	return &entity, nil
+}
+
+// GetSchedules returns the fee schedules that can apply to an asset and tier:
+// the ones of the asset or of all assets (empty), and of the tier or of all tiers (empty).
+func (feeDB FeeDB) GetSchedules(assetID assets.AssetID, tier fees.Tier) ([]fees.FeeSchedule, error) {
+	models := []FeeScheduleModel{}
+	res := feeDB.db.GetDB().
+		Where(`"asset_id" IN (?, '') AND "tier" IN (?, '')`, assetID, tier).
+		Find(&models)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	entities := make([]fees.FeeSchedule, 0, len(models))
+	for _, model := range models {
+		entities = append(entities, feeDB.ToEntity(model))
+	}
+	return entities, nil
+}
+
+// Upsert inserts a new fee schedule or updates the existing one of the same asset and tier.
+// A nil entity will be returned if an error occurs.
+func (feeDB FeeDB) Upsert(entity fees.FeeSchedule) (*fees.FeeSchedule, error) {
+	model := feeDB.ToModel(entity)
+	res := feeDB.db.GetDB().
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "asset_id"}, {Name: "tier"}},
+			DoUpdates: clause.AssignmentColumns([]string{"components", "updated_at", "deleted_at"}),
+		}).
+		Create(&model)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return feeDB.GetSchedule(entity.AssetID, entity.Tier)
+}
+
+// GetUserTier returns the tier of an user.
+// An empty tier will be returned if the user has no tier.
+func (feeDB FeeDB) GetUserTier(userID users.UserID) (fees.Tier, error) {
+	model := UserTierModel{}
+	res := feeDB.db.GetDB().Where(`"user_id"=?`, userID).Take(&model)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if res.Error != nil {
+		return "", res.Error
+	}
+	return model.Tier, nil
+}
+
+// SetUserTier sets the tier of an user.
+// The following errors can happen: ErrUserDoesNotExist.
+func (feeDB FeeDB) SetUserTier(userID users.UserID, tier fees.Tier) error {
+	model := UserTierModel{UserID: userID, Tier: tier}
+	res := feeDB.db.GetDB().
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"tier", "updated_at", "deleted_at"}),
+		}).
+		Create(&model)
+	if res.Error != nil {
+		errMsg := res.Error.Error()
+		if strings.Contains(errMsg, "foreign key constraint") && strings.Contains(errMsg, "user") {
+			// Original error: "ERROR: insert or update on table "usertier" violates foreign key constraint "fk_usertier_user" (SQLSTATE 23503)"
+			return fmt.Errorf("%w: User ID %d", users.ErrUserDoesNotExist, userID)
+		}
+		return res.Error
+	}
+	return nil
+}
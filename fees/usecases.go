@@ -0,0 +1,159 @@
+package fees
+
+import (
+	"errors"
+	"home-broker/assets"
+	"home-broker/core"
+	"home-broker/money"
+	"home-broker/users"
+)
+
+// tierMaxLength is the maximum length of a tier name.
+const tierMaxLength = 32
+
+// FeeUseCases represents the fee use cases.
+type FeeUseCases struct {
+	db      FeeDBInterface
+	assetUC assets.AssetUseCases
+	userUC  users.UserUseCases
+}
+
+// NewFeeUseCases returns a new FeeUseCases.
+func NewFeeUseCases(db FeeDBInterface, assetUC assets.AssetUseCases, userUC users.UserUseCases) FeeUseCases {
+	return FeeUseCases{db: db, assetUC: assetUC, userUC: userUC}
+}
+
+// GetSchedule returns the fee schedule of an asset and tier.
+// Empty values are the schedules of all the assets or tiers.
+// A nil entity will be returned if it does not exist.
+func (uc FeeUseCases) GetSchedule(assetID assets.AssetID, tier Tier) (*FeeSchedule, error) {
+	return uc.db.GetSchedule(assetID, tier)
+}
+
+// SetSchedule creates or changes the fee schedule of an asset and tier.
+// Empty values are the schedules of all the assets or tiers.
+// This is an admin operation.
+func (uc FeeUseCases) SetSchedule(assetID assets.AssetID, tier Tier, components []FeeComponent) (*FeeSchedule, error) {
+	if len(tier) > tierMaxLength {
+		return nil, core.NewErrValidation("Invalid tier.")
+	}
+	if assetID != "" {
+		asset, err := uc.assetUC.GetAsset(assetID)
+		if err != nil {
+			return nil, err
+		}
+		if asset == nil {
+			return nil, core.NewErrValidation("Asset does not exist.")
+		}
+	}
+	for _, component := range components {
+		err := validateComponent(component)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return uc.db.Upsert(NewFeeSchedule(assetID, tier, components))
+}
+
+// validateComponent returns an ErrValidation if a fee component is not valid.
+func validateComponent(c FeeComponent) error {
+	if c.Amount < 0 || !validBasisPoints(c.BasisPoints) || !validBasisPoints(c.MakerBasisPoints) || !validBasisPoints(c.TakerBasisPoints) {
+		return core.NewErrValidation("Invalid fee value.")
+	}
+	switch c.Type {
+	case FeeTypeFixed, FeeTypePercentage, FeeTypeMakerTaker, FeeTypePassThrough:
+		return nil
+	case FeeTypeTiered:
+		if len(c.Brackets) == 0 {
+			return core.NewErrValidation("A tiered fee needs brackets.")
+		}
+		for i, bracket := range c.Brackets {
+			if !validBasisPoints(bracket.BasisPoints) || bracket.UpTo < 0 {
+				return core.NewErrValidation("Invalid fee bracket.")
+			}
+			last := i == len(c.Brackets)-1
+			if bracket.UpTo == 0 && !last {
+				return core.NewErrValidation("Only the last fee bracket can have no limit.")
+			}
+			if i > 0 && bracket.UpTo != 0 && bracket.UpTo <= c.Brackets[i-1].UpTo {
+				return core.NewErrValidation("The fee brackets must be sorted.")
+			}
+		}
+		return nil
+	}
+	return core.NewErrValidation("Invalid fee type.")
+}
+
+// validBasisPoints returns true if a rate is between 0 and 100% (BasisPointsBase).
+func validBasisPoints(bps int64) bool {
+	return bps >= 0 && bps <= BasisPointsBase
+}
+
+// GetUserTier returns the tier of an user (TierDefault if the user has no tier).
+func (uc FeeUseCases) GetUserTier(userID users.UserID) (Tier, error) {
+	if userID <= 0 {
+		return "", core.NewErrValidation("Invalid user ID.")
+	}
+	tier, err := uc.db.GetUserTier(userID)
+	if err != nil {
+		return "", err
+	}
+	if tier == "" {
+		return TierDefault, nil
+	}
+	return tier, nil
+}
+
+// SetUserTier changes the tier of an user.
+// The user is created if it does not exist.
+// This is an admin operation.
+func (uc FeeUseCases) SetUserTier(userID users.UserID, tier Tier) error {
+	if userID <= 0 {
+		return core.NewErrValidation("Invalid user ID.")
+	}
+	if tier == "" || len(tier) > tierMaxLength {
+		return core.NewErrValidation("Invalid tier.")
+	}
+	_, _, err := uc.userUC.GetUser(userID) // forces user creation
+	if err != nil {
+		return err
+	}
+	err = uc.db.SetUserTier(userID, tier)
+	if errors.Is(err, users.ErrUserDoesNotExist) {
+		return core.NewErrValidation("User does not exist.")
+	}
+	return err
+}
+
+// GetUserSchedule returns the fee schedule applied to the trades of an user on an asset (see SelectSchedule).
+// A nil entity will be returned if no schedule applies (no fees).
+func (uc FeeUseCases) GetUserSchedule(userID users.UserID, assetID assets.AssetID) (*FeeSchedule, error) {
+	tier, err := uc.GetUserTier(userID)
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := uc.db.GetSchedules(assetID, tier)
+	if err != nil {
+		return nil, err
+	}
+	return SelectSchedule(schedules, assetID, tier), nil
+}
+
+// TradeFee returns the fee charged to an user on a trade of an asset.
+func (uc FeeUseCases) TradeFee(userID users.UserID, assetID assets.AssetID, trade Trade) (money.Money, error) {
+	schedule, err := uc.GetUserSchedule(userID, assetID)
+	if err != nil || schedule == nil {
+		return 0, err
+	}
+	return schedule.Fee(trade), nil
+}
+
+// MaxFee returns the highest fee that an user can be charged on a trade value of an asset (see FeeSchedule.MaxFee).
+// It is held with the funds of the buying orders.
+func (uc FeeUseCases) MaxFee(userID users.UserID, assetID assets.AssetID, value money.Money) (money.Money, error) {
+	schedule, err := uc.GetUserSchedule(userID, assetID)
+	if err != nil || schedule == nil {
+		return 0, err
+	}
+	return schedule.MaxFee(value), nil
+}
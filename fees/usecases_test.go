@@ -0,0 +1,53 @@
+package fees_test
+
+import (
+	"home-broker/assets"
+	"home-broker/core"
+	"home-broker/fees"
+	"home-broker/tests/fees/mocks"
+	"home-broker/users"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestSetSchedule_InvalidBasisPoints_ErrValidation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockFeeDBInterface(mockCtrl)
+	uc := fees.NewFeeUseCases(mockDB, assets.AssetUseCases{}, users.UserUseCases{})
+
+	components := map[string]fees.FeeComponent{
+		"percentage": {Name: "brokerage", Type: fees.FeeTypePercentage, BasisPoints: fees.BasisPointsBase + 1},
+		"maker":      {Name: "brokerage", Type: fees.FeeTypeMakerTaker, MakerBasisPoints: fees.BasisPointsBase + 1},
+		"taker":      {Name: "brokerage", Type: fees.FeeTypeMakerTaker, TakerBasisPoints: fees.BasisPointsBase + 1},
+		"negative":   {Name: "brokerage", Type: fees.FeeTypePercentage, BasisPoints: -1},
+		"bracket": {Name: "brokerage", Type: fees.FeeTypeTiered, Brackets: []fees.FeeBracket{
+			{UpTo: 1000000000, BasisPoints: 10}, {BasisPoints: fees.BasisPointsBase + 1},
+		}},
+	}
+	for name, component := range components {
+		t.Run(name, func(t *testing.T) {
+			_, err := uc.SetSchedule("", fees.TierDefault, []fees.FeeComponent{component})
+			if _, ok := err.(core.ErrValidation); !ok {
+				t.Errorf("error is %v, expected ErrValidation", err)
+			}
+		})
+	}
+}
+
+func TestSetSchedule_FullRate_Saved(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockFeeDBInterface(mockCtrl)
+	uc := fees.NewFeeUseCases(mockDB, assets.AssetUseCases{}, users.UserUseCases{})
+
+	component := fees.FeeComponent{Name: "brokerage", Type: fees.FeeTypePercentage, BasisPoints: fees.BasisPointsBase}
+	schedule := fees.NewFeeSchedule("", fees.TierDefault, []fees.FeeComponent{component})
+	mockDB.EXPECT().Upsert(schedule).Return(&schedule, nil)
+
+	_, err := uc.SetSchedule("", fees.TierDefault, []fees.FeeComponent{component})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/gin-gonic/gin v1.6.3
 	github.com/golang/mock v1.4.4
+	github.com/jackc/pgx/v4 v4.8.1
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/shopspring/decimal v0.0.0-20200227202807-02e2044944cc
 	github.com/spf13/cobra v1.0.0
@@ -0,0 +1,79 @@
+package money
+
+import (
+	"errors"
+	"home-broker/assets"
+	"math/big"
+)
+
+// RoundingMode represents how a value is rounded to the Money precision.
+// Use the value of RoundDown, RoundUp, RoundHalfUp or RoundHalfEven to set this data type.
+type RoundingMode int
+
+const (
+	// RoundDown truncates the value (towards zero). Ex: credits that must not exceed the exact value.
+	RoundDown RoundingMode = iota
+
+	// RoundUp rounds the value away from zero. Ex: holds that must cover the exact value.
+	RoundUp
+
+	// RoundHalfUp rounds the value to the nearest one, and the halves away from zero.
+	RoundHalfUp
+
+	// RoundHalfEven rounds the value to the nearest one, and the halves to the even one (banker's rounding).
+	RoundHalfEven
+)
+
+var (
+	// ErrOverflow happens when a value does not fit in Money.
+	ErrOverflow = errors.New("money overflow")
+
+	// ErrInvalidRoundingMode happens when a rounding mode is unknown.
+	ErrInvalidRoundingMode = errors.New("invalid rounding mode")
+)
+
+// Notional returns the value of a quantity of an asset at a price (price * quantity).
+// Both values have implied decimals (see MoneyDecimalPlaces and assets.AssetUnitDecimalPlaces), so the product
+// is scaled back to the Money precision and rounded with "mode".
+// Ex: $10.50 * 2.5 units = Notional(10500000, 2500000) = 26250000 ($26.25).
+// The following errors can happen: ErrOverflow, ErrInvalidRoundingMode.
+func Notional(price Money, quantity assets.AssetUnit, mode RoundingMode) (Money, error) {
+	product := new(big.Int).Mul(big.NewInt(int64(price)), big.NewInt(int64(quantity)))
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(assets.AssetUnitDecimalPlaces)), nil)
+	value, err := divRound(product, scale, mode)
+	if err != nil {
+		return 0, err
+	}
+	if !value.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return Money(value.Int64()), nil
+}
+
+// divRound returns n / d (d > 0) rounded with "mode".
+func divRound(n *big.Int, d *big.Int, mode RoundingMode) (*big.Int, error) {
+	// QuoRem truncates towards zero, so the remainder has the sign of "n".
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if r.Sign() == 0 {
+		return q, nil
+	}
+	away := big.NewInt(int64(n.Sign())) // The next value away from zero is q + sign.
+	// cmp compares twice the remainder with the divisor: -1 below the half, 0 on the half, 1 above it.
+	cmp := new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).Cmp(d)
+	switch mode {
+	case RoundDown:
+	case RoundUp:
+		q.Add(q, away)
+	case RoundHalfUp:
+		if cmp >= 0 {
+			q.Add(q, away)
+		}
+	case RoundHalfEven:
+		if cmp > 0 || (cmp == 0 && q.Bit(0) == 1) {
+			q.Add(q, away)
+		}
+	default:
+		return nil, ErrInvalidRoundingMode
+	}
+	return q, nil
+}
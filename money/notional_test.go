@@ -0,0 +1,54 @@
+package money_test
+
+import (
+	"errors"
+	"home-broker/assets"
+	"home-broker/money"
+	"math"
+	"testing"
+)
+
+func TestNotional(t *testing.T) {
+	testTable := []struct {
+		test     string
+		price    money.Money
+		quantity assets.AssetUnit
+		mode     money.RoundingMode
+		expected money.Money
+		err      error
+	}{
+		// $10.50 * 2.5 units = $26.25
+		{test: "Exact", price: 10500000, quantity: 2500000, mode: money.RoundDown, expected: 26250000},
+		// $999.00 * 100 units = $99,900.00 (the old "price * amount" was 10^6 times bigger)
+		{test: "Realistic", price: 999000000, quantity: 100000000, mode: money.RoundHalfEven, expected: 99900000000},
+		// $0.000001 * 0.4 units = 0.0000004
+		{test: "DownBelowHalf", price: 1, quantity: 400000, mode: money.RoundDown, expected: 0},
+		{test: "UpBelowHalf", price: 1, quantity: 400000, mode: money.RoundUp, expected: 1},
+		{test: "HalfUpBelowHalf", price: 1, quantity: 400000, mode: money.RoundHalfUp, expected: 0},
+		// $0.000001 * 0.5 units = 0.0000005
+		{test: "HalfUpOnHalf", price: 1, quantity: 500000, mode: money.RoundHalfUp, expected: 1},
+		{test: "HalfEvenOnHalfToZero", price: 1, quantity: 500000, mode: money.RoundHalfEven, expected: 0},
+		// $0.000003 * 0.5 units = 0.0000015
+		{test: "HalfEvenOnHalfToTwo", price: 3, quantity: 500000, mode: money.RoundHalfEven, expected: 2},
+		// $0.000001 * 0.6 units = 0.0000006
+		{test: "HalfEvenAboveHalf", price: 1, quantity: 600000, mode: money.RoundHalfEven, expected: 1},
+		// -$0.000001 * 0.5 units = -0.0000005
+		{test: "NegativeUp", price: -1, quantity: 500000, mode: money.RoundUp, expected: -1},
+		{test: "NegativeDown", price: -1, quantity: 500000, mode: money.RoundDown, expected: 0},
+		// The product overflows int64, but the value fits in Money.
+		{test: "BigProduct", price: 1000000000000000, quantity: 9000000000, mode: money.RoundDown, expected: 9000000000000000000},
+		{test: "Overflow", price: math.MaxInt64, quantity: 2000000, mode: money.RoundDown, err: money.ErrOverflow},
+		{test: "InvalidMode", price: 1, quantity: 500000, mode: money.RoundingMode(99), err: money.ErrInvalidRoundingMode},
+	}
+	for _, table := range testTable {
+		t.Run(table.test, func(t *testing.T) {
+			value, err := money.Notional(table.price, table.quantity, table.mode)
+			if !errors.Is(err, table.err) {
+				t.Fatalf("err is %v, expected %v", err, table.err)
+			}
+			if value != table.expected {
+				t.Errorf("value is %v, expected %v", value, table.expected)
+			}
+		})
+	}
+}
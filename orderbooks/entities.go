@@ -4,11 +4,32 @@ import (
 	"home-broker/assets"
 	"home-broker/money"
 	"home-broker/orders"
+	"home-broker/pricebands"
 	"log"
+	"sort"
 	"sync"
 	"time"
 )
 
+type (
+	// Phase represents the trading phase of an order book.
+	// Use the value of PhaseContinuous, PhaseAuction or PhaseClosed to set this data type.
+	Phase string
+)
+
+const (
+	// PhaseContinuous is the phase where orders are matched as soon as they cross.
+	PhaseContinuous Phase = "continuous"
+
+	// PhaseAuction is a call auction phase (ex: opening and closing auctions).
+	// Orders accumulate without matching until the uncross.
+	PhaseAuction Phase = "auction"
+
+	// PhaseClosed is when the exchange session is closed.
+	// The updates are still applied, but orders are not matched.
+	PhaseClosed Phase = "closed"
+)
+
 // Order holds an order sent by an exchange service.
 // This not the same as "orders.Order".
 type Order struct {
@@ -46,6 +67,23 @@ type TradeRequest struct {
 	Amount          assets.AssetUnit
 }
 
+// AuctionResult holds the equilibrium price and volume of a call auction.
+type AuctionResult struct {
+	Price  money.Money      `json:"price"`
+	Volume assets.AssetUnit `json:"volume"`
+	// Imbalance is the amount left after the uncross.
+	// A positive value is a buying surplus and a negative value is a selling surplus.
+	Imbalance assets.AssetUnit `json:"imbalance"`
+}
+
+// Fill is an execution generated by an auction uncross.
+type Fill struct {
+	BuyOrder  Order            `json:"buy_order"`
+	SellOrder Order            `json:"sell_order"`
+	Price     money.Money      `json:"price"`
+	Amount    assets.AssetUnit `json:"amount"`
+}
+
 // PriceLevelOrder is a struct for an order inside OrderBookPriceLevel.
 type PriceLevelOrder struct {
 	Left  *PriceLevelOrder
@@ -82,6 +120,54 @@ func (pl PriceLevel) BetterOfferThan(priceLevel PriceLevel) bool {
 	return false
 }
 
+// CircuitBreaker halts the matching of an order book when the price moves too much in a time window.
+type CircuitBreaker struct {
+	// ThresholdBasisPoints is the maximum price movement inside the window. Ex: 1000 = 10%.
+	ThresholdBasisPoints int64
+	// Window is the time window used to compare the trade prices.
+	Window time.Duration
+	// Cooldown is the time the order book stays halted. A zero value waits for an admin command.
+	Cooldown time.Duration
+
+	trades []breakerTrade // trades inside of the window, oldest first
+}
+
+// breakerTrade is a trade price seen by the CircuitBreaker.
+type breakerTrade struct {
+	price     money.Money
+	timestamp time.Time
+}
+
+// NewCircuitBreaker creates a new CircuitBreaker.
+func NewCircuitBreaker(thresholdBasisPoints int64, window time.Duration, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{ThresholdBasisPoints: thresholdBasisPoints, Window: window, Cooldown: cooldown}
+}
+
+// RecordTrade adds a trade into the window and returns true if the price moved beyond the threshold.
+func (cb *CircuitBreaker) RecordTrade(price money.Money, timestamp time.Time) bool {
+	// Drops the trades outside of the window.
+	start := 0
+	for start < len(cb.trades) && timestamp.Sub(cb.trades[start].timestamp) > cb.Window {
+		start++
+	}
+	cb.trades = append(cb.trades[start:], breakerTrade{price: price, timestamp: timestamp})
+
+	for _, trade := range cb.trades {
+		// The price must stay inside of a band of the threshold around each trade of the window.
+		band := pricebands.PriceBand{ReferencePrice: trade.price, BasisPoints: cb.ThresholdBasisPoints}
+		if !band.Allows(price) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset forgets the trades inside of the window.
+// This avoids halting the order book again with the same trades after a resume.
+func (cb *CircuitBreaker) Reset() {
+	cb.trades = nil
+}
+
 // OrderBook holds the buying and selling orders of an asset.
 type OrderBook struct {
 	// Only one goroutine can perfom operations in this Order Book at time.
@@ -99,6 +185,20 @@ type OrderBook struct {
 	PriceLevelsByPrices map[orders.OrderType]map[money.Money]*PriceLevel
 	PriceLevelsHeads    map[orders.OrderType]*PriceLevel // linked list for buying and selling
 	OrdersCount         map[orders.OrderType]int64
+
+	// CircuitBreaker halts the matching on big price movements. A nil value disables it.
+	CircuitBreaker *CircuitBreaker
+
+	// Halted indicates that the matching is paused. The updates are still applied.
+	Halted bool
+	// HaltedUntil is when a halted order book resumes by itself. A zero value waits for an admin command.
+	HaltedUntil time.Time
+
+	// Phase is the current trading phase.
+	Phase Phase
+
+	// LastTradePrice is the price of the last trade. It is the reference price of the auctions.
+	LastTradePrice money.Money
 }
 
 // NewOrderBook creates a new OrderBook.
@@ -112,6 +212,7 @@ func NewOrderBook(assetID assets.AssetID) *OrderBook {
 		},
 		PriceLevelsHeads: make(map[orders.OrderType]*PriceLevel),
 		OrdersCount:      make(map[orders.OrderType]int64),
+		Phase:            PhaseContinuous,
 	}
 	return &ob
 }
@@ -162,7 +263,27 @@ func (ob *OrderBook) addNewPriceLevel(order Order) *PriceLevel {
 	return priceLevel
 }
 
+// removePriceLevel removes an empty PriceLevel from the OrderBook.
+func (ob *OrderBook) removePriceLevel(priceLevel *PriceLevel) {
+	if priceLevel.Left == nil { // head
+		ob.PriceLevelsHeads[priceLevel.Type] = priceLevel.Right
+	} else {
+		priceLevel.Left.Right = priceLevel.Right
+	}
+	if priceLevel.Right != nil {
+		priceLevel.Right.Left = priceLevel.Left
+	}
+	priceLevel.Left = nil
+	priceLevel.Right = nil
+	delete(ob.PriceLevelsByPrices[priceLevel.Type], priceLevel.Price)
+}
+
 func (ob *OrderBook) addNewPriceLevelOrder(order Order) *PriceLevelOrder {
+	plOrder := ob.OrdersByOrderID[order.ID] // this ID is an external ID
+	if plOrder != nil {
+		return nil
+	}
+
 	priceLevel, _ := ob.PriceLevelsByPrices[order.Type][order.Price]
 	if priceLevel == nil {
 		priceLevel = ob.addNewPriceLevel(order)
@@ -171,10 +292,6 @@ func (ob *OrderBook) addNewPriceLevelOrder(order Order) *PriceLevelOrder {
 	priceLevel.AmountSum += order.Amount
 	priceLevel.OrdersCount++
 
-	plOrder := ob.OrdersByOrderID[order.ID] // this ID is an external ID
-	if plOrder != nil {
-		return nil
-	}
 	plOrder = &PriceLevelOrder{Order: order}
 	ob.OrdersByOrderID[plOrder.Order.ID] = plOrder
 	ob.OrdersCount[order.Type]++
@@ -216,8 +333,16 @@ func (ob *OrderBook) AddOrder(order Order) *TradeRequest {
 	return ob.checksIfMatchs(newPLOrder)
 }
 
+// Match checks if the best buying and selling orders have a match.
+func (ob *OrderBook) Match() *TradeRequest {
+	return ob.checksIfMatchs(nil)
+}
+
 // checksIfMatchs checks if order has a match.
 func (ob *OrderBook) checksIfMatchs(plOrder *PriceLevelOrder) *TradeRequest {
+	if ob.Halted || ob.Phase != PhaseContinuous {
+		return nil
+	}
 	firstBuyPL := ob.PriceLevelsHeads[orders.OrderTypeBuy]
 	firstSellPL := ob.PriceLevelsHeads[orders.OrderTypeSell]
 	if firstBuyPL == nil || firstBuyPL.OrderHead == nil {
@@ -275,26 +400,92 @@ func (ob *OrderBook) checksIfMatchs(plOrder *PriceLevelOrder) *TradeRequest {
 
 // DecOrderAmount decrement an order amount.
 func (ob *OrderBook) DecOrderAmount(order Order) {
-	plOrder := ob.OrdersByOrderID[order.ID]
+	ob.decOrderAmount(order.ID, order.Amount)
+}
+
+// decOrderAmount decrement an order amount by the external order ID.
+func (ob *OrderBook) decOrderAmount(orderID orders.ExternalOrderID, amount assets.AssetUnit) {
+	plOrder := ob.OrdersByOrderID[orderID]
 	if plOrder == nil {
 		return
 	}
 	plOrder.Order.InTrade = false
-	plOrder.Order.Amount -= order.Amount
+	if amount > plOrder.Order.Amount {
+		amount = plOrder.Order.Amount
+	}
+	plOrder.Order.Amount -= amount
+	priceLevel := ob.PriceLevelsByPrices[plOrder.Order.Type][plOrder.Order.Price]
+	if priceLevel != nil {
+		priceLevel.AmountSum -= amount
+	}
 	if plOrder.Order.Amount <= 0 {
-		ob.RemoveOrder(order)
+		ob.RemoveOrder(plOrder.Order)
+	}
+}
+
+// RecordTrade feeds the circuit breaker with a trade.
+// The order book is halted if the trade moves the price beyond the threshold.
+// Returns true if the order book was halted by this trade.
+func (ob *OrderBook) RecordTrade(price money.Money, timestamp time.Time) bool {
+	ob.LastTradePrice = price
+	if ob.CircuitBreaker == nil || ob.Halted {
+		return false
+	}
+	if !ob.CircuitBreaker.RecordTrade(price, timestamp) {
+		return false
+	}
+	until := time.Time{}
+	if ob.CircuitBreaker.Cooldown > 0 {
+		until = timestamp.Add(ob.CircuitBreaker.Cooldown)
+	}
+	ob.Halt(until)
+	log.Printf("Order book halted by the circuit breaker! price $%v at %v (until %v)", price, timestamp, until)
+	return true
+}
+
+// Halt pauses the matching until the time "until".
+// A zero "until" keeps the order book halted until Resume is called.
+func (ob *OrderBook) Halt(until time.Time) {
+	ob.Halted = true
+	ob.HaltedUntil = until
+}
+
+// Resume restarts the matching.
+// Returns a trade request if the best orders have a match.
+func (ob *OrderBook) Resume() *TradeRequest {
+	ob.resume()
+	return ob.Match()
+}
+
+// ResumeIfCooledDown resumes the order book if the halt has expired at "now".
+// Returns true if the order book was resumed.
+func (ob *OrderBook) ResumeIfCooledDown(now time.Time) bool {
+	if !ob.Halted || ob.HaltedUntil.IsZero() || now.Before(ob.HaltedUntil) {
+		return false
+	}
+	ob.resume()
+	return true
+}
+
+// resume clears the halt state.
+func (ob *OrderBook) resume() {
+	ob.Halted = false
+	ob.HaltedUntil = time.Time{}
+	if ob.CircuitBreaker != nil {
+		ob.CircuitBreaker.Reset()
 	}
 }
 
 // RemoveOrder removes an order from the OrderBook.
 func (ob *OrderBook) RemoveOrder(order Order) {
-	priceLevel, _ := ob.PriceLevelsByPrices[order.Type][order.Price]
-	if priceLevel == nil {
+	plOrder := ob.OrdersByOrderID[order.ID]
+	if plOrder == nil {
 		return
 	}
 
-	plOrder := ob.OrdersByOrderID[order.ID]
-	if plOrder == nil {
+	// The order inside the book is the source of truth for the price and type.
+	priceLevel, _ := ob.PriceLevelsByPrices[plOrder.Order.Type][plOrder.Order.Price]
+	if priceLevel == nil {
 		return
 	}
 
@@ -312,9 +503,152 @@ func (ob *OrderBook) RemoveOrder(order Order) {
 	plOrder.Right = nil
 
 	delete(ob.OrdersByOrderID, order.ID)
-	ob.OrdersCount[order.Type]--
-	priceLevel.AmountSum -= order.Amount
+	ob.OrdersCount[plOrder.Order.Type]--
+	priceLevel.AmountSum -= plOrder.Order.Amount
 	priceLevel.OrdersCount--
+
+	if priceLevel.OrderHead == nil {
+		// An empty price level would hide the next best price.
+		ob.removePriceLevel(priceLevel)
+	}
+}
+
+// SetPhase changes the trading phase.
+// Changing to PhaseAuction does not uncross the book. Call Uncross before leaving an auction.
+func (ob *OrderBook) SetPhase(phase Phase) {
+	ob.Phase = phase
+}
+
+// IndicativeUncross returns the equilibrium price and volume if the auction uncrossed now.
+// The price maximises the executed volume. The tie-breaks are, in this order:
+//  - the minimum imbalance;
+//  - the market pressure (highest price for a buying surplus, lowest price for a selling surplus);
+//  - the closest price to the last trade price;
+//  - the lowest price.
+// A zero volume result means that the book does not cross.
+func (ob *OrderBook) IndicativeUncross() AuctionResult {
+	buyLevels := ob.getPriceLevels(orders.OrderTypeBuy)   // highest price first
+	sellLevels := ob.getPriceLevels(orders.OrderTypeSell) // lowest price first
+	if len(buyLevels) == 0 || len(sellLevels) == 0 {
+		return AuctionResult{}
+	}
+
+	prices := make([]money.Money, 0, len(buyLevels)+len(sellLevels))
+	buyTotal := assets.NewAssetUnitZero()
+	for _, pl := range buyLevels {
+		prices = append(prices, pl.Price)
+		buyTotal += pl.AmountSum
+	}
+	for _, pl := range sellLevels {
+		prices = append(prices, pl.Price)
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i] < prices[j] })
+
+	var best AuctionResult
+	var lastPrice money.Money
+	buyBelow := assets.NewAssetUnitZero() // buying amount with a price lower than the candidate
+	sellUpTo := assets.NewAssetUnitZero() // selling amount with a price lower or equal to the candidate
+	buyIdx := len(buyLevels) - 1          // walks the buying levels from the lowest price
+	sellIdx := 0
+	for i, price := range prices {
+		if i > 0 && price == lastPrice {
+			continue
+		}
+		lastPrice = price
+		for buyIdx >= 0 && buyLevels[buyIdx].Price < price {
+			buyBelow += buyLevels[buyIdx].AmountSum
+			buyIdx--
+		}
+		for sellIdx < len(sellLevels) && sellLevels[sellIdx].Price <= price {
+			sellUpTo += sellLevels[sellIdx].AmountSum
+			sellIdx++
+		}
+		buyVolume := buyTotal - buyBelow
+		volume := buyVolume
+		if sellUpTo < volume {
+			volume = sellUpTo
+		}
+		if volume <= 0 {
+			continue
+		}
+		candidate := AuctionResult{Price: price, Volume: volume, Imbalance: buyVolume - sellUpTo}
+		if best.Volume == 0 || ob.betterAuctionResult(candidate, best) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// betterAuctionResult returns true if "a" is a better uncross than "b".
+func (ob *OrderBook) betterAuctionResult(a AuctionResult, b AuctionResult) bool {
+	if a.Volume != b.Volume {
+		return a.Volume > b.Volume
+	}
+	absA, absB := a.Imbalance, b.Imbalance
+	if absA < 0 {
+		absA = -absA
+	}
+	if absB < 0 {
+		absB = -absB
+	}
+	if absA != absB {
+		return absA < absB
+	}
+	if a.Imbalance > 0 && b.Imbalance > 0 {
+		return a.Price > b.Price
+	}
+	if a.Imbalance < 0 && b.Imbalance < 0 {
+		return a.Price < b.Price
+	}
+	if ob.LastTradePrice > 0 {
+		distA, distB := a.Price-ob.LastTradePrice, b.Price-ob.LastTradePrice
+		if distA < 0 {
+			distA = -distA
+		}
+		if distB < 0 {
+			distB = -distB
+		}
+		if distA != distB {
+			return distA < distB
+		}
+	}
+	return a.Price < b.Price
+}
+
+// Uncross executes the auction at the equilibrium price.
+// The executed amounts are removed from the book and the generated fills are returned.
+// The phase is not changed.
+func (ob *OrderBook) Uncross() (AuctionResult, []Fill) {
+	result := ob.IndicativeUncross()
+	if result.Volume <= 0 {
+		return result, nil
+	}
+
+	fills := make([]Fill, 0)
+	remaining := result.Volume
+	for remaining > 0 {
+		buyPL := ob.PriceLevelsHeads[orders.OrderTypeBuy]
+		sellPL := ob.PriceLevelsHeads[orders.OrderTypeSell]
+		if buyPL == nil || buyPL.OrderHead == nil || sellPL == nil || sellPL.OrderHead == nil {
+			break
+		}
+		buyOrder := buyPL.OrderHead.Order
+		sellOrder := sellPL.OrderHead.Order
+		amount := remaining
+		if buyOrder.Amount < amount {
+			amount = buyOrder.Amount
+		}
+		if sellOrder.Amount < amount {
+			amount = sellOrder.Amount
+		}
+		fills = append(fills, Fill{BuyOrder: buyOrder, SellOrder: sellOrder, Price: result.Price, Amount: amount})
+		ob.decOrderAmount(buyOrder.ID, amount)
+		ob.decOrderAmount(sellOrder.ID, amount)
+		remaining -= amount
+	}
+	ob.LastTradePrice = result.Price
+	log.Printf("Auction uncross! $%v - %vqty (%d fills, imbalance %v)", result.Price, result.Volume, len(fills), result.Imbalance)
+	return result, fills
 }
 
 // GetBuyOrders returns a slice of buying orders.
@@ -329,6 +663,17 @@ func (ob *OrderBook) GetSellOrders() []Order {
 	return *orders
 }
 
+// getPriceLevels returns a slice of buying or selling price levels, best offer first.
+func (ob *OrderBook) getPriceLevels(orderType orders.OrderType) []*PriceLevel {
+	priceLevels := make([]*PriceLevel, 0, len(ob.PriceLevelsByPrices[orderType]))
+	currPriceLevel := ob.PriceLevelsHeads[orderType]
+	for currPriceLevel != nil {
+		priceLevels = append(priceLevels, currPriceLevel)
+		currPriceLevel = currPriceLevel.Right
+	}
+	return priceLevels
+}
+
 // getOrders returns a slice of buying or selling orders.
 func (ob *OrderBook) getOrders(orderType orders.OrderType) *[]Order {
 	currPriceLevel := ob.PriceLevelsHeads[orderType]
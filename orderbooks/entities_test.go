@@ -252,3 +252,260 @@ func BenchmarkOderBookSnapshots(b *testing.B) {
 		_ = ob.GetSellOrders()
 	}
 }
+
+func TestOrderBookRecordTrade_PriceMovesBeyondThreshold_Halted(t *testing.T) {
+	exTime := orderstests.BaseTime
+	ob := orderbooks.NewOrderBook(assets.AssetID("VIBR"))
+	ob.CircuitBreaker = orderbooks.NewCircuitBreaker(1000, time.Minute, time.Minute) // 10%
+
+	if ob.RecordTrade(money.Money(100), exTime) {
+		t.Errorf("order book halted on the first trade")
+	}
+	if ob.RecordTrade(money.Money(109), exTime.Add(10*time.Second)) {
+		t.Errorf("order book halted inside of the threshold")
+	}
+	if !ob.RecordTrade(money.Money(111), exTime.Add(20*time.Second)) {
+		t.Errorf("order book not halted, expected as halted")
+	}
+	if !ob.Halted {
+		t.Errorf("ob.Halted is false, expected true")
+	}
+	expectedUntil := exTime.Add(20 * time.Second).Add(time.Minute)
+	if !ob.HaltedUntil.Equal(expectedUntil) {
+		t.Errorf("ob.HaltedUntil is %v, expected %v", ob.HaltedUntil, expectedUntil)
+	}
+}
+
+func TestOrderBookRecordTrade_PriceMovesOutsideOfWindow_NotHalted(t *testing.T) {
+	exTime := orderstests.BaseTime
+	ob := orderbooks.NewOrderBook(assets.AssetID("VIBR"))
+	ob.CircuitBreaker = orderbooks.NewCircuitBreaker(1000, time.Minute, time.Minute) // 10%
+
+	ob.RecordTrade(money.Money(100), exTime)
+	if ob.RecordTrade(money.Money(120), exTime.Add(2*time.Minute)) {
+		t.Errorf("order book halted, expected as not halted")
+	}
+}
+
+func TestCircuitBreakerRecordTrade_BigPrices_ExactThreshold(t *testing.T) {
+	exTime := orderstests.BaseTime
+	// 10% of the reference is 90071992547409930. Float values lose the last digits of these prices.
+	reference := money.Money(900719925474099300)
+	limit := reference + 90071992547409930
+
+	cb := orderbooks.NewCircuitBreaker(1000, time.Minute, time.Minute)
+	cb.RecordTrade(reference, exTime)
+	if cb.RecordTrade(limit, exTime.Add(time.Second)) {
+		t.Errorf("circuit breaker tripped at the threshold")
+	}
+
+	cb = orderbooks.NewCircuitBreaker(1000, time.Minute, time.Minute)
+	cb.RecordTrade(reference, exTime)
+	if !cb.RecordTrade(limit+1, exTime.Add(time.Second)) {
+		t.Errorf("circuit breaker not tripped beyond the threshold")
+	}
+}
+
+func TestOrderBookHalted_NoMatchUntilResume(t *testing.T) {
+	exTime := orderstests.BaseTime
+	ob := orderbooks.NewOrderBook(assets.AssetID("VIBR"))
+	ob.Halt(exTime.Add(time.Minute))
+
+	match := ob.AddOrder(orderbooks.Order{Mine: true, ID: "ex1", Type: orders.OrderTypeBuy, Price: 1, Amount: 1, Timestamp: exTime})
+	if match != nil {
+		t.Errorf("nil expected, found %v", match)
+	}
+	match = ob.AddOrder(orderbooks.Order{ID: "ex2", Type: orders.OrderTypeSell, Price: 1, Amount: 1, Timestamp: exTime})
+	if match != nil {
+		t.Errorf("nil expected while halted, found %v", match)
+	}
+	if len(ob.GetSellOrders()) != 1 {
+		t.Errorf("the update was not applied while halted")
+	}
+
+	if ob.ResumeIfCooledDown(exTime.Add(30 * time.Second)) {
+		t.Errorf("order book resumed before the cooldown")
+	}
+	if !ob.ResumeIfCooledDown(exTime.Add(time.Minute)) {
+		t.Errorf("order book not resumed after the cooldown")
+	}
+	match = ob.Match()
+	if match == nil {
+		t.Errorf("match expected after resume, found nil")
+	}
+}
+
+func TestOrderBookHalt_ZeroUntil_WaitsForResume(t *testing.T) {
+	ob := orderbooks.NewOrderBook(assets.AssetID("VIBR"))
+	ob.Halt(time.Time{})
+	if ob.ResumeIfCooledDown(time.Now().Add(24 * time.Hour)) {
+		t.Errorf("order book resumed by itself, expected to wait for an admin")
+	}
+	ob.Resume()
+	if ob.Halted {
+		t.Errorf("ob.Halted is true, expected false")
+	}
+}
+
+func TestOrderBookRemoveOrder_EmptyPriceLevel_NextPriceLevelMatches(t *testing.T) {
+	exTime := orderstests.BaseTime
+	ob := orderbooks.NewOrderBook(assets.AssetID("VIBR"))
+	ob.AddOrder(orderbooks.Order{ID: "ex1", Type: orders.OrderTypeSell, Price: 1, Amount: 1, Timestamp: exTime})
+	ob.AddOrder(orderbooks.Order{ID: "ex2", Type: orders.OrderTypeSell, Price: 2, Amount: 1, Timestamp: exTime})
+	ob.RemoveOrder(orderbooks.Order{ID: "ex1"})
+
+	match := ob.AddOrder(orderbooks.Order{Mine: true, ID: "ex3", Type: orders.OrderTypeBuy, Price: 2, Amount: 1, Timestamp: exTime})
+	if match == nil {
+		t.Fatalf("match expected, found nil")
+	}
+	if match.InterestOrder.ID != "ex2" {
+		t.Errorf("expected ID ex2, received %v", match.InterestOrder.ID)
+	}
+}
+
+func TestOrderBookAuction_NoMatchDuringAuction(t *testing.T) {
+	exTime := orderstests.BaseTime
+	ob := orderbooks.NewOrderBook(assets.AssetID("VIBR"))
+	ob.SetPhase(orderbooks.PhaseAuction)
+	ob.AddOrder(orderbooks.Order{Mine: true, ID: "ex1", Type: orders.OrderTypeBuy, Price: 10, Amount: 5, Timestamp: exTime})
+	match := ob.AddOrder(orderbooks.Order{ID: "ex2", Type: orders.OrderTypeSell, Price: 9, Amount: 5, Timestamp: exTime})
+	if match != nil {
+		t.Errorf("nil expected during auction, found %v", match)
+	}
+}
+
+func TestOrderBookIndicativeUncross(t *testing.T) {
+	exTime := orderstests.BaseTime
+	testTable := []struct {
+		test      string
+		orders    []orderbooks.Order
+		lastTrade money.Money
+		expected  orderbooks.AuctionResult
+	}{
+		{
+			test: "MaximumVolume",
+			orders: []orderbooks.Order{
+				{ID: "b1", Type: orders.OrderTypeBuy, Price: 12, Amount: 10},
+				{ID: "b2", Type: orders.OrderTypeBuy, Price: 11, Amount: 10},
+				{ID: "b3", Type: orders.OrderTypeBuy, Price: 10, Amount: 10},
+				{ID: "s1", Type: orders.OrderTypeSell, Price: 9, Amount: 5},
+				{ID: "s2", Type: orders.OrderTypeSell, Price: 10, Amount: 10},
+				{ID: "s3", Type: orders.OrderTypeSell, Price: 11, Amount: 10},
+			},
+			// 10 -> buy 30, sell 15 = 15 | 11 -> buy 20, sell 25 = 20 | 12 -> buy 10, sell 25 = 10
+			expected: orderbooks.AuctionResult{Price: 11, Volume: 20, Imbalance: -5},
+		},
+		{
+			test: "MinimumImbalance",
+			orders: []orderbooks.Order{
+				{ID: "b1", Type: orders.OrderTypeBuy, Price: 11, Amount: 10},
+				{ID: "b2", Type: orders.OrderTypeBuy, Price: 10, Amount: 5},
+				{ID: "s1", Type: orders.OrderTypeSell, Price: 10, Amount: 10},
+				{ID: "s2", Type: orders.OrderTypeSell, Price: 11, Amount: 3},
+			},
+			// 10 -> buy 15, sell 10 = 10 (imbalance 5) | 11 -> buy 10, sell 13 = 10 (imbalance -3)
+			expected: orderbooks.AuctionResult{Price: 11, Volume: 10, Imbalance: -3},
+		},
+		{
+			test: "BuyingPressure_HighestPrice",
+			orders: []orderbooks.Order{
+				{ID: "b1", Type: orders.OrderTypeBuy, Price: 12, Amount: 20},
+				{ID: "s1", Type: orders.OrderTypeSell, Price: 10, Amount: 10},
+			},
+			expected: orderbooks.AuctionResult{Price: 12, Volume: 10, Imbalance: 10},
+		},
+		{
+			test: "SellingPressure_LowestPrice",
+			orders: []orderbooks.Order{
+				{ID: "b1", Type: orders.OrderTypeBuy, Price: 12, Amount: 10},
+				{ID: "s1", Type: orders.OrderTypeSell, Price: 10, Amount: 20},
+			},
+			expected: orderbooks.AuctionResult{Price: 10, Volume: 10, Imbalance: -10},
+		},
+		{
+			test: "NoImbalance_ClosestToLastTrade",
+			orders: []orderbooks.Order{
+				{ID: "b1", Type: orders.OrderTypeBuy, Price: 12, Amount: 10},
+				{ID: "s1", Type: orders.OrderTypeSell, Price: 10, Amount: 10},
+			},
+			lastTrade: 13,
+			expected:  orderbooks.AuctionResult{Price: 12, Volume: 10, Imbalance: 0},
+		},
+		{
+			test: "NoCross",
+			orders: []orderbooks.Order{
+				{ID: "b1", Type: orders.OrderTypeBuy, Price: 9, Amount: 10},
+				{ID: "s1", Type: orders.OrderTypeSell, Price: 10, Amount: 10},
+			},
+			expected: orderbooks.AuctionResult{},
+		},
+	}
+	for _, table := range testTable {
+		t.Run(table.test, func(t *testing.T) {
+			ob := orderbooks.NewOrderBook(assets.AssetID("VIBR"))
+			ob.SetPhase(orderbooks.PhaseAuction)
+			ob.LastTradePrice = table.lastTrade
+			for _, order := range table.orders {
+				order.Timestamp = exTime
+				ob.AddOrder(order)
+			}
+			result := ob.IndicativeUncross()
+			if result != table.expected {
+				t.Errorf("result is %+v, expected %+v", result, table.expected)
+			}
+		})
+	}
+}
+
+func TestOrderBookUncross_FillsGeneratedAndRemoved(t *testing.T) {
+	exTime := orderstests.BaseTime
+	ob := orderbooks.NewOrderBook(assets.AssetID("VIBR"))
+	ob.SetPhase(orderbooks.PhaseAuction)
+	ob.AddOrder(orderbooks.Order{ID: "b1", Type: orders.OrderTypeBuy, Price: 12, Amount: 10, Timestamp: exTime})
+	ob.AddOrder(orderbooks.Order{ID: "b2", Type: orders.OrderTypeBuy, Price: 11, Amount: 10, Timestamp: exTime})
+	ob.AddOrder(orderbooks.Order{ID: "s1", Type: orders.OrderTypeSell, Price: 9, Amount: 5, Timestamp: exTime})
+	ob.AddOrder(orderbooks.Order{ID: "s2", Type: orders.OrderTypeSell, Price: 10, Amount: 10, Timestamp: exTime})
+	ob.AddOrder(orderbooks.Order{ID: "s3", Type: orders.OrderTypeSell, Price: 13, Amount: 10, Timestamp: exTime})
+
+	result, fills := ob.Uncross()
+	expected := orderbooks.AuctionResult{Price: 11, Volume: 15, Imbalance: 5}
+	if result != expected {
+		t.Errorf("result is %+v, expected %+v", result, expected)
+	}
+
+	expectedFills := []struct {
+		buyID  orders.ExternalOrderID
+		sellID orders.ExternalOrderID
+		amount assets.AssetUnit
+	}{
+		{buyID: "b1", sellID: "s1", amount: 5},
+		{buyID: "b1", sellID: "s2", amount: 5},
+		{buyID: "b2", sellID: "s2", amount: 5},
+	}
+	if len(fills) != len(expectedFills) {
+		t.Fatalf("fills has %d itens, expected %d", len(fills), len(expectedFills))
+	}
+	for i, expectedFill := range expectedFills {
+		fill := fills[i]
+		if fill.BuyOrder.ID != expectedFill.buyID || fill.SellOrder.ID != expectedFill.sellID || fill.Amount != expectedFill.amount {
+			t.Errorf("fills[%d] is %v/%v %v, expected %v/%v %v", i,
+				fill.BuyOrder.ID, fill.SellOrder.ID, fill.Amount,
+				expectedFill.buyID, expectedFill.sellID, expectedFill.amount)
+		}
+		if fill.Price != result.Price {
+			t.Errorf("fills[%d].Price is %v, expected %v", i, fill.Price, result.Price)
+		}
+	}
+
+	buyOrders := ob.GetBuyOrders()
+	if len(buyOrders) != 1 || buyOrders[0].ID != "b2" || buyOrders[0].Amount != 5 {
+		t.Errorf("buy orders are %+v, expected only b2 with amount 5", buyOrders)
+	}
+	sellOrders := ob.GetSellOrders()
+	if len(sellOrders) != 1 || sellOrders[0].ID != "s3" {
+		t.Errorf("sell orders are %+v, expected only s3", sellOrders)
+	}
+	if ob.LastTradePrice != result.Price {
+		t.Errorf("ob.LastTradePrice is %v, expected %v", ob.LastTradePrice, result.Price)
+	}
+}
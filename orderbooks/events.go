@@ -0,0 +1,46 @@
+package orderbooks
+
+import (
+	"home-broker/assets"
+	"home-broker/money"
+	"home-broker/orders"
+)
+
+// TopicTrades is the topic of the matches of the orders of this home broker, to be requested to the exchange.
+const TopicTrades = "orderbooks.trades"
+
+// TradeEvent is the payload of TopicTrades.
+type TradeEvent struct {
+	AssetID   assets.AssetID   `json:"asset_id"`
+	BuyOrder  Order            `json:"buy_order"`
+	SellOrder Order            `json:"sell_order"`
+	Price     money.Money      `json:"price,omitempty"` // Only on the auction fills (the equilibrium price).
+	Amount    assets.AssetUnit `json:"amount"`
+	Auction   bool             `json:"auction"`
+}
+
+// NewTradeEventFromRequest creates a TradeEvent of a match of the continuous phase.
+func NewTradeEventFromRequest(tradeRequest TradeRequest) TradeEvent {
+	event := TradeEvent{
+		AssetID:   tradeRequest.InterestedOrder.AssetID,
+		BuyOrder:  tradeRequest.InterestedOrder,
+		SellOrder: tradeRequest.InterestOrder,
+		Amount:    tradeRequest.Amount,
+	}
+	if tradeRequest.InterestedOrder.Type == orders.OrderTypeSell {
+		event.BuyOrder, event.SellOrder = tradeRequest.InterestOrder, tradeRequest.InterestedOrder
+	}
+	return event
+}
+
+// NewTradeEventFromFill creates a TradeEvent of a fill of an auction.
+func NewTradeEventFromFill(fill Fill) TradeEvent {
+	return TradeEvent{
+		AssetID:   fill.BuyOrder.AssetID,
+		BuyOrder:  fill.BuyOrder,
+		SellOrder: fill.SellOrder,
+		Price:     fill.Price,
+		Amount:    fill.Amount,
+		Auction:   true,
+	}
+}
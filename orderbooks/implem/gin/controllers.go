@@ -1,18 +1,21 @@
 package orderbooksgin
 
 import (
+	"errors"
 	"fmt"
 	"home-broker/assets"
 	"home-broker/core"
 	"home-broker/orderbooks"
 	"home-broker/orders"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 var (
-	apiErrorInvalidJSON = core.NewAPIError("Invalid JSON.", 400)
+	apiErrorInvalidJSON    = core.NewAPIError("Invalid JSON.", 400)
+	apiErrorTooManyUpdates = core.NewAPIError(fmt.Sprintf("Too many updates (max %d).", orders.MaxExternalUpdatesBatch), 413)
 )
 
 // OrderBookController represents an order controller.
@@ -26,19 +29,124 @@ func NewOrderBookController(assetID assets.AssetID, uc orderbooks.OrderBookUseCa
 	return OrderBookController{assetID: assetID, uc: uc}
 }
 
-// Webhook receives the updates in the order book.
-func (orderBookC OrderBookController) Webhook(c *gin.Context) {
+// HaltJSON is the JSON received on Halt.
+type HaltJSON struct {
+	Seconds int64 `json:"seconds"` // zero halts until a resume command
+}
+
+// UncrossJSON is the JSON received on Uncross.
+type UncrossJSON struct {
+	NextPhase orderbooks.Phase `json:"next_phase"` // continuous/auction/closed, default is "continuous"
+}
+
+// checkAssetID returns false and sets an error if the URL asset is not handled by this host.
+func (orderBookC OrderBookController) checkAssetID(c *gin.Context) bool {
 	assetID := assets.AssetID(c.Param("asset_id"))
 	if orderBookC.assetID != assetID {
 		c.Error(core.NewAPIError(fmt.Sprintf("Check the URL. This host only handles orders of asset \"%v\".", orderBookC.assetID), 400))
+		return false
+	}
+	return true
+}
+
+// Webhook receives the updates in the order book.
+// The body is an update, a JSON array of updates or a NDJSON stream of updates (see orders.DecodeExternalUpdates).
+// A batch is applied under a single lock and answered with the result of each update.
+func (orderBookC OrderBookController) Webhook(c *gin.Context) {
+	if !orderBookC.checkAssetID(c) {
+		return
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		c.Error(apiErrorInvalidJSON)
+		return
+	}
+	items, batch, err := orders.DecodeExternalUpdates(c.ContentType(), body)
+	if errors.Is(err, orders.ErrTooManyUpdates) {
+		c.Error(apiErrorTooManyUpdates)
+		return
+	}
+	if err != nil {
+		c.Error(apiErrorInvalidJSON)
+		return
+	}
+	if batch {
+		c.JSON(http.StatusOK, orderBookC.uc.WebhookBatch(items))
+		return
+	}
+	response, err := orderBookC.uc.Webhook(items[0].Update)
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Status returns the state of the order book.
+func (orderBookC OrderBookController) Status(c *gin.Context) {
+	if !orderBookC.checkAssetID(c) {
 		return
 	}
-	var json orders.ExternalUpdate
+	c.JSON(http.StatusOK, orderBookC.uc.Status())
+}
+
+// Halt pauses the matching of the order book.
+func (orderBookC OrderBookController) Halt(c *gin.Context) {
+	if !orderBookC.checkAssetID(c) {
+		return
+	}
+	var json HaltJSON
 	if err := c.ShouldBindJSON(&json); err != nil {
 		c.Error(apiErrorInvalidJSON)
 		return
 	}
-	response, err := orderBookC.uc.Webhook(json)
+	response, err := orderBookC.uc.Halt(time.Duration(json.Seconds) * time.Second)
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Resume restarts the matching of the order book.
+func (orderBookC OrderBookController) Resume(c *gin.Context) {
+	if !orderBookC.checkAssetID(c) {
+		return
+	}
+	c.JSON(http.StatusOK, orderBookC.uc.Resume())
+}
+
+// StartAuction moves the order book to the auction phase.
+func (orderBookC OrderBookController) StartAuction(c *gin.Context) {
+	if !orderBookC.checkAssetID(c) {
+		return
+	}
+	c.JSON(http.StatusOK, orderBookC.uc.StartAuction())
+}
+
+// Uncross executes the auction.
+func (orderBookC OrderBookController) Uncross(c *gin.Context) {
+	if !orderBookC.checkAssetID(c) {
+		return
+	}
+	json := UncrossJSON{NextPhase: orderbooks.PhaseContinuous}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&json); err != nil {
+			c.Error(apiErrorInvalidJSON)
+			return
+		}
+	}
+	response, err := orderBookC.uc.Uncross(json.NextPhase)
 	if err != nil {
 		errVal, ok := err.(core.ErrValidation)
 		if ok {
@@ -2,6 +2,8 @@ package orderbooksgin
 
 import (
 	"home-broker/assets"
+	"home-broker/core"
+	coregin "home-broker/core/implem/gin"
 	"home-broker/orderbooks"
 
 	"github.com/gin-gonic/gin"
@@ -9,13 +11,17 @@ import (
 
 // OrderBookRouter represents an orders router.
 type OrderBookRouter struct {
-	assetID assets.AssetID
-	uc      orderbooks.OrderBookUseCases
+	assetID         assets.AssetID
+	uc              orderbooks.OrderBookUseCases
+	webhookVerifier core.WebhookVerifier
+	adminToken      string
 }
 
 // NewOrderBookRouter creates a new Router.
-func NewOrderBookRouter(assetID assets.AssetID, uc orderbooks.OrderBookUseCases) OrderBookRouter {
-	return OrderBookRouter{assetID: assetID, uc: uc}
+// The webhook accepts only the requests signed by the API (see core.WebhookVerifier)
+// and the admin commands only the requests with the admin token (see coregin.MiddlewareAdminToken).
+func NewOrderBookRouter(assetID assets.AssetID, uc orderbooks.OrderBookUseCases, webhookVerifier core.WebhookVerifier, adminToken string) OrderBookRouter {
+	return OrderBookRouter{assetID: assetID, uc: uc, webhookVerifier: webhookVerifier, adminToken: adminToken}
 }
 
 // SetupRouter setups orders router.
@@ -24,6 +30,12 @@ func (wr OrderBookRouter) SetupRouter(router *gin.Engine) {
 	orderBookC := NewOrderBookController(wr.assetID, wr.uc)
 	v1 := router.Group("/api/v1/orderbooks")
 	{
-		v1.POST(":asset_id/webhook/", orderBookC.Webhook)
+		v1.POST(":asset_id/webhook/", coregin.MiddlewareWebhookSignature(wr.webhookVerifier), orderBookC.Webhook)
+		v1.GET(":asset_id/", orderBookC.Status)
+		admin := coregin.MiddlewareAdminToken(wr.adminToken)
+		v1.POST(":asset_id/halt/", admin, orderBookC.Halt)
+		v1.POST(":asset_id/resume/", admin, orderBookC.Resume)
+		v1.POST(":asset_id/auction/", admin, orderBookC.StartAuction)
+		v1.POST(":asset_id/auction/uncross/", admin, orderBookC.Uncross)
 	}
 }
@@ -1,42 +1,144 @@
 package orderbooks
 
 import (
+	"home-broker/calendars"
 	"home-broker/core"
 	"home-broker/orders"
+	"log"
+	"time"
 )
 
 // OrderBookUseCases represents the order use cases.
 type OrderBookUseCases struct {
 	orderBook *OrderBook
+	eventBus  core.EventBus
 }
 
 // NewOrderBookUseCases returns a new OrderBookUseCases.
-func NewOrderBookUseCases(orderBook *OrderBook) OrderBookUseCases {
-	return OrderBookUseCases{orderBook: orderBook}
+// The matches of the orders of this home broker are published on the event bus (see TopicTrades).
+func NewOrderBookUseCases(orderBook *OrderBook, eventBus core.EventBus) OrderBookUseCases {
+	return OrderBookUseCases{orderBook: orderBook, eventBus: eventBus}
 }
 
 // WebhookResponse is the Webhook response.
 type WebhookResponse struct {
-	BuyOrdersCount  int64 `json:"buy_orders_count"`
-	SellOrdersCount int64 `json:"sell_orders_count"`
+	BuyOrdersCount  int64          `json:"buy_orders_count"`
+	SellOrdersCount int64          `json:"sell_orders_count"`
+	Halted          bool           `json:"halted"`
+	Phase           Phase          `json:"phase"`
+	Indicative      *AuctionResult `json:"indicative,omitempty"` // only during an auction
 }
 
-// Webhook process orders updates.
-// This is a non-concurrency process.
-func (orderBookUC OrderBookUseCases) Webhook(externalUp orders.ExternalUpdate) (WebhookResponse, error) {
+// StatusResponse holds the state of the order book.
+type StatusResponse struct {
+	BuyOrdersCount  int64          `json:"buy_orders_count"`
+	SellOrdersCount int64          `json:"sell_orders_count"`
+	Halted          bool           `json:"halted"`
+	HaltedUntil     time.Time      `json:"halted_until"` // zero if it waits for an admin command
+	Phase           Phase          `json:"phase"`
+	Indicative      *AuctionResult `json:"indicative,omitempty"` // only during an auction
+}
+
+// UncrossResponse is the Uncross response.
+type UncrossResponse struct {
+	Result AuctionResult  `json:"result"`
+	Fills  []Fill         `json:"fills"`
+	Status StatusResponse `json:"status"`
+}
+
+// WebhookBatchResponse is the WebhookBatch response.
+// The state of the order book is the one after the whole batch.
+type WebhookBatchResponse struct {
+	Results []orders.ExternalUpdateResult `json:"results"`
+	WebhookResponse
+}
+
+// validateExternalUpdate returns a validation error if an update cannot change the order book.
+func validateExternalUpdate(externalUp orders.ExternalUpdate) error {
 	if externalUp.AssetID == "" {
-		return WebhookResponse{}, core.NewErrValidation("Asset ID is invalid")
+		return core.NewErrValidation("Asset ID is invalid")
 	}
 	if externalUp.ID == "" {
-		return WebhookResponse{}, core.NewErrValidation("ID (external) is invalid")
+		return core.NewErrValidation("ID (external) is invalid")
 	}
 	if externalUp.Timestamp.IsZero() {
-		return WebhookResponse{}, core.NewErrValidation("Timestamp is invalid")
+		return core.NewErrValidation("Timestamp is invalid")
 	}
 	if (externalUp.Type != orders.OrderTypeBuy) && (externalUp.Type != orders.OrderTypeSell) {
-		return WebhookResponse{}, core.NewErrValidation("Type is invalid")
+		return core.NewErrValidation("Type is invalid")
 	}
+	return nil
+}
 
+// Webhook process orders updates.
+// This is a non-concurrency process.
+func (orderBookUC OrderBookUseCases) Webhook(externalUp orders.ExternalUpdate) (WebhookResponse, error) {
+	err := validateExternalUpdate(externalUp)
+	if err != nil {
+		return WebhookResponse{}, err
+	}
+	response := orderBookUC.WebhookBatch([]orders.ExternalUpdateItem{{Update: externalUp}})
+	return response.WebhookResponse, nil
+}
+
+// WebhookBatch process a batch of orders updates, in order, under a single lock of the order book.
+// The invalid updates (with decoding or validation errors) are skipped and returned on their results.
+func (orderBookUC OrderBookUseCases) WebhookBatch(items []orders.ExternalUpdateItem) WebhookBatchResponse {
+	response := WebhookBatchResponse{Results: make([]orders.ExternalUpdateResult, 0, len(items))}
+	var tradeRequests []*TradeRequest
+
+	func() {
+		orderBookUC.orderBook.Lock()
+		defer orderBookUC.orderBook.Unlock()
+
+		// A halted order book keeps applying the updates, but it does not match orders.
+		resumed := orderBookUC.orderBook.ResumeIfCooledDown(time.Now())
+		if resumed {
+			log.Printf("Order book resumed after the cooldown")
+		}
+
+		for i, item := range items {
+			err := item.Err
+			if err == nil {
+				err = validateExternalUpdate(item.Update)
+			}
+			response.Results = append(response.Results, orders.NewExternalUpdateResult(i, err))
+			if err != nil {
+				continue
+			}
+			tradeRequest := orderBookUC.applyExternalUpdate(item.Update)
+			if tradeRequest != nil {
+				tradeRequests = append(tradeRequests, tradeRequest)
+			}
+		}
+		if resumed && len(tradeRequests) == 0 {
+			// Orders crossed while halted can match now.
+			tradeRequest := orderBookUC.orderBook.Match()
+			if tradeRequest != nil {
+				tradeRequests = append(tradeRequests, tradeRequest)
+			}
+		}
+
+		status := orderBookUC.status()
+		response.WebhookResponse = WebhookResponse{
+			BuyOrdersCount:  status.BuyOrdersCount,
+			SellOrdersCount: status.SellOrdersCount,
+			Halted:          status.Halted,
+			Phase:           status.Phase,
+			Indicative:      status.Indicative,
+		}
+	}()
+
+	for _, tradeRequest := range tradeRequests {
+		orderBookUC.publishTrade(NewTradeEventFromRequest(*tradeRequest))
+	}
+
+	return response
+}
+
+// applyExternalUpdate changes the order book with an update.
+// The order book must be locked.
+func (orderBookUC OrderBookUseCases) applyExternalUpdate(externalUp orders.ExternalUpdate) *TradeRequest {
 	order := Order{ // this is not the same as "orders.Order" type.
 		Mine:      externalUp.Mine,
 		ID:        externalUp.ID,
@@ -48,29 +150,180 @@ func (orderBookUC OrderBookUseCases) Webhook(externalUp orders.ExternalUpdate) (
 	}
 
 	var tradeRequest *TradeRequest
+	switch externalUp.Action {
+	case "added":
+		tradeRequest = orderBookUC.orderBook.AddOrder(order)
+
+	case "deleted":
+		orderBookUC.orderBook.RemoveOrder(order)
+	case "traded":
+		orderBookUC.orderBook.DecOrderAmount(order)
+		orderBookUC.orderBook.RecordTrade(order.Price, order.Timestamp)
+	}
+	return tradeRequest
+}
+
+// Status returns the state of the order book.
+func (orderBookUC OrderBookUseCases) Status() StatusResponse {
+	orderBookUC.orderBook.Lock()
+	defer orderBookUC.orderBook.Unlock()
+	orderBookUC.orderBook.ResumeIfCooledDown(time.Now())
+	return orderBookUC.status()
+}
+
+// Halt pauses the matching of the order book.
+// A zero duration keeps the order book halted until Resume is called.
+// This is an admin command.
+func (orderBookUC OrderBookUseCases) Halt(duration time.Duration) (StatusResponse, error) {
+	if duration < 0 {
+		return StatusResponse{}, core.NewErrValidation("Invalid duration.")
+	}
+	orderBookUC.orderBook.Lock()
+	defer orderBookUC.orderBook.Unlock()
+	until := time.Time{}
+	if duration > 0 {
+		until = time.Now().Add(duration)
+	}
+	orderBookUC.orderBook.Halt(until)
+	log.Printf("Order book halted by an admin (until %v)", until)
+	return orderBookUC.status(), nil
+}
 
+// Resume restarts the matching of the order book.
+// This is an admin command.
+func (orderBookUC OrderBookUseCases) Resume() StatusResponse {
+	var tradeRequest *TradeRequest
+	var response StatusResponse
 	func() {
 		orderBookUC.orderBook.Lock()
 		defer orderBookUC.orderBook.Unlock()
+		tradeRequest = orderBookUC.orderBook.Resume()
+		log.Printf("Order book resumed by an admin")
+		response = orderBookUC.status()
+	}()
 
-		switch externalUp.Action {
-		case "added":
-			tradeRequest = orderBookUC.orderBook.AddOrder(order)
+	if tradeRequest != nil {
+		orderBookUC.publishTrade(NewTradeEventFromRequest(*tradeRequest))
+	}
+	return response
+}
 
-		case "deleted":
-			orderBookUC.orderBook.RemoveOrder(order)
-		case "traded":
-			orderBookUC.orderBook.DecOrderAmount(order)
+// StartAuction moves the order book to the auction phase.
+// The orders accumulate without matching until Uncross is called.
+func (orderBookUC OrderBookUseCases) StartAuction() StatusResponse {
+	orderBookUC.orderBook.Lock()
+	defer orderBookUC.orderBook.Unlock()
+	orderBookUC.orderBook.SetPhase(PhaseAuction)
+	log.Printf("Order book auction started")
+	return orderBookUC.status()
+}
+
+// Uncross executes the auction and moves the order book to the "next" phase.
+func (orderBookUC OrderBookUseCases) Uncross(next Phase) (UncrossResponse, error) {
+	if next != PhaseContinuous && next != PhaseAuction && next != PhaseClosed {
+		return UncrossResponse{}, core.NewErrValidation("Invalid phase.")
+	}
+	orderBookUC.orderBook.Lock()
+	defer orderBookUC.orderBook.Unlock()
+	if orderBookUC.orderBook.Phase != PhaseAuction {
+		return UncrossResponse{}, core.NewErrValidation("The order book is not in an auction.")
+	}
+	return orderBookUC.uncross(next), nil
+}
+
+// ApplySessionPhase switches the order book to the phase of an exchange session.
+// Leaving an auction uncrosses the order book.
+func (orderBookUC OrderBookUseCases) ApplySessionPhase(sessionPhase calendars.SessionPhase) StatusResponse {
+	var next Phase
+	switch sessionPhase {
+	case calendars.SessionPhasePreOpen, calendars.SessionPhaseClosingAuction:
+		next = PhaseAuction
+	case calendars.SessionPhaseContinuous:
+		next = PhaseContinuous
+	default:
+		next = PhaseClosed
+	}
+
+	orderBookUC.orderBook.Lock()
+	defer orderBookUC.orderBook.Unlock()
+	current := orderBookUC.orderBook.Phase
+	if current == next {
+		return orderBookUC.status()
+	}
+	log.Printf("Order book phase changed by the session schedule: %v -> %v (%v)", current, next, sessionPhase)
+	if current == PhaseAuction {
+		return orderBookUC.uncross(next).Status
+	}
+	orderBookUC.orderBook.SetPhase(next)
+	return orderBookUC.status()
+}
+
+// RunSessionScheduler switches the order book phases following an exchange calendar.
+// The calendar is checked on every interval until "stop" is closed. A session phase is applied only when
+// the calendar enters it, so a phase changed by hand (ex: an auction started by StartAuction) is kept
+// until the next session of the calendar.
+func (orderBookUC OrderBookUseCases) RunSessionScheduler(calendar calendars.Calendar, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last calendars.SessionPhase
+	applied := false
+	for {
+		sessionPhase := calendar.PhaseAt(time.Now())
+		if !applied || sessionPhase != last {
+			orderBookUC.ApplySessionPhase(sessionPhase)
+			last = sessionPhase
+			applied = true
 		}
-	}()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
 
-	if tradeRequest != nil {
-		// TODO: Do request on the exchange OR on a kafka topic.
-		// We also need to change the order status.
+// uncross executes the auction and moves the order book to the "next" phase.
+// The order book must be locked.
+func (orderBookUC OrderBookUseCases) uncross(next Phase) UncrossResponse {
+	result, fills := orderBookUC.orderBook.Uncross()
+	orderBookUC.orderBook.SetPhase(next)
+
+	for _, fill := range fills {
+		if fill.BuyOrder.Mine || fill.SellOrder.Mine {
+			log.Printf("Auction fill! buy %v - sell %v - $%v - %vqty", fill.BuyOrder.ID, fill.SellOrder.ID, fill.Price, fill.Amount)
+			orderBookUC.publishTrade(NewTradeEventFromFill(fill))
+		}
 	}
 
-	return WebhookResponse{
+	if fills == nil {
+		fills = []Fill{}
+	}
+	return UncrossResponse{Result: result, Fills: fills, Status: orderBookUC.status()}
+}
+
+// publishTrade publishes a match of the orders of this home broker (see TopicTrades).
+// The order status changes when the exchange sends the "traded" updates.
+func (orderBookUC OrderBookUseCases) publishTrade(event TradeEvent) {
+	err := orderBookUC.eventBus.Publish(TopicTrades, string(event.AssetID), event)
+	if err != nil {
+		log.Printf("error to publish the trade of the orders %v and %v: %v\n", event.BuyOrder.ID, event.SellOrder.ID, err)
+	}
+}
+
+// status returns the state of the order book.
+// The order book must be locked.
+func (orderBookUC OrderBookUseCases) status() StatusResponse {
+	var indicative *AuctionResult
+	if orderBookUC.orderBook.Phase == PhaseAuction {
+		result := orderBookUC.orderBook.IndicativeUncross()
+		indicative = &result
+	}
+	return StatusResponse{
 		BuyOrdersCount:  orderBookUC.orderBook.OrdersCount[orders.OrderTypeBuy],
 		SellOrdersCount: orderBookUC.orderBook.OrdersCount[orders.OrderTypeSell],
-	}, nil
+		Halted:          orderBookUC.orderBook.Halted,
+		HaltedUntil:     orderBookUC.orderBook.HaltedUntil,
+		Phase:           orderBookUC.orderBook.Phase,
+		Indicative:      indicative,
+	}
 }
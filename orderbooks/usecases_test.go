@@ -0,0 +1,62 @@
+package orderbooks_test
+
+import (
+	"home-broker/calendars"
+	"home-broker/core"
+	"home-broker/orderbooks"
+	"home-broker/orders"
+	orderstests "home-broker/tests/orders"
+	"testing"
+	"time"
+)
+
+func TestOrderBookUseCasesWebhookBatch_InvalidItemsSkipped(t *testing.T) {
+	orderBook := orderbooks.NewOrderBook("VIBR")
+	uc := orderbooks.NewOrderBookUseCases(orderBook, core.NewMemoryEventBus(time.Second))
+	items := []orders.ExternalUpdateItem{
+		{Update: orders.ExternalUpdate{ID: "1", AssetID: "VIBR", Type: orders.OrderTypeBuy, Price: 10, Amount: 1, Timestamp: orderstests.BaseTime, Action: orders.ExternalUpdateActionAdded}},
+		{Err: core.NewErrValidation("Invalid JSON.")},
+		{Update: orders.ExternalUpdate{ID: "2", AssetID: "VIBR", Type: "invalid", Timestamp: orderstests.BaseTime, Action: orders.ExternalUpdateActionAdded}},
+		{Update: orders.ExternalUpdate{ID: "3", AssetID: "VIBR", Type: orders.OrderTypeSell, Price: 20, Amount: 1, Timestamp: orderstests.BaseTime, Action: orders.ExternalUpdateActionAdded}},
+	}
+	response := uc.WebhookBatch(items)
+	expected := []orders.ExternalUpdateResult{
+		{Index: 0, OK: true},
+		{Index: 1, Error: "Invalid JSON."},
+		{Index: 2, Error: "Type is invalid"},
+		{Index: 3, OK: true},
+	}
+	if len(response.Results) != len(expected) {
+		t.Fatalf("results count is %d, expected %d", len(response.Results), len(expected))
+	}
+	for i, result := range response.Results {
+		if result != expected[i] {
+			t.Errorf("result %d is %v, expected %v", i, result, expected[i])
+		}
+	}
+	if response.BuyOrdersCount != 1 || response.SellOrdersCount != 1 {
+		t.Errorf("orders count is %d/%d, expected 1/1", response.BuyOrdersCount, response.SellOrdersCount)
+	}
+}
+
+func TestOrderBookUseCasesRunSessionScheduler_ManualAuctionKept(t *testing.T) {
+	calendar, err := calendars.NewCalendar("VIBR", "UTC", nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderBook := orderbooks.NewOrderBook("VIBR")
+	uc := orderbooks.NewOrderBookUseCases(orderBook, core.NewMemoryEventBus(time.Second))
+	stop := make(chan struct{})
+	defer close(stop)
+	go uc.RunSessionScheduler(calendar, 10*time.Millisecond, stop)
+
+	time.Sleep(50 * time.Millisecond)
+	if phase := uc.Status().Phase; phase != orderbooks.PhaseContinuous {
+		t.Fatalf("phase is %v, expected %v", phase, orderbooks.PhaseContinuous)
+	}
+	uc.StartAuction()
+	time.Sleep(50 * time.Millisecond)
+	if phase := uc.Status().Phase; phase != orderbooks.PhaseAuction {
+		t.Errorf("phase is %v, expected %v (the calendar phase did not change)", phase, orderbooks.PhaseAuction)
+	}
+}
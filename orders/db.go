@@ -1,10 +1,25 @@
 package orders
 
 import (
+	"errors"
 	"home-broker/assets"
+	"home-broker/core"
+	"home-broker/money"
+	"home-broker/users"
 	"time"
 )
 
+var (
+	// ErrExecutionAlreadyExists happens when the trade of an execution was already recorded for the order.
+	ErrExecutionAlreadyExists = errors.New("execution already exists")
+
+	// ErrClientOrderIDAlreadyExists happens when the user already has an order with the client order ID.
+	ErrClientOrderIDAlreadyExists = errors.New("client order ID already exists")
+
+	// ErrOutboxMessagePending happens when an order already has an outbox message waiting to be delivered.
+	ErrOutboxMessagePending = errors.New("order has an outbox message pending")
+)
+
 // OrderDBInterface is an interface that handles database commands for Order entity.
 type OrderDBInterface interface {
 
@@ -13,17 +28,169 @@ type OrderDBInterface interface {
 	GetByID(id OrderID) (*Order, error)
 
 	// GetByExternalIDAssetID must return an order by external ID and asset ID.
+	// The external IDs that the order had before its replaces are found too.
 	// If the record does not exist a nil entity will be returned.
 	GetByExternalIDAssetID(externalID ExternalOrderID, assetID assets.AssetID) (*Order, error)
 
+	// GetByUserIDClientOrderID must return an order by user ID and client order ID.
+	// If the record does not exist a nil entity will be returned.
+	GetByUserIDClientOrderID(userID users.UserID, clientOrderID string) (*Order, error)
+
+	// Search must return up to "filter.Limit" orders matching the filter,
+	// sorted by "filter.Sort" and starting after "filter.After".
+	Search(filter OrderFilter) ([]Order, error)
+
 	// Insert must insert a new order.
 	// A nil entity will be returned if an error occurs.
 	// The following errors can happen: ErrUserDoesNotExist, ErrAssetDoesNotExist.
 	Insert(entity Order) (*Order, error)
 
-	// UpdateExternalResponse updates an order base on a exchange response.
-	UpdateExternalResponse(orderID OrderID, externalID ExternalOrderID, externalTimestamp time.Time, status OrderStatus) error
+	// InsertWithOutbox must insert a new order and its outbox message in the same transaction.
+	// The order HeldFunds and HeldAssets must be held on the user wallets in the same transaction too.
+	// A nil entity will be returned if an error occurs (nothing is inserted).
+	// The following errors can happen: ErrUserDoesNotExist, ErrAssetDoesNotExist, ErrInsufficientFunds, ErrInsufficientAssets,
+	// ErrClientOrderIDAlreadyExists.
+	InsertWithOutbox(entity Order, action OutboxAction) (*Order, error)
+
+	// InsertGroup must insert an order group and its orders in the same transaction, like InsertWithOutbox.
+	// Only the "pending" orders have an outbox message (submit). For a bracket, the first order is the parent of the others.
+	// A nil entity will be returned if an error occurs (nothing is inserted).
+	// The following errors can happen: ErrUserDoesNotExist, ErrAssetDoesNotExist, ErrInsufficientFunds, ErrInsufficientAssets.
+	InsertGroup(entity OrderGroup) (*OrderGroup, error)
+
+	// GetOrderGroup must return an order group by ID with its orders, the oldest first.
+	// If the record does not exist a nil entity will be returned.
+	GetOrderGroup(id OrderGroupID) (*OrderGroup, error)
+
+	// GetWaitingStopOrders must return the "waiting" orders of an asset with a stop price,
+	// without the bracket exits whose parent is not filled yet.
+	GetWaitingStopOrders(assetID assets.AssetID) ([]Order, error)
+
+	// MoveGroupHolds must move the funds and assets held by the siblings of an order (same group and parent)
+	// to the order, in the same transaction (ex: the leg of an OCO that was filled).
+	MoveGroupHolds(orderID OrderID) error
+
+	// ReleaseHolds must release all the funds and assets still held by an order (ex: canceled or denied).
+	// The holds of a group leg must be moved to a sibling (same group and parent) that is not final yet,
+	// so they are released only when every leg is final.
+	// The order and the wallets must be updated in the same transaction.
+	// Nothing happens if the order does not hold anything anymore.
+	ReleaseHolds(orderID OrderID) error
+
+	// ConsumeHeldFunds must release up to "amount" of the funds held by an order and
+	// remove "cost" from the wallet balance, in the same transaction (ex: a trade).
+	ConsumeHeldFunds(orderID OrderID, amount money.Money, cost money.Money) error
+
+	// ConsumeHeldAssets must release up to "amount" of the assets held by an order and
+	// remove them from the asset wallet balance, in the same transaction (ex: a trade).
+	ConsumeHeldAssets(orderID OrderID, amount assets.AssetUnit) error
+
+	// AdjustHolds must set the funds and assets held by an order, holding or releasing the difference
+	// on the user wallets in the same transaction.
+	// The following errors can happen: ErrInsufficientFunds, ErrInsufficientAssets.
+	AdjustHolds(orderID OrderID, funds money.Money, assets assets.AssetUnit) error
+
+	// AdjustExitHolds must set the funds and assets held by a bracket exit like AdjustHolds,
+	// but the assets can be held from the pending assets of the asset wallet (the assets bought by the entry
+	// stay pending until the settlement date, see settlements).
+	// The following errors can happen: ErrInsufficientFunds, ErrInsufficientAssets.
+	AdjustExitHolds(orderID OrderID, funds money.Money, assets assets.AssetUnit) error
+
+	// RequestReplace must set the funds and assets held by an order like AdjustHolds and insert the outbox message
+	// of a replace, in the same transaction. The locked order must accept the replace (see Order.CanReplace)
+	// and must not have other outbox messages pending.
+	// The updated order is returned.
+	// The following errors can happen: ErrInvalidStatusTransition, ErrOutboxMessagePending, ErrInsufficientFunds, ErrInsufficientAssets.
+	RequestReplace(message OutboxMessage, funds money.Money, assets assets.AssetUnit) (*Order, error)
+
+	// Replace must change the order price, amount and external ID to the ones of the replacement and
+	// record the replace, in the same transaction. The holds must be adjusted to the new terms too (see Order.RequiredHolds),
+	// plus the "entity.FeeHold" of a buying order. The replace was already accepted by the exchange, so if the locked order
+	// does not accept it anymore (see Order.CanReplace) only the external ID must be changed (the terms and holds are kept).
+	// A replace already saved must not change the order. The updated order is returned.
+	Replace(entity OrderReplace) (*Order, error)
+
+	// UpdateExternalResponse updates a pending order base on a exchange response.
+	// The change must be recorded on the status history.
+	// Orders that are not pending anymore must not be changed, so a repeated response has no effect.
+	// A canceling order without external ID (canceled while it was sent) must get the external ID, and it
+	// must change to canceled if the response is denied, or to filled.
+	UpdateExternalResponse(externalID ExternalOrderID, externalTimestamp time.Time, change OrderStatusChange) error
+
+	// SetExternalID must save the external ID of an order that does not have one yet
+	// (ex: a trade received before the submit response). Orders with an external ID must not be changed.
+	SetExternalID(orderID OrderID, externalID ExternalOrderID, externalTimestamp time.Time) error
+
+	// ChangeStatus must change an order status and record the change on the status history.
+	// If "change.FromStatus" is set, the order must still be in this status.
+	// The updated order is returned.
+	// The following errors can happen: ErrInvalidStatusTransition.
+	ChangeStatus(change OrderStatusChange) (*Order, error)
+
+	// ChangeStatusWithOutbox must change an order status like ChangeStatus and insert an outbox message
+	// of the order in the same transaction (ex: a cancel to be sent to the exchange).
+	// The updated order is returned.
+	// The following errors can happen: ErrInvalidStatusTransition.
+	ChangeStatusWithOutbox(change OrderStatusChange, action OutboxAction) (*Order, error)
+
+	// RestoreStatus must return an order in the status "change.FromStatus" to the status it had before,
+	// based on the status history (ex: a cancel that failed). See RestoredStatus.
+	// The updated order is returned.
+	// The following errors can happen: ErrInvalidStatusTransition.
+	RestoreStatus(change OrderStatusChange) (*Order, error)
+
+	// GetStatusHistory must return the status changes of an order, the oldest first.
+	GetStatusHistory(orderID OrderID) ([]OrderStatusChange, error)
+
+	// AddExecution must insert an execution and add it to the order filled amount,
+	// average price and status (see Order.AddFill) in the same transaction.
+	// The fee of a buying order must be capped at the fee it still holds (see Order.HeldFee) plus the available wallet balance.
+	// A status change must be recorded on the status history.
+	// The updated order and the inserted execution are returned.
+	// The following errors can happen: ErrExecutionAlreadyExists.
+	AddExecution(entity Execution) (*Order, *Execution, error)
+
+	// GetExecutionsByOrderID must return the executions of an order, the oldest first.
+	GetExecutionsByOrderID(orderID OrderID) ([]Execution, error)
+
+	// GetDueOutboxMessages must return up to "limit" pending outbox messages to be delivered at "now".
+	// The oldest messages come first.
+	GetDueOutboxMessages(now time.Time, limit int) ([]OutboxMessage, error)
+
+	// ClaimOutboxMessage must reserve a due outbox message until "until", so other dispatchers skip it.
+	// It returns false if the message is not due anymore (ex: claimed by another dispatcher).
+	ClaimOutboxMessage(id OutboxMessageID, now time.Time, until time.Time) (bool, error)
+
+	// UpdateOutboxMessage must save the delivery state of an outbox message
+	// (status, attempts, next attempt and last error).
+	UpdateOutboxMessage(entity OutboxMessage) error
+
+	// EnqueueOrderBookUpdates must insert a pending order book message for each update, in the same transaction.
+	// The messages must keep the order of the updates (ID order).
+	EnqueueOrderBookUpdates(updates []ExternalUpdate) error
+
+	// GetOrderBookQueueAssets must return the assets with pending order book messages.
+	GetOrderBookQueueAssets() ([]assets.AssetID, error)
+
+	// ClaimOrderBookBatch must return up to "limit" pending order book messages of an asset, the oldest first,
+	// if the oldest one is due at "now". The oldest message must be reserved until "until", so other forwarders skip
+	// the asset and the messages are delivered in order. No messages are returned if the asset is not due
+	// (ex: waiting for a retry or claimed by another forwarder).
+	ClaimOrderBookBatch(assetID assets.AssetID, now time.Time, until time.Time, limit int) ([]OrderBookMessage, error)
+
+	// UpdateOrderBookMessages must save the delivery state of order book messages
+	// (status, attempts, next attempt and last error).
+	UpdateOrderBookMessages(entities []OrderBookMessage) error
+
+	// GetDeadOrderBookMessages must return up to "limit" dead order book messages (dead letters), the newest first.
+	// An empty asset ID returns the messages of all the assets.
+	GetDeadOrderBookMessages(assetID assets.AssetID, limit int) ([]OrderBookMessage, error)
+
+	// DeleteOrderBookMessages must delete the order book messages of a status last updated before "before".
+	// It returns the number of deleted messages.
+	DeleteOrderBookMessages(status OrderBookMessageStatus, before time.Time) (int64, error)
 
-	// UpdateStatus updates an order status.
-	UpdateStatus(orderID OrderID, status OrderStatus) error
+	// WithTx must return a copy of the handler that runs its commands inside a transaction (see core.UnitOfWork).
+	// The methods that use their own transaction must join it instead (ex: with a savepoint).
+	WithTx(tx core.Tx) OrderDBInterface
 }
@@ -1,10 +1,22 @@
 package orders
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"home-broker/assets"
 	"home-broker/money"
 	"home-broker/users"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	// ErrInvalidCursor happens when a search cursor was not returned by a search.
+	ErrInvalidCursor = errors.New("invalid cursor")
 )
 
 type (
@@ -20,6 +32,12 @@ type (
 
 	// OrderStatus represents the status of an order.
 	OrderStatus string
+
+	// ExecutionID represents the Execution ID type.
+	ExecutionID int64
+
+	// ExternalTradeID represents a trade ID generated by an exchange.
+	ExternalTradeID string
 )
 
 const (
@@ -29,6 +47,12 @@ const (
 	// OrderTypeSell is an order type for a sell.
 	OrderTypeSell OrderType = "sell"
 
+	// LiquidityMaker is a trade of an order that was on the book.
+	LiquidityMaker = "maker"
+
+	// LiquidityTaker is a trade of an order that matched an order of the book.
+	LiquidityTaker = "taker"
+
 	// OrderStatusAccepted is an accepted order.
 	// This means that the order was accepted and processed by the exchange.
 	OrderStatusAccepted = "accepted"
@@ -48,6 +72,16 @@ const (
 	// OrderStatusCanceled is a canceled order.
 	OrderStatusCanceled = "canceled"
 
+	// OrderStatusPartiallyFilled is an accepted order with part of the amount traded.
+	OrderStatusPartiallyFilled = "partially_filled"
+
+	// OrderStatusFilled is an order with all the amount traded.
+	OrderStatusFilled = "filled"
+
+	// OrderStatusWaiting is an order kept by the home broker and not sent to the exchange yet
+	// (ex: a stop order or the exit of a bracket waiting for its parent to fill).
+	OrderStatusWaiting = "waiting"
+
 	// ExternalUpdateActionAdded is an order added to the order book.
 	ExternalUpdateActionAdded = "added"
 
@@ -65,10 +99,18 @@ type Order struct {
 	AssetID           assets.AssetID   `json:"asset_id"`           // Internal asset ID.
 	ExternalID        ExternalOrderID  `json:"external_id"`        // External order ID (from a Stock Exchange)
 	ExternalTimestamp time.Time        `json:"external_timestamp"` // External timestamp.
+	ClientOrderID     string           `json:"client_order_id"`    // ID sent by the client, unique by user (optional).
+	GroupID           OrderGroupID     `json:"group_id"`           // OCO or bracket group (optional).
+	ParentID          OrderID          `json:"parent_id"`          // Bracket entry of an exit order (optional).
+	StopPrice         money.Money      `json:"stop_price"`         // The order waits until a trade reaches this price (optional).
 	Amount            assets.AssetUnit `json:"amount"`
 	Price             money.Money      `json:"price"`
 	Type              OrderType        `json:"type"`
 	Status            OrderStatus      `json:"status"`
+	HeldFunds         money.Money      `json:"held_funds"`  // Wallet funds still reserved by a buying order.
+	HeldAssets        assets.AssetUnit `json:"held_assets"` // Wallet assets still reserved by a selling order.
+	FilledAmount      assets.AssetUnit `json:"filled_amount"`
+	AveragePrice      money.Money      `json:"average_price"` // Average price of the executions.
 	CreatedAt         time.Time        `json:"created_at"`
 	UpdatedAt         time.Time        `json:"updated_at"`
 	DeletedAt         time.Time        `json:"-"`
@@ -94,14 +136,240 @@ func NewSellOrder(assetID assets.AssetID, amount assets.AssetUnit, price money.M
 	}
 }
 
+// AddFill adds an execution to the filled amount and average price.
+// The status changes to "partially_filled" or "filled", except for orders that are not
+// working anymore (ex: canceling), which only change when the whole amount is filled.
+func (o *Order) AddFill(price money.Money, amount assets.AssetUnit) {
+	filled := o.FilledAmount + amount
+	if filled > 0 {
+		total := decimal.NewFromInt(int64(o.AveragePrice)).Mul(decimal.NewFromInt(int64(o.FilledAmount))).
+			Add(decimal.NewFromInt(int64(price)).Mul(decimal.NewFromInt(int64(amount))))
+		o.AveragePrice = money.Money(total.Div(decimal.NewFromInt(int64(filled))).Round(0).IntPart())
+	}
+	o.FilledAmount = filled
+
+	switch {
+	case o.FilledAmount >= o.Amount:
+		o.Status = OrderStatusFilled
+	case o.Status == OrderStatusPending || o.Status == OrderStatusAccepted:
+		o.Status = OrderStatusPartiallyFilled
+	}
+}
+
 // ExternalUpdate holds an order update sent by an exchange service.
 type ExternalUpdate struct {
-	Mine      bool             `json:"mine"` // special flag to indicates that this order is from this system
-	ID        ExternalOrderID  `json:"id"`
-	AssetID   assets.AssetID   `json:"asset_id"`
+	Mine          bool             `json:"mine"` // special flag to indicates that this order is from this system
+	ID            ExternalOrderID  `json:"id"`
+	AssetID       assets.AssetID   `json:"asset_id"`
+	Price         money.Money      `json:"price"`
+	Amount        assets.AssetUnit `json:"amount"`
+	Type          OrderType        `json:"type"`
+	Timestamp     time.Time        `json:"timestamp"`
+	Action        string           `json:"action"`                    // added / deleted / traded
+	TradeID       ExternalTradeID  `json:"trade_id,omitempty"`        // Exchange trade ID (only on "traded").
+	Liquidity     string           `json:"liquidity,omitempty"`       // maker / taker (only on "traded"). Unknown is taker.
+	ExchangeFee   *money.Money     `json:"exchange_fee,omitempty"`    // Fee charged by the exchange (only on "traded", if reported).
+	ClientOrderID string           `json:"client_order_id,omitempty"` // Order ID sent by this system (see ExchangeClient.SubmitOrder), if reported.
+}
+
+// Execution is a trade of an order (a fill) reported by the exchange.
+type Execution struct {
+	ID        ExecutionID      `json:"id"`
+	OrderID   OrderID          `json:"order_id"`
+	TradeID   ExternalTradeID  `json:"trade_id"` // Exchange trade ID. It is unique by order.
 	Price     money.Money      `json:"price"`
 	Amount    assets.AssetUnit `json:"amount"`
-	Type      OrderType        `json:"type"`
-	Timestamp time.Time        `json:"timestamp"`
-	Action    string           `json:"action"` // added / deleted / traded
+	Fee       money.Money      `json:"fee"`
+	Timestamp time.Time        `json:"timestamp"` // Exchange timestamp.
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	DeletedAt time.Time        `json:"-"`
+}
+
+// NewExecution creates an execution of an order from a "traded" update.
+// The update must have a trade ID (the key of a repeated trade).
+func NewExecution(orderID OrderID, externalUp ExternalUpdate) Execution {
+	return Execution{
+		OrderID:   orderID,
+		TradeID:   externalUp.TradeID,
+		Price:     externalUp.Price,
+		Amount:    externalUp.Amount,
+		Timestamp: externalUp.Timestamp,
+	}
+}
+
+type (
+	// OutboxMessageID represents the OutboxMessage ID type.
+	OutboxMessageID int64
+
+	// OutboxAction represents what must be done on the exchange for an outbox message.
+	// Use the value of OutboxActionSubmit, OutboxActionCancel or OutboxActionReplace to set this data type.
+	OutboxAction string
+
+	// OutboxStatus represents the delivery status of an outbox message.
+	// Use the value of OutboxStatusPending, OutboxStatusSent or OutboxStatusFailed to set this data type.
+	OutboxStatus string
+)
+
+const (
+	// OutboxActionSubmit sends a new order to the exchange.
+	OutboxActionSubmit OutboxAction = "submit"
+
+	// OutboxActionCancel sends a cancel of a "canceling" order to the exchange.
+	OutboxActionCancel OutboxAction = "cancel"
+
+	// OutboxActionReplace sends a replace (new price and amount) of a working order to the exchange.
+	OutboxActionReplace OutboxAction = "replace"
+
+	// OutboxStatusPending is a message waiting to be delivered (or retried).
+	OutboxStatusPending OutboxStatus = "pending"
+
+	// OutboxStatusSent is a message delivered to the exchange.
+	OutboxStatusSent OutboxStatus = "sent"
+
+	// OutboxStatusFailed is a message that could not be delivered after all the attempts.
+	OutboxStatusFailed OutboxStatus = "failed"
+)
+
+// OutboxMessage is a request to the exchange saved together with the order (transactional outbox).
+// It is delivered later by a dispatcher, so the order request does not wait for the exchange.
+type OutboxMessage struct {
+	ID            OutboxMessageID  `json:"id"`
+	OrderID       OrderID          `json:"order_id"`
+	Action        OutboxAction     `json:"action"`
+	Status        OutboxStatus     `json:"status"`
+	Attempts      int              `json:"attempts"`
+	NextAttemptAt time.Time        `json:"next_attempt_at"` // The message is not delivered before this time.
+	LastError     string           `json:"last_error"`
+	Price         money.Money      `json:"price"`  // New price of a replace.
+	Amount        assets.AssetUnit `json:"amount"` // New amount of a replace.
+	// ExternalID and ExternalTimestamp are the response of a replace accepted by the exchange but not saved yet.
+	// The replace is not sent again, only saved.
+	ExternalID        ExternalOrderID `json:"external_id"`
+	ExternalTimestamp time.Time       `json:"external_timestamp"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+	DeletedAt         time.Time       `json:"-"`
+}
+
+// NewOutboxMessage creates a new pending outbox message of an order.
+func NewOutboxMessage(orderID OrderID, action OutboxAction) OutboxMessage {
+	return OutboxMessage{
+		OrderID: orderID,
+		Action:  action,
+		Status:  OutboxStatusPending,
+	}
+}
+
+// Backoff returns the time to wait before the next attempt.
+// It doubles on each attempt, starting from "base" and limited by "max".
+func (m OutboxMessage) Backoff(base time.Duration, max time.Duration) time.Duration {
+	return backoff(m.Attempts, base, max)
+}
+
+// backoff returns the time to wait after "attempts" attempts.
+// It doubles on each attempt, starting from "base" and limited by "max".
+func backoff(attempts int, base time.Duration, max time.Duration) time.Duration {
+	wait := base
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= max {
+			return max
+		}
+	}
+	if wait > max {
+		return max
+	}
+	return wait
+}
+
+// OrderSort represents the order of a search result.
+// Use the value of OrderSortNewest or OrderSortOldest to set this data type.
+type OrderSort string
+
+const (
+	// OrderSortNewest returns the newest orders first (default).
+	OrderSortNewest OrderSort = "-created_at"
+
+	// OrderSortOldest returns the oldest orders first.
+	OrderSortOldest OrderSort = "created_at"
+)
+
+// OrderCursor is the position of the last order of a search page.
+// The next page starts after it. A zero cursor is the first page.
+type OrderCursor struct {
+	CreatedAt time.Time
+	ID        OrderID
+}
+
+// IsZero returns true for the first page cursor.
+func (c OrderCursor) IsZero() bool {
+	return c.ID == 0
+}
+
+// String returns the cursor as an opaque string (used by the clients to get the next page).
+func (c OrderCursor) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	value := fmt.Sprintf("%d.%d", c.CreatedAt.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+// ParseOrderCursor parses a cursor returned by OrderCursor.String.
+// An empty value is the first page cursor.
+// The following errors can happen: ErrInvalidCursor.
+func ParseOrderCursor(value string) (OrderCursor, error) {
+	if value == "" {
+		return OrderCursor{}, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return OrderCursor{}, ErrInvalidCursor
+	}
+	parts := strings.Split(string(decoded), ".")
+	if len(parts) != 2 {
+		return OrderCursor{}, ErrInvalidCursor
+	}
+	createdAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return OrderCursor{}, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || id <= 0 {
+		return OrderCursor{}, ErrInvalidCursor
+	}
+	return OrderCursor{CreatedAt: time.Unix(0, createdAt).UTC(), ID: OrderID(id)}, nil
+}
+
+// OrderFilter holds the criteria of an order search.
+// Zero values are not used as criteria.
+type OrderFilter struct {
+	UserID  users.UserID
+	AssetID assets.AssetID
+	Status  OrderStatus
+	Type    OrderType
+	From    time.Time   // Orders created at or after this time.
+	To      time.Time   // Orders created before this time.
+	Sort    OrderSort   // Sorted by creation time and ID.
+	After   OrderCursor // Orders after this position (next page).
+	Limit   int
+}
+
+// OrderPage is a page of an order search.
+type OrderPage struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"next_cursor"` // Empty on the last page.
+}
+
+// MassCancelFailure is an order that could not be canceled by a mass cancel.
+type MassCancelFailure struct {
+	OrderID OrderID `json:"order_id"`
+	Error   string  `json:"error"`
+}
+
+// MassCancelResult is the summary of a mass cancel.
+type MassCancelResult struct {
+	Sent   []OrderID           `json:"sent"`   // Orders changed to "canceling".
+	Failed []MassCancelFailure `json:"failed"` // Orders that were not canceled.
 }
@@ -0,0 +1,87 @@
+package orders_test
+
+import (
+	"home-broker/orders"
+	"testing"
+	"time"
+)
+
+func TestOutboxMessageBackoff(t *testing.T) {
+	testTable := []struct {
+		test     string
+		attempts int
+		expected time.Duration
+	}{
+		{test: "NoAttempts", attempts: 0, expected: time.Second},
+		{test: "FirstAttempt", attempts: 1, expected: time.Second},
+		{test: "ThirdAttempt", attempts: 3, expected: 4 * time.Second},
+		{test: "Limit", attempts: 30, expected: time.Minute},
+	}
+	for _, table := range testTable {
+		t.Run(table.test, func(t *testing.T) {
+			message := orders.NewOutboxMessage(1, orders.OutboxActionSubmit)
+			message.Attempts = table.attempts
+			backoff := message.Backoff(time.Second, time.Minute)
+			if backoff != table.expected {
+				t.Errorf("backoff is %v, expected %v", backoff, table.expected)
+			}
+		})
+	}
+}
+
+func TestOrderCursor(t *testing.T) {
+	cursor := orders.OrderCursor{CreatedAt: time.Date(2020, 9, 21, 10, 11, 12, 123456000, time.UTC), ID: 999}
+	parsed, err := orders.ParseOrderCursor(cursor.String())
+	if err != nil {
+		t.Error(err)
+	}
+	if !parsed.CreatedAt.Equal(cursor.CreatedAt) || parsed.ID != cursor.ID {
+		t.Errorf("cursor is %v, expected %v", parsed, cursor)
+	}
+
+	first, err := orders.ParseOrderCursor("")
+	if err != nil {
+		t.Error(err)
+	}
+	if !first.IsZero() || first.String() != "" {
+		t.Errorf("cursor is %v, expected the first page", first)
+	}
+}
+
+func TestParseOrderCursor_InvalidValue_ErrInvalidCursor(t *testing.T) {
+	for _, value := range []string{"***", "MTIz", "YS4x", "MTIzLjA"} {
+		_, err := orders.ParseOrderCursor(value)
+		if err != orders.ErrInvalidCursor {
+			t.Errorf("error is %v for %q, expected ErrInvalidCursor", err, value)
+		}
+	}
+}
+
+func TestOrderAddFill(t *testing.T) {
+	order := orders.NewBuyOrder("VIBR", 100, 10000000)
+	order.Status = orders.OrderStatusAccepted
+
+	order.AddFill(10000000, 40)
+	if order.FilledAmount != 40 || order.AveragePrice != 10000000 || order.Status != orders.OrderStatusPartiallyFilled {
+		t.Errorf("order is %v/%v (%v), expected 40/10000000 (partially_filled)", order.FilledAmount, order.AveragePrice, order.Status)
+	}
+
+	order.AddFill(9000000, 60)
+	if order.FilledAmount != 100 || order.AveragePrice != 9400000 || order.Status != orders.OrderStatusFilled {
+		t.Errorf("order is %v/%v (%v), expected 100/9400000 (filled)", order.FilledAmount, order.AveragePrice, order.Status)
+	}
+}
+
+func TestOrderAddFill_Canceling_KeepsStatusUntilFilled(t *testing.T) {
+	order := orders.NewSellOrder("VIBR", 100, 10000000)
+	order.Status = orders.OrderStatusCanceling
+
+	order.AddFill(10000000, 40)
+	if order.Status != orders.OrderStatusCanceling {
+		t.Errorf("status is %v, expected canceling", order.Status)
+	}
+	order.AddFill(10000000, 60)
+	if order.Status != orders.OrderStatusFilled {
+		t.Errorf("status is %v, expected filled", order.Status)
+	}
+}
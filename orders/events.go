@@ -0,0 +1,48 @@
+package orders
+
+import (
+	"home-broker/assets"
+	"home-broker/users"
+)
+
+const (
+	// TopicOrderSubmitted is the topic of the order messages queued to the exchange (new orders, cancels and replaces).
+	// The outbox keeps the messages, the events only wake up the dispatchers (see RunOutboxDispatcher).
+	TopicOrderSubmitted = "orders.submitted"
+
+	// TopicOrderBookUpdates is the topic of the updates queued to the order book of an asset.
+	// The order book queue keeps the updates, the events only wake up the forwarders (see RunOrderBookForwarder).
+	TopicOrderBookUpdates = "orders.orderbookupdates"
+
+	// TopicOrderTrades is the topic of the trades of the orders, published after they are settled (trade notifications).
+	TopicOrderTrades = "orders.trades"
+
+	// eventGroupDispatcher is the consumer group that delivers the order messages to the exchange.
+	eventGroupDispatcher = "orders-dispatcher"
+
+	// eventGroupForwarder is the consumer group that forwards the updates to the order books.
+	eventGroupForwarder = "orders-orderbook-forwarder"
+)
+
+// OrderSubmittedEvent is the payload of TopicOrderSubmitted.
+type OrderSubmittedEvent struct {
+	OrderID OrderID        `json:"order_id"`
+	AssetID assets.AssetID `json:"asset_id"`
+	Action  OutboxAction   `json:"action"`
+}
+
+// OrderBookUpdatesEvent is the payload of TopicOrderBookUpdates.
+type OrderBookUpdatesEvent struct {
+	AssetID assets.AssetID `json:"asset_id"`
+	Count   int            `json:"count"` // Number of updates queued.
+}
+
+// OrderTradeEvent is the payload of TopicOrderTrades.
+type OrderTradeEvent struct {
+	OrderID   OrderID        `json:"order_id"`
+	UserID    users.UserID   `json:"user_id"`
+	AssetID   assets.AssetID `json:"asset_id"`
+	Type      OrderType      `json:"type"`
+	Status    OrderStatus    `json:"status"` // The order status after the trade.
+	Execution Execution      `json:"execution"`
+}
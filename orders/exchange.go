@@ -0,0 +1,75 @@
+package orders
+
+import (
+	"errors"
+	"home-broker/assets"
+	"home-broker/money"
+	"time"
+)
+
+var (
+	// ErrNoExchangeClient happens when there is no exchange client for the exchange of an asset.
+	ErrNoExchangeClient = errors.New("no exchange client for the asset exchange")
+
+	// ErrCancelRejected happens when the exchange rejects a cancel or replace request (ex: the order was filled).
+	// Retrying the request does not help.
+	ErrCancelRejected = errors.New("cancel rejected by the exchange")
+
+	// ErrOrderNotSent happens when the cancel of an order is sent while the order itself is being sent
+	// to the exchange (it has no external ID yet). The cancel is retried.
+	ErrOrderNotSent = errors.New("order not sent to the exchange yet")
+
+	// ErrInvalidExchangeResponse happens when the exchange answers a request with an unexpected status
+	// (ex: a submit answered as "filled"). The request is retried.
+	ErrInvalidExchangeResponse = errors.New("invalid exchange response")
+)
+
+// ExchangeResponse represents the response of an exchange to an order request.
+type ExchangeResponse struct {
+	ID        ExternalOrderID // Order ID generated by the exchange (external ID).
+	Timestamp time.Time       // Exchange timestamp.
+	Status    OrderStatus     // New order status.
+}
+
+// ExchangeClient is an interface that sends order requests to an exchange (ex: B3/Nasdaq).
+// The internal order ID must be sent as the client order ID, so repeated requests are not duplicated.
+type ExchangeClient interface {
+	// SubmitOrder must send a new order to the exchange.
+	// The status is "accepted" or "denied", even if the order is matched before the response:
+	// the fills are received only as updates (see ExternalUpdate).
+	SubmitOrder(order Order) (ExchangeResponse, error)
+
+	// CancelOrder must cancel an order on the exchange.
+	// The status is "canceled" (or "canceling" while the exchange does not confirm it).
+	// The following errors can happen: ErrCancelRejected.
+	CancelOrder(order Order) (ExchangeResponse, error)
+
+	// ReplaceOrder must change the price and amount of an order on the exchange.
+	// The amount is the new total amount of the order (the filled amount included).
+	// The ID is the external ID of the replacement order (it can be the same one).
+	// The following errors can happen: ErrCancelRejected.
+	ReplaceOrder(order Order, price money.Money, amount assets.AssetUnit) (ExchangeResponse, error)
+
+	// GetOrderStatus must return the current state of an order on the exchange.
+	GetOrderStatus(order Order) (ExchangeResponse, error)
+}
+
+// ExchangeUpdateSource is an exchange client that also receives the order updates
+// (ex: FIX execution reports), instead of the webhook.
+type ExchangeUpdateSource interface {
+	// Updates must return the order updates received from the exchange.
+	Updates() <-chan ExternalUpdate
+}
+
+// ExchangeClients chooses the exchange client by the exchange ID of the assets.
+type ExchangeClients map[assets.ExchangeID]ExchangeClient
+
+// Get returns the exchange client of an exchange.
+// The following errors can happen: ErrNoExchangeClient.
+func (clients ExchangeClients) Get(exchangeID assets.ExchangeID) (ExchangeClient, error) {
+	client, ok := clients[exchangeID]
+	if !ok || client == nil {
+		return nil, ErrNoExchangeClient
+	}
+	return client, nil
+}
@@ -0,0 +1,22 @@
+package orders_test
+
+import (
+	"home-broker/orders"
+	ordersfake "home-broker/orders/implem/fake"
+	"testing"
+)
+
+func TestExchangeClientsGet(t *testing.T) {
+	clients := orders.ExchangeClients{"VIBR": ordersfake.NewExchangeClient()}
+	client, err := clients.Get("VIBR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client == nil {
+		t.Errorf("a client was expected")
+	}
+	_, err = clients.Get("B3")
+	if err != orders.ErrNoExchangeClient {
+		t.Errorf("received %v, expected %v", err, orders.ErrNoExchangeClient)
+	}
+}
@@ -0,0 +1,94 @@
+package orders
+
+import (
+	"home-broker/assets"
+	"home-broker/money"
+	"home-broker/users"
+	"time"
+)
+
+type (
+	// OrderGroupID represents the OrderGroup ID type.
+	OrderGroupID int64
+
+	// OrderGroupType represents the type of an order group.
+	// Use the value of OrderGroupTypeOCO or OrderGroupTypeBracket to set this data type.
+	OrderGroupType string
+)
+
+const (
+	// OrderGroupTypeOCO is a group of orders of the same type where one cancels the others:
+	// when an order is filled (even partially), canceled or denied, the others are canceled.
+	OrderGroupTypeOCO OrderGroupType = "oco"
+
+	// OrderGroupTypeBracket is an entry order with exit orders of the opposite type (ex: take-profit and stop-loss).
+	// The exits wait until the entry is filled and then they work as an OCO.
+	OrderGroupTypeBracket OrderGroupType = "bracket"
+)
+
+// OrderGroup is a group of orders of a user and asset that depend on each other (OCO or bracket).
+type OrderGroup struct {
+	ID        OrderGroupID   `json:"id"`
+	Type      OrderGroupType `json:"type"`
+	UserID    users.UserID   `json:"user_id"`
+	AssetID   assets.AssetID `json:"asset_id"`
+	Orders    []Order        `json:"orders"` // The legs, the oldest first (the bracket entry first).
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt time.Time      `json:"-"`
+}
+
+// Siblings returns the legs of the group that cancel each other with "order" (same parent), without it.
+func (g OrderGroup) Siblings(order Order) []Order {
+	siblings := make([]Order, 0, len(g.Orders))
+	for _, leg := range g.Orders {
+		if leg.ID != order.ID && leg.ParentID == order.ParentID {
+			siblings = append(siblings, leg)
+		}
+	}
+	return siblings
+}
+
+// Children returns the legs of the group that wait for "order" to fill (bracket exits).
+func (g OrderGroup) Children(order Order) []Order {
+	children := make([]Order, 0, len(g.Orders))
+	for _, leg := range g.Orders {
+		if leg.ParentID == order.ID {
+			children = append(children, leg)
+		}
+	}
+	return children
+}
+
+// StopTriggered returns true if a trade at "price" triggers the stop price of an order.
+// A selling stop is triggered at or below its stop price and a buying stop at or above it.
+func (o Order) StopTriggered(price money.Money) bool {
+	if o.StopPrice <= 0 {
+		return false
+	}
+	if o.Type == OrderTypeSell {
+		return price <= o.StopPrice
+	}
+	return price >= o.StopPrice
+}
+
+// MaxRequiredHolds returns the largest funds and assets required by one of the orders (see Order.RequiredHolds).
+// Orders that cancel each other need to hold only for one of them.
+// The following errors can happen: money.ErrOverflow.
+func MaxRequiredHolds(orders []Order) (money.Money, assets.AssetUnit, error) {
+	var funds money.Money
+	var amount assets.AssetUnit
+	for _, order := range orders {
+		orderFunds, orderAssets, err := order.RequiredHolds()
+		if err != nil {
+			return 0, 0, err
+		}
+		if orderFunds > funds {
+			funds = orderFunds
+		}
+		if orderAssets > amount {
+			amount = orderAssets
+		}
+	}
+	return funds, amount, nil
+}
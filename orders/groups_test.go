@@ -0,0 +1,62 @@
+package orders_test
+
+import (
+	"home-broker/money"
+	"home-broker/orders"
+	"testing"
+)
+
+func TestOrderGroupSiblingsChildren(t *testing.T) {
+	group := orders.OrderGroup{
+		Type: orders.OrderGroupTypeBracket,
+		Orders: []orders.Order{
+			{ID: 1},
+			{ID: 2, ParentID: 1},
+			{ID: 3, ParentID: 1},
+		},
+	}
+	siblings := group.Siblings(group.Orders[0])
+	if len(siblings) != 0 {
+		t.Errorf("siblings of the entry are %v, expected none", siblings)
+	}
+	siblings = group.Siblings(group.Orders[1])
+	if len(siblings) != 1 || siblings[0].ID != 3 {
+		t.Errorf("siblings of the exit are %v, expected [3]", siblings)
+	}
+	children := group.Children(group.Orders[0])
+	if len(children) != 2 || children[0].ID != 2 || children[1].ID != 3 {
+		t.Errorf("children of the entry are %v, expected [2 3]", children)
+	}
+}
+
+func TestOrderStopTriggered(t *testing.T) {
+	testTable := []struct {
+		order    orders.Order
+		price    money.Money
+		expected bool
+	}{
+		{order: orders.Order{Type: orders.OrderTypeSell, StopPrice: 100}, price: 101, expected: false},
+		{order: orders.Order{Type: orders.OrderTypeSell, StopPrice: 100}, price: 100, expected: true},
+		{order: orders.Order{Type: orders.OrderTypeSell, StopPrice: 100}, price: 99, expected: true},
+		{order: orders.Order{Type: orders.OrderTypeBuy, StopPrice: 100}, price: 99, expected: false},
+		{order: orders.Order{Type: orders.OrderTypeBuy, StopPrice: 100}, price: 101, expected: true},
+		{order: orders.Order{Type: orders.OrderTypeBuy}, price: 101, expected: false},
+	}
+	for _, tc := range testTable {
+		triggered := tc.order.StopTriggered(tc.price)
+		if triggered != tc.expected {
+			t.Errorf("%v stop %v at %v is %v, expected %v", tc.order.Type, tc.order.StopPrice, tc.price, triggered, tc.expected)
+		}
+	}
+}
+
+func TestMaxRequiredHolds(t *testing.T) {
+	legs := []orders.Order{
+		orders.NewSellOrder("VIBR", 100, 20),
+		orders.NewSellOrder("VIBR", 150, 10),
+	}
+	funds, assets, err := orders.MaxRequiredHolds(legs)
+	if err != nil || funds != 0 || assets != 150 {
+		t.Errorf("received %v/%v, expected %v/%v", funds, assets, 0, 150)
+	}
+}
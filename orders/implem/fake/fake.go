@@ -0,0 +1,66 @@
+package ordersfake
+
+import (
+	"fmt"
+	"home-broker/assets"
+	"home-broker/money"
+	"home-broker/orders"
+	"time"
+)
+
+// ExchangeClient is a fake exchange that accepts all the requests.
+// It is used on development and by exchanges without a real client.
+type ExchangeClient struct {
+	orders.ExchangeClient
+}
+
+// NewExchangeClient creates a new fake ExchangeClient.
+func NewExchangeClient() ExchangeClient {
+	return ExchangeClient{}
+}
+
+// externalID returns the fake external ID of an order.
+// It only depends of the order ID, so repeated requests have the same response.
+func (ExchangeClient) externalID(order orders.Order) orders.ExternalOrderID {
+	return orders.ExternalOrderID(fmt.Sprintf("EX-%v", order.ID))
+}
+
+// SubmitOrder accepts a new order.
+func (client ExchangeClient) SubmitOrder(order orders.Order) (orders.ExchangeResponse, error) {
+	return orders.ExchangeResponse{
+		ID:        client.externalID(order),
+		Timestamp: time.Now(),
+		Status:    orders.OrderStatusAccepted,
+	}, nil
+}
+
+// CancelOrder cancels an order.
+func (client ExchangeClient) CancelOrder(order orders.Order) (orders.ExchangeResponse, error) {
+	return orders.ExchangeResponse{
+		ID:        client.externalID(order),
+		Timestamp: time.Now(),
+		Status:    orders.OrderStatusCanceled,
+	}, nil
+}
+
+// ReplaceOrder accepts the new price and amount of an order, keeping the same external ID.
+func (client ExchangeClient) ReplaceOrder(order orders.Order, price money.Money, amount assets.AssetUnit) (orders.ExchangeResponse, error) {
+	return orders.ExchangeResponse{
+		ID:        client.externalID(order),
+		Timestamp: time.Now(),
+		Status:    orders.OrderStatusAccepted,
+	}, nil
+}
+
+// GetOrderStatus returns the order status. Pending orders are reported as accepted.
+func (client ExchangeClient) GetOrderStatus(order orders.Order) (orders.ExchangeResponse, error) {
+	status := order.Status
+	if status == orders.OrderStatusPending {
+		status = orders.OrderStatusAccepted
+	}
+	return orders.ExchangeResponse{
+		ID:        client.externalID(order),
+		Timestamp: time.Now(),
+		Status:    status,
+	}, nil
+}
@@ -0,0 +1,390 @@
+package ordersfix
+
+import (
+	"errors"
+	"fmt"
+	"home-broker/assets"
+	"home-broker/money"
+	"home-broker/orders"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// FIX ExecType (150) values.
+const (
+	ExecTypeNew         = "0"
+	ExecTypeCanceled    = "4"
+	ExecTypeReplaced    = "5"
+	ExecTypePendingNew  = "A"
+	ExecTypeRejected    = "8"
+	ExecTypeTrade       = "F"
+	ExecTypeOrderStatus = "I"
+)
+
+// FIX OrdStatus (39) values.
+const (
+	OrdStatusNew             = "0"
+	OrdStatusPartiallyFilled = "1"
+	OrdStatusFilled          = "2"
+	OrdStatusCanceled        = "4"
+	OrdStatusPendingCancel   = "6"
+	OrdStatusRejected        = "8"
+	OrdStatusPendingNew      = "A"
+	OrdStatusPendingReplace  = "E"
+)
+
+// FIX LastLiquidityInd (851) values.
+const (
+	LastLiquidityIndAdded   = "1" // maker
+	LastLiquidityIndRemoved = "2" // taker
+)
+
+var (
+	// ErrTimeout happens when the exchange does not answer a request in time.
+	ErrTimeout = errors.New("FIX request timeout")
+
+	// ErrCancelRejected happens when the exchange rejects a cancel or replace request (OrderCancelReject).
+	ErrCancelRejected = orders.ErrCancelRejected
+)
+
+// pendingRequest waits for the answer of a request.
+type pendingRequest struct {
+	execTypes map[string]bool // ExecTypes that answer the request.
+	response  chan Message
+}
+
+// ExchangeClient sends the orders to an exchange over a FIX 4.4 session.
+// It is also an update source: the execution reports are published as ExternalUpdate on Updates.
+type ExchangeClient struct {
+	orders.ExchangeClient
+	session *Session
+	timeout time.Duration
+
+	mux        sync.Mutex
+	pending    map[string]*pendingRequest        // by ClOrdID (or OrdStatusReqID)
+	externalID map[string]orders.ExternalOrderID // exchange order ID by ClOrdID
+	updates    chan orders.ExternalUpdate
+	lastReqID  int64
+}
+
+// NewExchangeClient creates a new FIX ExchangeClient.
+// The requests wait up to "timeout" for the exchange answer. Call Start to connect.
+func NewExchangeClient(config SessionConfig, timeout time.Duration) *ExchangeClient {
+	client := &ExchangeClient{
+		timeout:    timeout,
+		pending:    make(map[string]*pendingRequest),
+		externalID: make(map[string]orders.ExternalOrderID),
+		updates:    make(chan orders.ExternalUpdate, 1000),
+	}
+	client.session = NewSession(config, client.onMessage)
+	return client
+}
+
+// Start connects the FIX session.
+func (client *ExchangeClient) Start() {
+	client.session.Start()
+}
+
+// Stop logs out the FIX session.
+func (client *ExchangeClient) Stop() {
+	client.session.Stop()
+}
+
+// Session returns the FIX session.
+func (client *ExchangeClient) Session() *Session {
+	return client.session
+}
+
+// Updates returns the order updates received from the exchange (execution reports).
+func (client *ExchangeClient) Updates() <-chan orders.ExternalUpdate {
+	return client.updates
+}
+
+// SubmitOrder sends a NewOrderSingle. The order ID is the ClOrdID, so the exchange can drop a repeated order.
+// An order rejected by the exchange is denied.
+func (client *ExchangeClient) SubmitOrder(order orders.Order) (orders.ExchangeResponse, error) {
+	clOrdID := strconv.FormatInt(int64(order.ID), 10)
+	msg := NewMessage(MsgTypeNewOrderSingle)
+	msg.Set(TagClOrdID, clOrdID)
+	msg.Set(TagSymbol, string(order.AssetID))
+	msg.Set(TagSide, side(order.Type))
+	msg.Set(TagTransactTime, FormatTimestamp(time.Now()))
+	msg.Set(TagOrderQty, formatAssetUnit(order.Amount))
+	msg.Set(TagOrdType, "2") // limit
+	msg.Set(TagPrice, formatMoney(order.Price))
+	msg.Set(TagTimeInForce, "0") // day
+	report, err := client.request(msg, clOrdID, ExecTypeNew, ExecTypePendingNew, ExecTypeRejected, ExecTypeTrade)
+	if err != nil {
+		return orders.ExchangeResponse{}, err
+	}
+	response := client.exchangeResponse(report)
+	switch response.Status {
+	case orders.OrderStatusPartiallyFilled, orders.OrderStatusFilled:
+		// The order was matched before it was acknowledged, the fills are received as updates.
+		response.Status = orders.OrderStatusAccepted
+	}
+	return response, nil
+}
+
+// CancelOrder sends an OrderCancelRequest.
+// The following errors can happen: ErrCancelRejected, ErrTimeout.
+func (client *ExchangeClient) CancelOrder(order orders.Order) (orders.ExchangeResponse, error) {
+	clOrdID := client.newClOrdID(order, "C")
+	msg := NewMessage(MsgTypeOrderCancelRequest)
+	msg.Set(TagOrigClOrdID, strconv.FormatInt(int64(order.ID), 10))
+	msg.Set(TagOrderID, string(order.ExternalID))
+	msg.Set(TagClOrdID, clOrdID)
+	msg.Set(TagSymbol, string(order.AssetID))
+	msg.Set(TagSide, side(order.Type))
+	msg.Set(TagTransactTime, FormatTimestamp(time.Now()))
+	msg.Set(TagOrderQty, formatAssetUnit(order.Amount))
+	report, err := client.request(msg, clOrdID, ExecTypeCanceled)
+	if err != nil {
+		return orders.ExchangeResponse{}, err
+	}
+	return client.exchangeResponse(report), nil
+}
+
+// ReplaceOrder sends an OrderCancelReplaceRequest. The response has the order ID after the replace.
+// The following errors can happen: ErrCancelRejected, ErrTimeout.
+func (client *ExchangeClient) ReplaceOrder(order orders.Order, price money.Money, amount assets.AssetUnit) (orders.ExchangeResponse, error) {
+	clOrdID := client.newClOrdID(order, "R")
+	msg := NewMessage(MsgTypeOrderCancelReplaceRequest)
+	msg.Set(TagOrigClOrdID, strconv.FormatInt(int64(order.ID), 10))
+	msg.Set(TagOrderID, string(order.ExternalID))
+	msg.Set(TagClOrdID, clOrdID)
+	msg.Set(TagSymbol, string(order.AssetID))
+	msg.Set(TagSide, side(order.Type))
+	msg.Set(TagTransactTime, FormatTimestamp(time.Now()))
+	msg.Set(TagOrderQty, formatAssetUnit(amount))
+	msg.Set(TagOrdType, "2") // limit
+	msg.Set(TagPrice, formatMoney(price))
+	report, err := client.request(msg, clOrdID, ExecTypeReplaced)
+	if err != nil {
+		return orders.ExchangeResponse{}, err
+	}
+	return client.exchangeResponse(report), nil
+}
+
+// GetOrderStatus sends an OrderStatusRequest.
+// The following errors can happen: ErrTimeout.
+func (client *ExchangeClient) GetOrderStatus(order orders.Order) (orders.ExchangeResponse, error) {
+	reqID := client.newClOrdID(order, "S")
+	msg := NewMessage(MsgTypeOrderStatusRequest)
+	msg.Set(TagOrderID, string(order.ExternalID))
+	msg.Set(TagClOrdID, strconv.FormatInt(int64(order.ID), 10))
+	msg.Set(TagSymbol, string(order.AssetID))
+	msg.Set(TagSide, side(order.Type))
+	msg.Set(TagOrdStatusReqID, reqID)
+	report, err := client.request(msg, reqID, ExecTypeOrderStatus)
+	if err != nil {
+		return orders.ExchangeResponse{}, err
+	}
+	return client.exchangeResponse(report), nil
+}
+
+// newClOrdID returns a new unique ClOrdID for a request about an order.
+func (client *ExchangeClient) newClOrdID(order orders.Order, prefix string) string {
+	reqID := atomic.AddInt64(&client.lastReqID, 1)
+	return fmt.Sprintf("%d-%s%d-%d", order.ID, prefix, time.Now().Unix(), reqID)
+}
+
+// request sends a message and waits for the execution report with one of the ExecTypes.
+func (client *ExchangeClient) request(msg Message, key string, execTypes ...string) (Message, error) {
+	pending := &pendingRequest{execTypes: make(map[string]bool), response: make(chan Message, 1)}
+	for _, execType := range execTypes {
+		pending.execTypes[execType] = true
+	}
+	client.mux.Lock()
+	client.pending[key] = pending
+	client.mux.Unlock()
+	defer func() {
+		client.mux.Lock()
+		delete(client.pending, key)
+		client.mux.Unlock()
+	}()
+
+	err := client.session.Send(msg)
+	if err != nil {
+		return Message{}, err
+	}
+	select {
+	case report := <-pending.response:
+		if report.MsgType() == MsgTypeOrderCancelReject {
+			return Message{}, fmt.Errorf("%w: %s", ErrCancelRejected, report.Get(TagText))
+		}
+		return report, nil
+	case <-time.After(client.timeout):
+		return Message{}, ErrTimeout
+	}
+}
+
+// onMessage handles the application messages of the session.
+func (client *ExchangeClient) onMessage(msg Message) {
+	switch msg.MsgType() {
+	case MsgTypeExecutionReport:
+		execType := msg.Get(TagExecType)
+		key := msg.Get(TagClOrdID)
+		if execType == ExecTypeOrderStatus {
+			key = msg.Get(TagOrdStatusReqID)
+		}
+		client.answer(key, execType, msg)
+		for _, update := range client.externalUpdates(msg) {
+			client.updates <- update
+		}
+	case MsgTypeOrderCancelReject:
+		client.answer(msg.Get(TagClOrdID), "", msg)
+	default:
+		log.Printf("FIX message not handled: %v\n", msg)
+	}
+}
+
+// answer delivers a message to a pending request.
+// An empty ExecType answers any request (ex: cancel rejects).
+func (client *ExchangeClient) answer(key string, execType string, msg Message) {
+	client.mux.Lock()
+	defer client.mux.Unlock()
+	pending, ok := client.pending[key]
+	if !ok || (execType != "" && !pending.execTypes[execType]) {
+		return
+	}
+	select {
+	case pending.response <- msg:
+	default:
+	}
+}
+
+// exchangeResponse maps an execution report to an ExchangeResponse.
+func (client *ExchangeClient) exchangeResponse(report Message) orders.ExchangeResponse {
+	timestamp, err := ParseTimestamp(report.Get(TagTransactTime))
+	if err != nil {
+		timestamp = time.Now()
+	}
+	return orders.ExchangeResponse{
+		ID:        orders.ExternalOrderID(report.Get(TagOrderID)),
+		Timestamp: timestamp,
+		Status:    orderStatus(report),
+	}
+}
+
+// externalUpdates maps an execution report to the order book updates.
+// A replace removes the old order and adds the new one.
+func (client *ExchangeClient) externalUpdates(report Message) []orders.ExternalUpdate {
+	timestamp, err := ParseTimestamp(report.Get(TagTransactTime))
+	if err != nil {
+		timestamp = time.Now()
+	}
+	update := orders.ExternalUpdate{
+		ID:            orders.ExternalOrderID(report.Get(TagOrderID)),
+		AssetID:       assets.AssetID(report.Get(TagSymbol)),
+		Type:          orderType(report.Get(TagSide)),
+		Timestamp:     timestamp,
+		ClientOrderID: report.Get(TagClOrdID),
+	}
+	price, _ := money.NewMoneyFromFloatString(report.Get(TagPrice))
+	leavesQty, _ := assets.NewAssetUnitFromFloatString(report.Get(TagLeavesQty))
+
+	client.mux.Lock()
+	previousID := client.externalID[report.Get(TagOrigClOrdID)]
+	if update.ID != "" {
+		client.externalID[report.Get(TagClOrdID)] = update.ID
+	}
+	client.mux.Unlock()
+
+	switch report.Get(TagExecType) {
+	case ExecTypeNew:
+		update.Action = orders.ExternalUpdateActionAdded
+		update.Price = price
+		update.Amount = leavesQty
+	case ExecTypeCanceled:
+		update.Action = orders.ExternalUpdateActionDeleted
+		update.Price = price
+		update.Amount = leavesQty
+	case ExecTypeTrade:
+		update.Action = orders.ExternalUpdateActionTraded
+		update.TradeID = orders.ExternalTradeID(report.Get(TagExecID))
+		update.Price, _ = money.NewMoneyFromFloatString(report.Get(TagLastPx))
+		update.Amount, _ = assets.NewAssetUnitFromFloatString(report.Get(TagLastQty))
+		switch report.Get(TagLastLiquidityInd) {
+		case LastLiquidityIndAdded:
+			update.Liquidity = orders.LiquidityMaker
+		case LastLiquidityIndRemoved:
+			update.Liquidity = orders.LiquidityTaker
+		}
+	case ExecTypeReplaced:
+		added := update
+		added.Action = orders.ExternalUpdateActionAdded
+		added.Price = price
+		added.Amount = leavesQty
+		if previousID == "" || previousID == update.ID {
+			// The exchange kept the order ID, the old order must leave the book anyway.
+			previousID = update.ID
+		}
+		deleted := update
+		deleted.ID = previousID
+		deleted.Action = orders.ExternalUpdateActionDeleted
+		return []orders.ExternalUpdate{deleted, added}
+	default:
+		return nil
+	}
+	return []orders.ExternalUpdate{update}
+}
+
+// orderStatus maps the ExecType/OrdStatus of an execution report to an OrderStatus.
+func orderStatus(report Message) orders.OrderStatus {
+	switch report.Get(TagExecType) {
+	case ExecTypeRejected:
+		return orders.OrderStatusDenied
+	case ExecTypeCanceled:
+		return orders.OrderStatusCanceled
+	case ExecTypePendingNew:
+		return orders.OrderStatusPending
+	case ExecTypeTrade, ExecTypeOrderStatus:
+		switch report.Get(TagOrdStatus) {
+		case OrdStatusPartiallyFilled:
+			return orders.OrderStatusPartiallyFilled
+		case OrdStatusFilled:
+			return orders.OrderStatusFilled
+		case OrdStatusCanceled:
+			return orders.OrderStatusCanceled
+		case OrdStatusRejected:
+			return orders.OrderStatusDenied
+		case OrdStatusPendingCancel:
+			return orders.OrderStatusCanceling
+		case OrdStatusPendingNew:
+			return orders.OrderStatusPending
+		}
+	}
+	return orders.OrderStatusAccepted
+}
+
+// side returns the FIX Side (54) of an order type.
+func side(orderType orders.OrderType) string {
+	if orderType == orders.OrderTypeSell {
+		return "2"
+	}
+	return "1"
+}
+
+// orderType returns the order type of a FIX Side (54).
+func orderType(side string) orders.OrderType {
+	if side == "2" {
+		return orders.OrderTypeSell
+	}
+	return orders.OrderTypeBuy
+}
+
+// formatMoney returns a money value as a FIX Price.
+func formatMoney(value money.Money) string {
+	return decimal.New(int64(value), -int32(money.MoneyDecimalPlaces)).String()
+}
+
+// formatAssetUnit returns an asset unit value as a FIX Qty.
+func formatAssetUnit(value assets.AssetUnit) string {
+	return decimal.New(int64(value), -int32(assets.AssetUnitDecimalPlaces)).String()
+}
@@ -0,0 +1,472 @@
+package ordersfix_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"home-broker/orders"
+	ordersfix "home-broker/orders/implem/fix"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// acceptor is a FIX acceptor stub (the exchange side of the session).
+type acceptor struct {
+	t        *testing.T
+	listener net.Listener
+	conns    chan net.Conn
+	conn     net.Conn
+	reader   *bufio.Reader
+	nextSeq  int
+}
+
+func newAcceptor(t *testing.T) *acceptor {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &acceptor{t: t, listener: listener, conns: make(chan net.Conn, 10), nextSeq: 1}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			a.conns <- conn
+		}
+	}()
+	return a
+}
+
+func (a *acceptor) close() {
+	a.listener.Close()
+	if a.conn != nil {
+		a.conn.Close()
+	}
+}
+
+func (a *acceptor) accept() {
+	select {
+	case conn := <-a.conns:
+		a.conn = conn
+		a.reader = bufio.NewReader(conn)
+	case <-time.After(3 * time.Second):
+		a.t.Fatal("the client did not connect")
+	}
+}
+
+// expect reads messages until one of the type. Heartbeats are skipped when not expected.
+func (a *acceptor) expect(msgType string) ordersfix.Message {
+	for {
+		a.conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		msg, err := ordersfix.ReadMessage(a.reader)
+		if err != nil {
+			a.t.Fatalf("error waiting for message %v: %v", msgType, err)
+		}
+		if msg.MsgType() == msgType {
+			return msg
+		}
+		if msg.MsgType() != ordersfix.MsgTypeHeartbeat {
+			a.t.Fatalf("message %v was expected, received %v", msgType, msg)
+		}
+	}
+}
+
+// send sends a message with the next sequence number.
+func (a *acceptor) send(msg ordersfix.Message) {
+	a.sendSeq(msg, a.nextSeq)
+	a.nextSeq++
+}
+
+// sendSeq sends a message with a sequence number.
+func (a *acceptor) sendSeq(msg ordersfix.Message, seq int) {
+	msg.Set(ordersfix.TagSenderCompID, "EXCH")
+	msg.Set(ordersfix.TagTargetCompID, "HB")
+	msg.Set(ordersfix.TagMsgSeqNum, strconv.Itoa(seq))
+	msg.Set(ordersfix.TagSendingTime, ordersfix.FormatTimestamp(time.Now()))
+	_, err := a.conn.Write(msg.Encode())
+	if err != nil {
+		a.t.Fatal(err)
+	}
+}
+
+// logon accepts a connection and answers the logon.
+func (a *acceptor) logon() ordersfix.Message {
+	a.accept()
+	logon := a.expect(ordersfix.MsgTypeLogon)
+	reply := ordersfix.NewMessage(ordersfix.MsgTypeLogon)
+	reply.Set(ordersfix.TagEncryptMethod, "0")
+	reply.Set(ordersfix.TagHeartBtInt, logon.Get(ordersfix.TagHeartBtInt))
+	a.send(reply)
+	return logon
+}
+
+func newClient(t *testing.T, a *acceptor, heartBtInt time.Duration, timeout time.Duration) *ordersfix.ExchangeClient {
+	return newClientWithConfig(t, a, ordersfix.SessionConfig{HeartBtInt: heartBtInt}, timeout)
+}
+
+func newClientWithConfig(t *testing.T, a *acceptor, config ordersfix.SessionConfig, timeout time.Duration) *ordersfix.ExchangeClient {
+	config.Addr = a.listener.Addr().String()
+	config.SenderCompID = "HB"
+	config.TargetCompID = "EXCH"
+	config.ReconnectInterval = 50 * time.Millisecond
+	client := ordersfix.NewExchangeClient(config, timeout)
+	client.Start()
+	return client
+}
+
+func waitLoggedOn(t *testing.T, client *ordersfix.ExchangeClient) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !client.Session().LoggedOn() {
+		if time.Now().After(deadline) {
+			t.Fatal("the session did not log on")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitUpdate(t *testing.T, client *ordersfix.ExchangeClient) orders.ExternalUpdate {
+	select {
+	case update := <-client.Updates():
+		return update
+	case <-time.After(3 * time.Second):
+		t.Fatal("an update was expected")
+	}
+	return orders.ExternalUpdate{}
+}
+
+func executionReport(execType string, orderID string, clOrdID string) ordersfix.Message {
+	msg := ordersfix.NewMessage(ordersfix.MsgTypeExecutionReport)
+	msg.Set(ordersfix.TagOrderID, orderID)
+	msg.Set(ordersfix.TagClOrdID, clOrdID)
+	msg.Set(ordersfix.TagExecType, execType)
+	msg.Set(ordersfix.TagSymbol, "VIBR")
+	msg.Set(ordersfix.TagSide, "1")
+	msg.Set(ordersfix.TagPrice, "100.5")
+	msg.Set(ordersfix.TagLeavesQty, "10")
+	msg.Set(ordersfix.TagTransactTime, ordersfix.FormatTimestamp(time.Now()))
+	return msg
+}
+
+func TestMessageEncodeRead(t *testing.T) {
+	msg := ordersfix.NewMessage(ordersfix.MsgTypeNewOrderSingle)
+	msg.Set(ordersfix.TagClOrdID, "1")
+	msg.Set(ordersfix.TagMsgSeqNum, "7")
+	encoded := msg.Encode()
+	if !bytes.HasPrefix(encoded, []byte("8=FIX.4.4\x019=")) {
+		t.Errorf("invalid header %q", encoded)
+	}
+	read, err := ordersfix.ReadMessage(bufio.NewReader(bytes.NewReader(encoded)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.MsgType() != ordersfix.MsgTypeNewOrderSingle || read.SeqNum() != 7 || read.Get(ordersfix.TagClOrdID) != "1" {
+		t.Errorf("received %v, expected %v", read, msg)
+	}
+
+	// A changed byte breaks the checksum.
+	encoded[len(encoded)-8] = 'X'
+	_, err = ordersfix.ReadMessage(bufio.NewReader(bytes.NewReader(encoded)))
+	if !errors.Is(err, ordersfix.ErrInvalidMessage) {
+		t.Errorf("received %v, expected %v", err, ordersfix.ErrInvalidMessage)
+	}
+}
+
+func TestExchangeClient_Requests(t *testing.T) {
+	a := newAcceptor(t)
+	defer a.close()
+	client := newClient(t, a, 30*time.Second, 3*time.Second)
+	defer client.Stop()
+	a.logon()
+	waitLoggedOn(t, client)
+
+	order := orders.Order{ID: 42, AssetID: "VIBR", Type: orders.OrderTypeBuy, Price: 100500000, Amount: 10000000}
+
+	// NewOrderSingle -> ExecutionReport (new)
+	done := make(chan orders.ExchangeResponse)
+	go func() {
+		response, err := client.SubmitOrder(order)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- response
+	}()
+	newOrder := a.expect(ordersfix.MsgTypeNewOrderSingle)
+	if newOrder.Get(ordersfix.TagClOrdID) != "42" || newOrder.Get(ordersfix.TagPrice) != "100.5" || newOrder.Get(ordersfix.TagOrderQty) != "10" || newOrder.Get(ordersfix.TagSide) != "1" {
+		t.Errorf("invalid NewOrderSingle %v", newOrder)
+	}
+	a.send(executionReport(ordersfix.ExecTypeNew, "EX-1", "42"))
+	response := <-done
+	if response.ID != "EX-1" || response.Status != orders.OrderStatusAccepted {
+		t.Errorf("invalid response %v", response)
+	}
+	update := waitUpdate(t, client)
+	if update.Action != orders.ExternalUpdateActionAdded || update.ID != "EX-1" || update.Price != 100500000 || update.Amount != 10000000 {
+		t.Errorf("invalid update %v", update)
+	}
+
+	// Unsolicited trade.
+	trade := executionReport(ordersfix.ExecTypeTrade, "EX-1", "42")
+	trade.Set(ordersfix.TagLastPx, "100.25")
+	trade.Set(ordersfix.TagLastQty, "4")
+	trade.Set(ordersfix.TagExecID, "T-1")
+	trade.Set(ordersfix.TagLastLiquidityInd, ordersfix.LastLiquidityIndAdded)
+	a.send(trade)
+	update = waitUpdate(t, client)
+	if update.Action != orders.ExternalUpdateActionTraded || update.TradeID != "T-1" || update.Price != 100250000 || update.Amount != 4000000 ||
+		update.Liquidity != orders.LiquidityMaker {
+		t.Errorf("invalid update %v", update)
+	}
+
+	// OrderCancelRequest -> OrderCancelReject
+	order.ExternalID = "EX-1"
+	errs := make(chan error)
+	go func() {
+		_, err := client.CancelOrder(order)
+		errs <- err
+	}()
+	cancel := a.expect(ordersfix.MsgTypeOrderCancelRequest)
+	if cancel.Get(ordersfix.TagOrigClOrdID) != "42" || cancel.Get(ordersfix.TagOrderID) != "EX-1" {
+		t.Errorf("invalid OrderCancelRequest %v", cancel)
+	}
+	reject := ordersfix.NewMessage(ordersfix.MsgTypeOrderCancelReject)
+	reject.Set(ordersfix.TagClOrdID, cancel.Get(ordersfix.TagClOrdID))
+	reject.Set(ordersfix.TagText, "too late")
+	a.send(reject)
+	err := <-errs
+	if !errors.Is(err, ordersfix.ErrCancelRejected) {
+		t.Errorf("received %v, expected %v", err, ordersfix.ErrCancelRejected)
+	}
+
+	// OrderCancelReplaceRequest -> ExecutionReport (replaced)
+	go func() {
+		response, err := client.ReplaceOrder(order, 101000000, 6000000)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- response
+	}()
+	replace := a.expect(ordersfix.MsgTypeOrderCancelReplaceRequest)
+	if replace.Get(ordersfix.TagPrice) != "101" || replace.Get(ordersfix.TagOrderQty) != "6" {
+		t.Errorf("invalid OrderCancelReplaceRequest %v", replace)
+	}
+	replaced := executionReport(ordersfix.ExecTypeReplaced, "EX-2", replace.Get(ordersfix.TagClOrdID))
+	replaced.Set(ordersfix.TagOrigClOrdID, "42")
+	a.send(replaced)
+	response = <-done
+	if response.ID != "EX-2" || response.Status != orders.OrderStatusAccepted {
+		t.Errorf("invalid response %v", response)
+	}
+	deleted := waitUpdate(t, client)
+	added := waitUpdate(t, client)
+	if deleted.Action != orders.ExternalUpdateActionDeleted || deleted.ID != "EX-1" || added.Action != orders.ExternalUpdateActionAdded || added.ID != "EX-2" {
+		t.Errorf("invalid updates %v %v", deleted, added)
+	}
+
+	// OrderStatusRequest -> ExecutionReport (order status)
+	go func() {
+		response, err := client.GetOrderStatus(order)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- response
+	}()
+	statusRequest := a.expect(ordersfix.MsgTypeOrderStatusRequest)
+	status := executionReport(ordersfix.ExecTypeOrderStatus, "EX-2", "42")
+	status.Set(ordersfix.TagOrdStatus, ordersfix.OrdStatusCanceled)
+	status.Set(ordersfix.TagOrdStatusReqID, statusRequest.Get(ordersfix.TagOrdStatusReqID))
+	a.send(status)
+	response = <-done
+	if response.Status != orders.OrderStatusCanceled {
+		t.Errorf("status is %v, expected %v", response.Status, orders.OrderStatusCanceled)
+	}
+}
+
+func TestSession_TestRequest_Heartbeat(t *testing.T) {
+	a := newAcceptor(t)
+	defer a.close()
+	client := newClient(t, a, 30*time.Second, time.Second)
+	defer client.Stop()
+	a.logon()
+	waitLoggedOn(t, client)
+
+	testRequest := ordersfix.NewMessage(ordersfix.MsgTypeTestRequest)
+	testRequest.Set(ordersfix.TagTestReqID, "abc")
+	a.send(testRequest)
+	heartbeat := a.expect(ordersfix.MsgTypeHeartbeat)
+	if heartbeat.Get(ordersfix.TagTestReqID) != "abc" {
+		t.Errorf("TestReqID is %v, expected abc", heartbeat.Get(ordersfix.TagTestReqID))
+	}
+}
+
+func TestSession_SendsHeartbeats(t *testing.T) {
+	a := newAcceptor(t)
+	defer a.close()
+	client := newClient(t, a, 200*time.Millisecond, time.Second)
+	defer client.Stop()
+	a.logon()
+	a.expect(ordersfix.MsgTypeHeartbeat)
+}
+
+func TestSession_Gap_SendsResendRequest(t *testing.T) {
+	a := newAcceptor(t)
+	defer a.close()
+	client := newClient(t, a, 30*time.Second, time.Second)
+	defer client.Stop()
+	a.logon() // acceptor seq 1
+	waitLoggedOn(t, client)
+
+	// Messages 2 to 4 were lost.
+	a.sendSeq(executionReport(ordersfix.ExecTypeNew, "EX-5", "5"), 5)
+	resendRequest := a.expect(ordersfix.MsgTypeResendRequest)
+	if resendRequest.Get(ordersfix.TagBeginSeqNo) != "2" || resendRequest.Get(ordersfix.TagEndSeqNo) != "0" {
+		t.Errorf("invalid ResendRequest %v", resendRequest)
+	}
+
+	// The acceptor skips the admin messages and resends the report.
+	gapFill := ordersfix.NewMessage(ordersfix.MsgTypeSequenceReset)
+	gapFill.Set(ordersfix.TagPossDupFlag, "Y")
+	gapFill.Set(ordersfix.TagGapFillFlag, "Y")
+	gapFill.Set(ordersfix.TagNewSeqNo, "5")
+	a.sendSeq(gapFill, 2)
+	report := executionReport(ordersfix.ExecTypeNew, "EX-5", "5")
+	report.Set(ordersfix.TagPossDupFlag, "Y")
+	a.sendSeq(report, 5)
+
+	update := waitUpdate(t, client)
+	if update.ID != "EX-5" {
+		t.Errorf("update ID is %v, expected EX-5", update.ID)
+	}
+	_, nextIn := client.Session().SeqNums()
+	if nextIn != 6 {
+		t.Errorf("next incoming sequence is %v, expected 6", nextIn)
+	}
+}
+
+func TestSession_ResendRequest_ResendsApplicationMessages(t *testing.T) {
+	a := newAcceptor(t)
+	defer a.close()
+	client := newClient(t, a, 30*time.Second, 200*time.Millisecond)
+	defer client.Stop()
+	a.logon() // client seq 1
+	waitLoggedOn(t, client)
+
+	go client.SubmitOrder(orders.Order{ID: 7, AssetID: "VIBR", Type: orders.OrderTypeSell, Price: 1000000, Amount: 1000000})
+	a.expect(ordersfix.MsgTypeNewOrderSingle) // client seq 2
+
+	resendRequest := ordersfix.NewMessage(ordersfix.MsgTypeResendRequest)
+	resendRequest.Set(ordersfix.TagBeginSeqNo, "1")
+	resendRequest.Set(ordersfix.TagEndSeqNo, "0")
+	a.send(resendRequest)
+
+	gapFill := a.expect(ordersfix.MsgTypeSequenceReset)
+	if gapFill.SeqNum() != 1 || gapFill.Get(ordersfix.TagNewSeqNo) != "2" || gapFill.Get(ordersfix.TagGapFillFlag) != "Y" {
+		t.Errorf("invalid gap fill %v", gapFill)
+	}
+	resent := a.expect(ordersfix.MsgTypeNewOrderSingle)
+	if resent.SeqNum() != 2 || resent.Get(ordersfix.TagPossDupFlag) != "Y" || resent.Get(ordersfix.TagOrigSendingTime) == "" || resent.Get(ordersfix.TagClOrdID) != "7" {
+		t.Errorf("invalid resent message %v", resent)
+	}
+}
+
+func TestSession_Reconnect_KeepsSequenceNumbers(t *testing.T) {
+	a := newAcceptor(t)
+	defer a.close()
+	client := newClient(t, a, 30*time.Second, time.Second)
+	defer client.Stop()
+	logon := a.logon()
+	if logon.SeqNum() != 1 || logon.Get(ordersfix.TagResetSeqNumFlag) != "Y" {
+		t.Errorf("invalid first logon %v", logon)
+	}
+	waitLoggedOn(t, client)
+
+	a.conn.Close()
+	logon = a.logon()
+	if logon.SeqNum() != 2 || logon.Get(ordersfix.TagResetSeqNumFlag) != "" {
+		t.Errorf("invalid logon after the reconnection %v", logon)
+	}
+	waitLoggedOn(t, client)
+	_, nextIn := client.Session().SeqNums()
+	if nextIn != 3 {
+		t.Errorf("next incoming sequence is %v, expected 3", nextIn)
+	}
+}
+
+func TestSession_ResetOnLogon_ResetsSequenceNumbers(t *testing.T) {
+	a := newAcceptor(t)
+	defer a.close()
+	client := newClientWithConfig(t, a, ordersfix.SessionConfig{HeartBtInt: 30 * time.Second, ResetOnLogon: true}, time.Second)
+	defer client.Stop()
+	a.logon()
+	waitLoggedOn(t, client)
+
+	a.conn.Close()
+	a.nextSeq = 1
+	logon := a.logon()
+	if logon.SeqNum() != 1 || logon.Get(ordersfix.TagResetSeqNumFlag) != "Y" {
+		t.Errorf("invalid logon after the reconnection %v", logon)
+	}
+	waitLoggedOn(t, client)
+	nextOut, nextIn := client.Session().SeqNums()
+	if nextOut != 2 || nextIn != 2 {
+		t.Errorf("next sequences are %v/%v, expected 2/2", nextOut, nextIn)
+	}
+}
+
+func TestSession_CounterpartyReset_ResetsSequenceNumbers(t *testing.T) {
+	a := newAcceptor(t)
+	defer a.close()
+	client := newClient(t, a, 30*time.Second, time.Second)
+	defer client.Stop()
+	a.logon()
+	waitLoggedOn(t, client)
+	a.send(executionReport(ordersfix.ExecTypeNew, "EX-1", "1"))
+	waitUpdate(t, client)
+
+	// The exchange restarts its sequence numbers in the middle of the session.
+	reset := ordersfix.NewMessage(ordersfix.MsgTypeLogon)
+	reset.Set(ordersfix.TagEncryptMethod, "0")
+	reset.Set(ordersfix.TagHeartBtInt, "30")
+	reset.Set(ordersfix.TagResetSeqNumFlag, "Y")
+	a.nextSeq = 1
+	a.send(reset)
+	answer := a.expect(ordersfix.MsgTypeLogon)
+	if answer.SeqNum() != 1 || answer.Get(ordersfix.TagResetSeqNumFlag) != "Y" {
+		t.Errorf("invalid logon answer %v", answer)
+	}
+	a.send(executionReport(ordersfix.ExecTypeNew, "EX-2", "2"))
+	update := waitUpdate(t, client)
+	if update.ID != "EX-2" {
+		t.Errorf("update ID is %v, expected EX-2", update.ID)
+	}
+}
+
+func TestSession_ResendRequest_OldMessagesGapFilled(t *testing.T) {
+	a := newAcceptor(t)
+	defer a.close()
+	client := newClientWithConfig(t, a, ordersfix.SessionConfig{HeartBtInt: 30 * time.Second, MaxSentMessages: 1}, 200*time.Millisecond)
+	defer client.Stop()
+	a.logon() // client seq 1
+	waitLoggedOn(t, client)
+
+	go client.SubmitOrder(orders.Order{ID: 7, AssetID: "VIBR", Type: orders.OrderTypeSell, Price: 1000000, Amount: 1000000})
+	a.expect(ordersfix.MsgTypeNewOrderSingle) // client seq 2
+	go client.SubmitOrder(orders.Order{ID: 8, AssetID: "VIBR", Type: orders.OrderTypeSell, Price: 1000000, Amount: 1000000})
+	a.expect(ordersfix.MsgTypeNewOrderSingle) // client seq 3, seq 2 is dropped
+
+	resendRequest := ordersfix.NewMessage(ordersfix.MsgTypeResendRequest)
+	resendRequest.Set(ordersfix.TagBeginSeqNo, "1")
+	resendRequest.Set(ordersfix.TagEndSeqNo, "0")
+	a.send(resendRequest)
+
+	gapFill := a.expect(ordersfix.MsgTypeSequenceReset)
+	if gapFill.SeqNum() != 1 || gapFill.Get(ordersfix.TagNewSeqNo) != "3" {
+		t.Errorf("invalid gap fill %v", gapFill)
+	}
+	resent := a.expect(ordersfix.MsgTypeNewOrderSingle)
+	if resent.SeqNum() != 3 || resent.Get(ordersfix.TagClOrdID) != "8" {
+		t.Errorf("invalid resent message %v", resent)
+	}
+}
@@ -0,0 +1,276 @@
+package ordersfix
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// BeginString is the FIX version of the messages.
+	BeginString = "FIX.4.4"
+
+	// soh is the field separator.
+	soh = '\x01'
+
+	// timestampLayout is the layout of the UTCTimestamp fields.
+	timestampLayout = "20060102-15:04:05.000"
+)
+
+// FIX tags used by the gateway.
+const (
+	TagBeginSeqNo       = 7
+	TagBeginString      = 8
+	TagBodyLength       = 9
+	TagCheckSum         = 10
+	TagClOrdID          = 11
+	TagCumQty           = 14
+	TagEndSeqNo         = 16
+	TagExecID           = 17
+	TagLastPx           = 31
+	TagLastQty          = 32
+	TagMsgSeqNum        = 34
+	TagMsgType          = 35
+	TagNewSeqNo         = 36
+	TagOrderID          = 37
+	TagOrderQty         = 38
+	TagOrdStatus        = 39
+	TagOrdType          = 40
+	TagOrigClOrdID      = 41
+	TagPossDupFlag      = 43
+	TagPrice            = 44
+	TagRefSeqNum        = 45
+	TagSenderCompID     = 49
+	TagSendingTime      = 52
+	TagSide             = 54
+	TagSymbol           = 55
+	TagTargetCompID     = 56
+	TagText             = 58
+	TagTimeInForce      = 59
+	TagTransactTime     = 60
+	TagEncryptMethod    = 98
+	TagHeartBtInt       = 108
+	TagTestReqID        = 112
+	TagOrigSendingTime  = 122
+	TagGapFillFlag      = 123
+	TagResetSeqNumFlag  = 141
+	TagExecType         = 150
+	TagLeavesQty        = 151
+	TagOrdStatusReqID   = 790
+	TagLastLiquidityInd = 851
+)
+
+// FIX message types used by the gateway.
+const (
+	MsgTypeHeartbeat                 = "0"
+	MsgTypeTestRequest               = "1"
+	MsgTypeResendRequest             = "2"
+	MsgTypeReject                    = "3"
+	MsgTypeSequenceReset             = "4"
+	MsgTypeLogout                    = "5"
+	MsgTypeExecutionReport           = "8"
+	MsgTypeOrderCancelReject         = "9"
+	MsgTypeLogon                     = "A"
+	MsgTypeNewOrderSingle            = "D"
+	MsgTypeOrderCancelRequest        = "F"
+	MsgTypeOrderCancelReplaceRequest = "G"
+	MsgTypeOrderStatusRequest        = "H"
+)
+
+// headerTags are written right after the MsgType, in this order.
+var headerTags = []int{TagSenderCompID, TagTargetCompID, TagMsgSeqNum, TagPossDupFlag, TagSendingTime, TagOrigSendingTime}
+
+var (
+	// ErrInvalidMessage happens when the received bytes are not a valid FIX message.
+	ErrInvalidMessage = errors.New("invalid FIX message")
+)
+
+// Field is a FIX "tag=value" pair.
+type Field struct {
+	Tag   int
+	Value string
+}
+
+// Message is a FIX message.
+// BeginString, BodyLength and CheckSum are not kept in the fields, they are set by Encode.
+type Message struct {
+	Fields []Field
+}
+
+// NewMessage creates a new message of a type.
+func NewMessage(msgType string) Message {
+	return Message{Fields: []Field{{Tag: TagMsgType, Value: msgType}}}
+}
+
+// Set replaces the value of a tag or adds it to the end of the message.
+func (m *Message) Set(tag int, value string) {
+	for i := range m.Fields {
+		if m.Fields[i].Tag == tag {
+			m.Fields[i].Value = value
+			return
+		}
+	}
+	m.Fields = append(m.Fields, Field{Tag: tag, Value: value})
+}
+
+// Get returns the value of the first field with the tag, or an empty string.
+func (m Message) Get(tag int) string {
+	for _, field := range m.Fields {
+		if field.Tag == tag {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// GetInt returns the value of a tag as an integer (zero if it is missing or invalid).
+func (m Message) GetInt(tag int) int {
+	value, _ := strconv.Atoi(m.Get(tag))
+	return value
+}
+
+// MsgType returns the message type.
+func (m Message) MsgType() string {
+	return m.Get(TagMsgType)
+}
+
+// SeqNum returns the message sequence number.
+func (m Message) SeqNum() int {
+	return m.GetInt(TagMsgSeqNum)
+}
+
+// IsAdmin returns true for session messages (they are not resent, a gap fill is sent instead).
+func (m Message) IsAdmin() bool {
+	switch m.MsgType() {
+	case MsgTypeHeartbeat, MsgTypeTestRequest, MsgTypeResendRequest, MsgTypeReject, MsgTypeSequenceReset, MsgTypeLogout, MsgTypeLogon:
+		return true
+	}
+	return false
+}
+
+// Copy returns a copy of the message that does not share the fields.
+func (m Message) Copy() Message {
+	fields := make([]Field, len(m.Fields))
+	copy(fields, m.Fields)
+	return Message{Fields: fields}
+}
+
+// Encode returns the message in the FIX wire format.
+// The header fields come first and the BodyLength and CheckSum are computed.
+func (m Message) Encode() []byte {
+	body := bytes.Buffer{}
+	written := make(map[int]bool)
+	writeField := func(tag int) {
+		for _, field := range m.Fields {
+			if field.Tag == tag {
+				fmt.Fprintf(&body, "%d=%s%c", field.Tag, field.Value, soh)
+				written[tag] = true
+				return
+			}
+		}
+	}
+	writeField(TagMsgType)
+	for _, tag := range headerTags {
+		writeField(tag)
+	}
+	for _, field := range m.Fields {
+		if written[field.Tag] || field.Tag == TagBeginString || field.Tag == TagBodyLength || field.Tag == TagCheckSum {
+			continue
+		}
+		fmt.Fprintf(&body, "%d=%s%c", field.Tag, field.Value, soh)
+	}
+
+	msg := bytes.Buffer{}
+	fmt.Fprintf(&msg, "%d=%s%c%d=%d%c", TagBeginString, BeginString, soh, TagBodyLength, body.Len(), soh)
+	msg.Write(body.Bytes())
+	fmt.Fprintf(&msg, "%d=%03d%c", TagCheckSum, checksum(msg.Bytes()), soh)
+	return msg.Bytes()
+}
+
+// String returns the message with "|" as separator (for logs).
+func (m Message) String() string {
+	return strings.ReplaceAll(string(m.Encode()), string(soh), "|")
+}
+
+// ReadMessage reads a message in the FIX wire format.
+// The BodyLength and CheckSum are validated.
+func ReadMessage(reader *bufio.Reader) (Message, error) {
+	beginString, err := reader.ReadString(soh)
+	if err != nil {
+		return Message{}, err
+	}
+	if beginString != fmt.Sprintf("%d=%s%c", TagBeginString, BeginString, soh) {
+		return Message{}, fmt.Errorf("%w: unexpected begin string %q", ErrInvalidMessage, beginString)
+	}
+	bodyLengthField, err := reader.ReadString(soh)
+	if err != nil {
+		return Message{}, err
+	}
+	bodyLengthValue := strings.TrimPrefix(strings.TrimSuffix(bodyLengthField, string(soh)), fmt.Sprintf("%d=", TagBodyLength))
+	bodyLength, err := strconv.Atoi(bodyLengthValue)
+	if err != nil || bodyLength <= 0 {
+		return Message{}, fmt.Errorf("%w: invalid body length %q", ErrInvalidMessage, bodyLengthField)
+	}
+	body := make([]byte, bodyLength)
+	_, err = io.ReadFull(reader, body)
+	if err != nil {
+		return Message{}, err
+	}
+	checksumField, err := reader.ReadString(soh)
+	if err != nil {
+		return Message{}, err
+	}
+	expected := checksum([]byte(beginString + bodyLengthField + string(body)))
+	if checksumField != fmt.Sprintf("%d=%03d%c", TagCheckSum, expected, soh) {
+		return Message{}, fmt.Errorf("%w: invalid checksum %q", ErrInvalidMessage, checksumField)
+	}
+	return parseBody(body)
+}
+
+// parseBody parses the "tag=value" fields of a message body.
+func parseBody(body []byte) (Message, error) {
+	msg := Message{}
+	for _, raw := range bytes.Split(bytes.TrimSuffix(body, []byte{soh}), []byte{soh}) {
+		parts := bytes.SplitN(raw, []byte{'='}, 2)
+		if len(parts) != 2 {
+			return Message{}, fmt.Errorf("%w: invalid field %q", ErrInvalidMessage, raw)
+		}
+		tag, err := strconv.Atoi(string(parts[0]))
+		if err != nil {
+			return Message{}, fmt.Errorf("%w: invalid tag %q", ErrInvalidMessage, parts[0])
+		}
+		msg.Fields = append(msg.Fields, Field{Tag: tag, Value: string(parts[1])})
+	}
+	if msg.MsgType() == "" {
+		return Message{}, fmt.Errorf("%w: missing message type", ErrInvalidMessage)
+	}
+	return msg, nil
+}
+
+// checksum returns the FIX checksum (sum of the bytes modulo 256).
+func checksum(data []byte) int {
+	sum := 0
+	for _, b := range data {
+		sum += int(b)
+	}
+	return sum % 256
+}
+
+// FormatTimestamp returns a time as a FIX UTCTimestamp.
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+// ParseTimestamp parses a FIX UTCTimestamp (with or without milliseconds).
+func ParseTimestamp(value string) (time.Time, error) {
+	t, err := time.Parse(timestampLayout, value)
+	if err != nil {
+		return time.Parse("20060102-15:04:05", value)
+	}
+	return t, nil
+}
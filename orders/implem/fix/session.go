@@ -0,0 +1,435 @@
+package ordersfix
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotLoggedOn happens when a message is sent while the session is not logged on.
+	ErrNotLoggedOn = errors.New("FIX session is not logged on")
+)
+
+// SessionConfig holds the settings of a FIX session.
+type SessionConfig struct {
+	Addr              string        // Acceptor address (ex: "localhost:9876").
+	SenderCompID      string        // Our ID.
+	TargetCompID      string        // Exchange ID.
+	HeartBtInt        time.Duration // Heartbeat interval.
+	ReconnectInterval time.Duration // Wait before reconnecting.
+	MaxSentMessages   int           // Application messages kept for the resend requests (the older ones are gap filled).
+	ResetOnLogon      bool          // Resets the sequence numbers on every logon, not only on the first one.
+}
+
+// Session is a FIX 4.4 initiator session over TCP.
+// It reconnects by itself and keeps the sequence numbers and the last sent messages in memory,
+// so the gaps of a reconnection are recovered with resend requests.
+// The sequence numbers are not persisted: the first logon of a session resets them (ResetSeqNumFlag),
+// and the orders sent before a restart are recovered with order status requests.
+type Session struct {
+	config  SessionConfig
+	handler func(Message) // Receives the application messages, in order.
+
+	// Only one goroutine can change the session state at time.
+	mux          sync.Mutex
+	conn         net.Conn
+	loggedOn     bool
+	nextOutSeq   int
+	nextInSeq    int
+	sent         map[int]Message // Application messages by sequence number, for the resend requests.
+	resendTarget int             // Sequence number that started a resend request (zero if none).
+	resetPending bool            // The next logon resets the sequence numbers.
+	resetSent    bool            // A logon with ResetSeqNumFlag was sent and not answered yet.
+	lastSent     time.Time
+	lastReceived time.Time
+	testReqID    string // Pending test request (empty if none).
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSession creates a new FIX Session.
+// The application messages received are passed to "handler".
+func NewSession(config SessionConfig, handler func(Message)) *Session {
+	if config.HeartBtInt <= 0 {
+		config.HeartBtInt = 30 * time.Second
+	}
+	if config.ReconnectInterval <= 0 {
+		config.ReconnectInterval = 5 * time.Second
+	}
+	if config.MaxSentMessages <= 0 {
+		config.MaxSentMessages = 10000
+	}
+	return &Session{
+		config:       config,
+		handler:      handler,
+		nextOutSeq:   1,
+		nextInSeq:    1,
+		sent:         make(map[int]Message),
+		resetPending: true,
+		stop:         make(chan struct{}),
+	}
+}
+
+// Start connects to the acceptor and keeps the session connected until Stop is called.
+func (s *Session) Start() {
+	go s.run()
+}
+
+// Stop sends a logout and closes the session.
+func (s *Session) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		if s.conn == nil {
+			return
+		}
+		if s.loggedOn {
+			s.writeLocked(NewMessage(MsgTypeLogout))
+		}
+		s.conn.Close()
+	})
+}
+
+// LoggedOn returns true if the session is logged on.
+func (s *Session) LoggedOn() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.loggedOn
+}
+
+// SeqNums returns the next outgoing and incoming sequence numbers.
+func (s *Session) SeqNums() (int, int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.nextOutSeq, s.nextInSeq
+}
+
+// Send sends an application message.
+// The message is kept to be resent if the exchange asks for it.
+// The following errors can happen: ErrNotLoggedOn.
+func (s *Session) Send(msg Message) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.loggedOn {
+		return ErrNotLoggedOn
+	}
+	return s.writeLocked(msg)
+}
+
+// run keeps the session connected.
+func (s *Session) run() {
+	for {
+		err := s.connect()
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		log.Printf("FIX session %s->%s disconnected: %v\n", s.config.SenderCompID, s.config.TargetCompID, err)
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(s.config.ReconnectInterval):
+		}
+	}
+}
+
+// connect opens a connection, logs on and reads the messages until the connection is closed.
+func (s *Session) connect() error {
+	conn, err := net.DialTimeout("tcp", s.config.Addr, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		s.disconnect(conn)
+	}()
+
+	s.mux.Lock()
+	s.conn = conn
+	s.lastReceived = time.Now()
+	s.testReqID = ""
+	reset := s.resetPending || s.config.ResetOnLogon
+	if reset {
+		s.resetSeqNumsLocked()
+		s.nextInSeq = 1
+	}
+	err = s.writeLocked(s.logonMessage(reset))
+	s.mux.Unlock()
+	if err != nil {
+		return err
+	}
+
+	go s.heartbeat(conn, done)
+
+	reader := bufio.NewReader(conn)
+	for {
+		msg, err := ReadMessage(reader)
+		if err != nil {
+			return err
+		}
+		s.receive(conn, msg)
+	}
+}
+
+// disconnect closes a connection and resets the logon state.
+func (s *Session) disconnect(conn net.Conn) {
+	s.mux.Lock()
+	if s.conn == conn {
+		s.conn = nil
+		s.loggedOn = false
+		s.resendTarget = 0
+		s.resetSent = false
+	}
+	s.mux.Unlock()
+	conn.Close()
+}
+
+// logonMessage returns a new logon. "reset" sets the ResetSeqNumFlag.
+func (s *Session) logonMessage(reset bool) Message {
+	logon := NewMessage(MsgTypeLogon)
+	logon.Set(TagEncryptMethod, "0")
+	logon.Set(TagHeartBtInt, strconv.Itoa(int(s.config.HeartBtInt/time.Second)))
+	if reset {
+		logon.Set(TagResetSeqNumFlag, "Y")
+	}
+	return logon
+}
+
+// resetSeqNumsLocked restarts the outgoing sequence numbers and drops the sent messages.
+// The logon sent next has ResetSeqNumFlag.
+// The session must be locked.
+func (s *Session) resetSeqNumsLocked() {
+	s.nextOutSeq = 1
+	s.sent = make(map[int]Message)
+	s.resetSent = true
+}
+
+// heartbeat sends heartbeats when nothing was sent and test requests when nothing was received.
+// The connection is closed if the test request is not answered.
+func (s *Session) heartbeat(conn net.Conn, done <-chan struct{}) {
+	interval := s.config.HeartBtInt
+	ticker := time.NewTicker(interval / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		s.mux.Lock()
+		if s.conn == conn && s.loggedOn {
+			now := time.Now()
+			silence := now.Sub(s.lastReceived)
+			switch {
+			case s.testReqID != "" && silence >= 2*interval:
+				log.Printf("FIX session %s->%s: test request not answered\n", s.config.SenderCompID, s.config.TargetCompID)
+				conn.Close()
+			case s.testReqID == "" && silence >= interval+interval/5:
+				s.testReqID = strconv.FormatInt(now.UnixNano(), 10)
+				testRequest := NewMessage(MsgTypeTestRequest)
+				testRequest.Set(TagTestReqID, s.testReqID)
+				s.writeLocked(testRequest)
+			case now.Sub(s.lastSent) >= interval:
+				s.writeLocked(NewMessage(MsgTypeHeartbeat))
+			}
+		}
+		s.mux.Unlock()
+	}
+}
+
+// receive handles a message read from the connection.
+func (s *Session) receive(conn net.Conn, msg Message) {
+	s.mux.Lock()
+	s.lastReceived = time.Now()
+	s.testReqID = ""
+	deliver, err := s.processLocked(msg)
+	s.mux.Unlock()
+	if err != nil {
+		log.Printf("FIX session %s->%s: %v\n", s.config.SenderCompID, s.config.TargetCompID, err)
+		conn.Close()
+		return
+	}
+	if deliver && s.handler != nil {
+		s.handler(msg)
+	}
+}
+
+// processLocked checks the sequence number and handles the session messages.
+// It returns true if the message must be delivered to the application.
+// The session must be locked.
+func (s *Session) processLocked(msg Message) (bool, error) {
+	msgType := msg.MsgType()
+	seq := msg.SeqNum()
+
+	if msgType == MsgTypeSequenceReset && msg.Get(TagGapFillFlag) != "Y" {
+		// Reset mode ignores the sequence number.
+		newSeq := msg.GetInt(TagNewSeqNo)
+		if newSeq > s.nextInSeq {
+			s.nextInSeq = newSeq
+		}
+		return false, nil
+	}
+	if msgType == MsgTypeLogon && msg.Get(TagResetSeqNumFlag) == "Y" {
+		// The logon with ResetSeqNumFlag is the first message of the counterparty.
+		s.nextInSeq = seq
+		s.resendTarget = 0
+		if !s.resetSent {
+			// The reset was started by the counterparty: our sequence numbers are reset too.
+			s.resetSeqNumsLocked()
+			err := s.writeLocked(s.logonMessage(true))
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	if msgType == MsgTypeLogon {
+		// The logon is accepted even with a gap. The gap is requested below.
+		s.loggedOn = true
+		s.resetPending = false
+		s.resetSent = false
+	}
+	if msgType == MsgTypeLogout {
+		if s.loggedOn {
+			s.loggedOn = false
+			s.writeLocked(NewMessage(MsgTypeLogout))
+		}
+		return false, fmt.Errorf("logout received: %s", msg.Get(TagText))
+	}
+
+	if seq > s.nextInSeq {
+		// The messages after the gap are dropped, they come again with the resend.
+		if s.resendTarget == 0 {
+			resendRequest := NewMessage(MsgTypeResendRequest)
+			resendRequest.Set(TagBeginSeqNo, strconv.Itoa(s.nextInSeq))
+			resendRequest.Set(TagEndSeqNo, "0") // up to the last one
+			s.resendTarget = seq
+			return false, s.writeLocked(resendRequest)
+		}
+		return false, nil
+	}
+	if seq < s.nextInSeq {
+		if msg.Get(TagPossDupFlag) == "Y" {
+			return false, nil
+		}
+		return false, fmt.Errorf("MsgSeqNum too low, expecting %d but received %d", s.nextInSeq, seq)
+	}
+
+	s.nextInSeq++
+	if s.resendTarget != 0 && s.nextInSeq > s.resendTarget {
+		s.resendTarget = 0
+	}
+
+	switch msgType {
+	case MsgTypeTestRequest:
+		heartbeat := NewMessage(MsgTypeHeartbeat)
+		heartbeat.Set(TagTestReqID, msg.Get(TagTestReqID))
+		return false, s.writeLocked(heartbeat)
+	case MsgTypeResendRequest:
+		return false, s.resendLocked(msg.GetInt(TagBeginSeqNo), msg.GetInt(TagEndSeqNo))
+	case MsgTypeSequenceReset:
+		newSeq := msg.GetInt(TagNewSeqNo)
+		if newSeq > s.nextInSeq {
+			s.nextInSeq = newSeq
+		}
+		return false, nil
+	case MsgTypeReject:
+		log.Printf("FIX session %s->%s: message %s rejected: %s\n", s.config.SenderCompID, s.config.TargetCompID, msg.Get(TagRefSeqNum), msg.Get(TagText))
+		return false, nil
+	case MsgTypeHeartbeat, MsgTypeLogon:
+		return false, nil
+	}
+	return true, nil
+}
+
+// resendLocked resends the application messages from "begin" to "end" (zero is the last one).
+// The session messages are not resent, a gap fill is sent instead.
+// The session must be locked.
+func (s *Session) resendLocked(begin int, end int) error {
+	last := s.nextOutSeq - 1
+	if end == 0 || end > last {
+		end = last
+	}
+	gapStart := 0
+	for seq := begin; seq <= end; seq++ {
+		msg, ok := s.sent[seq]
+		if !ok {
+			if gapStart == 0 {
+				gapStart = seq
+			}
+			continue
+		}
+		if gapStart != 0 {
+			err := s.gapFillLocked(gapStart, seq)
+			if err != nil {
+				return err
+			}
+			gapStart = 0
+		}
+		dup := msg.Copy()
+		dup.Set(TagPossDupFlag, "Y")
+		dup.Set(TagOrigSendingTime, msg.Get(TagSendingTime))
+		dup.Set(TagSendingTime, FormatTimestamp(time.Now()))
+		err := s.writeRawLocked(dup)
+		if err != nil {
+			return err
+		}
+	}
+	if gapStart != 0 {
+		return s.gapFillLocked(gapStart, end+1)
+	}
+	return nil
+}
+
+// gapFillLocked sends a sequence reset (gap fill) from "seq" to "newSeq".
+// The session must be locked.
+func (s *Session) gapFillLocked(seq int, newSeq int) error {
+	gapFill := NewMessage(MsgTypeSequenceReset)
+	gapFill.Set(TagSenderCompID, s.config.SenderCompID)
+	gapFill.Set(TagTargetCompID, s.config.TargetCompID)
+	gapFill.Set(TagMsgSeqNum, strconv.Itoa(seq))
+	gapFill.Set(TagPossDupFlag, "Y")
+	gapFill.Set(TagSendingTime, FormatTimestamp(time.Now()))
+	gapFill.Set(TagGapFillFlag, "Y")
+	gapFill.Set(TagNewSeqNo, strconv.Itoa(newSeq))
+	return s.writeRawLocked(gapFill)
+}
+
+// writeLocked sets the header of a new message and writes it.
+// The sequence number is used even if the write fails, so the message is recovered by a resend.
+// Only the last MaxSentMessages sequence numbers are kept for the resends.
+// The session must be locked.
+func (s *Session) writeLocked(msg Message) error {
+	msg = msg.Copy()
+	seq := s.nextOutSeq
+	s.nextOutSeq++
+	msg.Set(TagSenderCompID, s.config.SenderCompID)
+	msg.Set(TagTargetCompID, s.config.TargetCompID)
+	msg.Set(TagMsgSeqNum, strconv.Itoa(seq))
+	msg.Set(TagSendingTime, FormatTimestamp(time.Now()))
+	if !msg.IsAdmin() {
+		s.sent[seq] = msg
+	}
+	delete(s.sent, seq-s.config.MaxSentMessages)
+	return s.writeRawLocked(msg)
+}
+
+// writeRawLocked writes a message as it is.
+// The session must be locked.
+func (s *Session) writeRawLocked(msg Message) error {
+	if s.conn == nil {
+		return ErrNotLoggedOn
+	}
+	s.lastSent = time.Now()
+	_, err := s.conn.Write(msg.Encode())
+	return err
+}
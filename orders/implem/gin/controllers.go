@@ -1,6 +1,8 @@
 package ordersgin
 
 import (
+	"errors"
+	"fmt"
 	"home-broker/assets"
 	"home-broker/core"
 	"home-broker/money"
@@ -8,6 +10,7 @@ import (
 	"home-broker/users"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,6 +20,13 @@ var (
 	apiErrorInvalidOrderID = core.NewAPIError("Invalid order ID.", 400)
 	apiErrorInvalidUserID  = core.NewAPIError("Invalid user ID.", 400)
 	apiErrorInvalidAssetID = core.NewAPIError("Invalid asset ID.", 400)
+	apiErrorInvalidDate    = core.NewAPIError("Invalid date (use RFC 3339).", 400)
+	apiErrorInvalidLimit   = core.NewAPIError("Invalid limit.", 400)
+	apiErrorInvalidCursor  = core.NewAPIError("Invalid cursor.", 400)
+
+	apiErrorTooManyUpdates = core.NewAPIError(fmt.Sprintf("Too many updates (max %d).", orders.MaxExternalUpdatesBatch), 413)
+
+	apiErrorInvalidClientOrderID = core.NewAPIError("The client order ID and the Idempotency-Key header are different.", 400)
 )
 
 // OrderController represents an order controller.
@@ -35,9 +45,42 @@ type AddOrderJSON struct {
 	AssetID assets.AssetID   `json:"asset_id"`
 	Price   money.Money      `json:"price"`
 	Amount  assets.AssetUnit `json:"amount"`
+
+	// ClientOrderID identifies the order for the client, so a retried request does not place it twice.
+	// The "Idempotency-Key" header can be used instead.
+	ClientOrderID string `json:"client_order_id"`
+}
+
+// ReplaceOrderJSON is the JSON received on ReplaceOrder.
+type ReplaceOrderJSON struct {
+	Price  money.Money      `json:"price"`
+	Amount assets.AssetUnit `json:"amount"`
+}
+
+// OrderGroupJSON is the JSON received on PlaceOrderGroup.
+type OrderGroupJSON struct {
+	UserID  users.UserID          `json:"user_id"`
+	AssetID assets.AssetID        `json:"asset_id"`
+	Type    orders.OrderGroupType `json:"type"`
+	Orders  []OrderGroupLegJSON   `json:"orders"`
+}
+
+// OrderGroupLegJSON is an order of OrderGroupJSON.
+type OrderGroupLegJSON struct {
+	Type      orders.OrderType `json:"type"`
+	Price     money.Money      `json:"price"`
+	Amount    assets.AssetUnit `json:"amount"`
+	StopPrice money.Money      `json:"stop_price"`
+}
+
+// OrderDetailJSON is an order with its group (if any), returned by GetOrder.
+type OrderDetailJSON struct {
+	orders.Order
+	Group *orders.OrderGroup `json:"group,omitempty"`
 }
 
 // GetOrder returns an order.
+// The orders of its group (OCO or bracket) are returned too.
 func (orderC OrderController) GetOrder(c *gin.Context) {
 	orderID, err := strconv.ParseInt(c.Param("order_id"), 10, 64)
 	if err != nil {
@@ -53,7 +96,144 @@ func (orderC OrderController) GetOrder(c *gin.Context) {
 		c.Error(core.NewAPIError("Not found", 404))
 		return
 	}
-	c.JSON(http.StatusOK, entity)
+	detail := OrderDetailJSON{Order: *entity}
+	if entity.GroupID != 0 {
+		detail.Group, err = orderC.uc.GetOrderGroup(entity.GroupID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, detail)
+}
+
+// PlaceOrderGroup adds an OCO or bracket group of orders.
+func (orderC OrderController) PlaceOrderGroup(c *gin.Context) {
+	var json OrderGroupJSON
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.Error(apiErrorInvalidJSON)
+		return
+	}
+	legs := make([]orders.Order, 0, len(json.Orders))
+	for _, leg := range json.Orders {
+		legs = append(legs, orders.Order{Type: leg.Type, Price: leg.Price, Amount: leg.Amount, StopPrice: leg.StopPrice})
+	}
+	group, err := orderC.uc.PlaceOrderGroup(json.UserID, json.AssetID, json.Type, legs)
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+// GetOrderExecutions returns the executions (fills) of an order.
+func (orderC OrderController) GetOrderExecutions(c *gin.Context) {
+	orderID, err := strconv.ParseInt(c.Param("order_id"), 10, 64)
+	if err != nil {
+		c.Error(apiErrorInvalidOrderID)
+		return
+	}
+	entities, err := orderC.uc.GetOrderExecutions(orders.OrderID(orderID))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if entities == nil {
+		c.Error(core.NewAPIError("Not found", 404))
+		return
+	}
+	c.JSON(http.StatusOK, entities)
+}
+
+// GetOrderStatusHistory returns the status changes of an order.
+func (orderC OrderController) GetOrderStatusHistory(c *gin.Context) {
+	orderID, err := strconv.ParseInt(c.Param("order_id"), 10, 64)
+	if err != nil {
+		c.Error(apiErrorInvalidOrderID)
+		return
+	}
+	entities, err := orderC.uc.GetOrderStatusHistory(orders.OrderID(orderID))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if entities == nil {
+		c.Error(core.NewAPIError("Not found", 404))
+		return
+	}
+	c.JSON(http.StatusOK, entities)
+}
+
+// GetDeadOrderBookMessages returns the updates refused by the order books (dead letters).
+func (orderC OrderController) GetDeadOrderBookMessages(c *gin.Context) {
+	entities, err := orderC.uc.GetDeadOrderBookMessages(assets.AssetID(c.Query("asset_id")))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, entities)
+}
+
+// SearchOrders returns a page of orders filtered by the query parameters.
+func (orderC OrderController) SearchOrders(c *gin.Context) {
+	filter := orders.OrderFilter{
+		AssetID: assets.AssetID(c.Query("asset_id")),
+		Status:  orders.OrderStatus(c.Query("status")),
+		Type:    orders.OrderType(c.Query("type")),
+		Sort:    orders.OrderSort(c.Query("sort")),
+	}
+	var err error
+	if value := c.Query("user_id"); value != "" {
+		userID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			c.Error(apiErrorInvalidUserID)
+			return
+		}
+		filter.UserID = users.UserID(userID)
+	}
+	if value := c.Query("from"); value != "" {
+		filter.From, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.Error(apiErrorInvalidDate)
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		filter.To, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.Error(apiErrorInvalidDate)
+			return
+		}
+	}
+	if value := c.Query("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil {
+			c.Error(apiErrorInvalidLimit)
+			return
+		}
+	}
+	filter.After, err = orders.ParseOrderCursor(c.Query("cursor"))
+	if err != nil {
+		c.Error(apiErrorInvalidCursor)
+		return
+	}
+
+	page, err := orderC.uc.SearchOrders(filter)
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
 }
 
 // BuyOrder adds an buy Order.
@@ -63,7 +243,12 @@ func (orderC OrderController) BuyOrder(c *gin.Context) {
 		c.Error(apiErrorInvalidJSON)
 		return
 	}
-	entity, err := orderC.uc.BuyOrder(json.UserID, json.AssetID, json.Price, json.Amount)
+	clientOrderID, ok := orderC.clientOrderID(c, json)
+	if !ok {
+		c.Error(apiErrorInvalidClientOrderID)
+		return
+	}
+	entity, err := orderC.uc.BuyOrder(json.UserID, json.AssetID, json.Price, json.Amount, clientOrderID)
 	if err != nil {
 		errVal, ok := err.(core.ErrValidation)
 		if ok {
@@ -84,7 +269,12 @@ func (orderC OrderController) SellOrder(c *gin.Context) {
 		c.Error(apiErrorInvalidJSON)
 		return
 	}
-	entity, err := orderC.uc.SellOrder(json.UserID, json.AssetID, json.Price, json.Amount)
+	clientOrderID, ok := orderC.clientOrderID(c, json)
+	if !ok {
+		c.Error(apiErrorInvalidClientOrderID)
+		return
+	}
+	entity, err := orderC.uc.SellOrder(json.UserID, json.AssetID, json.Price, json.Amount, clientOrderID)
 	if err != nil {
 		errVal, ok := err.(core.ErrValidation)
 		if ok {
@@ -98,6 +288,19 @@ func (orderC OrderController) SellOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, entity)
 }
 
+// clientOrderID returns the client order ID of the JSON or of the "Idempotency-Key" header.
+// It returns false if both are sent with different values.
+func (OrderController) clientOrderID(c *gin.Context, json AddOrderJSON) (string, bool) {
+	key := c.GetHeader("Idempotency-Key")
+	switch {
+	case key == "":
+		return json.ClientOrderID, true
+	case json.ClientOrderID == "" || json.ClientOrderID == key:
+		return key, true
+	}
+	return "", false
+}
+
 // CancelOrder returns an order.
 func (orderC OrderController) CancelOrder(c *gin.Context) {
 	orderID, err := strconv.ParseInt(c.Param("order_id"), 10, 64)
@@ -107,6 +310,11 @@ func (orderC OrderController) CancelOrder(c *gin.Context) {
 	}
 	entity, err := orderC.uc.CancelOrder(orders.OrderID(orderID))
 	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
 		c.Error(err)
 		return
 	}
@@ -117,19 +325,106 @@ func (orderC OrderController) CancelOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, entity)
 }
 
-// Webhook receives the order updates from an exchange service.
-// These updates are sent by an exchange service.
-func (orderC OrderController) Webhook(c *gin.Context) {
-	var json orders.ExternalUpdate
+// ReplaceOrder requests the change of the price and amount of an order.
+func (orderC OrderController) ReplaceOrder(c *gin.Context) {
+	orderID, err := strconv.ParseInt(c.Param("order_id"), 10, 64)
+	if err != nil {
+		c.Error(apiErrorInvalidOrderID)
+		return
+	}
+	var json ReplaceOrderJSON
 	if err := c.ShouldBindJSON(&json); err != nil {
 		c.Error(apiErrorInvalidJSON)
 		return
 	}
+	entity, err := orderC.uc.ReplaceOrder(orders.OrderID(orderID), json.Price, json.Amount)
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	if entity == nil {
+		c.Error(core.NewAPIError("Not found", 404))
+		return
+	}
+	c.JSON(http.StatusOK, entity)
+}
 
-	err := orderC.uc.ProcessExternalUpdate(json)
+// CancelOrders cancels the working orders filtered by the query parameters (user_id, asset_id and/or type).
+func (orderC OrderController) CancelOrders(c *gin.Context) {
+	filter := orders.OrderFilter{
+		AssetID: assets.AssetID(c.Query("asset_id")),
+		Type:    orders.OrderType(c.Query("type")),
+	}
+	if value := c.Query("user_id"); value != "" {
+		userID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || userID <= 0 {
+			c.Error(apiErrorInvalidUserID)
+			return
+		}
+		filter.UserID = users.UserID(userID)
+	}
+	result, err := orderC.uc.CancelOrders(filter)
 	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
 		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"ok": true})
+	c.JSON(http.StatusOK, result)
+}
+
+// Webhook receives the order updates from an exchange service.
+// These updates are sent by an exchange service.
+// The body is an update, a JSON array of updates or a NDJSON stream of updates (see orders.DecodeExternalUpdates).
+// A batch is answered with the result of each update.
+func (orderC OrderController) Webhook(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.Error(apiErrorInvalidJSON)
+		return
+	}
+	items, batch, err := orders.DecodeExternalUpdates(c.ContentType(), body)
+	if errors.Is(err, orders.ErrTooManyUpdates) {
+		c.Error(apiErrorTooManyUpdates)
+		return
+	}
+	if err != nil {
+		c.Error(apiErrorInvalidJSON)
+		return
+	}
+
+	if !batch {
+		err = orderC.uc.ProcessExternalUpdate(items[0].Update)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+		return
+	}
+
+	// The items that were not decoded are not processed.
+	indexes := make([]int, 0, len(items))
+	updates := make([]orders.ExternalUpdate, 0, len(items))
+	results := make([]orders.ExternalUpdateResult, len(items))
+	for i, item := range items {
+		if item.Err != nil {
+			results[i] = orders.NewExternalUpdateResult(i, item.Err)
+			continue
+		}
+		indexes = append(indexes, i)
+		updates = append(updates, item.Update)
+	}
+	for j, err := range orderC.uc.ProcessExternalUpdates(updates) {
+		results[indexes[j]] = orders.NewExternalUpdateResult(indexes[j], err)
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
 }
@@ -1,6 +1,8 @@
 package ordersgin
 
 import (
+	"home-broker/core"
+	coregin "home-broker/core/implem/gin"
 	"home-broker/orders"
 
 	"github.com/gin-gonic/gin"
@@ -8,12 +10,14 @@ import (
 
 // OrderRouter represents an orders router.
 type OrderRouter struct {
-	uc orders.OrderUseCases
+	uc              orders.OrderUseCases
+	webhookVerifier core.WebhookVerifier
 }
 
 // NewOrderRouter creates a new Router.
-func NewOrderRouter(uc orders.OrderUseCases) OrderRouter {
-	return OrderRouter{uc: uc}
+// The webhook accepts only the requests signed by the exchange (see core.WebhookVerifier).
+func NewOrderRouter(uc orders.OrderUseCases, webhookVerifier core.WebhookVerifier) OrderRouter {
+	return OrderRouter{uc: uc, webhookVerifier: webhookVerifier}
 }
 
 // SetupRouter setups orders router.
@@ -21,10 +25,20 @@ func (wr OrderRouter) SetupRouter(router *gin.Engine) {
 	orderC := NewOrderController(wr.uc)
 	v1 := router.Group("/api/v1/orders")
 	{
-		v1.POST("webhook/", orderC.Webhook)
+		v1.GET("/", orderC.SearchOrders)
+		v1.DELETE("/", orderC.CancelOrders)
+		v1.POST("webhook/", coregin.MiddlewareWebhookSignature(wr.webhookVerifier), orderC.Webhook)
 		v1.POST("buy/", orderC.BuyOrder)
 		v1.POST("sell/", orderC.SellOrder)
+		v1.POST("groups/", orderC.PlaceOrderGroup)
 		v1.GET(":order_id/", orderC.GetOrder)
+		v1.GET(":order_id/executions/", orderC.GetOrderExecutions)
+		v1.GET(":order_id/history/", orderC.GetOrderStatusHistory)
+		v1.PATCH(":order_id/", orderC.ReplaceOrder)
 		v1.DELETE(":order_id/", orderC.CancelOrder)
 	}
+	queue := router.Group("/api/v1/orderbookqueue")
+	{
+		queue.GET("dead/", orderC.GetDeadOrderBookMessages)
+	}
 }
@@ -0,0 +1,159 @@
+package ordershttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"home-broker/assets"
+	"home-broker/money"
+	"home-broker/orders"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// errRefused happens when the exchange refuses a request (4xx).
+var errRefused = errors.New("request refused by the exchange")
+
+// ExchangeClient sends the orders to an exchange over HTTP (ex: the "exchange-sim" command).
+type ExchangeClient struct {
+	orders.ExchangeClient
+	host   string
+	client *http.Client
+}
+
+// NewExchangeClient creates a new HTTP ExchangeClient.
+// The host must have http:// or https:// (ex: "http://localhost:8082").
+func NewExchangeClient(host string) ExchangeClient {
+	return ExchangeClient{
+		host:   host,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// exchangeOrder is an order returned by the exchange.
+type exchangeOrder struct {
+	ID        orders.ExternalOrderID `json:"id"`
+	Status    orders.OrderStatus     `json:"status"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// exchangeError is an error returned by the exchange.
+type exchangeError struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// SubmitOrder sends a new order. The order ID is sent as the client order ID.
+// An order refused by the exchange (4xx) is denied.
+// A marketable order can be answered as filled or partially filled: it is accepted, the fills are received as updates.
+func (client ExchangeClient) SubmitOrder(order orders.Order) (orders.ExchangeResponse, error) {
+	body := map[string]interface{}{
+		"client_order_id": strconv.FormatInt(int64(order.ID), 10),
+		"asset_id":        order.AssetID,
+		"type":            order.Type,
+		"price":           order.Price,
+		"amount":          order.Amount,
+	}
+	response, err := client.do(http.MethodPost, "/api/v1/exchange/orders/", body, orders.OrderStatusDenied)
+	if err != nil {
+		return response, err
+	}
+	switch response.Status {
+	case orders.OrderStatusPartiallyFilled, orders.OrderStatusFilled:
+		response.Status = orders.OrderStatusAccepted
+	}
+	return response, nil
+}
+
+// CancelOrder cancels an order by its external ID.
+// A cancel refused by the exchange (4xx) returns ErrCancelRejected (ex: the order is not open anymore).
+func (client ExchangeClient) CancelOrder(order orders.Order) (orders.ExchangeResponse, error) {
+	response, err := client.do(http.MethodDelete, client.orderPath(order), nil, "")
+	return response, cancelRejected(err)
+}
+
+// ReplaceOrder changes the price and amount of an order. The response has the new external ID.
+// The exchange replaces it with a new order, so only the amount not filled yet is sent.
+// A replace refused by the exchange (4xx) returns ErrCancelRejected.
+func (client ExchangeClient) ReplaceOrder(order orders.Order, price money.Money, amount assets.AssetUnit) (orders.ExchangeResponse, error) {
+	body := map[string]interface{}{
+		"price":  price,
+		"amount": amount - order.FilledAmount,
+	}
+	response, err := client.do(http.MethodPut, client.orderPath(order), body, "")
+	return response, cancelRejected(err)
+}
+
+// GetOrderStatus returns the order state on the exchange.
+func (client ExchangeClient) GetOrderStatus(order orders.Order) (orders.ExchangeResponse, error) {
+	return client.do(http.MethodGet, client.orderPath(order), nil, "")
+}
+
+// cancelRejected translates a refused cancel or replace request to ErrCancelRejected.
+func cancelRejected(err error) error {
+	if errors.Is(err, errRefused) {
+		return fmt.Errorf("%w: %v", orders.ErrCancelRejected, err)
+	}
+	return err
+}
+
+// orderPath returns the URL path of an order on the exchange.
+func (ExchangeClient) orderPath(order orders.Order) string {
+	return fmt.Sprintf("/api/v1/exchange/orders/%s/", order.ExternalID)
+}
+
+// do sends a request to the exchange.
+// If "refusedStatus" is not empty, a 4xx response returns this status instead of an error.
+// Otherwise, a 4xx response returns errRefused.
+// Network errors and 5xx responses are returned as errors, so they can be retried.
+func (client ExchangeClient) do(method string, path string, body interface{}, refusedStatus orders.OrderStatus) (orders.ExchangeResponse, error) {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		reqBody, err = json.Marshal(body)
+		if err != nil {
+			return orders.ExchangeResponse{}, err
+		}
+	}
+	req, err := http.NewRequest(method, client.host+path, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return orders.ExchangeResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := client.client.Do(req)
+	if err != nil {
+		return orders.ExchangeResponse{}, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return orders.ExchangeResponse{}, err
+	}
+
+	if resp.StatusCode >= 400 {
+		exErr := exchangeError{}
+		json.Unmarshal(respBody, &exErr)
+		if resp.StatusCode < 500 {
+			if refusedStatus != "" {
+				return orders.ExchangeResponse{Timestamp: time.Now(), Status: refusedStatus}, nil
+			}
+			return orders.ExchangeResponse{}, fmt.Errorf("%w: exchange error %d: %s", errRefused, resp.StatusCode, exErr.Error.Message)
+		}
+		return orders.ExchangeResponse{}, fmt.Errorf("exchange error %d: %s", resp.StatusCode, exErr.Error.Message)
+	}
+
+	exOrder := exchangeOrder{}
+	err = json.Unmarshal(respBody, &exOrder)
+	if err != nil {
+		return orders.ExchangeResponse{}, err
+	}
+	return orders.ExchangeResponse{
+		ID:        exOrder.ID,
+		Timestamp: exOrder.Timestamp,
+		Status:    exOrder.Status,
+	}, nil
+}
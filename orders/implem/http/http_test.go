@@ -0,0 +1,49 @@
+package ordershttp_test
+
+import (
+	"encoding/json"
+	"home-broker/orders"
+	ordershttp "home-broker/orders/implem/http"
+	orderstests "home-broker/tests/orders"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSubmitOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     int
+		status   orders.OrderStatus
+		expected orders.OrderStatus
+	}{
+		{name: "Accepted", code: http.StatusCreated, status: orders.OrderStatusAccepted, expected: orders.OrderStatusAccepted},
+		// A marketable order is matched before the response, its fills are received as updates.
+		{name: "Filled", code: http.StatusCreated, status: orders.OrderStatusFilled, expected: orders.OrderStatusAccepted},
+		{name: "PartiallyFilled", code: http.StatusCreated, status: orders.OrderStatusPartiallyFilled, expected: orders.OrderStatusAccepted},
+		{name: "Refused", code: http.StatusBadRequest, expected: orders.OrderStatusDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.code)
+				if tt.code < 400 {
+					json.NewEncoder(w).Encode(map[string]interface{}{"id": "SIM-1", "status": tt.status})
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"message": "Invalid price."}})
+			}))
+			defer server.Close()
+			client := ordershttp.NewExchangeClient(server.URL)
+
+			order := orderstests.GetOrder(1, orders.OrderTypeBuy, 10000000, 1000000, orderstests.BaseTime)
+			response, err := client.SubmitOrder(order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Status != tt.expected {
+				t.Errorf("status is %v, expected %v", response.Status, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package postgresql
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"home-broker/assets"
+	"home-broker/orders"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExternalUpdateJSON is the ORM version of the update of an order book message.
+// It is saved as JSON.
+type ExternalUpdateJSON orders.ExternalUpdate
+
+// Value returns the JSON of the update to be saved.
+func (update ExternalUpdateJSON) Value() (driver.Value, error) {
+	data, err := json.Marshal(orders.ExternalUpdate(update))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan reads the update from its JSON.
+func (update *ExternalUpdateJSON) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("invalid external update: %v", value)
+	}
+	externalUp := orders.ExternalUpdate{}
+	err := json.Unmarshal(data, &externalUp)
+	if err != nil {
+		return err
+	}
+	*update = ExternalUpdateJSON(externalUp)
+	return nil
+}
+
+// OrderBookMessageModel is the ORM version of OrderBookMessage entity.
+// The AssetID is not a foreign key because the updates of any asset are forwarded to the order books.
+type OrderBookMessageModel struct {
+	gorm.Model
+	ID            orders.OrderBookMessageID     `gorm:"primaryKey;autoIncrement:true"`
+	AssetID       assets.AssetID                `gorm:"not null;index:idx_orderbookqueue_assetstatus"`
+	Update        ExternalUpdateJSON            `gorm:"type:text;not null"`
+	Status        orders.OrderBookMessageStatus `gorm:"not null;index:idx_orderbookqueue_assetstatus"`
+	Attempts      int                           `gorm:"not null"`
+	NextAttemptAt time.Time                     `gorm:"not null"`
+	LastError     string                        `gorm:"not null"`
+	CreatedAt     time.Time                     `gorm:"not null;index:,sort:desc"`
+	UpdatedAt     time.Time                     `gorm:"not null;index:,sort:desc"`
+	DeletedAt     gorm.DeletedAt                `gorm:"index:,sort:desc"`
+}
+
+// TableName returns the real table name of OrderBookMessage.
+// It is used by GORM to perfom operations on order book queue table (queries, migrations, etc.).
+func (OrderBookMessageModel) TableName() string {
+	return "orderbookqueue"
+}
+
+// ToOrderBookMessageEntity returns an OrderBookMessage entity from the ORM model.
+func (OrderDB) ToOrderBookMessageEntity(model OrderBookMessageModel) orders.OrderBookMessage {
+	return orders.OrderBookMessage{
+		ID:            model.ID,
+		AssetID:       model.AssetID,
+		Update:        orders.ExternalUpdate(model.Update),
+		Status:        model.Status,
+		Attempts:      model.Attempts,
+		NextAttemptAt: model.NextAttemptAt,
+		LastError:     model.LastError,
+		CreatedAt:     model.CreatedAt,
+		UpdatedAt:     model.UpdatedAt,
+	}
+}
+
+// ToOrderBookMessageModel returns a GORM model from an order book message entity.
+func (OrderDB) ToOrderBookMessageModel(entity orders.OrderBookMessage) OrderBookMessageModel {
+	return OrderBookMessageModel{
+		ID:            entity.ID,
+		AssetID:       entity.AssetID,
+		Update:        ExternalUpdateJSON(entity.Update),
+		Status:        entity.Status,
+		Attempts:      entity.Attempts,
+		NextAttemptAt: entity.NextAttemptAt,
+		LastError:     entity.LastError,
+		CreatedAt:     entity.CreatedAt,
+		UpdatedAt:     entity.UpdatedAt,
+	}
+}
+
+// EnqueueOrderBookUpdates inserts a pending order book message for each update, in the same transaction.
+// The messages keep the order of the updates (ID order).
+func (orderDB OrderDB) EnqueueOrderBookUpdates(updates []orders.ExternalUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	now := time.Now()
+	models := make([]OrderBookMessageModel, 0, len(updates))
+	for _, update := range updates {
+		message := orders.NewOrderBookMessage(update)
+		message.NextAttemptAt = now
+		models = append(models, orderDB.ToOrderBookMessageModel(message))
+	}
+	return orderDB.db.GetDB().Create(&models).Error
+}
+
+// GetOrderBookQueueAssets returns the assets with pending order book messages.
+func (orderDB OrderDB) GetOrderBookQueueAssets() ([]assets.AssetID, error) {
+	assetIDs := []assets.AssetID{}
+	res := orderDB.db.GetDB().
+		Model(&OrderBookMessageModel{}).
+		Where(`"status"=?`, orders.OrderBookMessageStatusPending).
+		Group(`"asset_id"`).
+		Pluck("asset_id", &assetIDs)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return assetIDs, nil
+}
+
+// ClaimOrderBookBatch returns up to "limit" pending order book messages of an asset, the oldest first,
+// if the oldest one is due at "now". The oldest message is reserved until "until", so other forwarders skip
+// the asset. If the forwarder dies the asset is due again after "until".
+func (orderDB OrderDB) ClaimOrderBookBatch(assetID assets.AssetID, now time.Time, until time.Time, limit int) ([]orders.OrderBookMessage, error) {
+	models := []OrderBookMessageModel{}
+	err := orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		first := OrderBookMessageModel{}
+		res := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(`"asset_id"=? AND "status"=?`, assetID, orders.OrderBookMessageStatusPending).
+			Order(`"id"`).
+			Take(&first)
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if res.Error != nil {
+			return res.Error
+		}
+		if first.NextAttemptAt.After(now) {
+			return nil
+		}
+		res = tx.Model(&first).Updates(map[string]interface{}{
+			"next_attempt_at": until,
+			"updated_at":      now,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		return tx.
+			Where(`"asset_id"=? AND "status"=?`, assetID, orders.OrderBookMessageStatusPending).
+			Order(`"id"`).
+			Limit(limit).
+			Find(&models).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	entities := make([]orders.OrderBookMessage, 0, len(models))
+	for _, model := range models {
+		entities = append(entities, orderDB.ToOrderBookMessageEntity(model))
+	}
+	return entities, nil
+}
+
+// UpdateOrderBookMessages saves the delivery state of order book messages
+// (status, attempts, next attempt and last error), in the same transaction.
+func (orderDB OrderDB) UpdateOrderBookMessages(entities []orders.OrderBookMessage) error {
+	updatedAt := time.Now()
+	return orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		for _, entity := range entities {
+			res := tx.
+				Table("orderbookqueue").
+				Where(`"id"=?`, entity.ID).
+				Updates(map[string]interface{}{
+					"status":          entity.Status,
+					"attempts":        entity.Attempts,
+					"next_attempt_at": entity.NextAttemptAt,
+					"last_error":      entity.LastError,
+					"updated_at":      updatedAt,
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+		}
+		return nil
+	})
+}
+
+// GetDeadOrderBookMessages returns up to "limit" dead order book messages (dead letters), the newest first.
+// An empty asset ID returns the messages of all the assets.
+func (orderDB OrderDB) GetDeadOrderBookMessages(assetID assets.AssetID, limit int) ([]orders.OrderBookMessage, error) {
+	models := []OrderBookMessageModel{}
+	query := orderDB.db.GetDB().Where(`"status"=?`, orders.OrderBookMessageStatusDead)
+	if assetID != "" {
+		query = query.Where(`"asset_id"=?`, assetID)
+	}
+	res := query.Order(`"id" DESC`).Limit(limit).Find(&models)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	entities := make([]orders.OrderBookMessage, 0, len(models))
+	for _, model := range models {
+		entities = append(entities, orderDB.ToOrderBookMessageEntity(model))
+	}
+	return entities, nil
+}
+
+// DeleteOrderBookMessages deletes the order book messages of a status last updated before "before".
+// It returns the number of deleted messages.
+func (orderDB OrderDB) DeleteOrderBookMessages(status orders.OrderBookMessageStatus, before time.Time) (int64, error) {
+	res := orderDB.db.GetDB().
+		Unscoped().
+		Where(`"status"=? AND "updated_at"<?`, status, before).
+		Delete(&OrderBookMessageModel{})
+	return res.RowsAffected, res.Error
+}
@@ -2,33 +2,46 @@ package postgresql
 
 import (
 	"errors"
+	"fmt"
 	"home-broker/assets"
 	assetspostgresql "home-broker/assets/implem/postgresql"
+	"home-broker/assetwallets"
+	"home-broker/core"
 	"home-broker/core/implem/postgresql"
 	"home-broker/money"
 	"home-broker/orders"
 	"home-broker/users"
 	userspostgresql "home-broker/users/implem/postgresql"
+	"home-broker/wallets"
 	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // OrderModel is the ORM version of Order entity.
 type OrderModel struct {
 	gorm.Model
 	ID                orders.OrderID `gorm:"primaryKey;autoIncrement:true"`
-	UserID            users.UserID   `gorm:"not null;index:,sort:desc"`
+	UserID            users.UserID   `gorm:"not null;index:,sort:desc;uniqueIndex:idx_order_userclientorder"`
 	User              userspostgresql.UserModel
 	AssetID           assets.AssetID `gorm:"not null;index:,sort:desc"`
 	Asset             assetspostgresql.AssetModel
 	ExternalID        orders.ExternalOrderID `gorm:"not null;index"`
 	ExternalTimestamp time.Time              `gorm:"not null;index:,sort:desc"`
+	ClientOrderID     string                 `gorm:"not null;default:'';uniqueIndex:idx_order_userclientorder,where:client_order_id <> ''"`
+	GroupID           orders.OrderGroupID    `gorm:"not null;default:0;index"`
+	ParentID          orders.OrderID         `gorm:"not null;default:0"`
+	StopPrice         money.Money            `gorm:"not null;default:0"`
 	Amount            assets.AssetUnit       `gorm:"not null"`
 	Price             money.Money            `gorm:"not null"`
 	Type              orders.OrderType       `gorm:"not null;index"`
 	Status            orders.OrderStatus     `gorm:"not null"`
+	HeldFunds         money.Money            `gorm:"not null;default:0"`
+	HeldAssets        assets.AssetUnit       `gorm:"not null;default:0"`
+	FilledAmount      assets.AssetUnit       `gorm:"not null;default:0"`
+	AveragePrice      money.Money            `gorm:"not null;default:0"`
 	CreatedAt         time.Time              `gorm:"not null;index:,sort:desc"`
 	UpdatedAt         time.Time              `gorm:"not null;index:,sort:desc"`
 	DeletedAt         gorm.DeletedAt         `gorm:"index:,sort:desc"`
@@ -40,15 +53,134 @@ func (OrderModel) TableName() string {
 	return "order"
 }
 
+// OutboxMessageModel is the ORM version of OutboxMessage entity.
+type OutboxMessageModel struct {
+	gorm.Model
+	ID            orders.OutboxMessageID `gorm:"primaryKey;autoIncrement:true"`
+	OrderID       orders.OrderID         `gorm:"not null;index"`
+	Order         OrderModel
+	Action        orders.OutboxAction `gorm:"not null"`
+	Status        orders.OutboxStatus `gorm:"not null;index"`
+	Attempts      int                 `gorm:"not null"`
+	NextAttemptAt time.Time           `gorm:"not null;index"`
+	LastError     string              `gorm:"not null"`
+	Price         money.Money         `gorm:"not null;default:0"` // New price of a replace.
+	Amount        assets.AssetUnit    `gorm:"not null;default:0"` // New amount of a replace.
+	// The response of a replace accepted by the exchange but not saved yet.
+	ExternalID        orders.ExternalOrderID `gorm:"not null;default:''"`
+	ExternalTimestamp time.Time
+	CreatedAt         time.Time      `gorm:"not null;index:,sort:desc"`
+	UpdatedAt         time.Time      `gorm:"not null;index:,sort:desc"`
+	DeletedAt         gorm.DeletedAt `gorm:"index:,sort:desc"`
+}
+
+// TableName returns the real table name of OutboxMessage.
+// It is used by GORM to perfom operations on order outbox table (queries, migrations, etc.).
+func (OutboxMessageModel) TableName() string {
+	return "orderoutbox"
+}
+
+// ExecutionModel is the ORM version of Execution entity.
+type ExecutionModel struct {
+	gorm.Model
+	ID        orders.ExecutionID `gorm:"primaryKey;autoIncrement:true"`
+	OrderID   orders.OrderID     `gorm:"not null;uniqueIndex:idx_execution_ordertrade"`
+	Order     OrderModel
+	TradeID   orders.ExternalTradeID `gorm:"not null;uniqueIndex:idx_execution_ordertrade"`
+	Price     money.Money            `gorm:"not null"`
+	Amount    assets.AssetUnit       `gorm:"not null"`
+	Fee       money.Money            `gorm:"not null"`
+	Timestamp time.Time              `gorm:"not null;index:,sort:desc"`
+	CreatedAt time.Time              `gorm:"not null;index:,sort:desc"`
+	UpdatedAt time.Time              `gorm:"not null;index:,sort:desc"`
+	DeletedAt gorm.DeletedAt         `gorm:"index:,sort:desc"`
+}
+
+// TableName returns the real table name of Execution.
+// It is used by GORM to perfom operations on execution table (queries, migrations, etc.).
+func (ExecutionModel) TableName() string {
+	return "execution"
+}
+
+// OrderStatusChangeModel is the ORM version of OrderStatusChange entity.
+// The history is never changed, so it does not have the update/delete fields.
+type OrderStatusChangeModel struct {
+	ID         orders.OrderStatusChangeID `gorm:"primaryKey;autoIncrement:true"`
+	OrderID    orders.OrderID             `gorm:"not null;index"`
+	Order      OrderModel
+	FromStatus orders.OrderStatus       `gorm:"not null"`
+	ToStatus   orders.OrderStatus       `gorm:"not null"`
+	Reason     string                   `gorm:"not null"`
+	Source     orders.OrderStatusSource `gorm:"not null"`
+	CreatedAt  time.Time                `gorm:"not null;index:,sort:desc"`
+}
+
+// TableName returns the real table name of OrderStatusChange.
+// It is used by GORM to perfom operations on order status history table (queries, migrations, etc.).
+func (OrderStatusChangeModel) TableName() string {
+	return "order_status_history"
+}
+
+// OrderGroupModel is the ORM version of OrderGroup entity.
+type OrderGroupModel struct {
+	gorm.Model
+	ID        orders.OrderGroupID   `gorm:"primaryKey;autoIncrement:true"`
+	Type      orders.OrderGroupType `gorm:"not null"`
+	UserID    users.UserID          `gorm:"not null;index"`
+	User      userspostgresql.UserModel
+	AssetID   assets.AssetID `gorm:"not null"`
+	Asset     assetspostgresql.AssetModel
+	CreatedAt time.Time      `gorm:"not null;index:,sort:desc"`
+	UpdatedAt time.Time      `gorm:"not null;index:,sort:desc"`
+	DeletedAt gorm.DeletedAt `gorm:"index:,sort:desc"`
+}
+
+// TableName returns the real table name of OrderGroup.
+// It is used by GORM to perfom operations on order group table (queries, migrations, etc.).
+func (OrderGroupModel) TableName() string {
+	return "order_group"
+}
+
+// OrderReplaceModel is the ORM version of OrderReplace entity.
+// The replaces are never changed, so it does not have the update/delete fields.
+type OrderReplaceModel struct {
+	ID                    orders.OrderReplaceID `gorm:"primaryKey;autoIncrement:true"`
+	OrderID               orders.OrderID        `gorm:"not null;index"`
+	Order                 OrderModel
+	OriginalExternalID    orders.ExternalOrderID `gorm:"not null;index"`
+	ReplacementExternalID orders.ExternalOrderID `gorm:"not null"`
+	OldPrice              money.Money            `gorm:"not null"`
+	OldAmount             assets.AssetUnit       `gorm:"not null"`
+	Price                 money.Money            `gorm:"not null"`
+	Amount                assets.AssetUnit       `gorm:"not null"`
+	ExternalTimestamp     time.Time              `gorm:"not null"`
+	CreatedAt             time.Time              `gorm:"not null;index:,sort:desc"`
+}
+
+// TableName returns the real table name of OrderReplace.
+// It is used by GORM to perfom operations on order replace table (queries, migrations, etc.).
+func (OrderReplaceModel) TableName() string {
+	return "order_replace"
+}
+
 // OrderDB handles database commands for wallet table.
 type OrderDB struct {
 	orders.OrderDBInterface
-	db postgresql.DB
+	db            postgresql.DB
+	walletDB      wallets.WalletDBInterface           // Holds the funds of the orders.
+	assetWalletDB assetwallets.AssetWalletDBInterface // Holds the assets of the orders.
 }
 
 // NewOrderDB creates a new OrderDB.
-func NewOrderDB(db postgresql.DB) OrderDB {
-	return OrderDB{db: db}
+// The holds of the orders are changed with "walletDB" and "assetWalletDB", inside the order transactions.
+func NewOrderDB(db postgresql.DB, walletDB wallets.WalletDBInterface, assetWalletDB assetwallets.AssetWalletDBInterface) OrderDB {
+	return OrderDB{db: db, walletDB: walletDB, assetWalletDB: assetWalletDB}
+}
+
+// WithTx returns a copy of the OrderDB that runs its commands inside a transaction.
+// Its own transactions become savepoints of it.
+func (orderDB OrderDB) WithTx(tx core.Tx) orders.OrderDBInterface {
+	return NewOrderDB(orderDB.db.WithTx(tx), orderDB.walletDB.WithTx(tx), orderDB.assetWalletDB.WithTx(tx))
 }
 
 // ToEntity returns a Order entity from the ORM model.
@@ -65,10 +197,18 @@ func (OrderDB) ToEntity(model OrderModel) orders.Order {
 		AssetID:           model.AssetID,
 		ExternalID:        model.ExternalID,
 		ExternalTimestamp: model.ExternalTimestamp,
+		ClientOrderID:     model.ClientOrderID,
+		GroupID:           model.GroupID,
+		ParentID:          model.ParentID,
+		StopPrice:         model.StopPrice,
 		Amount:            model.Amount,
 		Price:             model.Price,
 		Type:              model.Type,
 		Status:            model.Status,
+		HeldFunds:         model.HeldFunds,
+		HeldAssets:        model.HeldAssets,
+		FilledAmount:      model.FilledAmount,
+		AveragePrice:      model.AveragePrice,
 		CreatedAt:         model.CreatedAt,
 		UpdatedAt:         model.UpdatedAt,
 		DeletedAt:         deletedAt,
@@ -88,10 +228,18 @@ func (OrderDB) ToModel(entity orders.Order) OrderModel {
 		AssetID:           entity.AssetID,
 		ExternalID:        entity.ExternalID,
 		ExternalTimestamp: entity.ExternalTimestamp,
+		ClientOrderID:     entity.ClientOrderID,
+		GroupID:           entity.GroupID,
+		ParentID:          entity.ParentID,
+		StopPrice:         entity.StopPrice,
 		Amount:            entity.Amount,
 		Price:             entity.Price,
 		Type:              entity.Type,
 		Status:            entity.Status,
+		HeldFunds:         entity.HeldFunds,
+		HeldAssets:        entity.HeldAssets,
+		FilledAmount:      entity.FilledAmount,
+		AveragePrice:      entity.AveragePrice,
 		CreatedAt:         entity.CreatedAt,
 		UpdatedAt:         entity.UpdatedAt,
 		DeletedAt:         deletedAt,
@@ -115,10 +263,13 @@ func (orderDB OrderDB) GetByID(id orders.OrderID) (*orders.Order, error) {
 }
 
 // GetByExternalIDAssetID returns an order by external ID and asset ID.
+// The external IDs that the order had before its replaces are found too.
 // If the record does not exist a nil entity will be returned.
 func (orderDB OrderDB) GetByExternalIDAssetID(externalID orders.ExternalOrderID, assetID assets.AssetID) (*orders.Order, error) {
 	model := OrderModel{}
-	res := orderDB.db.GetDB().Where(`"external_id"=? AND "asset_id"=?`, externalID, assetID).Take(&model)
+	res := orderDB.db.GetDB().
+		Where(`("external_id"=? OR "id" IN (SELECT "order_id" FROM "order_replace" WHERE "original_external_id"=?)) AND "asset_id"=?`, externalID, externalID, assetID).
+		Take(&model)
 	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -129,6 +280,68 @@ func (orderDB OrderDB) GetByExternalIDAssetID(externalID orders.ExternalOrderID,
 	return &entity, nil
 }
 
+// GetByUserIDClientOrderID returns an order by user ID and client order ID.
+// If the record does not exist a nil entity will be returned.
+func (orderDB OrderDB) GetByUserIDClientOrderID(userID users.UserID, clientOrderID string) (*orders.Order, error) {
+	model := OrderModel{}
+	res := orderDB.db.GetDB().Where(`"user_id"=? AND "client_order_id"=?`, userID, clientOrderID).Take(&model)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	entity := orderDB.ToEntity(model)
+	return &entity, nil
+}
+
+// Search returns up to "filter.Limit" orders matching the filter,
+// sorted by "filter.Sort" and starting after "filter.After".
+// The pages use the (created_at, id) position, so new orders do not move the next pages.
+func (orderDB OrderDB) Search(filter orders.OrderFilter) ([]orders.Order, error) {
+	query := orderDB.db.GetDB().Model(&OrderModel{})
+	if filter.UserID != 0 {
+		query = query.Where(`"user_id"=?`, filter.UserID)
+	}
+	if filter.AssetID != "" {
+		query = query.Where(`"asset_id"=?`, filter.AssetID)
+	}
+	if filter.Status != "" {
+		query = query.Where(`"status"=?`, filter.Status)
+	}
+	if filter.Type != "" {
+		query = query.Where(`"type"=?`, filter.Type)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where(`"created_at">=?`, filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where(`"created_at"<?`, filter.To)
+	}
+	if filter.Sort == orders.OrderSortOldest {
+		if !filter.After.IsZero() {
+			query = query.Where(`("created_at","id")>(?,?)`, filter.After.CreatedAt, filter.After.ID)
+		}
+		query = query.Order(`"created_at","id"`)
+	} else {
+		if !filter.After.IsZero() {
+			query = query.Where(`("created_at","id")<(?,?)`, filter.After.CreatedAt, filter.After.ID)
+		}
+		query = query.Order(`"created_at" DESC,"id" DESC`)
+	}
+
+	models := []OrderModel{}
+	res := query.Limit(filter.Limit).Find(&models)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	entities := make([]orders.Order, 0, len(models))
+	for _, model := range models {
+		entities = append(entities, orderDB.ToEntity(model))
+	}
+	return entities, nil
+}
+
 // Insert inserts a new order.
 // A nil entity will be returned if an error occurs.
 // The following errors can happen: ErrUserDoesNotExist.
@@ -136,45 +349,1051 @@ func (orderDB OrderDB) Insert(entity orders.Order) (*orders.Order, error) {
 	model := orderDB.ToModel(entity)
 	res := orderDB.db.GetDB().Create(&model)
 	if res.Error != nil {
-		errMsg := res.Error.Error()
-		if strings.Contains(errMsg, "foreign key constraint") && strings.Contains(errMsg, "asset") {
-			// Original error: "ERROR: insert or update on table "order" violates foreign key constraint "fk_order_asset" (SQLSTATE 23503)"
-			return nil, assets.ErrAssetDoesNotExist
+		return nil, orderDB.insertError(res.Error)
+	}
+	newEntity := orderDB.ToEntity(model)
+	return &newEntity, nil
+}
+
+// InsertWithOutbox inserts a new order and its outbox message in the same transaction.
+// The order HeldFunds and HeldAssets are held on the user wallets in the same transaction too.
+// A nil entity will be returned if an error occurs (nothing is inserted).
+// The following errors can happen: ErrUserDoesNotExist, ErrAssetDoesNotExist, ErrInsufficientFunds, ErrInsufficientAssets,
+// ErrClientOrderIDAlreadyExists.
+func (orderDB OrderDB) InsertWithOutbox(entity orders.Order, action orders.OutboxAction) (*orders.Order, error) {
+	model := orderDB.ToModel(entity)
+	err := orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		return orderDB.insertWithOutbox(tx, &model, action)
+	})
+	if err != nil {
+		return nil, err
+	}
+	newEntity := orderDB.ToEntity(model)
+	return &newEntity, nil
+}
+
+// insertWithOutbox holds the HeldFunds and HeldAssets of a new order and inserts it with its status history.
+// The outbox message is inserted only if "action" is not empty.
+func (orderDB OrderDB) insertWithOutbox(tx *gorm.DB, model *OrderModel, action orders.OutboxAction) error {
+	if model.HeldFunds > 0 {
+		err := orderDB.walletDB.WithTx(tx).HoldFunds(model.UserID, model.HeldFunds)
+		if err != nil {
+			return err
 		}
-		if strings.Contains(errMsg, "foreign key constraint") && strings.Contains(errMsg, "user") {
-			// Original error: "ERROR: insert or update on table "order" violates foreign key constraint "fk_order_user" (SQLSTATE 23503)"
-			return nil, users.ErrUserDoesNotExist
+	}
+	if model.HeldAssets > 0 {
+		err := orderDB.assetWalletDB.WithTx(tx).HoldAssets(model.UserID, model.AssetID, model.HeldAssets)
+		if err != nil {
+			return err
+		}
+	}
+	res := tx.Create(model)
+	if res.Error != nil {
+		return orderDB.insertError(res.Error)
+	}
+	change := orders.NewOrderStatusChange(model.ID, model.Status, orders.OrderStatusSourceUser, "Order created.")
+	changeModel := orderDB.ToStatusChangeModel(change)
+	res = tx.Create(&changeModel)
+	if res.Error != nil {
+		return res.Error
+	}
+	if action == "" {
+		return nil
+	}
+	message := orders.NewOutboxMessage(model.ID, action)
+	message.NextAttemptAt = model.CreatedAt
+	outboxModel := orderDB.ToOutboxModel(message)
+	return tx.Create(&outboxModel).Error
+}
+
+// InsertGroup inserts an order group and its orders in the same transaction, like InsertWithOutbox.
+// Only the "pending" orders have an outbox message (submit). For a bracket, the first order is the parent of the others.
+// A nil entity will be returned if an error occurs (nothing is inserted).
+// The following errors can happen: ErrUserDoesNotExist, ErrAssetDoesNotExist, ErrInsufficientFunds, ErrInsufficientAssets.
+func (orderDB OrderDB) InsertGroup(entity orders.OrderGroup) (*orders.OrderGroup, error) {
+	model := orderDB.ToGroupModel(entity)
+	legs := make([]OrderModel, 0, len(entity.Orders))
+	err := orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		res := tx.Create(&model)
+		if res.Error != nil {
+			return orderDB.insertError(res.Error)
+		}
+		for i, leg := range entity.Orders {
+			legModel := orderDB.ToModel(leg)
+			legModel.GroupID = model.ID
+			if model.Type == orders.OrderGroupTypeBracket && i > 0 {
+				legModel.ParentID = legs[0].ID
+			}
+			action := orders.OutboxAction("")
+			if legModel.Status == orders.OrderStatusPending {
+				action = orders.OutboxActionSubmit
+			}
+			err := orderDB.insertWithOutbox(tx, &legModel, action)
+			if err != nil {
+				return err
+			}
+			legs = append(legs, legModel)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	group := orderDB.ToGroupEntity(model, legs)
+	return &group, nil
+}
+
+// GetOrderGroup returns an order group by ID with its orders, the oldest first.
+// If the record does not exist a nil entity will be returned.
+func (orderDB OrderDB) GetOrderGroup(id orders.OrderGroupID) (*orders.OrderGroup, error) {
+	model := OrderGroupModel{}
+	res := orderDB.db.GetDB().Take(&model, id)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if res.Error != nil {
 		return nil, res.Error
 	}
-	newEntity := orderDB.ToEntity(model)
-	return &newEntity, nil
+	legs := []OrderModel{}
+	res = orderDB.db.GetDB().
+		Where(`"group_id"=?`, id).
+		Order(`"id"`).
+		Find(&legs)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	group := orderDB.ToGroupEntity(model, legs)
+	return &group, nil
 }
 
-// UpdateExternalResponse updates an order base on a exchange response.
-func (orderDB OrderDB) UpdateExternalResponse(orderID orders.OrderID, externalID orders.ExternalOrderID, externalTimestamp time.Time, status orders.OrderStatus) error {
-	updatedAt := time.Now()
+// GetWaitingStopOrders returns the "waiting" orders of an asset with a stop price,
+// without the bracket exits whose parent is not filled yet.
+func (orderDB OrderDB) GetWaitingStopOrders(assetID assets.AssetID) ([]orders.Order, error) {
+	models := []OrderModel{}
 	res := orderDB.db.GetDB().
+		Where(`"asset_id"=? AND "status"=? AND "stop_price">0`, assetID, orders.OrderStatusWaiting).
+		Where(`("parent_id"=0 OR "parent_id" IN (SELECT "id" FROM "order" WHERE "status"=?))`, orders.OrderStatusFilled).
+		Order(`"id"`).
+		Find(&models)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	entities := make([]orders.Order, 0, len(models))
+	for _, model := range models {
+		entities = append(entities, orderDB.ToEntity(model))
+	}
+	return entities, nil
+}
+
+// MoveGroupHolds moves the funds and assets held by the siblings of an order (same group and parent)
+// to the order, in the same transaction (ex: the leg of an OCO that was filled).
+// The wallets do not change, only the order that holds them.
+func (orderDB OrderDB) MoveGroupHolds(orderID orders.OrderID) error {
+	order, err := orderDB.GetByID(orderID)
+	if err != nil || order == nil || order.GroupID == 0 {
+		return err
+	}
+	return orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		// All the legs are locked in the same order, so concurrent moves do not deadlock.
+		legs := []OrderModel{}
+		res := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(`"group_id"=? AND "parent_id"=?`, order.GroupID, order.ParentID).
+			Order(`"id"`).
+			Find(&legs)
+		if res.Error != nil {
+			return res.Error
+		}
+		var funds money.Money
+		var amount assets.AssetUnit
+		siblingIDs := make([]orders.OrderID, 0, len(legs))
+		for _, leg := range legs {
+			if leg.ID != orderID && (leg.HeldFunds > 0 || leg.HeldAssets > 0) {
+				funds += leg.HeldFunds
+				amount += leg.HeldAssets
+				siblingIDs = append(siblingIDs, leg.ID)
+			}
+		}
+		if len(siblingIDs) == 0 {
+			return nil
+		}
+		now := time.Now()
+		res = tx.
+			Table("order").
+			Where(`"id" IN ?`, siblingIDs).
+			Updates(map[string]interface{}{
+				"held_funds":  0,
+				"held_assets": 0,
+				"updated_at":  now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		res = tx.
+			Table("order").
+			Where(`"id"=?`, orderID).
+			Updates(map[string]interface{}{
+				"held_funds":  gorm.Expr(`"held_funds"+?`, funds),
+				"held_assets": gorm.Expr(`"held_assets"+?`, amount),
+				"updated_at":  now,
+			})
+		return res.Error
+	})
+}
+
+// ToGroupEntity returns an OrderGroup entity from the ORM models.
+func (orderDB OrderDB) ToGroupEntity(model OrderGroupModel, legs []OrderModel) orders.OrderGroup {
+	deletedAt := time.Time{} // A "time.Time" with zero value represents a "null".
+	if model.DeletedAt.Valid {
+		// "model.DeletedAt" is not a "null" value.
+		deletedAt = model.DeletedAt.Time
+	}
+	entity := orders.OrderGroup{
+		ID:        model.ID,
+		Type:      model.Type,
+		UserID:    model.UserID,
+		AssetID:   model.AssetID,
+		Orders:    make([]orders.Order, 0, len(legs)),
+		CreatedAt: model.CreatedAt,
+		UpdatedAt: model.UpdatedAt,
+		DeletedAt: deletedAt,
+	}
+	for _, leg := range legs {
+		entity.Orders = append(entity.Orders, orderDB.ToEntity(leg))
+	}
+	return entity
+}
+
+// ToGroupModel returns an ORM model from the OrderGroup entity (without the orders).
+func (OrderDB) ToGroupModel(entity orders.OrderGroup) OrderGroupModel {
+	deletedAt := gorm.DeletedAt{Time: entity.DeletedAt}
+	if !entity.DeletedAt.IsZero() {
+		deletedAt.Valid = true
+	}
+	return OrderGroupModel{
+		ID:        entity.ID,
+		Type:      entity.Type,
+		UserID:    entity.UserID,
+		AssetID:   entity.AssetID,
+		CreatedAt: entity.CreatedAt,
+		UpdatedAt: entity.UpdatedAt,
+		DeletedAt: deletedAt,
+	}
+}
+
+// insertError translates the foreign key and unique errors of an order insert.
+func (OrderDB) insertError(err error) error {
+	errMsg := err.Error()
+	if strings.Contains(errMsg, "unique constraint") && strings.Contains(errMsg, "idx_order_userclientorder") {
+		// Original error: "ERROR: duplicate key value violates unique constraint "idx_order_userclientorder" (SQLSTATE 23505)"
+		return orders.ErrClientOrderIDAlreadyExists
+	}
+	if strings.Contains(errMsg, "foreign key constraint") && strings.Contains(errMsg, "asset") {
+		// Original error: "ERROR: insert or update on table "order" violates foreign key constraint "fk_order_asset" (SQLSTATE 23503)"
+		return assets.ErrAssetDoesNotExist
+	}
+	if strings.Contains(errMsg, "foreign key constraint") && strings.Contains(errMsg, "user") {
+		// Original error: "ERROR: insert or update on table "order" violates foreign key constraint "fk_order_user" (SQLSTATE 23503)"
+		return users.ErrUserDoesNotExist
+	}
+	return err
+}
+
+// holdRelease is a change of the funds and assets held by an order.
+type holdRelease struct {
+	funds       money.Money      // Funds released from the wallet hold.
+	cost        money.Money      // Funds removed from the wallet balance.
+	assets      assets.AssetUnit // Assets released from the asset wallet hold.
+	assetsDebit assets.AssetUnit // Assets removed from the asset wallet balance.
+}
+
+// ReleaseHolds releases all the funds and assets still held by an order (ex: canceled or denied).
+// The siblings of a group leg (same group and parent) share its holds, so they are moved to a sibling
+// that is not final yet instead, and the wallets get them back only when every leg is final.
+// Nothing happens if the order does not hold anything anymore.
+func (orderDB OrderDB) ReleaseHolds(orderID orders.OrderID) error {
+	release := func(model OrderModel) holdRelease {
+		return holdRelease{funds: model.HeldFunds, assets: model.HeldAssets}
+	}
+	order, err := orderDB.GetByID(orderID)
+	if err != nil || order == nil {
+		return err
+	}
+	if order.GroupID == 0 {
+		return orderDB.updateHolds(orderID, release)
+	}
+	return orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		// All the legs are locked in the same order, so concurrent moves do not deadlock (see MoveGroupHolds).
+		legs := []OrderModel{}
+		res := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(`"group_id"=? AND "parent_id"=?`, order.GroupID, order.ParentID).
+			Order(`"id"`).
+			Find(&legs)
+		if res.Error != nil {
+			return res.Error
+		}
+		var model, sibling *OrderModel
+		for i := range legs {
+			switch {
+			case legs[i].ID == orderID:
+				model = &legs[i]
+			case sibling == nil && !orders.IsFinal(legs[i].Status):
+				sibling = &legs[i]
+			}
+		}
+		if model == nil || sibling == nil {
+			return orderDB.updateHoldsTx(tx, orderID, release)
+		}
+		if model.HeldFunds == 0 && model.HeldAssets == 0 {
+			return nil
+		}
+		now := time.Now()
+		res = tx.
+			Table("order").
+			Where(`"id"=?`, model.ID).
+			Updates(map[string]interface{}{
+				"held_funds":  0,
+				"held_assets": 0,
+				"updated_at":  now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		res = tx.
+			Table("order").
+			Where(`"id"=?`, sibling.ID).
+			Updates(map[string]interface{}{
+				"held_funds":  gorm.Expr(`"held_funds"+?`, model.HeldFunds),
+				"held_assets": gorm.Expr(`"held_assets"+?`, model.HeldAssets),
+				"updated_at":  now,
+			})
+		return res.Error
+	})
+}
+
+// ConsumeHeldFunds releases up to "amount" of the funds held by an order and
+// removes "cost" from the wallet balance, in the same transaction (ex: a trade).
+func (orderDB OrderDB) ConsumeHeldFunds(orderID orders.OrderID, amount money.Money, cost money.Money) error {
+	return orderDB.updateHolds(orderID, func(model OrderModel) holdRelease {
+		if amount > model.HeldFunds {
+			amount = model.HeldFunds
+		}
+		return holdRelease{funds: amount, cost: cost}
+	})
+}
+
+// ConsumeHeldAssets releases up to "amount" of the assets held by an order and
+// removes them from the asset wallet balance, in the same transaction (ex: a trade).
+func (orderDB OrderDB) ConsumeHeldAssets(orderID orders.OrderID, amount assets.AssetUnit) error {
+	return orderDB.updateHolds(orderID, func(model OrderModel) holdRelease {
+		held := amount
+		if held > model.HeldAssets {
+			held = model.HeldAssets
+		}
+		return holdRelease{assets: held, assetsDebit: amount}
+	})
+}
+
+// updateHolds locks an order and moves its held funds and assets back to the wallets.
+// "release" receives the locked order and returns what must be changed.
+func (orderDB OrderDB) updateHolds(orderID orders.OrderID, release func(model OrderModel) holdRelease) error {
+	return orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		return orderDB.updateHoldsTx(tx, orderID, release)
+	})
+}
+
+// updateHoldsTx is updateHolds inside of a transaction.
+func (orderDB OrderDB) updateHoldsTx(tx *gorm.DB, orderID orders.OrderID, release func(model OrderModel) holdRelease) error {
+	model := OrderModel{}
+	res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&model, orderID)
+	if res.Error != nil {
+		return res.Error
+	}
+	change := release(model)
+	if change.funds != 0 || change.cost != 0 {
+		err := orderDB.walletDB.WithTx(tx).ReleaseFunds(model.UserID, change.funds, change.cost)
+		if err != nil {
+			return err
+		}
+	}
+	if change.assets != 0 || change.assetsDebit != 0 {
+		err := orderDB.releaseAssets(tx, model, change.assets, change.assetsDebit)
+		if err != nil {
+			return err
+		}
+	}
+	if change.funds == 0 && change.assets == 0 {
+		return nil
+	}
+	res = tx.
 		Table("order").
 		Where(`"id"=?`, orderID).
+		Updates(map[string]interface{}{
+			"held_funds":  gorm.Expr(`"held_funds"-?`, change.funds),
+			"held_assets": gorm.Expr(`"held_assets"-?`, change.assets),
+			"updated_at":  time.Now(),
+		})
+	return res.Error
+}
+
+// releaseAssets releases assets held by a locked order and removes "debit" from the asset wallet balance.
+// The bracket exits can hold the pending assets bought by their entry (see AdjustExitHolds), so they can be
+// sold before the settlement date and the balance is negative until then (see assetwallets ReleasePendingAssets).
+func (orderDB OrderDB) releaseAssets(tx *gorm.DB, model OrderModel, amount assets.AssetUnit, debit assets.AssetUnit) error {
+	assetWalletDB := orderDB.assetWalletDB.WithTx(tx)
+	if model.ParentID != 0 {
+		return assetWalletDB.ReleasePendingAssets(model.UserID, model.AssetID, amount, debit)
+	}
+	return assetWalletDB.ReleaseAssets(model.UserID, model.AssetID, amount, debit)
+}
+
+// AdjustHolds sets the funds and assets held by an order, holding or releasing the difference
+// on the user wallets in the same transaction.
+// The following errors can happen: ErrInsufficientFunds, ErrInsufficientAssets.
+func (orderDB OrderDB) AdjustHolds(orderID orders.OrderID, funds money.Money, assets assets.AssetUnit) error {
+	return orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		model := OrderModel{}
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&model, orderID)
+		if res.Error != nil {
+			return res.Error
+		}
+		return orderDB.adjustHolds(tx, &model, funds, assets, false)
+	})
+}
+
+// AdjustExitHolds sets the funds and assets held by a bracket exit like AdjustHolds,
+// but the assets can be held from the pending assets of the asset wallet (the assets bought by the entry
+// stay pending until the settlement date).
+// The following errors can happen: ErrInsufficientFunds, ErrInsufficientAssets.
+func (orderDB OrderDB) AdjustExitHolds(orderID orders.OrderID, funds money.Money, assets assets.AssetUnit) error {
+	return orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		model := OrderModel{}
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&model, orderID)
+		if res.Error != nil {
+			return res.Error
+		}
+		return orderDB.adjustHolds(tx, &model, funds, assets, true)
+	})
+}
+
+// adjustHolds sets the funds and assets held by a locked order.
+// The pending assets of the asset wallet are held too if "pending" is true (see AdjustExitHolds).
+func (orderDB OrderDB) adjustHolds(tx *gorm.DB, model *OrderModel, funds money.Money, amount assets.AssetUnit, pending bool) error {
+	walletDB := orderDB.walletDB.WithTx(tx)
+	assetWalletDB := orderDB.assetWalletDB.WithTx(tx)
+	var err error
+	switch {
+	case funds > model.HeldFunds:
+		err = walletDB.HoldFunds(model.UserID, funds-model.HeldFunds)
+	case funds < model.HeldFunds:
+		err = walletDB.ReleaseFunds(model.UserID, model.HeldFunds-funds, 0)
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case amount > model.HeldAssets && pending:
+		err = assetWalletDB.HoldPendingAssets(model.UserID, model.AssetID, amount-model.HeldAssets)
+	case amount > model.HeldAssets:
+		err = assetWalletDB.HoldAssets(model.UserID, model.AssetID, amount-model.HeldAssets)
+	case amount < model.HeldAssets:
+		err = orderDB.releaseAssets(tx, *model, model.HeldAssets-amount, 0)
+	}
+	if err != nil {
+		return err
+	}
+	if funds == model.HeldFunds && amount == model.HeldAssets {
+		return nil
+	}
+	model.HeldFunds = funds
+	model.HeldAssets = amount
+	model.UpdatedAt = time.Now()
+	res := tx.
+		Table("order").
+		Where(`"id"=?`, model.ID).
+		Updates(map[string]interface{}{
+			"held_funds":  model.HeldFunds,
+			"held_assets": model.HeldAssets,
+			"updated_at":  model.UpdatedAt,
+		})
+	return res.Error
+}
+
+// RequestReplace sets the funds and assets held by an order like AdjustHolds and inserts the outbox message
+// of a replace, in the same transaction. The locked order must accept the replace (see Order.CanReplace)
+// and must not have other outbox messages pending.
+// The updated order is returned.
+// The following errors can happen: ErrInvalidStatusTransition, ErrOutboxMessagePending, ErrInsufficientFunds, ErrInsufficientAssets.
+func (orderDB OrderDB) RequestReplace(message orders.OutboxMessage, funds money.Money, assetsHold assets.AssetUnit) (*orders.Order, error) {
+	model := OrderModel{}
+	err := orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&model, message.OrderID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if !orderDB.ToEntity(model).CanReplace(message.Amount) {
+			return fmt.Errorf("%w: order %d is %s with %d filled", orders.ErrInvalidStatusTransition, model.ID, model.Status, model.FilledAmount)
+		}
+		var pending int64
+		res = tx.
+			Model(&OutboxMessageModel{}).
+			Where(`"order_id"=? AND "status"=?`, model.ID, orders.OutboxStatusPending).
+			Count(&pending)
+		if res.Error != nil {
+			return res.Error
+		}
+		if pending > 0 {
+			return fmt.Errorf("%w: order %d", orders.ErrOutboxMessagePending, model.ID)
+		}
+		err := orderDB.adjustHolds(tx, &model, funds, assetsHold, false)
+		if err != nil {
+			return err
+		}
+		message.NextAttemptAt = time.Now()
+		outboxModel := orderDB.ToOutboxModel(message)
+		return tx.Create(&outboxModel).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	entity := orderDB.ToEntity(model)
+	return &entity, nil
+}
+
+// Replace changes the order price, amount and external ID to the ones of the replacement and
+// records the replace, in the same transaction. The holds are adjusted to the new terms too (see Order.RequiredHolds),
+// plus the "entity.FeeHold" of a buying order. The locked order must accept the replace (see Order.CanReplace).
+// The updated order is returned.
+// The following errors can happen: ErrInvalidStatusTransition.
+func (orderDB OrderDB) Replace(entity orders.OrderReplace) (*orders.Order, error) {
+	model := OrderModel{}
+	err := orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&model, entity.OrderID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if model.ExternalID == entity.ReplacementExternalID && model.ExternalID != entity.OriginalExternalID {
+			// Already saved (ex: the dispatcher died before marking the message as sent).
+			return nil
+		}
+		if !orderDB.ToEntity(model).CanReplace(entity.Amount) {
+			// A fill or cancel landed while the replace was sent. The exchange works the replacement anyway,
+			// so its ID is saved (its updates must match the order), but the terms and holds are kept.
+			model.ExternalID = entity.ReplacementExternalID
+			model.ExternalTimestamp = entity.ExternalTimestamp
+			model.UpdatedAt = time.Now()
+			res = tx.
+				Table("order").
+				Where(`"id"=?`, model.ID).
+				Updates(map[string]interface{}{
+					"external_id":        model.ExternalID,
+					"external_timestamp": model.ExternalTimestamp,
+					"updated_at":         model.UpdatedAt,
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+			replaceModel := orderDB.ToReplaceModel(entity)
+			return tx.Create(&replaceModel).Error
+		}
+		model.Price = entity.Price
+		model.Amount = entity.Amount
+		model.ExternalID = entity.ReplacementExternalID
+		model.ExternalTimestamp = entity.ExternalTimestamp
+		model.UpdatedAt = time.Now()
+		res = tx.
+			Table("order").
+			Where(`"id"=?`, model.ID).
+			Updates(map[string]interface{}{
+				"price":              model.Price,
+				"amount":             model.Amount,
+				"external_id":        model.ExternalID,
+				"external_timestamp": model.ExternalTimestamp,
+				"updated_at":         model.UpdatedAt,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		replaceModel := orderDB.ToReplaceModel(entity)
+		res = tx.Create(&replaceModel)
+		if res.Error != nil {
+			return res.Error
+		}
+		funds, assets, err := orderDB.ToEntity(model).RequiredHolds()
+		if err != nil {
+			return err
+		}
+		if funds > 0 {
+			funds += entity.FeeHold
+		}
+		return orderDB.adjustHolds(tx, &model, funds, assets, false)
+	})
+	if err != nil {
+		return nil, err
+	}
+	order := orderDB.ToEntity(model)
+	return &order, nil
+}
+
+// ToReplaceEntity returns an OrderReplace entity from the ORM model.
+func (OrderDB) ToReplaceEntity(model OrderReplaceModel) orders.OrderReplace {
+	return orders.OrderReplace{
+		ID:                    model.ID,
+		OrderID:               model.OrderID,
+		OriginalExternalID:    model.OriginalExternalID,
+		ReplacementExternalID: model.ReplacementExternalID,
+		OldPrice:              model.OldPrice,
+		OldAmount:             model.OldAmount,
+		Price:                 model.Price,
+		Amount:                model.Amount,
+		ExternalTimestamp:     model.ExternalTimestamp,
+		CreatedAt:             model.CreatedAt,
+	}
+}
+
+// ToReplaceModel returns an ORM model from the OrderReplace entity.
+func (OrderDB) ToReplaceModel(entity orders.OrderReplace) OrderReplaceModel {
+	return OrderReplaceModel{
+		ID:                    entity.ID,
+		OrderID:               entity.OrderID,
+		OriginalExternalID:    entity.OriginalExternalID,
+		ReplacementExternalID: entity.ReplacementExternalID,
+		OldPrice:              entity.OldPrice,
+		OldAmount:             entity.OldAmount,
+		Price:                 entity.Price,
+		Amount:                entity.Amount,
+		ExternalTimestamp:     entity.ExternalTimestamp,
+		CreatedAt:             entity.CreatedAt,
+	}
+}
+
+// UpdateExternalResponse updates a pending order base on a exchange response.
+// The change is recorded on the status history.
+// Orders that are not pending anymore are not changed, so a repeated response has no effect.
+// A canceling order without external ID was canceled while it was sent: it gets the external ID (so the cancel
+// can be sent) and it changes to canceled if the response is denied, or to filled.
+func (orderDB OrderDB) UpdateExternalResponse(externalID orders.ExternalOrderID, externalTimestamp time.Time, change orders.OrderStatusChange) error {
+	return orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		model := OrderModel{}
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&model, change.OrderID)
+		if res.Error != nil {
+			return res.Error
+		}
+		sentWhileCanceling := model.Status == orders.OrderStatusCanceling && model.ExternalID == ""
+		if model.Status != orders.OrderStatusPending && !sentWhileCanceling {
+			return nil
+		}
+		if sentWhileCanceling {
+			switch change.ToStatus {
+			case orders.OrderStatusDenied:
+				// There is nothing to cancel on the exchange.
+				change.ToStatus = orders.OrderStatusCanceled
+			case orders.OrderStatusFilled:
+			default:
+				change.ToStatus = orders.OrderStatusCanceling
+			}
+		}
+		res = tx.
+			Table("order").
+			Where(`"id"=?`, model.ID).
+			Updates(map[string]interface{}{
+				"external_id":        externalID,
+				"external_timestamp": externalTimestamp,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		return orderDB.changeStatus(tx, &model, change)
+	})
+}
+
+// SetExternalID saves the external ID of an order that does not have one yet
+// (ex: a trade received before the submit response). Orders with an external ID are not changed.
+func (orderDB OrderDB) SetExternalID(orderID orders.OrderID, externalID orders.ExternalOrderID, externalTimestamp time.Time) error {
+	res := orderDB.db.GetDB().
+		Table("order").
+		Where(`"id"=? AND "external_id"=''`, orderID).
 		Updates(map[string]interface{}{
 			"external_id":        externalID,
 			"external_timestamp": externalTimestamp,
-			"status":             status,
-			"updated_at":         updatedAt,
+			"updated_at":         time.Now(),
 		})
 	return res.Error
 }
 
-// UpdateStatus updates an order status.
-func (orderDB OrderDB) UpdateStatus(orderID orders.OrderID, status orders.OrderStatus) error {
+// ChangeStatus changes an order status and records the change on the status history.
+// If "change.FromStatus" is set, the order must still be in this status.
+// The updated order is returned.
+// The following errors can happen: ErrInvalidStatusTransition.
+func (orderDB OrderDB) ChangeStatus(change orders.OrderStatusChange) (*orders.Order, error) {
+	return orderDB.ChangeStatusWithOutbox(change, "")
+}
+
+// ChangeStatusWithOutbox changes an order status like ChangeStatus and inserts an outbox message
+// of the order in the same transaction. No message is inserted if "action" is empty.
+// The updated order is returned.
+// The following errors can happen: ErrInvalidStatusTransition.
+func (orderDB OrderDB) ChangeStatusWithOutbox(change orders.OrderStatusChange, action orders.OutboxAction) (*orders.Order, error) {
+	model := OrderModel{}
+	err := orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&model, change.OrderID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if change.FromStatus != "" && change.FromStatus != model.Status {
+			return fmt.Errorf("%w: order %d is %s, expected %s", orders.ErrInvalidStatusTransition, model.ID, model.Status, change.FromStatus)
+		}
+		err := orderDB.changeStatus(tx, &model, change)
+		if err != nil || action == "" {
+			return err
+		}
+		message := orders.NewOutboxMessage(model.ID, action)
+		message.NextAttemptAt = model.UpdatedAt
+		outboxModel := orderDB.ToOutboxModel(message)
+		return tx.Create(&outboxModel).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	entity := orderDB.ToEntity(model)
+	return &entity, nil
+}
+
+// RestoreStatus returns an order in the status "change.FromStatus" to the status it had before,
+// based on the status history (ex: a cancel that failed). See RestoredStatus.
+// The updated order is returned.
+// The following errors can happen: ErrInvalidStatusTransition.
+func (orderDB OrderDB) RestoreStatus(change orders.OrderStatusChange) (*orders.Order, error) {
+	model := OrderModel{}
+	err := orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&model, change.OrderID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if model.Status != change.FromStatus {
+			return fmt.Errorf("%w: order %d is %s, expected %s", orders.ErrInvalidStatusTransition, model.ID, model.Status, change.FromStatus)
+		}
+		history, err := orderDB.getStatusHistory(tx, model.ID)
+		if err != nil {
+			return err
+		}
+		change.ToStatus = orders.RestoredStatus(orderDB.ToEntity(model), history)
+		return orderDB.changeStatus(tx, &model, change)
+	})
+	if err != nil {
+		return nil, err
+	}
+	entity := orderDB.ToEntity(model)
+	return &entity, nil
+}
+
+// changeStatus changes the status of a locked order and records the change.
+// Nothing is recorded if the status is the same.
+// The following errors can happen: ErrInvalidStatusTransition.
+func (orderDB OrderDB) changeStatus(tx *gorm.DB, model *OrderModel, change orders.OrderStatusChange) error {
+	if !orders.CanChangeStatus(model.Status, change.ToStatus) {
+		return fmt.Errorf("%w: order %d from %s to %s", orders.ErrInvalidStatusTransition, model.ID, model.Status, change.ToStatus)
+	}
+	if model.Status == change.ToStatus {
+		return nil
+	}
+	change.OrderID = model.ID
+	change.FromStatus = model.Status
+	model.Status = change.ToStatus
+	model.UpdatedAt = time.Now()
+	res := tx.
+		Table("order").
+		Where(`"id"=?`, model.ID).
+		Updates(map[string]interface{}{
+			"status":     model.Status,
+			"updated_at": model.UpdatedAt,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	changeModel := orderDB.ToStatusChangeModel(change)
+	return tx.Create(&changeModel).Error
+}
+
+// GetStatusHistory returns the status changes of an order, the oldest first.
+func (orderDB OrderDB) GetStatusHistory(orderID orders.OrderID) ([]orders.OrderStatusChange, error) {
+	return orderDB.getStatusHistory(orderDB.db.GetDB(), orderID)
+}
+
+// getStatusHistory returns the status changes of an order, the oldest first.
+func (orderDB OrderDB) getStatusHistory(tx *gorm.DB, orderID orders.OrderID) ([]orders.OrderStatusChange, error) {
+	models := []OrderStatusChangeModel{}
+	res := tx.
+		Where(`"order_id"=?`, orderID).
+		Order(`"id"`).
+		Find(&models)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	entities := make([]orders.OrderStatusChange, 0, len(models))
+	for _, model := range models {
+		entities = append(entities, orderDB.ToStatusChangeEntity(model))
+	}
+	return entities, nil
+}
+
+// ToStatusChangeEntity returns an OrderStatusChange entity from the ORM model.
+func (OrderDB) ToStatusChangeEntity(model OrderStatusChangeModel) orders.OrderStatusChange {
+	entity := orders.OrderStatusChange{
+		ID:         model.ID,
+		OrderID:    model.OrderID,
+		FromStatus: model.FromStatus,
+		ToStatus:   model.ToStatus,
+		Reason:     model.Reason,
+		Source:     model.Source,
+		CreatedAt:  model.CreatedAt,
+	}
+	return entity
+}
+
+// ToStatusChangeModel returns a GORM model from an order status change entity.
+func (OrderDB) ToStatusChangeModel(entity orders.OrderStatusChange) OrderStatusChangeModel {
+	model := OrderStatusChangeModel{
+		ID:         entity.ID,
+		OrderID:    entity.OrderID,
+		FromStatus: entity.FromStatus,
+		ToStatus:   entity.ToStatus,
+		Reason:     entity.Reason,
+		Source:     entity.Source,
+		CreatedAt:  entity.CreatedAt,
+	}
+	return model
+}
+
+// ToExecutionEntity returns an Execution entity from the ORM model.
+func (OrderDB) ToExecutionEntity(model ExecutionModel) orders.Execution {
+	deletedAt := time.Time{}
+	if model.DeletedAt.Valid {
+		deletedAt = model.DeletedAt.Time
+	}
+	entity := orders.Execution{
+		ID:        model.ID,
+		OrderID:   model.OrderID,
+		TradeID:   model.TradeID,
+		Price:     model.Price,
+		Amount:    model.Amount,
+		Fee:       model.Fee,
+		Timestamp: model.Timestamp,
+		CreatedAt: model.CreatedAt,
+		UpdatedAt: model.UpdatedAt,
+		DeletedAt: deletedAt,
+	}
+	return entity
+}
+
+// ToExecutionModel returns a GORM model from an execution entity.
+func (OrderDB) ToExecutionModel(entity orders.Execution) ExecutionModel {
+	deletedAt := gorm.DeletedAt{Time: entity.DeletedAt}
+	if !entity.DeletedAt.IsZero() {
+		deletedAt.Valid = true
+	}
+	model := ExecutionModel{
+		ID:        entity.ID,
+		OrderID:   entity.OrderID,
+		TradeID:   entity.TradeID,
+		Price:     entity.Price,
+		Amount:    entity.Amount,
+		Fee:       entity.Fee,
+		Timestamp: entity.Timestamp,
+		CreatedAt: entity.CreatedAt,
+		UpdatedAt: entity.UpdatedAt,
+		DeletedAt: deletedAt,
+	}
+	return model
+}
+
+// AddExecution inserts an execution and adds it to the order filled amount,
+// average price and status (see Order.AddFill) in the same transaction.
+// The fee of a buying order is capped at the fee it still holds (see Order.HeldFee) plus the available wallet balance.
+// The updated order and the inserted execution are returned.
+// The following errors can happen: ErrExecutionAlreadyExists.
+func (orderDB OrderDB) AddExecution(entity orders.Execution) (*orders.Order, *orders.Execution, error) {
+	var order orders.Order
+	err := orderDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		model := OrderModel{}
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&model, entity.OrderID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if model.Type == orders.OrderTypeBuy {
+			// The fee is paid from the funds held for it and the rest from the available balance
+			// (ex: a fixed fee is held once, but charged on each trade).
+			payable := orderDB.ToEntity(model).HeldFee()
+			wallet, err := orderDB.walletDB.WithTx(tx).GetByUserID(model.UserID)
+			if err != nil {
+				return err
+			}
+			if wallet != nil && wallet.Available > 0 {
+				payable += wallet.Available
+			}
+			if entity.Fee > payable {
+				entity.Fee = payable
+			}
+		}
+		executionModel := orderDB.ToExecutionModel(entity)
+		res = tx.Create(&executionModel)
+		if res.Error != nil {
+			if strings.Contains(res.Error.Error(), "unique constraint") {
+				// Original error: "ERROR: duplicate key value violates unique constraint "idx_execution_ordertrade" (SQLSTATE 23505)"
+				return fmt.Errorf("%w: Order ID %d, Trade ID %s", orders.ErrExecutionAlreadyExists, entity.OrderID, entity.TradeID)
+			}
+			return res.Error
+		}
+		entity = orderDB.ToExecutionEntity(executionModel)
+		filled := orderDB.ToEntity(model)
+		filled.AddFill(entity.Price, entity.Amount)
+		model.FilledAmount = filled.FilledAmount
+		model.AveragePrice = filled.AveragePrice
+		model.UpdatedAt = time.Now()
+		res = tx.
+			Table("order").
+			Where(`"id"=?`, model.ID).
+			Updates(map[string]interface{}{
+				"filled_amount": model.FilledAmount,
+				"average_price": model.AveragePrice,
+				"updated_at":    model.UpdatedAt,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		change := orders.NewOrderStatusChange(model.ID, filled.Status, orders.OrderStatusSourceExchange, fmt.Sprintf("Trade %s.", entity.TradeID))
+		err := orderDB.changeStatus(tx, &model, change)
+		if err != nil {
+			return err
+		}
+		order = orderDB.ToEntity(model)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &order, &entity, nil
+}
+
+// GetExecutionsByOrderID returns the executions of an order, the oldest first.
+func (orderDB OrderDB) GetExecutionsByOrderID(orderID orders.OrderID) ([]orders.Execution, error) {
+	models := []ExecutionModel{}
+	res := orderDB.db.GetDB().
+		Where(`"order_id"=?`, orderID).
+		Order(`"timestamp","id"`).
+		Find(&models)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	entities := make([]orders.Execution, 0, len(models))
+	for _, model := range models {
+		entities = append(entities, orderDB.ToExecutionEntity(model))
+	}
+	return entities, nil
+}
+
+// ToOutboxEntity returns an OutboxMessage entity from the ORM model.
+func (OrderDB) ToOutboxEntity(model OutboxMessageModel) orders.OutboxMessage {
+	deletedAt := time.Time{}
+	if model.DeletedAt.Valid {
+		deletedAt = model.DeletedAt.Time
+	}
+	entity := orders.OutboxMessage{
+		ID:                model.ID,
+		OrderID:           model.OrderID,
+		Action:            model.Action,
+		Status:            model.Status,
+		Attempts:          model.Attempts,
+		NextAttemptAt:     model.NextAttemptAt,
+		LastError:         model.LastError,
+		Price:             model.Price,
+		Amount:            model.Amount,
+		ExternalID:        model.ExternalID,
+		ExternalTimestamp: model.ExternalTimestamp,
+		CreatedAt:         model.CreatedAt,
+		UpdatedAt:         model.UpdatedAt,
+		DeletedAt:         deletedAt,
+	}
+	return entity
+}
+
+// ToOutboxModel returns a GORM model from an outbox message entity.
+func (OrderDB) ToOutboxModel(entity orders.OutboxMessage) OutboxMessageModel {
+	deletedAt := gorm.DeletedAt{Time: entity.DeletedAt}
+	if !entity.DeletedAt.IsZero() {
+		deletedAt.Valid = true
+	}
+	model := OutboxMessageModel{
+		ID:                entity.ID,
+		OrderID:           entity.OrderID,
+		Action:            entity.Action,
+		Status:            entity.Status,
+		Attempts:          entity.Attempts,
+		NextAttemptAt:     entity.NextAttemptAt,
+		LastError:         entity.LastError,
+		Price:             entity.Price,
+		Amount:            entity.Amount,
+		ExternalID:        entity.ExternalID,
+		ExternalTimestamp: entity.ExternalTimestamp,
+		CreatedAt:         entity.CreatedAt,
+		UpdatedAt:         entity.UpdatedAt,
+		DeletedAt:         deletedAt,
+	}
+	return model
+}
+
+// GetDueOutboxMessages returns up to "limit" pending outbox messages to be delivered at "now".
+// The oldest messages come first.
+func (orderDB OrderDB) GetDueOutboxMessages(now time.Time, limit int) ([]orders.OutboxMessage, error) {
+	models := []OutboxMessageModel{}
+	res := orderDB.db.GetDB().
+		Where(`"status"=? AND "next_attempt_at"<=?`, orders.OutboxStatusPending, now).
+		Order(`"id"`).
+		Limit(limit).
+		Find(&models)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	entities := make([]orders.OutboxMessage, 0, len(models))
+	for _, model := range models {
+		entities = append(entities, orderDB.ToOutboxEntity(model))
+	}
+	return entities, nil
+}
+
+// ClaimOutboxMessage reserves a due outbox message until "until", so other dispatchers skip it.
+// It returns false if the message is not due anymore (ex: claimed by another dispatcher).
+// If the dispatcher dies the message is due again after "until".
+func (orderDB OrderDB) ClaimOutboxMessage(id orders.OutboxMessageID, now time.Time, until time.Time) (bool, error) {
+	res := orderDB.db.GetDB().
+		Table("orderoutbox").
+		Where(`"id"=? AND "status"=? AND "next_attempt_at"<=?`, id, orders.OutboxStatusPending, now).
+		Updates(map[string]interface{}{
+			"next_attempt_at": until,
+			"updated_at":      now,
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// UpdateOutboxMessage saves the delivery state of an outbox message
+// (status, attempts, next attempt and last error).
+func (orderDB OrderDB) UpdateOutboxMessage(entity orders.OutboxMessage) error {
 	updatedAt := time.Now()
 	res := orderDB.db.GetDB().
-		Table("order").
-		Where(`"id"=?`, orderID).
+		Table("orderoutbox").
+		Where(`"id"=?`, entity.ID).
 		Updates(map[string]interface{}{
-			"status":     status,
-			"updated_at": updatedAt,
+			"status":             entity.Status,
+			"attempts":           entity.Attempts,
+			"next_attempt_at":    entity.NextAttemptAt,
+			"last_error":         entity.LastError,
+			"external_id":        entity.ExternalID,
+			"external_timestamp": entity.ExternalTimestamp,
+			"updated_at":         updatedAt,
 		})
 	return res.Error
 }
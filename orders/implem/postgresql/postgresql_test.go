@@ -0,0 +1,334 @@
+package postgresql_test
+
+import (
+	"errors"
+	"home-broker/assetwallets"
+	"home-broker/orders"
+	orderstests "home-broker/tests/orders"
+	postgresqltests "home-broker/tests/postgresql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSearch(t *testing.T) {
+	db, mock, err := postgresqltests.GetMockedOrderDB()
+	if err != nil {
+		t.Error(err)
+	}
+	expectedEntity := orderstests.GetOrder(10, orders.OrderTypeBuy, 999000000, 100000000, orderstests.BaseTime)
+	columns := []string{"id", "user_id", "asset_id", "external_id", "amount", "price", "type", "status", "created_at", "updated_at", "deleted_at"}
+
+	t.Run("FirstPageNewest", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT \* FROM "order" WHERE "user_id"=\$1 AND "type"=\$2 AND "created_at">=\$3 AND "order"\."deleted_at" IS NULL ORDER BY "created_at" DESC,"id" DESC LIMIT 51`).
+			WithArgs(expectedEntity.UserID, expectedEntity.Type, orderstests.BaseTime).
+			WillReturnRows(mock.NewRows(columns).
+				AddRow(
+					expectedEntity.ID, expectedEntity.UserID, expectedEntity.AssetID, expectedEntity.ExternalID,
+					expectedEntity.Amount, expectedEntity.Price, expectedEntity.Type, expectedEntity.Status,
+					expectedEntity.CreatedAt, expectedEntity.UpdatedAt, nil))
+
+		entities, err := db.Search(orders.OrderFilter{
+			UserID: expectedEntity.UserID,
+			Type:   expectedEntity.Type,
+			From:   orderstests.BaseTime,
+			Sort:   orders.OrderSortNewest,
+			Limit:  51,
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		if len(entities) != 1 || entities[0].ID != expectedEntity.ID {
+			t.Errorf("orders are %v, expected [%v]", entities, expectedEntity)
+		}
+	})
+
+	t.Run("NextPageOldest", func(t *testing.T) {
+		after := orders.OrderCursor{CreatedAt: orderstests.BaseTime.Add(time.Hour), ID: 9}
+		mock.ExpectQuery(`SELECT \* FROM "order" WHERE "asset_id"=\$1 AND \("created_at","id"\)>\(\$2,\$3\) AND "order"\."deleted_at" IS NULL ORDER BY "created_at","id" LIMIT 10`).
+			WithArgs(expectedEntity.AssetID, after.CreatedAt, after.ID).
+			WillReturnRows(mock.NewRows(columns))
+
+		entities, err := db.Search(orders.OrderFilter{
+			AssetID: expectedEntity.AssetID,
+			Sort:    orders.OrderSortOldest,
+			After:   after,
+			Limit:   10,
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		if len(entities) != 0 {
+			t.Errorf("orders are %v, expected none", entities)
+		}
+	})
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetByUserIDClientOrderID(t *testing.T) {
+	db, mock, err := postgresqltests.GetMockedOrderDB()
+	if err != nil {
+		t.Error(err)
+	}
+	expectedEntity := orderstests.GetOrder(10, orders.OrderTypeBuy, 999000000, 100000000, orderstests.BaseTime)
+	expectedEntity.ClientOrderID = "mobile-1"
+	columns := []string{"id", "user_id", "asset_id", "client_order_id", "amount", "price", "type", "status", "created_at", "updated_at", "deleted_at"}
+
+	mock.ExpectQuery(`SELECT \* FROM "order" WHERE \("user_id"=\$1 AND "client_order_id"=\$2\) AND "order"\."deleted_at" IS NULL LIMIT 1`).
+		WithArgs(expectedEntity.UserID, expectedEntity.ClientOrderID).
+		WillReturnRows(mock.NewRows(columns).
+			AddRow(
+				expectedEntity.ID, expectedEntity.UserID, expectedEntity.AssetID, expectedEntity.ClientOrderID,
+				expectedEntity.Amount, expectedEntity.Price, expectedEntity.Type, expectedEntity.Status,
+				expectedEntity.CreatedAt, expectedEntity.UpdatedAt, nil))
+
+	entity, err := db.GetByUserIDClientOrderID(expectedEntity.UserID, expectedEntity.ClientOrderID)
+	if err != nil {
+		t.Error(err)
+	}
+	if entity == nil || entity.ID != expectedEntity.ID || entity.ClientOrderID != expectedEntity.ClientOrderID {
+		t.Errorf("order is %v, expected %v", entity, expectedEntity)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClaimOrderBookBatch(t *testing.T) {
+	db, mock, err := postgresqltests.GetMockedOrderDB()
+	if err != nil {
+		t.Error(err)
+	}
+	now := orderstests.BaseTime
+	until := now.Add(30 * time.Second)
+	columns := []string{"id", "asset_id", "update", "status", "attempts", "next_attempt_at", "last_error", "created_at", "updated_at", "deleted_at"}
+	update := `{"id":"EX-1","asset_id":"VIBR","type":"buy","action":"added"}`
+
+	t.Run("Due", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT \* FROM "orderbookqueue" WHERE \("asset_id"=\$1 AND "status"=\$2\) AND "orderbookqueue"\."deleted_at" IS NULL ORDER BY "id" LIMIT 1 FOR UPDATE`).
+			WithArgs("VIBR", orders.OrderBookMessageStatusPending).
+			WillReturnRows(mock.NewRows(columns).AddRow(1, "VIBR", update, orders.OrderBookMessageStatusPending, 2, now, "", now, now, nil))
+		mock.ExpectExec(`UPDATE "orderbookqueue" SET "next_attempt_at"=\$1,"updated_at"=\$2 WHERE "id" = \$3`).
+			WithArgs(until, now, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`SELECT \* FROM "orderbookqueue" WHERE \("asset_id"=\$1 AND "status"=\$2\) AND "orderbookqueue"\."deleted_at" IS NULL ORDER BY "id" LIMIT 100`).
+			WithArgs("VIBR", orders.OrderBookMessageStatusPending).
+			WillReturnRows(mock.NewRows(columns).
+				AddRow(1, "VIBR", update, orders.OrderBookMessageStatusPending, 2, until, "", now, now, nil).
+				AddRow(2, "VIBR", update, orders.OrderBookMessageStatusPending, 0, now, "", now, now, nil))
+		mock.ExpectCommit()
+
+		messages, err := db.ClaimOrderBookBatch("VIBR", now, until, 100)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(messages) != 2 || messages[0].ID != 1 || messages[1].ID != 2 {
+			t.Errorf("messages are %v, expected the messages 1 and 2", messages)
+		}
+		if len(messages) > 0 && (messages[0].Update.ID != "EX-1" || messages[0].Attempts != 2) {
+			t.Errorf("message is %v, expected the update EX-1 with 2 attempts", messages[0])
+		}
+	})
+
+	t.Run("WaitingRetry", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT \* FROM "orderbookqueue" WHERE \("asset_id"=\$1 AND "status"=\$2\) AND "orderbookqueue"\."deleted_at" IS NULL ORDER BY "id" LIMIT 1 FOR UPDATE`).
+			WithArgs("VIBR", orders.OrderBookMessageStatusPending).
+			WillReturnRows(mock.NewRows(columns).AddRow(1, "VIBR", update, orders.OrderBookMessageStatusPending, 3, now.Add(time.Second), "", now, now, nil))
+		mock.ExpectCommit()
+
+		messages, err := db.ClaimOrderBookBatch("VIBR", now, until, 100)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(messages) != 0 {
+			t.Errorf("messages are %v, expected none", messages)
+		}
+	})
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReplace_OrderFilled_ExternalIDSaved(t *testing.T) {
+	db, mock, err := postgresqltests.GetMockedOrderDB()
+	if err != nil {
+		t.Error(err)
+	}
+	entity := orderstests.GetOrder(10, orders.OrderTypeSell, 10000000, 2000000, orderstests.BaseTime)
+	columns := []string{"id", "user_id", "asset_id", "external_id", "amount", "price", "type", "status", "filled_amount", "created_at", "updated_at", "deleted_at"}
+
+	// The order was filled while the replace was sent: the exchange works the replacement, so only its ID is saved.
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "order" WHERE "order"\."id" = \$1 AND "order"\."deleted_at" IS NULL LIMIT 1 FOR UPDATE`).
+		WithArgs(entity.ID).
+		WillReturnRows(mock.NewRows(columns).
+			AddRow(
+				entity.ID, entity.UserID, entity.AssetID, entity.ExternalID,
+				entity.Amount, entity.Price, entity.Type, orders.OrderStatusFilled, entity.Amount,
+				entity.CreatedAt, entity.UpdatedAt, nil))
+	mock.ExpectExec(`UPDATE "order" SET "external_id"=\$1,"external_timestamp"=\$2,"updated_at"=\$3 WHERE "id"=\$4`).
+		WithArgs("EX-2", orderstests.BaseTime, sqlmock.AnyArg(), entity.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "order_replace"`).
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	replace := orders.NewOrderReplace(entity, 11000000, 3000000, orders.ExchangeResponse{ID: "EX-2", Timestamp: orderstests.BaseTime})
+	updated, err := db.Replace(replace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ExternalID != "EX-2" || updated.Price != entity.Price || updated.Amount != entity.Amount {
+		t.Errorf("order is %+v, expected the external ID EX-2 with the old terms", updated)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReleaseHolds_OCOLeg_HoldsMovedToWorkingSibling(t *testing.T) {
+	db, mock, err := postgresqltests.GetMockedOrderDB()
+	if err != nil {
+		t.Error(err)
+	}
+	now := orderstests.BaseTime
+	columns := []string{"id", "user_id", "asset_id", "group_id", "parent_id", "type", "status", "held_funds", "held_assets", "created_at", "updated_at", "deleted_at"}
+
+	// The first leg holds for both, and it was canceled while the second one is working.
+	mock.ExpectQuery(`SELECT \* FROM "order" WHERE "order"\."id" = \$1 AND "order"\."deleted_at" IS NULL LIMIT 1`).
+		WithArgs(1).
+		WillReturnRows(mock.NewRows(columns).AddRow(1, 999, "VIBR", 5, 0, orders.OrderTypeBuy, orders.OrderStatusCanceled, 20000000, 0, now, now, nil))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "order" WHERE \("group_id"=\$1 AND "parent_id"=\$2\) AND "order"\."deleted_at" IS NULL ORDER BY "id" FOR UPDATE`).
+		WithArgs(5, 0).
+		WillReturnRows(mock.NewRows(columns).
+			AddRow(1, 999, "VIBR", 5, 0, orders.OrderTypeBuy, orders.OrderStatusCanceled, 20000000, 0, now, now, nil).
+			AddRow(2, 999, "VIBR", 5, 0, orders.OrderTypeBuy, orders.OrderStatusPartiallyFilled, 0, 0, now, now, nil))
+	// The wallet is not changed.
+	mock.ExpectExec(`UPDATE "order" SET "held_assets"=\$1,"held_funds"=\$2,"updated_at"=\$3 WHERE "id"=\$4`).
+		WithArgs(0, 0, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE "order" SET "held_assets"="held_assets"\+\$1,"held_funds"="held_funds"\+\$2,"updated_at"=\$3 WHERE "id"=\$4`).
+		WithArgs(0, 20000000, sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = db.ReleaseHolds(1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeleteOrderBookMessages(t *testing.T) {
+	db, mock, err := postgresqltests.GetMockedOrderDB()
+	if err != nil {
+		t.Error(err)
+	}
+	before := orderstests.BaseTime
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "orderbookqueue" WHERE "status"=\$1 AND "updated_at"<\$2`).
+		WithArgs(orders.OrderBookMessageStatusSent, before).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	deleted, err := db.DeleteOrderBookMessages(orders.OrderBookMessageStatusSent, before)
+	if err != nil {
+		t.Error(err)
+	}
+	if deleted != 2 {
+		t.Errorf("%d messages deleted, expected 2", deleted)
+	}
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConsumeHeldAssets(t *testing.T) {
+	db, mock, err := postgresqltests.GetMockedOrderDB()
+	if err != nil {
+		t.Error(err)
+	}
+	now := orderstests.BaseTime
+	columns := []string{"id", "user_id", "asset_id", "group_id", "parent_id", "type", "status", "held_funds", "held_assets", "created_at", "updated_at", "deleted_at"}
+
+	t.Run("Order_BalanceCoversHeld", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT \* FROM "order" WHERE "order"\."id" = \$1 AND "order"\."deleted_at" IS NULL LIMIT 1 FOR UPDATE`).
+			WithArgs(1).
+			WillReturnRows(mock.NewRows(columns).AddRow(1, 999, "VIBR", 0, 0, orders.OrderTypeSell, orders.OrderStatusAccepted, 0, 1000000, now, now, nil))
+		mock.ExpectExec(`UPDATE "assetwallet" SET "balance"="balance"-\$1,"held"="held"-\$2,"updated_at"=\$3 WHERE "user_id"=\$4 AND "asset_id"=\$5 AND "deleted_at" IS NULL AND "balance"-\$6>="held"-\$7`).
+			WithArgs(1000000, 1000000, sqlmock.AnyArg(), 999, "VIBR", 1000000, 1000000).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE "order" SET "held_assets"="held_assets"-\$1,"held_funds"="held_funds"-\$2,"updated_at"=\$3 WHERE "id"=\$4`).
+			WithArgs(1000000, 0, sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := db.ConsumeHeldAssets(1, 1000000)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("BracketExit_PendingAssetsCoverHeld", func(t *testing.T) {
+		// The exit holds the assets bought by its entry, which are not settled yet,
+		// so the asset wallet balance is negative until the settlement date.
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT \* FROM "order" WHERE "order"\."id" = \$1 AND "order"\."deleted_at" IS NULL LIMIT 1 FOR UPDATE`).
+			WithArgs(2).
+			WillReturnRows(mock.NewRows(columns).AddRow(2, 999, "VIBR", 5, 1, orders.OrderTypeSell, orders.OrderStatusAccepted, 0, 1000000, now, now, nil))
+		mock.ExpectExec(`UPDATE "assetwallet" SET "balance"="balance"-\$1,"held"="held"-\$2,"updated_at"=\$3 WHERE "user_id"=\$4 AND "asset_id"=\$5 AND "deleted_at" IS NULL AND "balance"\+"pending"-\$6>="held"-\$7`).
+			WithArgs(1000000, 1000000, sqlmock.AnyArg(), 999, "VIBR", 1000000, 1000000).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE "order" SET "held_assets"="held_assets"-\$1,"held_funds"="held_funds"-\$2,"updated_at"=\$3 WHERE "id"=\$4`).
+			WithArgs(1000000, 0, sqlmock.AnyArg(), 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := db.ConsumeHeldAssets(2, 1000000)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("BalanceDoesNotCoverHeld_ErrInsufficientAssets", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT \* FROM "order" WHERE "order"\."id" = \$1 AND "order"\."deleted_at" IS NULL LIMIT 1 FOR UPDATE`).
+			WithArgs(1).
+			WillReturnRows(mock.NewRows(columns).AddRow(1, 999, "VIBR", 0, 0, orders.OrderTypeSell, orders.OrderStatusAccepted, 0, 1000000, now, now, nil))
+		mock.ExpectExec(`UPDATE "assetwallet" SET "balance"="balance"-\$1,"held"="held"-\$2,"updated_at"=\$3 WHERE "user_id"=\$4 AND "asset_id"=\$5 AND "deleted_at" IS NULL AND "balance"-\$6>="held"-\$7`).
+			WithArgs(1000000, 1000000, sqlmock.AnyArg(), 999, "VIBR", 1000000, 1000000).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := db.ConsumeHeldAssets(1, 1000000)
+		if !errors.Is(err, assetwallets.ErrInsufficientAssets) {
+			t.Errorf("expected ErrInsufficientAssets, received \"%v\"", err)
+		}
+	})
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
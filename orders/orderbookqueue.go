@@ -0,0 +1,66 @@
+package orders
+
+import (
+	"errors"
+	"home-broker/assets"
+	"time"
+)
+
+var (
+	// ErrOrderBookRejected happens when the order book refuses an update for good (ex: an invalid update).
+	// Retrying the update does not help, so it goes to the dead letters.
+	ErrOrderBookRejected = errors.New("update rejected by the order book")
+
+	// ErrOrderBookUnavailable happens when the circuit breaker of an order book is open.
+	ErrOrderBookUnavailable = errors.New("order book unavailable")
+)
+
+type (
+	// OrderBookMessageID represents the OrderBookMessage ID type.
+	OrderBookMessageID int64
+
+	// OrderBookMessageStatus represents the delivery status of an order book message.
+	// Use the value of OrderBookMessageStatusPending, OrderBookMessageStatusSent or OrderBookMessageStatusDead to set this data type.
+	OrderBookMessageStatus string
+)
+
+const (
+	// OrderBookMessageStatusPending is a message waiting to be delivered (or retried).
+	OrderBookMessageStatusPending OrderBookMessageStatus = "pending"
+
+	// OrderBookMessageStatusSent is a message delivered to the order book.
+	OrderBookMessageStatusSent OrderBookMessageStatus = "sent"
+
+	// OrderBookMessageStatusDead is a message refused by the order book (dead letter).
+	// It is kept to be checked, but it is not delivered again.
+	OrderBookMessageStatusDead OrderBookMessageStatus = "dead"
+)
+
+// OrderBookMessage is an update waiting to be forwarded to the order book of its asset.
+// The messages of an asset are delivered in the order they were queued (ID order).
+type OrderBookMessage struct {
+	ID            OrderBookMessageID     `json:"id"`
+	AssetID       assets.AssetID         `json:"asset_id"`
+	Update        ExternalUpdate         `json:"update"`
+	Status        OrderBookMessageStatus `json:"status"`
+	Attempts      int                    `json:"attempts"`
+	NextAttemptAt time.Time              `json:"next_attempt_at"` // Only the first pending message of the asset uses it.
+	LastError     string                 `json:"last_error"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+}
+
+// NewOrderBookMessage creates a new pending order book message of an update.
+func NewOrderBookMessage(update ExternalUpdate) OrderBookMessage {
+	return OrderBookMessage{
+		AssetID: update.AssetID,
+		Update:  update,
+		Status:  OrderBookMessageStatusPending,
+	}
+}
+
+// Backoff returns the time to wait before the next attempt.
+// It doubles on each attempt, starting from "base" and limited by "max".
+func (m OrderBookMessage) Backoff(base time.Duration, max time.Duration) time.Duration {
+	return backoff(m.Attempts, base, max)
+}
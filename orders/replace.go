@@ -0,0 +1,84 @@
+package orders
+
+import (
+	"home-broker/assets"
+	"home-broker/money"
+	"time"
+)
+
+// OrderReplaceID represents the OrderReplace ID type.
+type OrderReplaceID int64
+
+// OrderReplace is a change of the price and amount of a working order (cancel/replace).
+// It links the external ID of the order before the replace to the external ID of the replacement,
+// so the updates sent by the exchange for both IDs are found.
+type OrderReplace struct {
+	ID                    OrderReplaceID   `json:"id"`
+	OrderID               OrderID          `json:"order_id"`
+	OriginalExternalID    ExternalOrderID  `json:"original_external_id"`
+	ReplacementExternalID ExternalOrderID  `json:"replacement_external_id"`
+	OldPrice              money.Money      `json:"old_price"`
+	OldAmount             assets.AssetUnit `json:"old_amount"`
+	Price                 money.Money      `json:"price"`
+	Amount                assets.AssetUnit `json:"amount"`
+	ExternalTimestamp     time.Time        `json:"external_timestamp"` // Exchange timestamp of the replace.
+	FeeHold               money.Money      `json:"-"`                  // Fees held with the funds of the new terms (not saved).
+	CreatedAt             time.Time        `json:"created_at"`
+}
+
+// NewOrderReplace creates the replace of an order based on the exchange response.
+func NewOrderReplace(order Order, price money.Money, amount assets.AssetUnit, response ExchangeResponse) OrderReplace {
+	replacementID := response.ID
+	if replacementID == "" {
+		// The exchange kept the order ID.
+		replacementID = order.ExternalID
+	}
+	return OrderReplace{
+		OrderID:               order.ID,
+		OriginalExternalID:    order.ExternalID,
+		ReplacementExternalID: replacementID,
+		OldPrice:              order.Price,
+		OldAmount:             order.Amount,
+		Price:                 price,
+		Amount:                amount,
+		ExternalTimestamp:     response.Timestamp,
+	}
+}
+
+// CanReplace returns true if the order can be replaced by one with "amount": it must be working
+// ("accepted" or "partially_filled") and "amount" must be greater than the filled amount.
+func (o Order) CanReplace(amount assets.AssetUnit) bool {
+	if o.Status != OrderStatusAccepted && o.Status != OrderStatusPartiallyFilled {
+		return false
+	}
+	return amount > o.FilledAmount
+}
+
+// RequiredHolds returns the funds (buying order) or assets (selling order)
+// that an order must hold for the amount not filled yet.
+// The funds are rounded up, so they cover the value of the amount (see money.Notional).
+// The following errors can happen: money.ErrOverflow.
+func (o Order) RequiredHolds() (money.Money, assets.AssetUnit, error) {
+	remaining := o.Amount - o.FilledAmount
+	if remaining < 0 {
+		remaining = 0
+	}
+	if o.Type == OrderTypeBuy {
+		funds, err := money.Notional(o.Price, remaining, money.RoundUp)
+		if err != nil {
+			return 0, 0, err
+		}
+		return funds, 0, nil
+	}
+	return 0, remaining, nil
+}
+
+// HeldFee returns the funds held by a buying order beyond the funds of the amount not filled yet
+// (see RequiredHolds). They pay the fees of its trades.
+func (o Order) HeldFee() money.Money {
+	funds, _, err := o.RequiredHolds()
+	if err != nil || funds >= o.HeldFunds {
+		return 0
+	}
+	return o.HeldFunds - funds
+}
@@ -0,0 +1,104 @@
+package orders_test
+
+import (
+	"errors"
+	"home-broker/money"
+	"home-broker/orders"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestOrderRequiredHolds(t *testing.T) {
+	// 100 units at $20.00, 40 units filled: holds 60 * $20.00.
+	buy := orders.NewBuyOrder("VIBR", 100000000, 20000000)
+	buy.FilledAmount = 40000000
+	funds, assets, err := buy.RequiredHolds()
+	if err != nil || funds != 1200000000 || assets != 0 {
+		t.Errorf("received %v/%v/%v, expected %v/%v/nil", funds, assets, err, 1200000000, 0)
+	}
+
+	// The funds of a fraction of unit are rounded up.
+	buy = orders.NewBuyOrder("VIBR", 1, 20000001)
+	funds, _, err = buy.RequiredHolds()
+	if err != nil || funds != 21 {
+		t.Errorf("received %v/%v, expected %v/nil", funds, err, 21)
+	}
+
+	sell := orders.NewSellOrder("VIBR", 100, 20)
+	sell.FilledAmount = 40
+	funds, assets, err = sell.RequiredHolds()
+	if err != nil || funds != 0 || assets != 60 {
+		t.Errorf("received %v/%v/%v, expected %v/%v/nil", funds, assets, err, 0, 60)
+	}
+
+	// Overfilled.
+	sell.FilledAmount = 120
+	_, assets, _ = sell.RequiredHolds()
+	if assets != 0 {
+		t.Errorf("received %v, expected %v", assets, 0)
+	}
+
+	// The value does not fit in Money.
+	buy = orders.NewBuyOrder("VIBR", math.MaxInt64, math.MaxInt64)
+	_, _, err = buy.RequiredHolds()
+	if !errors.Is(err, money.ErrOverflow) {
+		t.Errorf("err is %v, expected %v", err, money.ErrOverflow)
+	}
+}
+
+func TestNewOrderReplace(t *testing.T) {
+	order := orders.NewBuyOrder("VIBR", 100, 20)
+	order.ID = 1
+	order.ExternalID = "EXT-1"
+	now := time.Now()
+
+	replace := orders.NewOrderReplace(order, 21, 150, orders.ExchangeResponse{ID: "EXT-2", Timestamp: now})
+	expected := orders.OrderReplace{
+		OrderID:               1,
+		OriginalExternalID:    "EXT-1",
+		ReplacementExternalID: "EXT-2",
+		OldPrice:              20,
+		OldAmount:             100,
+		Price:                 21,
+		Amount:                150,
+		ExternalTimestamp:     now,
+	}
+	if replace != expected {
+		t.Errorf("received %v, expected %v", replace, expected)
+	}
+
+	// The exchange kept the order ID.
+	replace = orders.NewOrderReplace(order, 21, 150, orders.ExchangeResponse{Timestamp: now})
+	if replace.ReplacementExternalID != "EXT-1" {
+		t.Errorf("received %v, expected %v", replace.ReplacementExternalID, "EXT-1")
+	}
+}
+
+func TestHeldFee(t *testing.T) {
+	// 20.00 for 2 assets at 10.00 and 5.00 for the fees.
+	buy := orders.NewBuyOrder("VIBR", 2000000, 10000000)
+	buy.HeldFunds = 25000000
+	if fee := buy.HeldFee(); fee != 5000000 {
+		t.Errorf("received %v, expected %v", fee, 5000000)
+	}
+
+	// A fill released 10.00 and the fee.
+	buy.FilledAmount = 1000000
+	buy.HeldFunds = 10000000
+	if fee := buy.HeldFee(); fee != 0 {
+		t.Errorf("received %v, expected %v", fee, 0)
+	}
+
+	// Less than the remaining amount is held (ex: the holds were released).
+	buy.HeldFunds = 0
+	if fee := buy.HeldFee(); fee != 0 {
+		t.Errorf("received %v, expected %v", fee, 0)
+	}
+
+	sell := orders.NewSellOrder("VIBR", 100, 20)
+	sell.HeldAssets = 100
+	if fee := sell.HeldFee(); fee != 0 {
+		t.Errorf("received %v, expected %v", fee, 0)
+	}
+}
@@ -0,0 +1,103 @@
+package orders
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInvalidStatusTransition happens when an order status cannot change to another one.
+	ErrInvalidStatusTransition = errors.New("invalid order status transition")
+)
+
+// OrderStatusSource represents who changed the status of an order.
+// Use the value of OrderStatusSourceUser, OrderStatusSourceExchange or OrderStatusSourceDispatcher to set this data type.
+type OrderStatusSource string
+
+const (
+	// OrderStatusSourceUser is a change requested by the user (ex: a cancel).
+	OrderStatusSourceUser OrderStatusSource = "user"
+
+	// OrderStatusSourceExchange is a change reported by the exchange (responses and updates).
+	OrderStatusSourceExchange OrderStatusSource = "exchange"
+
+	// OrderStatusSourceDispatcher is a change made by the outbox dispatcher (ex: delivery failed).
+	OrderStatusSourceDispatcher OrderStatusSource = "dispatcher"
+)
+
+// orderStatusTransitions holds the statuses that each status can change to.
+// The statuses without transitions are final.
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:         {OrderStatusAccepted, OrderStatusDenied, OrderStatusPartiallyFilled, OrderStatusFilled, OrderStatusCanceling},
+	OrderStatusAccepted:        {OrderStatusPartiallyFilled, OrderStatusFilled, OrderStatusCanceling, OrderStatusCanceled},
+	OrderStatusPartiallyFilled: {OrderStatusFilled, OrderStatusCanceling, OrderStatusCanceled},
+	// A canceling order goes back to a working (or pending) status if the cancel fails.
+	OrderStatusCanceling: {OrderStatusCanceled, OrderStatusAccepted, OrderStatusPartiallyFilled, OrderStatusFilled, OrderStatusPending},
+	// A waiting order is sent to the exchange (or canceled) by the home broker.
+	OrderStatusWaiting: {OrderStatusPending, OrderStatusCanceled},
+}
+
+// CanChangeStatus returns true if an order status can change from "from" to "to".
+// Keeping the same status is allowed (ex: a partially filled order with another fill).
+func CanChangeStatus(from OrderStatus, to OrderStatus) bool {
+	if from == to {
+		return true
+	}
+	for _, status := range orderStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal returns true if an order status cannot change anymore.
+func IsFinal(status OrderStatus) bool {
+	return len(orderStatusTransitions[status]) == 0
+}
+
+// OrderStatusChangeID represents the OrderStatusChange ID type.
+type OrderStatusChangeID int64
+
+// OrderStatusChange is a record of the order status history.
+type OrderStatusChange struct {
+	ID         OrderStatusChangeID `json:"id"`
+	OrderID    OrderID             `json:"order_id"`
+	FromStatus OrderStatus         `json:"from_status"` // Empty for a new order.
+	ToStatus   OrderStatus         `json:"to_status"`
+	Reason     string              `json:"reason"`
+	Source     OrderStatusSource   `json:"source"`
+	CreatedAt  time.Time           `json:"created_at"`
+}
+
+// NewOrderStatusChange creates a change of an order to a status.
+func NewOrderStatusChange(orderID OrderID, status OrderStatus, source OrderStatusSource, reason string) OrderStatusChange {
+	return OrderStatusChange{
+		OrderID:  orderID,
+		ToStatus: status,
+		Source:   source,
+		Reason:   reason,
+	}
+}
+
+// PreviousStatus returns the status of an order before it changed to "status", based on its history
+// (the oldest change first). It returns an empty status if the order was never in "status".
+func PreviousStatus(history []OrderStatusChange, status OrderStatus) OrderStatus {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].ToStatus == status && history[i].FromStatus != status {
+			return history[i].FromStatus
+		}
+	}
+	return ""
+}
+
+// RestoredStatus returns the working status that an order goes back to when it leaves its current status
+// without changing (ex: a cancel rejected by the exchange). It is the status before the current one on the
+// history (the oldest change first), but an accepted order filled in the meantime goes back as partially filled.
+func RestoredStatus(order Order, history []OrderStatusChange) OrderStatus {
+	status := PreviousStatus(history, order.Status)
+	if status == OrderStatusAccepted && order.FilledAmount > 0 {
+		return OrderStatusPartiallyFilled
+	}
+	return status
+}
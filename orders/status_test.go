@@ -0,0 +1,84 @@
+package orders_test
+
+import (
+	"home-broker/orders"
+	"testing"
+)
+
+func TestCanChangeStatus(t *testing.T) {
+	testTable := []struct {
+		from     orders.OrderStatus
+		to       orders.OrderStatus
+		expected bool
+	}{
+		{from: orders.OrderStatusPending, to: orders.OrderStatusAccepted, expected: true},
+		{from: orders.OrderStatusPending, to: orders.OrderStatusCanceling, expected: true},
+		{from: orders.OrderStatusPending, to: orders.OrderStatusCanceled, expected: false},
+		{from: orders.OrderStatusAccepted, to: orders.OrderStatusCanceling, expected: true},
+		{from: orders.OrderStatusAccepted, to: orders.OrderStatusPending, expected: false},
+		{from: orders.OrderStatusPartiallyFilled, to: orders.OrderStatusPartiallyFilled, expected: true},
+		{from: orders.OrderStatusCanceling, to: orders.OrderStatusAccepted, expected: true},
+		{from: orders.OrderStatusCanceled, to: orders.OrderStatusAccepted, expected: false},
+		{from: orders.OrderStatusWaiting, to: orders.OrderStatusPending, expected: true},
+		{from: orders.OrderStatusWaiting, to: orders.OrderStatusCanceling, expected: false},
+		{from: orders.OrderStatusFilled, to: orders.OrderStatusCanceling, expected: false},
+		{from: orders.OrderStatusDenied, to: orders.OrderStatusAccepted, expected: false},
+	}
+	for _, table := range testTable {
+		t.Run(string(table.from)+"_"+string(table.to), func(t *testing.T) {
+			if orders.CanChangeStatus(table.from, table.to) != table.expected {
+				t.Errorf("CanChangeStatus is %v, expected %v", !table.expected, table.expected)
+			}
+		})
+	}
+}
+
+func TestIsFinal(t *testing.T) {
+	for _, status := range []orders.OrderStatus{orders.OrderStatusDenied, orders.OrderStatusCanceled, orders.OrderStatusFilled} {
+		if !orders.IsFinal(status) {
+			t.Errorf("%v is not final, expected as final", status)
+		}
+	}
+	for _, status := range []orders.OrderStatus{orders.OrderStatusPending, orders.OrderStatusAccepted, orders.OrderStatusPartiallyFilled, orders.OrderStatusCanceling} {
+		if orders.IsFinal(status) {
+			t.Errorf("%v is final, expected as not final", status)
+		}
+	}
+}
+
+func TestPreviousStatus(t *testing.T) {
+	history := []orders.OrderStatusChange{
+		{ToStatus: orders.OrderStatusPending},
+		{FromStatus: orders.OrderStatusPending, ToStatus: orders.OrderStatusAccepted},
+		{FromStatus: orders.OrderStatusAccepted, ToStatus: orders.OrderStatusPartiallyFilled},
+		{FromStatus: orders.OrderStatusPartiallyFilled, ToStatus: orders.OrderStatusCanceling},
+	}
+	previous := orders.PreviousStatus(history, orders.OrderStatusCanceling)
+	if previous != orders.OrderStatusPartiallyFilled {
+		t.Errorf("previous status is %v, expected %v", previous, orders.OrderStatusPartiallyFilled)
+	}
+	previous = orders.PreviousStatus(history, orders.OrderStatusCanceled)
+	if previous != "" {
+		t.Errorf("previous status is %v, expected empty", previous)
+	}
+}
+
+func TestRestoredStatus(t *testing.T) {
+	history := []orders.OrderStatusChange{
+		{ToStatus: orders.OrderStatusPending},
+		{FromStatus: orders.OrderStatusPending, ToStatus: orders.OrderStatusAccepted},
+		{FromStatus: orders.OrderStatusAccepted, ToStatus: orders.OrderStatusCanceling},
+	}
+	order := orders.Order{Status: orders.OrderStatusCanceling, Amount: 100}
+	restored := orders.RestoredStatus(order, history)
+	if restored != orders.OrderStatusAccepted {
+		t.Errorf("restored status is %v, expected %v", restored, orders.OrderStatusAccepted)
+	}
+
+	// Filled while canceling.
+	order.FilledAmount = 40
+	restored = orders.RestoredStatus(order, history)
+	if restored != orders.OrderStatusPartiallyFilled {
+		t.Errorf("restored status is %v, expected %v", restored, orders.OrderStatusPartiallyFilled)
+	}
+}
@@ -0,0 +1,106 @@
+package orders
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"home-broker/core"
+	"strings"
+)
+
+const (
+	// MaxExternalUpdatesBatch is the highest number of updates of a batch.
+	MaxExternalUpdatesBatch = 10000
+
+	// NDJSONContentType is the content type of a stream of updates, one JSON per line.
+	NDJSONContentType = "application/x-ndjson"
+)
+
+var (
+	// ErrInvalidUpdates happens when a webhook body is not an update, a JSON array of updates or NDJSON.
+	ErrInvalidUpdates = errors.New("invalid external updates")
+
+	// ErrTooManyUpdates happens when a batch has more than MaxExternalUpdatesBatch updates.
+	ErrTooManyUpdates = errors.New("too many external updates")
+)
+
+// ExternalUpdateItem is an update of a batch and its decoding error (ex: an invalid NDJSON line).
+type ExternalUpdateItem struct {
+	Update ExternalUpdate
+	Err    error
+}
+
+// ExternalUpdateResult is the result of an update of a batch, in the same position (index) of the batch.
+type ExternalUpdateResult struct {
+	Index int    `json:"index"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// NewExternalUpdateResult returns the result of an update of a batch.
+// Only the validation messages are returned, the other errors are "Internal server error." like on the API errors.
+func NewExternalUpdateResult(index int, err error) ExternalUpdateResult {
+	if err == nil {
+		return ExternalUpdateResult{Index: index, OK: true}
+	}
+	result := ExternalUpdateResult{Index: index, Error: "Internal server error."}
+	errVal, ok := err.(core.ErrValidation)
+	if ok {
+		result.Error = errVal.Message
+	}
+	return result
+}
+
+// DecodeExternalUpdates decodes a webhook body with an update (JSON object), a JSON array of updates
+// or a NDJSON stream of updates (one JSON object per line, NDJSONContentType).
+// It returns false on "batch" if the body is a single update (JSON object).
+// An invalid NDJSON line is returned as an item with error, so the other lines can be processed.
+// The following errors can happen: ErrInvalidUpdates, ErrTooManyUpdates.
+func DecodeExternalUpdates(contentType string, body []byte) (items []ExternalUpdateItem, batch bool, err error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, false, ErrInvalidUpdates
+	}
+	if body[0] == '[' {
+		updates := []ExternalUpdate{}
+		if err := json.Unmarshal(body, &updates); err != nil {
+			return nil, true, ErrInvalidUpdates
+		}
+		if len(updates) > MaxExternalUpdatesBatch {
+			return nil, true, ErrTooManyUpdates
+		}
+		items = make([]ExternalUpdateItem, 0, len(updates))
+		for _, update := range updates {
+			items = append(items, ExternalUpdateItem{Update: update})
+		}
+		return items, true, nil
+	}
+	if !strings.HasPrefix(contentType, NDJSONContentType) && !bytes.ContainsRune(body, '\n') {
+		update := ExternalUpdate{}
+		if err := json.Unmarshal(body, &update); err != nil {
+			return nil, false, ErrInvalidUpdates
+		}
+		return []ExternalUpdateItem{{Update: update}}, false, nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(items) == MaxExternalUpdatesBatch {
+			return nil, true, ErrTooManyUpdates
+		}
+		item := ExternalUpdateItem{}
+		if err := json.Unmarshal(line, &item.Update); err != nil {
+			item.Err = core.NewErrValidation("Invalid JSON.")
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, true, ErrInvalidUpdates
+	}
+	return items, true, nil
+}
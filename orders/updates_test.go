@@ -0,0 +1,56 @@
+package orders_test
+
+import (
+	"errors"
+	"home-broker/orders"
+	"strings"
+	"testing"
+)
+
+func TestDecodeExternalUpdates(t *testing.T) {
+	update := `{"id":"1","asset_id":"VIBR","action":"added"}`
+	testTable := []struct {
+		test        string
+		contentType string
+		body        string
+		batch       bool
+		ids         []orders.ExternalOrderID
+		itemErrors  []bool
+		expectedErr error
+	}{
+		{test: "Single", contentType: "application/json", body: update, batch: false, ids: []orders.ExternalOrderID{"1"}, itemErrors: []bool{false}},
+		{test: "Array", contentType: "application/json", body: `[` + update + `,{"id":"2","asset_id":"VIBR"}]`, batch: true, ids: []orders.ExternalOrderID{"1", "2"}, itemErrors: []bool{false, false}},
+		{test: "NDJSON", contentType: orders.NDJSONContentType, body: update + "\n\n{\"id\":\"2\"}\n", batch: true, ids: []orders.ExternalOrderID{"1", "2"}, itemErrors: []bool{false, false}},
+		{test: "NDJSONOneLine", contentType: orders.NDJSONContentType, body: update, batch: true, ids: []orders.ExternalOrderID{"1"}, itemErrors: []bool{false}},
+		{test: "NDJSONInvalidLine", contentType: orders.NDJSONContentType, body: update + "\n{invalid\n{\"id\":\"3\"}", batch: true, ids: []orders.ExternalOrderID{"1", "", "3"}, itemErrors: []bool{false, true, false}},
+		{test: "InvalidSingle", contentType: "application/json", body: `{invalid`, expectedErr: orders.ErrInvalidUpdates},
+		{test: "InvalidArray", contentType: "application/json", body: `[` + update + `,{invalid]`, expectedErr: orders.ErrInvalidUpdates},
+		{test: "Empty", contentType: "application/json", body: ` `, expectedErr: orders.ErrInvalidUpdates},
+		{test: "TooMany", contentType: orders.NDJSONContentType, body: strings.Repeat(update+"\n", orders.MaxExternalUpdatesBatch+1), expectedErr: orders.ErrTooManyUpdates},
+	}
+	for _, table := range testTable {
+		t.Run(table.test, func(t *testing.T) {
+			items, batch, err := orders.DecodeExternalUpdates(table.contentType, []byte(table.body))
+			if !errors.Is(err, table.expectedErr) {
+				t.Fatalf("err is %v, expected %v", err, table.expectedErr)
+			}
+			if table.expectedErr != nil {
+				return
+			}
+			if batch != table.batch {
+				t.Errorf("batch is %v, expected %v", batch, table.batch)
+			}
+			if len(items) != len(table.ids) {
+				t.Fatalf("items count is %d, expected %d", len(items), len(table.ids))
+			}
+			for i, item := range items {
+				if item.Update.ID != table.ids[i] {
+					t.Errorf("item %d ID is %v, expected %v", i, item.Update.ID, table.ids[i])
+				}
+				if (item.Err != nil) != table.itemErrors[i] {
+					t.Errorf("item %d error is %v, expected error %v", i, item.Err, table.itemErrors[i])
+				}
+			}
+		})
+	}
+}
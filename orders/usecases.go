@@ -3,39 +3,123 @@ package orders
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"home-broker/assets"
 	"home-broker/assetwallets"
+	"home-broker/calendars"
 	"home-broker/core"
+	"home-broker/fees"
 	"home-broker/money"
+	"home-broker/pricebands"
+	"home-broker/settlements"
 	"home-broker/users"
 	"home-broker/wallets"
 	"io/ioutil"
 	"log"
-	"math"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 )
 
 // OrderUseCases represents the order use cases.
 type OrderUseCases struct {
-	db            OrderDBInterface
-	walletUC      wallets.WalletUseCases
-	assetWalletUC assetwallets.AssetWalletUseCases
-	orderBookHost string
+	db                OrderDBInterface
+	uow               core.UnitOfWork
+	walletUC          wallets.WalletUseCases
+	assetWalletUC     assetwallets.AssetWalletUseCases
+	assetUC           assets.AssetUseCases
+	priceBandUC       pricebands.PriceBandUseCases
+	feeUC             fees.FeeUseCases
+	settlementUC      settlements.SettlementUseCases
+	calendarUC        calendars.CalendarUseCases
+	exchangeClients   ExchangeClients
+	orderBookHost     string
+	orderBookSigner   core.WebhookSigner
+	orderBookClient   *http.Client
+	updatesMux        *sync.Mutex
+	orderBookBreakers *orderBookBreakers
+	eventBus          core.EventBus
 }
 
 // NewOrderUseCases returns a new OrderUseCases.
-func NewOrderUseCases(db OrderDBInterface, walletUC wallets.WalletUseCases, assetWalletUC assetwallets.AssetWalletUseCases, orderBookHost string) OrderUseCases {
-	return OrderUseCases{db: db, walletUC: walletUC, assetWalletUC: assetWalletUC, orderBookHost: orderBookHost}
+func NewOrderUseCases(db OrderDBInterface, uow core.UnitOfWork, walletUC wallets.WalletUseCases, assetWalletUC assetwallets.AssetWalletUseCases, assetUC assets.AssetUseCases, priceBandUC pricebands.PriceBandUseCases, feeUC fees.FeeUseCases, settlementUC settlements.SettlementUseCases, calendarUC calendars.CalendarUseCases, exchangeClients ExchangeClients, orderBookHost string, orderBookSigner core.WebhookSigner, eventBus core.EventBus) OrderUseCases {
+	return OrderUseCases{
+		db:                db,
+		uow:               uow,
+		walletUC:          walletUC,
+		assetWalletUC:     assetWalletUC,
+		assetUC:           assetUC,
+		priceBandUC:       priceBandUC,
+		feeUC:             feeUC,
+		settlementUC:      settlementUC,
+		calendarUC:        calendarUC,
+		exchangeClients:   exchangeClients,
+		orderBookHost:     orderBookHost,
+		orderBookSigner:   orderBookSigner,
+		orderBookClient:   &http.Client{Timeout: orderBookTimeout},
+		updatesMux:        &sync.Mutex{},
+		orderBookBreakers: newOrderBookBreakers(),
+		eventBus:          eventBus,
+	}
 }
 
-// ExchangeOrderResponse represents a send order response of a exchange.
-type exchangeOrderResponse struct {
-	id        ExternalOrderID
-	timestamp time.Time
-	status    OrderStatus
-}
+const (
+	// updateSourceBatchSize is the highest number of updates of an exchange update source processed together.
+	updateSourceBatchSize = 1000
+
+	// outboxBatchSize is the number of outbox messages read on each dispatch.
+	outboxBatchSize = 100
+
+	// outboxLease is how long a claimed outbox message is hidden from other dispatchers.
+	outboxLease = 30 * time.Second
+
+	// outboxMaxAttempts is the number of delivery attempts before denying the order.
+	outboxMaxAttempts = 10
+
+	// outboxBaseBackoff and outboxMaxBackoff limit the wait between delivery attempts.
+	outboxBaseBackoff = time.Second
+	outboxMaxBackoff  = 5 * time.Minute
+
+	// orderBookBatchSize is the highest number of queued updates of an asset forwarded in one request.
+	orderBookBatchSize = 100
+
+	// orderBookLease is how long the queue of an asset is hidden from other forwarders while delivering.
+	orderBookLease = 30 * time.Second
+
+	// orderBookTimeout is the timeout of a request to an order book.
+	// It is lower than orderBookLease, so a batch is not claimed by another forwarder while it is being sent.
+	orderBookTimeout = 10 * time.Second
+
+	// orderBookForwarders is the highest number of order books receiving updates at the same time.
+	orderBookForwarders = 8
+
+	// orderBookBaseBackoff and orderBookMaxBackoff limit the wait between delivery attempts.
+	// The updates are never dropped while the order book is unavailable, so there is no max attempts.
+	orderBookBaseBackoff = time.Second
+	orderBookMaxBackoff  = 5 * time.Minute
+
+	// orderBookBreakerThreshold failures in a row stop the requests to an order book for orderBookBreakerCooldown.
+	orderBookBreakerThreshold = 5
+	orderBookBreakerCooldown  = 30 * time.Second
+
+	// orderBookDeadLettersLimit is the number of dead letters returned.
+	orderBookDeadLettersLimit = 100
+
+	// orderBookSentRetention and orderBookDeadRetention are how long the sent updates and the dead letters
+	// are kept on the order book queue. They are deleted on every orderBookPruneInterval.
+	orderBookSentRetention = 24 * time.Hour
+	orderBookDeadRetention = 30 * 24 * time.Hour
+	orderBookPruneInterval = time.Hour
+
+	// searchDefaultLimit and searchMaxLimit are the page sizes of an order search.
+	searchDefaultLimit = 50
+	searchMaxLimit     = 200
+
+	// clientOrderIDMaxLength is the max length of a client order ID.
+	clientOrderIDMaxLength = 64
+)
 
 // GetOrder returns an order by ID.
 func (uc OrderUseCases) GetOrder(orderID OrderID) (*Order, error) {
@@ -46,8 +130,66 @@ func (uc OrderUseCases) GetOrder(orderID OrderID) (*Order, error) {
 	return entity, err
 }
 
+// GetOrderExecutions returns the executions (fills) of an order, the oldest first.
+// A nil slice will be returned if the order does not exist.
+func (uc OrderUseCases) GetOrderExecutions(orderID OrderID) ([]Execution, error) {
+	if orderID <= 0 {
+		return nil, core.NewErrValidation("Invalid order ID.")
+	}
+	entity, err := uc.db.GetByID(orderID)
+	if err != nil || entity == nil {
+		return nil, err
+	}
+	return uc.db.GetExecutionsByOrderID(orderID)
+}
+
+// SearchOrders returns a page of the orders matching a filter.
+// The NextCursor of the page must be parsed into "filter.After" to get the next page.
+func (uc OrderUseCases) SearchOrders(filter OrderFilter) (*OrderPage, error) {
+	if filter.UserID < 0 {
+		return nil, core.NewErrValidation("Invalid user ID.")
+	}
+	switch filter.Type {
+	case "", OrderTypeBuy, OrderTypeSell:
+	default:
+		return nil, core.NewErrValidation("Invalid type.")
+	}
+	switch filter.Sort {
+	case "":
+		filter.Sort = OrderSortNewest
+	case OrderSortNewest, OrderSortOldest:
+	default:
+		return nil, core.NewErrValidation("Invalid sort.")
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, core.NewErrValidation("Invalid date range.")
+	}
+	if filter.Limit == 0 {
+		filter.Limit = searchDefaultLimit
+	}
+	if filter.Limit < 0 || filter.Limit > searchMaxLimit {
+		return nil, core.NewErrValidation(fmt.Sprintf("Invalid limit (max %d).", searchMaxLimit))
+	}
+
+	// One more order is read to know if there is a next page.
+	limit := filter.Limit
+	filter.Limit++
+	entities, err := uc.db.Search(filter)
+	if err != nil {
+		return nil, err
+	}
+	page := &OrderPage{Orders: entities}
+	if len(entities) > limit {
+		page.Orders = entities[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = OrderCursor{CreatedAt: last.CreatedAt, ID: last.ID}.String()
+	}
+	return page, nil
+}
+
 // BuyOrder adds a buying order.
-func (uc OrderUseCases) BuyOrder(userID users.UserID, assetID assets.AssetID, price money.Money, amount assets.AssetUnit) (*Order, error) {
+// A retried request with the same client order ID (optional) returns the order already placed.
+func (uc OrderUseCases) BuyOrder(userID users.UserID, assetID assets.AssetID, price money.Money, amount assets.AssetUnit, clientOrderID string) (*Order, error) {
 	if userID <= 0 {
 		return nil, core.NewErrValidation("Invalid user ID.")
 	}
@@ -60,55 +202,53 @@ func (uc OrderUseCases) BuyOrder(userID users.UserID, assetID assets.AssetID, pr
 	if amount <= 0 {
 		return nil, core.NewErrValidation("Invalid amount.")
 	}
-
-	wallet, _, _, err := uc.walletUC.GetWallet(userID)
-	if err != nil {
-		return nil, err
-	}
-	if wallet.Balance < money.Money(int64(price)*int64(amount)) {
-		return nil, core.NewErrValidation("No funds.")
+	if len(clientOrderID) > clientOrderIDMaxLength {
+		return nil, core.NewErrValidation("Invalid client order ID.")
 	}
 
 	entity := NewBuyOrder(assetID, amount, price)
 	entity.UserID = userID
-	entity.Status = OrderStatusPending
+	entity.ClientOrderID = clientOrderID
+	original, err := uc.placedOrder(entity)
+	if err != nil || original != nil {
+		return original, err
+	}
 
-	newEntity, err := uc.db.Insert(entity)
+	err = uc.checkMarketRules(assetID, price)
 	if err != nil {
-		switch err {
-		case assets.ErrAssetDoesNotExist:
-			return nil, core.NewErrValidation("Asset does not exist.")
-		case users.ErrUserDoesNotExist:
-			return nil, core.NewErrValidation("User does not exist.")
-		default:
-			return nil, err
-		}
+		return nil, err
 	}
 
-	// TODO: We can do this using a message broker to be asynchronous.
-	// - Send to a topic/queue and leaves the order with "pending" status.
-	// - Retuns this method with the order as "pending".
-	// The Order entity already has a "status" for this:
-	// - "pending" for sent or being send to the exchange
-	// - "accepted" for orders accepted by the exchange
-	// - "denied" for order denied by the exchange
-	// For now we are just mocking the exchange response, so all requests are "accepted".
-	response := uc.sendOrderToExchange(newEntity) // fake call
-
-	// After that we update the order with the ID generate by the exchange (external ID).
-	err = uc.db.UpdateExternalResponse(newEntity.ID, response.id, response.timestamp, response.status)
+	wallet, _, _, err := uc.walletUC.GetWallet(userID)
+	if err != nil {
+		return nil, err
+	}
+	// The funds are held until the order is filled, canceled or denied. The highest fees of the order are held too.
+	// The hold is checked again with the insert, so concurrent orders cannot use the same funds.
+	hold, err := money.Notional(price, amount, money.RoundUp)
 	if err != nil {
-		return newEntity, err
+		return nil, orderValueError(err)
+	}
+	fee, err := uc.feeHold(userID, assetID, hold)
+	if err != nil {
+		return nil, err
+	}
+	hold += fee
+	if wallet.Available < hold {
+		return nil, core.NewErrValidation("No funds.")
 	}
 
-	// Refresh the order because it has a new state.
-	newEntity, err = uc.db.GetByID(newEntity.ID)
+	entity.Status = OrderStatusPending
+	entity.HeldFunds = hold
 
-	return newEntity, err
+	// The order is sent to the exchange by the outbox dispatcher (see DispatchOutbox).
+	// It stays "pending" until the exchange accepts or denies it.
+	return uc.insertOrder(entity)
 }
 
 // SellOrder adds a selling order.
-func (uc OrderUseCases) SellOrder(userID users.UserID, assetID assets.AssetID, price money.Money, amount assets.AssetUnit) (*Order, error) {
+// A retried request with the same client order ID (optional) returns the order already placed.
+func (uc OrderUseCases) SellOrder(userID users.UserID, assetID assets.AssetID, price money.Money, amount assets.AssetUnit, clientOrderID string) (*Order, error) {
 	if userID <= 0 {
 		return nil, core.NewErrValidation("Invalid user ID.")
 	}
@@ -121,54 +261,110 @@ func (uc OrderUseCases) SellOrder(userID users.UserID, assetID assets.AssetID, p
 	if amount <= 0 {
 		return nil, core.NewErrValidation("Invalid amount.")
 	}
+	if len(clientOrderID) > clientOrderIDMaxLength {
+		return nil, core.NewErrValidation("Invalid client order ID.")
+	}
+
+	entity := NewSellOrder(assetID, amount, price)
+	entity.UserID = userID
+	entity.ClientOrderID = clientOrderID
+	original, err := uc.placedOrder(entity)
+	if err != nil || original != nil {
+		return original, err
+	}
+
+	err = uc.checkMarketRules(assetID, price)
+	if err != nil {
+		return nil, err
+	}
 
 	assetWallet, _, _, err := uc.assetWalletUC.GetAssetWallet(userID, assetID)
 	if err != nil {
 		return nil, err
 	}
-	if assetWallet.Balance < amount {
+	// The assets are held until the order is filled, canceled or denied.
+	// The hold is checked again with the insert, so concurrent orders cannot sell the same assets.
+	if assetWallet.Available < amount {
 		return nil, core.NewErrValidation("No assets.")
 	}
 
-	entity := NewSellOrder(assetID, amount, price)
-	entity.UserID = userID
 	entity.Status = OrderStatusPending
+	entity.HeldAssets = amount
+
+	// The order is sent to the exchange by the outbox dispatcher (see DispatchOutbox).
+	// It stays "pending" until the exchange accepts or denies it.
+	return uc.insertOrder(entity)
+}
 
-	newEntity, err := uc.db.Insert(entity)
+// insertOrder saves a new order together with its outbox message.
+func (uc OrderUseCases) insertOrder(entity Order) (*Order, error) {
+	newEntity, err := uc.db.InsertWithOutbox(entity, OutboxActionSubmit)
+	if errors.Is(err, ErrClientOrderIDAlreadyExists) {
+		// A concurrent request with the same client order ID was placed first.
+		return uc.placedOrder(entity)
+	}
 	if err != nil {
-		switch err {
-		case assets.ErrAssetDoesNotExist:
-			return nil, core.NewErrValidation("Asset does not exist.")
-		case users.ErrUserDoesNotExist:
-			return nil, core.NewErrValidation("User does not exist.")
-		default:
-			return nil, err
-		}
+		return nil, insertError(err)
 	}
+	uc.publishOrderSubmitted(*newEntity, OutboxActionSubmit)
+	return newEntity, nil
+}
 
-	// TODO: We can do this using a message broker to be asynchronous.
-	// - Send to a topic/queue and leaves the order with "pending" status.
-	// - Retuns this method with the order as "pending".
-	// The Order entity already has a "status" for this:
-	// - "pending" for sent or being send to the exchange
-	// - "accepted" for orders accepted by the exchange
-	// - "denied" for order denied by the exchange
-	// For now we are just mocking the exchange response, so all requests are "accepted".
-	response := uc.sendOrderToExchange(newEntity) // fake call
-
-	// After that we update the order with the ID generate by the exchange (external ID).
-	err = uc.db.UpdateExternalResponse(newEntity.ID, response.id, response.timestamp, response.status)
-	if err != nil {
-		return newEntity, err
+// insertError translates the errors of an order insert to an ErrValidation.
+func insertError(err error) error {
+	switch {
+	case errors.Is(err, assets.ErrAssetDoesNotExist):
+		return core.NewErrValidation("Asset does not exist.")
+	case errors.Is(err, users.ErrUserDoesNotExist):
+		return core.NewErrValidation("User does not exist.")
+	case errors.Is(err, wallets.ErrInsufficientFunds):
+		return core.NewErrValidation("No funds.")
+	case errors.Is(err, assetwallets.ErrInsufficientAssets):
+		return core.NewErrValidation("No assets.")
 	}
+	return err
+}
 
-	// Refresh the order because it has a new state.
-	newEntity, err = uc.db.GetByID(newEntity.ID)
+// placedOrder returns the order already placed by the user with the client order ID of "entity" (a retried request).
+// A nil entity will be returned if there is no such order.
+// It returns an ErrValidation if the client order ID was used by an order of another asset or type.
+func (uc OrderUseCases) placedOrder(entity Order) (*Order, error) {
+	if entity.ClientOrderID == "" {
+		return nil, nil
+	}
+	original, err := uc.db.GetByUserIDClientOrderID(entity.UserID, entity.ClientOrderID)
+	if err != nil || original == nil {
+		return nil, err
+	}
+	// The price and amount are not compared because the order can be replaced after it was placed.
+	if original.AssetID != entity.AssetID || original.Type != entity.Type {
+		return nil, core.NewErrValidation("Client order ID already used by another order.")
+	}
+	return original, nil
+}
 
-	return newEntity, err
+// checkMarketRules checks if the exchange accepts a new order of an asset at a price.
+// It returns an ErrValidation if the exchange session is closed or the price is outside of the price band.
+func (uc OrderUseCases) checkMarketRules(assetID assets.AssetID, price money.Money) error {
+	asset, err := uc.assetUC.GetAsset(assetID)
+	if err != nil {
+		return err
+	}
+	if asset == nil {
+		return core.NewErrValidation("Asset does not exist.")
+	}
+	// Orders are refused outside of the exchange sessions.
+	err = uc.calendarUC.CheckOrdersAllowed(asset.ExchangeID, time.Now())
+	if err != nil {
+		return err
+	}
+	return uc.priceBandUC.CheckPrice(assetID, price)
 }
 
-// CancelOrder returns an order by ID.
+// CancelOrder requests the cancel of an order by ID.
+// The order changes to "canceling" and the cancel is sent to the exchange later by the outbox dispatcher.
+// It becomes "canceled" when the exchange confirms it, or goes back to its working status if the cancel fails.
+// A nil entity will be returned if the order does not exist.
 func (uc OrderUseCases) CancelOrder(orderID OrderID) (*Order, error) {
 	if orderID <= 0 {
 		return nil, core.NewErrValidation("Invalid order ID.")
@@ -180,135 +376,1439 @@ func (uc OrderUseCases) CancelOrder(orderID OrderID) (*Order, error) {
 	if entity == nil {
 		return nil, nil
 	}
-	// TODO: This not the best approach.
-	// We should have a status group for "orders accepted" and "orders in canceling" processes.
-	// A order should be able to go back to the previous status if the cancel fail for some reasons.
-	// We lost the previous status if we ovewrite the value with "canceling".
-	if entity.Status == OrderStatusAccepted {
-		response := uc.cancelOrderOnExchange(entity.ID)
-		// After that we update the order status.
-		err = uc.db.UpdateStatus(entity.ID, response.status)
+	if entity.Status != OrderStatusWaiting && (entity.Status == OrderStatusCanceling || !CanChangeStatus(entity.Status, OrderStatusCanceling)) {
+		// Only working and waiting orders can be canceled.
+		return entity, nil
+	}
+	entity, err = uc.requestCancel(*entity, OrderStatusSourceUser, "Cancel requested.")
+	if errors.Is(err, ErrInvalidStatusTransition) {
+		// The order changed in the meantime (ex: filled).
+		return nil, core.NewErrValidation("The order cannot be canceled.")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if entity != nil && entity.Status == OrderStatusCanceled {
+		uc.syncOrderGroup(entity.GroupID)
+	}
+	return entity, nil
+}
+
+// requestCancel cancels an order (see CancelOrder).
+// A waiting order is not on the exchange, so it is canceled right away.
+// The following errors can happen: ErrInvalidStatusTransition.
+func (uc OrderUseCases) requestCancel(entity Order, source OrderStatusSource, reason string) (*Order, error) {
+	if entity.Status == OrderStatusWaiting {
+		change := NewOrderStatusChange(entity.ID, OrderStatusCanceled, source, reason)
+		change.FromStatus = OrderStatusWaiting
+		_, err := uc.db.ChangeStatus(change)
+		if err != nil {
+			return nil, err
+		}
+		err = uc.db.ReleaseHolds(entity.ID)
 		if err != nil {
-			return entity, err
+			return nil, err
 		}
+		// Refresh the order because the holds were released.
+		return uc.db.GetByID(entity.ID)
+	}
 
-		// Refresh the order because it has a new state.
-		entity, err = uc.db.GetByID(entity.ID)
+	// The previous status stays on the status history, so the order goes back to it if the cancel fails.
+	change := NewOrderStatusChange(entity.ID, OrderStatusCanceling, source, reason)
+	change.FromStatus = entity.Status
+	updated, err := uc.db.ChangeStatusWithOutbox(change, OutboxActionCancel)
+	if err != nil {
+		return nil, err
 	}
-	return entity, err
+	uc.publishOrderSubmitted(*updated, OutboxActionCancel)
+	return updated, nil
 }
 
-// ProcessExternalUpdate process an order update received from an exchange service.
-// These updates change the state of an Order Book.
-func (uc OrderUseCases) ProcessExternalUpdate(externalUp ExternalUpdate) error {
-	entity, err := uc.db.GetByExternalIDAssetID(externalUp.ID, externalUp.AssetID)
-	if err != nil {
-		log.Printf("erro while trying to get ther order from db: %v\n", err)
+// CancelOrders requests the cancel of every pending, working or waiting order matching the user ID, asset ID
+// and/or type of a filter (the other fields are ignored). At least one of them is required.
+// Each order is canceled by CancelOrder, so a failure does not stop the others.
+func (uc OrderUseCases) CancelOrders(filter OrderFilter) (*MassCancelResult, error) {
+	if filter.UserID == 0 && filter.AssetID == "" && filter.Type == "" {
+		return nil, core.NewErrValidation("A user ID, asset ID or type is required.")
 	}
-	if entity != nil {
-		externalUp.Mine = true
+	result := &MassCancelResult{Sent: []OrderID{}, Failed: []MassCancelFailure{}}
+	for _, status := range []OrderStatus{OrderStatusPending, OrderStatusAccepted, OrderStatusPartiallyFilled, OrderStatusWaiting} {
+		search := OrderFilter{
+			UserID:  filter.UserID,
+			AssetID: filter.AssetID,
+			Type:    filter.Type,
+			Status:  status,
+			Sort:    OrderSortOldest,
+			Limit:   searchMaxLimit,
+		}
+		for {
+			page, err := uc.SearchOrders(search)
+			if err != nil {
+				return nil, err
+			}
+			for _, order := range page.Orders {
+				entity, err := uc.CancelOrder(order.ID)
+				switch {
+				case err != nil:
+					result.Failed = append(result.Failed, MassCancelFailure{OrderID: order.ID, Error: err.Error()})
+				case entity == nil || (entity.Status != OrderStatusCanceling && entity.Status != OrderStatusCanceled):
+					// The order changed in the meantime (ex: filled).
+					result.Failed = append(result.Failed, MassCancelFailure{OrderID: order.ID, Error: "The order cannot be canceled."})
+				default:
+					result.Sent = append(result.Sent, order.ID)
+				}
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			last := page.Orders[len(page.Orders)-1]
+			search.After = OrderCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		}
 	}
+	return result, nil
+}
 
-	err = uc.updateOrderBook(externalUp)
+// confirmCancel changes a "canceling" order to "canceled" and releases its holds.
+// Nothing changes if the order is not "canceling" anymore (ex: filled before the cancel).
+func (uc OrderUseCases) confirmCancel(orderID OrderID, reason string) error {
+	change := NewOrderStatusChange(orderID, OrderStatusCanceled, OrderStatusSourceExchange, reason)
+	change.FromStatus = OrderStatusCanceling
+	entity, err := uc.db.ChangeStatus(change)
+	if errors.Is(err, ErrInvalidStatusTransition) {
+		log.Printf("cancel of the order %v ignored: %v\n", orderID, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = uc.db.ReleaseHolds(orderID)
 	if err != nil {
-		log.Printf("error to update order book: %v\n", err)
+		return err
 	}
-	if externalUp.Action == ExternalUpdateActionTraded {
-		err = uc.processExternalUpdateTraded(entity, externalUp)
+	uc.syncOrderGroup(entity.GroupID)
+	return nil
+}
+
+// rejectCancel returns a "canceling" order to its working status (see RestoredStatus).
+// Nothing changes if the order is not "canceling" anymore (ex: filled before the cancel).
+func (uc OrderUseCases) rejectCancel(orderID OrderID, cause error) error {
+	restore := NewOrderStatusChange(orderID, "", OrderStatusSourceExchange, fmt.Sprintf("Cancel failed: %v", cause))
+	restore.FromStatus = OrderStatusCanceling
+	_, err := uc.db.RestoreStatus(restore)
+	if errors.Is(err, ErrInvalidStatusTransition) {
+		log.Printf("cancel rejection of the order %v ignored: %v\n", orderID, err)
+		return nil
 	}
 	return err
 }
 
-func (uc OrderUseCases) updateOrderBook(externalUp ExternalUpdate) error {
-	url := fmt.Sprintf("%s/api/v1/orderbooks/%s/webhook", uc.orderBookHost, externalUp.AssetID)
-	log.Printf("sending to order book on %s...\n", url)
-	json, err := json.Marshal(externalUp)
-	resp, err := http.Post(url, "application/json; charset=utf-8", bytes.NewBuffer(json))
+// ReplaceOrder requests the change of the price and amount of a working order (cancel/replace).
+// The amount is the new total amount of the order, so it must be greater than the filled amount.
+// The holds of the new terms are taken together with an outbox message, and the replace is sent to the exchange
+// later by the outbox dispatcher. The order gets the new terms when the exchange confirms the replace,
+// and it keeps its old terms and holds if the exchange rejects it.
+// A nil entity will be returned if the order does not exist.
+func (uc OrderUseCases) ReplaceOrder(orderID OrderID, price money.Money, amount assets.AssetUnit) (*Order, error) {
+	if orderID <= 0 {
+		return nil, core.NewErrValidation("Invalid order ID.")
+	}
+	if price <= 0 {
+		return nil, core.NewErrValidation("Invalid price.")
+	}
+	if amount <= 0 {
+		return nil, core.NewErrValidation("Invalid amount.")
+	}
+	entity, err := uc.db.GetByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return nil, nil
+	}
+	if entity.Status != OrderStatusAccepted && entity.Status != OrderStatusPartiallyFilled {
+		// Only working orders can be replaced.
+		return nil, core.NewErrValidation("The order cannot be replaced.")
+	}
+	if entity.GroupID != 0 {
+		// The legs of a group share their holds.
+		return nil, core.NewErrValidation("The orders of a group cannot be replaced.")
+	}
+	if !entity.CanReplace(amount) {
+		return nil, core.NewErrValidation("The amount must be greater than the filled amount.")
+	}
+	if price == entity.Price && amount == entity.Amount {
+		return entity, nil
+	}
+	err = uc.checkMarketRules(entity.AssetID, price)
+	if err != nil {
+		return nil, err
+	}
+
+	// While the exchange does not answer, the order holds enough for the old and the new terms.
+	replaced := *entity
+	replaced.Price = price
+	replaced.Amount = amount
+	funds, assetsHold, err := replaced.RequiredHolds()
+	if err != nil {
+		return nil, orderValueError(err)
+	}
+	fee, err := uc.feeHold(entity.UserID, entity.AssetID, funds)
+	if err != nil {
+		return nil, err
+	}
+	funds += fee
+	if funds < entity.HeldFunds {
+		funds = entity.HeldFunds
+	}
+	if assetsHold < entity.HeldAssets {
+		assetsHold = entity.HeldAssets
+	}
+	message := NewOutboxMessage(entity.ID, OutboxActionReplace)
+	message.Price = price
+	message.Amount = amount
+	updated, err := uc.db.RequestReplace(message, funds, assetsHold)
+	switch {
+	case errors.Is(err, wallets.ErrInsufficientFunds):
+		return nil, core.NewErrValidation("No funds.")
+	case errors.Is(err, assetwallets.ErrInsufficientAssets):
+		return nil, core.NewErrValidation("No assets.")
+	case errors.Is(err, ErrInvalidStatusTransition):
+		// The order changed in the meantime (ex: filled).
+		return nil, core.NewErrValidation("The order cannot be replaced.")
+	case errors.Is(err, ErrOutboxMessagePending):
+		return nil, core.NewErrValidation("The order has a request not sent to the exchange yet.")
+	case err != nil:
+		return nil, err
+	}
+	uc.publishOrderSubmitted(*updated, OutboxActionReplace)
+	return updated, nil
+}
+
+// restoreHolds sets the holds of an order back to its current terms (see Order.RequiredHolds).
+func (uc OrderUseCases) restoreHolds(orderID OrderID) error {
+	entity, err := uc.db.GetByID(orderID)
+	if err != nil || entity == nil {
+		return err
+	}
+	funds, assetsHold, err := entity.RequiredHolds()
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	bodyBytes, _ := ioutil.ReadAll(resp.Body)
-	bodyString := string(bodyBytes)
-	log.Printf("response: %s\n", bodyString)
-	return nil
+	fee, err := uc.feeHold(entity.UserID, entity.AssetID, funds)
+	if err != nil {
+		return err
+	}
+	return uc.db.AdjustHolds(orderID, funds+fee, assetsHold)
 }
 
-func (uc OrderUseCases) processExternalUpdateTraded(order *Order, externalUp ExternalUpdate) error {
-	if order == nil {
-		// The user and/or asset is not from this home broker.
-		return nil
+// orderValueError returns a validation error if the value of an order does not fit in Money (see money.Notional).
+func orderValueError(err error) error {
+	if errors.Is(err, money.ErrOverflow) {
+		return core.NewErrValidation("Order value is too large.")
+	}
+	return err
+}
+
+// feeHold returns the fees held with the funds of a buying order (see fees.FeeUseCases.MaxFee).
+func (uc OrderUseCases) feeHold(userID users.UserID, assetID assets.AssetID, funds money.Money) (money.Money, error) {
+	if funds <= 0 {
+		return 0, nil
+	}
+	return uc.feeUC.MaxFee(userID, assetID, funds)
+}
+
+// PlaceOrderGroup places an OCO or bracket group of orders (see OrderGroupType).
+// Only the type, price, amount and stop price of the orders are used.
+// An OCO has 2 orders of the same type and the first one holds the funds/assets for both.
+// A bracket has the entry order first and 1 or 2 exits of the opposite type with the same amount.
+// The orders with a stop price wait until a trade reaches it (see Order.StopTriggered).
+func (uc OrderUseCases) PlaceOrderGroup(userID users.UserID, assetID assets.AssetID, groupType OrderGroupType, legs []Order) (*OrderGroup, error) {
+	if userID <= 0 {
+		return nil, core.NewErrValidation("Invalid user ID.")
+	}
+	if assetID == "" {
+		return nil, core.NewErrValidation("Invalid asset ID.")
+	}
+	switch groupType {
+	case OrderGroupTypeOCO:
+		if len(legs) != 2 {
+			return nil, core.NewErrValidation("An OCO must have 2 orders.")
+		}
+		if legs[0].Type != legs[1].Type {
+			return nil, core.NewErrValidation("The orders of an OCO must have the same type.")
+		}
+	case OrderGroupTypeBracket:
+		if len(legs) < 2 || len(legs) > 3 {
+			return nil, core.NewErrValidation("A bracket must have an entry order and 1 or 2 exit orders.")
+		}
+		for _, exit := range legs[1:] {
+			if exit.Type == legs[0].Type || exit.Amount != legs[0].Amount {
+				return nil, core.NewErrValidation("The exit orders must have the opposite type and the same amount of the entry order.")
+			}
+		}
+	default:
+		return nil, core.NewErrValidation("Invalid group type.")
+	}
+
+	group := OrderGroup{Type: groupType, UserID: userID, AssetID: assetID, Orders: make([]Order, 0, len(legs))}
+	for i, leg := range legs {
+		if leg.Type != OrderTypeBuy && leg.Type != OrderTypeSell {
+			return nil, core.NewErrValidation("Invalid type.")
+		}
+		if leg.Price <= 0 {
+			return nil, core.NewErrValidation("Invalid price.")
+		}
+		if leg.Amount <= 0 {
+			return nil, core.NewErrValidation("Invalid amount.")
+		}
+		if leg.StopPrice < 0 {
+			return nil, core.NewErrValidation("Invalid stop price.")
+		}
+		entity := NewBuyOrder(assetID, leg.Amount, leg.Price)
+		entity.Type = leg.Type
+		entity.UserID = userID
+		entity.StopPrice = leg.StopPrice
+		entity.Status = OrderStatusPending
+		if entity.StopPrice > 0 || (groupType == OrderGroupTypeBracket && i > 0) {
+			entity.Status = OrderStatusWaiting
+		} else {
+			err := uc.checkMarketRules(assetID, entity.Price)
+			if err != nil {
+				return nil, err
+			}
+		}
+		group.Orders = append(group.Orders, entity)
 	}
 
+	// The legs that cancel each other hold only once. The bracket exits hold when the entry is filled.
 	var err error
+	if groupType == OrderGroupTypeOCO {
+		group.Orders[0].HeldFunds, group.Orders[0].HeldAssets, err = MaxRequiredHolds(group.Orders)
+	} else {
+		group.Orders[0].HeldFunds, group.Orders[0].HeldAssets, err = group.Orders[0].RequiredHolds()
+	}
+	if err != nil {
+		return nil, orderValueError(err)
+	}
+	fee, err := uc.feeHold(userID, assetID, group.Orders[0].HeldFunds)
+	if err != nil {
+		return nil, err
+	}
+	group.Orders[0].HeldFunds += fee
 
-	// TODO: This is not the best way.
-	// We should put everything inside a transaction.
-	switch order.Type {
-	case OrderTypeBuy:
-		// On buy, we remove money and add assets.
-		valueMoney := money.Money(math.Abs(float64(int64(externalUp.Amount) * int64(externalUp.Price))))
-		valueMoney *= -1
-		_, err = uc.walletUC.IncBalanceByUserID(order.UserID, valueMoney)
-		if err != nil {
-			return err
+	newGroup, err := uc.db.InsertGroup(group)
+	if err != nil {
+		return nil, insertError(err)
+	}
+	for _, entity := range newGroup.Orders {
+		if entity.Status == OrderStatusPending {
+			uc.publishOrderSubmitted(entity, OutboxActionSubmit)
 		}
-		amountAssets := assets.AssetUnit(math.Abs(float64(externalUp.Amount)))
-		_, err = uc.assetWalletUC.IncBalanceByUserIDAssetID(order.UserID, order.AssetID, amountAssets)
-		if err != nil {
-			return err
+	}
+	return newGroup, nil
+}
+
+// GetOrderGroup returns an order group by ID with its orders.
+func (uc OrderUseCases) GetOrderGroup(groupID OrderGroupID) (*OrderGroup, error) {
+	if groupID <= 0 {
+		return nil, core.NewErrValidation("Invalid group ID.")
+	}
+	return uc.db.GetOrderGroup(groupID)
+}
+
+// syncOrderGroup keeps the orders of a group consistent with each other:
+// an order without trades is canceled when a sibling (OCO) was traded or has ended (ex: canceled),
+// and the bracket exits are canceled when the entry ends without being filled.
+// It can run many times, nothing changes if the group is already consistent.
+// The errors are only logged because the order that changed is already saved.
+func (uc OrderUseCases) syncOrderGroup(groupID OrderGroupID) {
+	if groupID == 0 {
+		return
+	}
+	group, err := uc.db.GetOrderGroup(groupID)
+	if err != nil || group == nil {
+		log.Printf("error to get the order group %v: %v\n", groupID, err)
+		return
+	}
+	ended := make(map[OrderID]bool, len(group.Orders))
+	for _, leg := range group.Orders {
+		ended[leg.ID] = IsFinal(leg.Status)
+	}
+	for _, leg := range group.Orders {
+		if leg.FilledAmount > 0 || ended[leg.ID] || leg.Status == OrderStatusCanceling {
+			continue
 		}
-	case OrderTypeSell:
-		// On sell, we add money and remove assets.
-		valueMoney := money.Money(math.Abs(float64(int64(order.Amount) * int64(order.Price))))
-		_, err = uc.walletUC.IncBalanceByUserID(order.UserID, valueMoney)
+		reason := ""
+		for _, sibling := range group.Siblings(leg) {
+			if sibling.FilledAmount > 0 || ended[sibling.ID] {
+				reason = fmt.Sprintf("Order %d of the group was traded or ended.", sibling.ID)
+				break
+			}
+		}
+		if leg.ParentID != 0 && ended[leg.ParentID] && leg.Status == OrderStatusWaiting {
+			for _, parent := range group.Orders {
+				if parent.ID == leg.ParentID && parent.Status != OrderStatusFilled {
+					reason = fmt.Sprintf("Entry order %d ended without being filled.", parent.ID)
+				}
+			}
+		}
+		if reason == "" || leg.Status == OrderStatusPending {
+			// A pending order is canceled when the exchange answers (see dispatchSubmit).
+			continue
+		}
+		canceled, err := uc.requestCancel(leg, OrderStatusSourceDispatcher, reason)
 		if err != nil {
-			return err
+			log.Printf("error to cancel the order %v of the group %v: %v\n", leg.ID, groupID, err)
+			continue
+		}
+		ended[leg.ID] = canceled != nil && IsFinal(canceled.Status)
+	}
+}
+
+// placeBracketExits places the exits of a filled bracket entry.
+// The first exit holds the funds/assets for all of them (they work as an OCO)
+// and the exits without a stop price are sent to the exchange.
+// The assets bought by the entry can be held before they settle (ex: T+2 exchanges).
+func (uc OrderUseCases) placeBracketExits(entry Order) error {
+	group, err := uc.db.GetOrderGroup(entry.GroupID)
+	if err != nil || group == nil {
+		return err
+	}
+	exits := group.Children(entry)
+	if len(exits) == 0 {
+		return nil
+	}
+	funds, amount, err := MaxRequiredHolds(exits)
+	if err == nil {
+		err = uc.db.AdjustExitHolds(exits[0].ID, funds, amount)
+	}
+	if err != nil {
+		for _, exit := range exits {
+			_, cancelErr := uc.requestCancel(exit, OrderStatusSourceDispatcher, fmt.Sprintf("Exit not placed: %v", err))
+			if cancelErr != nil {
+				log.Printf("error to cancel the order %v: %v\n", exit.ID, cancelErr)
+			}
+		}
+		return err
+	}
+	for _, exit := range exits {
+		if exit.StopPrice > 0 {
+			// It waits for the stop price (see triggerStopOrders).
+			continue
 		}
-		amountAssets := assets.AssetUnit(math.Abs(float64(order.Amount)))
-		amountAssets *= -1
-		_, err = uc.assetWalletUC.IncBalanceByUserIDAssetID(order.UserID, order.AssetID, amountAssets)
+		change := NewOrderStatusChange(exit.ID, OrderStatusPending, OrderStatusSourceDispatcher, "Entry order filled.")
+		change.FromStatus = OrderStatusWaiting
+		updated, err := uc.db.ChangeStatusWithOutbox(change, OutboxActionSubmit)
 		if err != nil {
 			return err
 		}
+		uc.publishOrderSubmitted(*updated, OutboxActionSubmit)
 	}
 	return nil
 }
 
-// sendOrderToExchange sends an order to the exchange.
-//   For now we are just mocking the exchange response, so all requests are "accepted".
-func (uc OrderUseCases) sendOrderToExchange(order *Order) exchangeOrderResponse {
-	/*
-		This part depends of the exchange API (ex B3/Nasdaq).
-		- Connect to the exchange.
-		- Send the order.
-		- Receive the generated exchange order ID (external ID).
-
-		We can use the ExchangeID inside the asset (order.asset.ExchangeID) to choose the correct exchange.
-	*/
-
-	// We are just mocking the response here.
-	return exchangeOrderResponse{
-		id:        ExternalOrderID(fmt.Sprintf("EX-%v", order.ID)), // fake value
-		timestamp: time.Now(),                                      // fake value
-		status:    OrderStatusAccepted,
+// GetOrderStatusHistory returns the status changes of an order, the oldest first.
+// A nil slice will be returned if the order does not exist.
+func (uc OrderUseCases) GetOrderStatusHistory(orderID OrderID) ([]OrderStatusChange, error) {
+	if orderID <= 0 {
+		return nil, core.NewErrValidation("Invalid order ID.")
 	}
+	entity, err := uc.db.GetByID(orderID)
+	if err != nil || entity == nil {
+		return nil, err
+	}
+	return uc.db.GetStatusHistory(orderID)
 }
 
-// cancelOrderOnExchange cancel an order on the exchange.
-//   For now we are just mocking the exchange response, so all requests are "accepted".
-func (uc OrderUseCases) cancelOrderOnExchange(orderID OrderID) exchangeOrderResponse {
-	/*
-		This part depends of the exchange API (ex B3/Nasdaq).
-		- Connect to the exchange.
-		- Cancel the order.
-		- Receive a accepted/denied status.
-	*/
-
-	// We are just mocking the response here.
-	return exchangeOrderResponse{
-		id:        ExternalOrderID(fmt.Sprintf("EX-%v", orderID)), // fake value
-		timestamp: time.Now(),                                     // fake value
-		status:    OrderStatusCanceled,
+// ProcessExternalUpdate process an order update received from an exchange service.
+// These updates change the state of an Order Book.
+func (uc OrderUseCases) ProcessExternalUpdate(externalUp ExternalUpdate) error {
+	return uc.ProcessExternalUpdates([]ExternalUpdate{externalUp})[0]
+}
+
+// ProcessExternalUpdates processes a batch of order updates received from an exchange service, in order.
+// The batch takes the updates lock once, so the updates of concurrent batches are not interleaved,
+// and it is queued to be forwarded to the order books in order (see RunOrderBookForwarder).
+// It returns the error of each update, in the same position of the batch.
+// If the batch can not be queued, no update is processed and all of them return the error
+// (the exchange must send them again, otherwise the order books would miss them).
+func (uc OrderUseCases) ProcessExternalUpdates(updates []ExternalUpdate) []error {
+	uc.updatesMux.Lock()
+	defer uc.updatesMux.Unlock()
+
+	updates = append([]ExternalUpdate{}, updates...)
+	for i := range updates {
+		entity, err := uc.getExternalUpdateOrder(updates[i])
+		if err != nil {
+			log.Printf("erro while trying to get ther order from db: %v\n", err)
+		}
+		if entity != nil {
+			updates[i].Mine = true
+		}
+	}
+
+	errs := make([]error, len(updates))
+	err := uc.enqueueOrderBookUpdates(updates)
+	if err != nil {
+		log.Printf("error to queue the order book updates: %v\n", err)
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	for i, externalUp := range updates {
+		var entity *Order
+		if externalUp.Mine {
+			// The order is read again because a previous update of the batch can change it.
+			entity, err = uc.getExternalUpdateOrder(externalUp)
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+		}
+		errs[i] = uc.processExternalUpdate(entity, externalUp)
+	}
+	return errs
+}
+
+// getExternalUpdateOrder returns the order of an update (nil if it is not from this system).
+// An order sent to the exchange without the external ID yet (ex: a trade received before the submit response)
+// is found by the client order ID of the update, and the external ID is saved.
+func (uc OrderUseCases) getExternalUpdateOrder(externalUp ExternalUpdate) (*Order, error) {
+	entity, err := uc.db.GetByExternalIDAssetID(externalUp.ID, externalUp.AssetID)
+	if err != nil || entity != nil || externalUp.ClientOrderID == "" {
+		return entity, err
+	}
+	id, err := strconv.ParseInt(externalUp.ClientOrderID, 10, 64)
+	if err != nil {
+		// Not an order ID of this system (ex: the ID of a replace request).
+		return nil, nil
+	}
+	entity, err = uc.db.GetByID(OrderID(id))
+	if err != nil || entity == nil {
+		return nil, err
+	}
+	sent := entity.Status == OrderStatusPending || entity.Status == OrderStatusCanceling
+	if !sent || entity.ExternalID != "" || entity.AssetID != externalUp.AssetID || entity.Type != externalUp.Type {
+		return nil, nil
+	}
+	err = uc.db.SetExternalID(entity.ID, externalUp.ID, externalUp.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	entity.ExternalID = externalUp.ID
+	return entity, nil
+}
+
+// processExternalUpdate changes the order of an update (nil if it is not from this system).
+func (uc OrderUseCases) processExternalUpdate(entity *Order, externalUp ExternalUpdate) error {
+	var err error
+	switch externalUp.Action {
+	case ExternalUpdateActionTraded:
+		// The last trade can move the price band of the asset, even when it is not from this system.
+		err = uc.priceBandUC.ProcessTrade(externalUp.AssetID, externalUp.Price)
+		if err != nil {
+			log.Printf("error to update the price band: %v\n", err)
+		}
+		// The last trade can trigger the stop orders too.
+		err = uc.triggerStopOrders(externalUp.AssetID, externalUp.Price)
+		if err != nil {
+			log.Printf("error to trigger the stop orders: %v\n", err)
+		}
+		err = uc.processExternalUpdateTraded(entity, externalUp)
+	case ExternalUpdateActionDeleted:
+		err = uc.processExternalUpdateDeleted(entity)
+	}
+	return err
+}
+
+// RunUpdateSource processes the order updates of an exchange update source until "stop" is closed.
+// The updates already received are processed together, in batches of up to updateSourceBatchSize.
+func (uc OrderUseCases) RunUpdateSource(source ExchangeUpdateSource, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case externalUp := <-source.Updates():
+			updates := []ExternalUpdate{externalUp}
+		drain:
+			for len(updates) < updateSourceBatchSize {
+				select {
+				case externalUp = <-source.Updates():
+					updates = append(updates, externalUp)
+				default:
+					break drain
+				}
+			}
+			for i, err := range uc.ProcessExternalUpdates(updates) {
+				if err != nil {
+					log.Printf("error to process the exchange update %v %v: %v\n", updates[i].Action, updates[i].ID, err)
+				}
+			}
+		}
+	}
+}
+
+// enqueueOrderBookUpdates saves the updates on the order book queue, to be forwarded by RunOrderBookForwarder,
+// and publishes an event of each asset to wake up the forwarders (see TopicOrderBookUpdates).
+func (uc OrderUseCases) enqueueOrderBookUpdates(updates []ExternalUpdate) error {
+	err := uc.db.EnqueueOrderBookUpdates(updates)
+	if err != nil {
+		return err
+	}
+	assetIDs := []assets.AssetID{}
+	counts := map[assets.AssetID]int{}
+	for _, externalUp := range updates {
+		if _, ok := counts[externalUp.AssetID]; !ok {
+			assetIDs = append(assetIDs, externalUp.AssetID)
+		}
+		counts[externalUp.AssetID]++
+	}
+	for _, assetID := range assetIDs {
+		event := OrderBookUpdatesEvent{AssetID: assetID, Count: counts[assetID]}
+		err = uc.eventBus.Publish(TopicOrderBookUpdates, string(assetID), event)
+		if err != nil {
+			// The updates are forwarded on the next run of the forwarder.
+			log.Printf("error to publish the order book updates of %v: %v\n", assetID, err)
+		}
+	}
+	return nil
+}
+
+// ForwardOrderBookQueue forwards the pending updates of the order book queue, up to "limit" per asset.
+// It returns the number of delivered updates. The updates of each asset are delivered in order:
+// a failed delivery is retried later with backoff and the next updates of the asset wait for it.
+// The assets are forwarded concurrently (up to orderBookForwarders), so a slow order book does not delay the other ones.
+func (uc OrderUseCases) ForwardOrderBookQueue(limit int) (int, error) {
+	assetIDs, err := uc.db.GetOrderBookQueueAssets()
+	if err != nil {
+		return 0, err
+	}
+	mu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	slots := make(chan struct{}, orderBookForwarders)
+	sent := 0
+	for _, assetID := range assetIDs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(assetID assets.AssetID) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			n, err := uc.forwardOrderBookAsset(assetID, limit, time.Now())
+			if err != nil {
+				log.Printf("error to forward the updates to the order book of %v: %v\n", assetID, err)
+			}
+			mu.Lock()
+			sent += n
+			mu.Unlock()
+		}(assetID)
+	}
+	wg.Wait()
+	return sent, nil
+}
+
+// RunOrderBookForwarder forwards the order book queue on every interval until "stop" is closed.
+// The new updates are forwarded right away by the consumers of TopicOrderBookUpdates (see SubscribeEvents),
+// so the interval is the wait of the retries. The old messages are deleted on every orderBookPruneInterval.
+func (uc OrderUseCases) RunOrderBookForwarder(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(orderBookPruneInterval)
+	defer pruneTicker.Stop()
+	for {
+		_, err := uc.ForwardOrderBookQueue(orderBookBatchSize)
+		if err != nil {
+			log.Printf("error to read the order book queue: %v\n", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-pruneTicker.C:
+			err = uc.PruneOrderBookQueue(time.Now())
+			if err != nil {
+				log.Printf("error to delete the old messages of the order book queue: %v\n", err)
+			}
+		}
+	}
+}
+
+// PruneOrderBookQueue deletes the updates sent before orderBookSentRetention
+// and the dead letters older than orderBookDeadRetention. The pending updates are kept.
+func (uc OrderUseCases) PruneOrderBookQueue(now time.Time) error {
+	_, err := uc.db.DeleteOrderBookMessages(OrderBookMessageStatusSent, now.Add(-orderBookSentRetention))
+	if err != nil {
+		return err
+	}
+	_, err = uc.db.DeleteOrderBookMessages(OrderBookMessageStatusDead, now.Add(-orderBookDeadRetention))
+	return err
+}
+
+// GetDeadOrderBookMessages returns the updates refused by the order books (dead letters), the newest first.
+// An empty asset ID returns the updates of all the assets.
+func (uc OrderUseCases) GetDeadOrderBookMessages(assetID assets.AssetID) ([]OrderBookMessage, error) {
+	return uc.db.GetDeadOrderBookMessages(assetID, orderBookDeadLettersLimit)
+}
+
+// forwardOrderBookAsset delivers a batch of pending updates of an asset to its order book.
+// It returns the number of delivered updates.
+func (uc OrderUseCases) forwardOrderBookAsset(assetID assets.AssetID, limit int, now time.Time) (int, error) {
+	breaker := uc.orderBookBreakers.get(assetID)
+	if !breaker.Allow(now) {
+		return 0, nil
+	}
+	messages, err := uc.db.ClaimOrderBookBatch(assetID, now, now.Add(orderBookLease), limit)
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+	updates := make([]ExternalUpdate, 0, len(messages))
+	for _, message := range messages {
+		updates = append(updates, message.Update)
+	}
+	results, err := uc.sendOrderBookBatch(assetID, updates)
+	if err != nil && !errors.Is(err, ErrOrderBookRejected) {
+		// The order book is unavailable (or failed): the whole batch is retried, the first message keeps the order.
+		breaker.Failure(time.Now())
+		head := messages[0]
+		head.Attempts++
+		head.LastError = err.Error()
+		head.NextAttemptAt = now.Add(head.Backoff(orderBookBaseBackoff, orderBookMaxBackoff))
+		updateErr := uc.db.UpdateOrderBookMessages([]OrderBookMessage{head})
+		if updateErr != nil {
+			return 0, updateErr
+		}
+		return 0, err
+	}
+	breaker.Success()
+
+	sent := 0
+	for i := range messages {
+		messages[i].Attempts++
+		switch {
+		case err != nil:
+			// The order book refused the whole batch.
+			messages[i].Status = OrderBookMessageStatusDead
+			messages[i].LastError = err.Error()
+		case i < len(results) && !results[i].OK:
+			messages[i].Status = OrderBookMessageStatusDead
+			messages[i].LastError = results[i].Error
+		default:
+			messages[i].Status = OrderBookMessageStatusSent
+			messages[i].LastError = ""
+			sent++
+		}
+	}
+	if sent < len(messages) {
+		log.Printf("%d updates refused by the order book of %v\n", len(messages)-sent, assetID)
+	}
+	return sent, uc.db.UpdateOrderBookMessages(messages)
+}
+
+// sendOrderBookBatch posts a batch of updates of an asset to its order book.
+// It returns the result of each update (see orderbooks.WebhookBatchResponse).
+// The following errors can happen: ErrOrderBookRejected (the batch can not be delivered).
+// Any other error means that the order book is unavailable and the batch must be retried.
+func (uc OrderUseCases) sendOrderBookBatch(assetID assets.AssetID, updates []ExternalUpdate) ([]ExternalUpdateResult, error) {
+	url := fmt.Sprintf("%s/api/v1/orderbooks/%s/webhook/", uc.orderBookHost, assetID)
+	data, err := json.Marshal(updates)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOrderBookRejected, err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	// The order book accepts only the updates signed with the webhook secret.
+	err = uc.orderBookSigner.SignRequest(req, data)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := uc.orderBookClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	bodyBytes, _ := ioutil.ReadAll(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return nil, fmt.Errorf("%w: status %d: %s", ErrOrderBookRejected, resp.StatusCode, bodyBytes)
+	default:
+		// Ex: the order book is restarting (5xx) or the webhook secret is being rotated (401).
+		return nil, fmt.Errorf("order book status %d: %s", resp.StatusCode, bodyBytes)
+	}
+	response := struct {
+		Results []ExternalUpdateResult `json:"results"`
+	}{}
+	err = json.Unmarshal(bodyBytes, &response)
+	if err != nil {
+		return nil, fmt.Errorf("invalid order book response: %v", err)
+	}
+	if len(response.Results) != len(updates) {
+		return nil, fmt.Errorf("invalid order book response: %d results for %d updates", len(response.Results), len(updates))
+	}
+	return response.Results, nil
+}
+
+// orderBookBreakers holds a circuit breaker per order book, so an order book that is down
+// does not delay the updates of the other ones.
+type orderBookBreakers struct {
+	mu       *sync.Mutex
+	breakers map[assets.AssetID]*core.CircuitBreaker
+}
+
+// newOrderBookBreakers creates a new orderBookBreakers.
+func newOrderBookBreakers() *orderBookBreakers {
+	return &orderBookBreakers{mu: &sync.Mutex{}, breakers: map[assets.AssetID]*core.CircuitBreaker{}}
+}
+
+// get returns the circuit breaker of the order book of an asset.
+func (b *orderBookBreakers) get(assetID assets.AssetID) *core.CircuitBreaker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	breaker, ok := b.breakers[assetID]
+	if !ok {
+		breaker = core.NewCircuitBreaker(orderBookBreakerThreshold, orderBookBreakerCooldown)
+		b.breakers[assetID] = breaker
+	}
+	return breaker
+}
+
+func (uc OrderUseCases) processExternalUpdateTraded(order *Order, externalUp ExternalUpdate) error {
+	if order == nil {
+		// The user and/or asset is not from this home broker.
+		return nil
+	}
+	if externalUp.TradeID == "" {
+		// Without the trade ID, two fills of the order could not be told apart from a repeated one.
+		return core.NewErrValidation("Trade ID is required.")
+	}
+
+	// The wallet credited by the trade must exist before the settlement, so it is not created inside its transaction.
+	switch order.Type {
+	case OrderTypeBuy:
+		_, _, _, err := uc.assetWalletUC.GetAssetWallet(order.UserID, order.AssetID)
+		if err != nil {
+			return err
+		}
+	case OrderTypeSell:
+		_, _, _, err := uc.walletUC.GetWallet(order.UserID)
+		if err != nil {
+			return err
+		}
+	}
+
+	execution := NewExecution(order.ID, externalUp)
+	trade, err := tradeFeeData(order.Type, externalUp)
+	if err != nil {
+		return err
+	}
+	fee, err := uc.feeUC.TradeFee(order.UserID, order.AssetID, trade)
+	if err != nil {
+		return err
+	}
+	if order.Type == OrderTypeSell && fee > trade.Value {
+		// The fee of a sell is taken from the trade value, so the credit is never negative.
+		fee = trade.Value
+	}
+	execution.Fee = fee
+
+	// The execution, the holds and the wallets change in the same transaction.
+	// The execution is unique by trade ID, so a repeated trade is rolled back and never settled twice.
+	var updated *Order
+	err = uc.uow.Do(func(tx core.Tx) error {
+		var err error
+		updated, execution, err = uc.settleTrade(tx, *order, execution)
+		return err
+	})
+	if errors.Is(err, ErrExecutionAlreadyExists) {
+		log.Printf("trade %v of the order %v already processed\n", externalUp.TradeID, order.ID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	uc.publishOrderTrade(*updated, execution)
+
+	if order.GroupID != 0 {
+		if updated.Status == OrderStatusFilled && updated.FilledAmount-externalUp.Amount < updated.Amount {
+			// This trade filled the order, so its bracket exits are placed (only once).
+			err = uc.placeBracketExits(*updated)
+			if err != nil {
+				log.Printf("error to place the bracket exits of the order %v: %v\n", updated.ID, err)
+			}
+		}
+		uc.syncOrderGroup(order.GroupID)
+	}
+	return nil
+}
+
+// tradeValue returns the value of a trade of an order (see money.Notional).
+// It is rounded up on a buy (debited) and down on a sell (credited), so the rounding never favors the user.
+// The following errors can happen: money.ErrOverflow.
+func tradeValue(orderType OrderType, price money.Money, amount assets.AssetUnit) (money.Money, error) {
+	if amount < 0 {
+		amount = -amount
+	}
+	if orderType == OrderTypeBuy {
+		return money.Notional(price, amount, money.RoundUp)
+	}
+	return money.Notional(price, amount, money.RoundDown)
+}
+
+// tradeFeeData returns the data of a trade of an order used to compute its fees.
+// The following errors can happen: money.ErrOverflow.
+func tradeFeeData(orderType OrderType, externalUp ExternalUpdate) (fees.Trade, error) {
+	value, err := tradeValue(orderType, externalUp.Price, externalUp.Amount)
+	if err != nil {
+		return fees.Trade{}, err
+	}
+	trade := fees.Trade{
+		Value: value,
+		Maker: externalUp.Liquidity == LiquidityMaker,
+	}
+	if externalUp.ExchangeFee != nil {
+		trade.ExchangeFee = *externalUp.ExchangeFee
+		trade.ExchangeFeeReported = true
+	}
+	return trade, nil
+}
+
+// settleTrade records the execution of a trade and moves the funds and assets of the order user, inside a transaction.
+// The execution fee is debited from the wallet (a buy pays it from the fee it holds, see Order.HeldFee,
+// and the rest from the available balance).
+// The funds or assets received are pending until the settlement date of the asset exchange
+// (see settlements.SettlementUseCases.ScheduleTrade). The inserted execution is returned with the order.
+// The following errors can happen: ErrExecutionAlreadyExists.
+func (uc OrderUseCases) settleTrade(tx core.Tx, order Order, execution Execution) (*Order, Execution, error) {
+	db := uc.db.WithTx(tx)
+	if order.GroupID != 0 {
+		// The leg that trades takes the holds of the legs that it cancels (OCO), so its fee is charged from them.
+		err := db.MoveGroupHolds(order.ID)
+		if err != nil {
+			return nil, execution, err
+		}
+	}
+	updated, inserted, err := db.AddExecution(execution)
+	if err != nil {
+		return nil, execution, err
+	}
+	execution = *inserted
+
+	valueMoney, err := tradeValue(order.Type, execution.Price, execution.Amount)
+	if err != nil {
+		return nil, execution, err
+	}
+	amountAssets := execution.Amount
+	if amountAssets < 0 {
+		amountAssets = -amountAssets
+	}
+	settlementUC := uc.settlementUC.WithTx(tx)
+	reference := fmt.Sprintf("order %v trade %v", order.ID, execution.TradeID)
+	switch order.Type {
+	case OrderTypeBuy:
+		// On buy, we remove money and add assets.
+		// The funds held for the traded amount (at the order price) and its fee are released,
+		// and the trade cost and fee are debited. A fee beyond the held fee is paid from the available balance.
+		var heldMoney money.Money
+		heldMoney, err = money.Notional(order.Price, amountAssets, money.RoundUp)
+		if err != nil {
+			return nil, execution, err
+		}
+		released := heldMoney + execution.Fee
+		if held := updated.HeldFee(); released > held {
+			released = held
+		}
+		err = db.ConsumeHeldFunds(order.ID, released, valueMoney+execution.Fee)
+		if err != nil {
+			return nil, execution, err
+		}
+		// The assets are pending until the settlement date.
+		_, err = settlementUC.ScheduleTrade(order.UserID, order.AssetID, 0, amountAssets, execution.Timestamp, reference)
+		if err != nil {
+			return nil, execution, err
+		}
+	case OrderTypeSell:
+		// On sell, we add money (less the fee) and remove assets.
+		// The money is pending until the settlement date.
+		// The assets held for the traded amount are released and removed from the balance.
+		_, err = settlementUC.ScheduleTrade(order.UserID, order.AssetID, valueMoney-execution.Fee, 0, execution.Timestamp, reference)
+		if err != nil {
+			return nil, execution, err
+		}
+		err = db.ConsumeHeldAssets(order.ID, amountAssets)
+		if err != nil {
+			return nil, execution, err
+		}
+	}
+
+	if updated.Status == OrderStatusFilled {
+		// The funds held for the fees that were not charged are released.
+		err = db.ReleaseHolds(order.ID)
+		if err != nil {
+			return nil, execution, err
+		}
+	}
+	return updated, execution, nil
+}
+
+// triggerStopOrders sends to the exchange the waiting stop orders of an asset triggered by a trade price.
+// A triggered order refused by the market rules (ex: its price is outside of the price band) is canceled.
+func (uc OrderUseCases) triggerStopOrders(assetID assets.AssetID, price money.Money) error {
+	entities, err := uc.db.GetWaitingStopOrders(assetID)
+	if err != nil {
+		return err
+	}
+	for _, entity := range entities {
+		if !entity.StopTriggered(price) {
+			continue
+		}
+		err = uc.checkMarketRules(entity.AssetID, entity.Price)
+		if _, ok := err.(core.ErrValidation); ok {
+			reason := fmt.Sprintf("Stop price reached (trade at %v), but the order was refused: %v", price, err)
+			canceled, err := uc.requestCancel(entity, OrderStatusSourceDispatcher, reason)
+			if errors.Is(err, ErrInvalidStatusTransition) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if canceled != nil {
+				uc.syncOrderGroup(canceled.GroupID)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		change := NewOrderStatusChange(entity.ID, OrderStatusPending, OrderStatusSourceExchange, fmt.Sprintf("Stop price reached (trade at %v).", price))
+		change.FromStatus = OrderStatusWaiting
+		updated, err := uc.db.ChangeStatusWithOutbox(change, OutboxActionSubmit)
+		if errors.Is(err, ErrInvalidStatusTransition) {
+			// Triggered by another trade or canceled in the meantime.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		uc.publishOrderSubmitted(*updated, OutboxActionSubmit)
+	}
+	return nil
+}
+
+// processExternalUpdateDeleted confirms the cancel of an order removed from the order book.
+func (uc OrderUseCases) processExternalUpdateDeleted(order *Order) error {
+	if order == nil {
+		// The user and/or asset is not from this home broker.
+		return nil
+	}
+	switch order.Status {
+	case OrderStatusCanceling:
+		return uc.confirmCancel(order.ID, "Order deleted from the order book.")
+	case OrderStatusCanceled:
+		// The funds/assets can still be held if the release failed before.
+		return uc.db.ReleaseHolds(order.ID)
+	}
+	return nil
+}
+
+// SubscribeEvents adds the consumers of the order events to the event bus:
+// the dispatchers of the new order messages and the forwarders of the order book updates.
+func (uc OrderUseCases) SubscribeEvents() error {
+	_, err := uc.eventBus.Subscribe(TopicOrderSubmitted, eventGroupDispatcher, uc.handleOrderSubmitted)
+	if err != nil {
+		return err
+	}
+	_, err = uc.eventBus.Subscribe(TopicOrderBookUpdates, eventGroupForwarder, uc.handleOrderBookUpdates)
+	return err
+}
+
+// publishOrderSubmitted publishes an order message queued to the exchange (see TopicOrderSubmitted).
+// A lost event only delays the delivery until the next run of the outbox dispatcher.
+func (uc OrderUseCases) publishOrderSubmitted(order Order, action OutboxAction) {
+	event := OrderSubmittedEvent{OrderID: order.ID, AssetID: order.AssetID, Action: action}
+	err := uc.eventBus.Publish(TopicOrderSubmitted, string(order.AssetID), event)
+	if err != nil {
+		log.Printf("error to publish the %v of the order %v: %v\n", action, order.ID, err)
+	}
+}
+
+// publishOrderTrade publishes a trade of an order after it was settled (see TopicOrderTrades).
+func (uc OrderUseCases) publishOrderTrade(order Order, execution Execution) {
+	event := OrderTradeEvent{
+		OrderID:   order.ID,
+		UserID:    order.UserID,
+		AssetID:   order.AssetID,
+		Type:      order.Type,
+		Status:    order.Status,
+		Execution: execution,
+	}
+	err := uc.eventBus.Publish(TopicOrderTrades, string(order.AssetID), event)
+	if err != nil {
+		log.Printf("error to publish the trade %v of the order %v: %v\n", execution.TradeID, order.ID, err)
+	}
+}
+
+// handleOrderSubmitted delivers the due outbox messages to the exchange (see TopicOrderSubmitted).
+// The messages are read from the outbox, so the dispatchers never deliver a message twice.
+func (uc OrderUseCases) handleOrderSubmitted(event core.Event) error {
+	_, err := uc.DispatchOutbox(outboxBatchSize)
+	return err
+}
+
+// handleOrderBookUpdates forwards the queued updates of an asset to its order book (see TopicOrderBookUpdates).
+// The delivery errors are not returned: the queue retries them by itself without holding the events of the other assets.
+func (uc OrderUseCases) handleOrderBookUpdates(event core.Event) error {
+	payload := OrderBookUpdatesEvent{}
+	err := event.Decode(&payload)
+	if err != nil {
+		log.Printf("invalid order book updates event %v: %v\n", event.ID, err)
+		return nil
+	}
+	for {
+		sent, err := uc.forwardOrderBookAsset(payload.AssetID, orderBookBatchSize, time.Now())
+		if err != nil {
+			log.Printf("error to forward the updates to the order book of %v: %v\n", payload.AssetID, err)
+		}
+		if sent < orderBookBatchSize {
+			return nil
+		}
+	}
+}
+
+// DispatchOutbox delivers up to "limit" due outbox messages to the exchange.
+// It returns the number of delivered messages. Failed deliveries are retried later with backoff.
+func (uc OrderUseCases) DispatchOutbox(limit int) (int, error) {
+	now := time.Now()
+	messages, err := uc.db.GetDueOutboxMessages(now, limit)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, message := range messages {
+		ok, err := uc.dispatchOutboxMessage(message, now)
+		if err != nil {
+			log.Printf("error to dispatch the outbox message %v (order %v): %v\n", message.ID, message.OrderID, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// RunOutboxDispatcher delivers the outbox messages on every interval until "stop" is closed.
+func (uc OrderUseCases) RunOutboxDispatcher(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := uc.DispatchOutbox(outboxBatchSize)
+		if err != nil {
+			log.Printf("error to read the order outbox: %v\n", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchOutboxMessage delivers an outbox message to the exchange.
+// It returns false if the message was not delivered by this call (ex: claimed by another dispatcher).
+func (uc OrderUseCases) dispatchOutboxMessage(message OutboxMessage, now time.Time) (bool, error) {
+	claimed, err := uc.db.ClaimOutboxMessage(message.ID, now, now.Add(outboxLease))
+	if err != nil || !claimed {
+		return false, err
+	}
+	order, err := uc.db.GetByID(message.OrderID)
+	if err != nil {
+		return false, uc.retryOutboxMessage(message, nil, err)
+	}
+	switch message.Action {
+	case OutboxActionCancel:
+		return uc.dispatchCancel(message, order)
+	case OutboxActionReplace:
+		return uc.dispatchReplace(message, order)
+	}
+	return uc.dispatchSubmit(message, order)
+}
+
+// dispatchSubmit sends a new order to the exchange.
+// An order canceled before it was sent is not sent, its cancel is confirmed instead.
+func (uc OrderUseCases) dispatchSubmit(message OutboxMessage, order *Order) (bool, error) {
+	if order != nil && order.Status == OrderStatusCanceling && order.ExternalID == "" {
+		err := uc.confirmCancel(order.ID, "Canceled before it was sent to the exchange.")
+		if err != nil {
+			return false, uc.retryOutboxMessage(message, order, err)
+		}
+		message.Status = OutboxStatusSent
+		return false, uc.db.UpdateOutboxMessage(message)
+	}
+	if order == nil || order.Status != OrderStatusPending {
+		// Already delivered (ex: the dispatcher died before marking the message as sent).
+		if order != nil && order.Status == OrderStatusDenied {
+			// The funds/assets can still be held if the dispatcher died before releasing them.
+			err := uc.db.ReleaseHolds(order.ID)
+			if err != nil {
+				return false, err
+			}
+		}
+		message.Status = OutboxStatusSent
+		return false, uc.db.UpdateOutboxMessage(message)
+	}
+
+	client, err := uc.exchangeClient(order.AssetID)
+	if err == ErrNoExchangeClient {
+		// Retrying does not help, the asset is not traded on a known exchange.
+		return false, uc.failOutboxMessage(message, order, err)
+	}
+	if err != nil {
+		return false, uc.retryOutboxMessage(message, order, err)
+	}
+	response, err := client.SubmitOrder(*order)
+	if err != nil {
+		return false, uc.retryOutboxMessage(message, order, err)
+	}
+	if response.Status != OrderStatusAccepted && response.Status != OrderStatusDenied {
+		// The fills must come from the updates, with their executions and settlements.
+		err = fmt.Errorf("%w: submit answered as %q", ErrInvalidExchangeResponse, response.Status)
+		return false, uc.retryOutboxMessage(message, order, err)
+	}
+	// Only pending orders are updated, so a repeated response is ignored.
+	change := NewOrderStatusChange(order.ID, response.Status, OrderStatusSourceExchange, "Exchange response.")
+	err = uc.db.UpdateExternalResponse(response.ID, response.Timestamp, change)
+	if err != nil {
+		return false, uc.retryOutboxMessage(message, order, err)
+	}
+	if response.Status == OrderStatusDenied {
+		// On error, the holds are released on the next attempt (the order is not pending anymore).
+		err = uc.db.ReleaseHolds(order.ID)
+		if err != nil {
+			return false, uc.retryOutboxMessage(message, order, err)
+		}
+	}
+	// The other legs of the group could change while the order was pending.
+	uc.syncOrderGroup(order.GroupID)
+	return true, uc.sentOutboxMessage(message)
+}
+
+// dispatchCancel sends the cancel of a "canceling" order to the exchange.
+// The order stays "canceling" until the exchange confirms the cancel (on the response or on a "deleted" update).
+func (uc OrderUseCases) dispatchCancel(message OutboxMessage, order *Order) (bool, error) {
+	if order == nil || order.Status != OrderStatusCanceling {
+		// The cancel was already answered or the order was filled before it.
+		if order != nil && order.Status == OrderStatusCanceled {
+			// The funds/assets can still be held if the dispatcher died before releasing them.
+			err := uc.db.ReleaseHolds(order.ID)
+			if err != nil {
+				return false, err
+			}
+		}
+		message.Status = OutboxStatusSent
+		return false, uc.db.UpdateOutboxMessage(message)
+	}
+
+	if order.ExternalID == "" {
+		// The order was canceled while it was sent. The response of the submit gives the external ID
+		// (or cancels the order if it is denied, see UpdateExternalResponse).
+		return false, uc.retryOutboxMessage(message, order, ErrOrderNotSent)
+	}
+	client, err := uc.exchangeClient(order.AssetID)
+	if err == ErrNoExchangeClient {
+		return false, uc.failOutboxMessage(message, order, err)
+	}
+	if err != nil {
+		return false, uc.retryOutboxMessage(message, order, err)
+	}
+	response, err := client.CancelOrder(*order)
+	if errors.Is(err, ErrCancelRejected) {
+		// Retrying does not help (ex: the order was filled).
+		return false, uc.failOutboxMessage(message, order, err)
+	}
+	if err != nil {
+		return false, uc.retryOutboxMessage(message, order, err)
+	}
+	if response.Status == OrderStatusCanceled {
+		err = uc.confirmCancel(order.ID, "Cancel confirmed.")
+		if err != nil {
+			return false, uc.retryOutboxMessage(message, order, err)
+		}
+	}
+	return true, uc.sentOutboxMessage(message)
+}
+
+// dispatchReplace sends the replace of a working order to the exchange (see ReplaceOrder).
+// The order gets the new terms and the external ID of the replacement when the exchange confirms it
+// (the old external ID is kept on the replace).
+func (uc OrderUseCases) dispatchReplace(message OutboxMessage, order *Order) (bool, error) {
+	if message.ExternalID != "" {
+		// The exchange already accepted the replace, only the save failed.
+		return uc.saveReplace(message, order, ExchangeResponse{ID: message.ExternalID, Timestamp: message.ExternalTimestamp})
+	}
+	if order == nil || !order.CanReplace(message.Amount) {
+		// The order changed while the replace was waiting (ex: filled or canceled).
+		return false, uc.failOutboxMessage(message, order, ErrInvalidStatusTransition)
+	}
+	client, err := uc.exchangeClient(order.AssetID)
+	if err == ErrNoExchangeClient {
+		return false, uc.failOutboxMessage(message, order, err)
+	}
+	if err != nil {
+		return false, uc.retryOutboxMessage(message, order, err)
+	}
+	// The fee hold is read before the replace is sent, so it can not stop the save of an accepted replace.
+	feeHold, err := uc.replaceFeeHold(*order, message)
+	if errors.Is(err, money.ErrOverflow) {
+		return false, uc.failOutboxMessage(message, order, err)
+	}
+	if err != nil {
+		return false, uc.retryOutboxMessage(message, order, err)
+	}
+	response, err := client.ReplaceOrder(*order, message.Price, message.Amount)
+	if errors.Is(err, ErrCancelRejected) {
+		return false, uc.failOutboxMessage(message, order, err)
+	}
+	if err != nil {
+		return false, uc.retryOutboxMessage(message, order, err)
+	}
+	if response.ID == "" {
+		// The exchange kept the order ID.
+		response.ID = order.ExternalID
+	}
+	replace := NewOrderReplace(*order, message.Price, message.Amount, response)
+	replace.FeeHold = feeHold
+	_, err = uc.db.Replace(replace)
+	if err != nil {
+		// The replacement is working on the exchange: the response is kept and only the save is retried.
+		message.ExternalID = response.ID
+		message.ExternalTimestamp = response.Timestamp
+		return false, uc.retryReplaceSave(message, err)
+	}
+	return true, uc.sentOutboxMessage(message)
+}
+
+// saveReplace saves a replace accepted by the exchange whose save failed before (see dispatchReplace).
+// The save is retried until it works: the replace is never sent again or failed.
+func (uc OrderUseCases) saveReplace(message OutboxMessage, order *Order, response ExchangeResponse) (bool, error) {
+	if order == nil {
+		return false, uc.retryReplaceSave(message, fmt.Errorf("order %d not found", message.OrderID))
+	}
+	if order.ExternalID == response.ID && order.Price == message.Price && order.Amount == message.Amount {
+		// Already saved (ex: the dispatcher died before marking the message as sent).
+		return false, uc.sentOutboxMessage(message)
+	}
+	feeHold, err := uc.replaceFeeHold(*order, message)
+	if err != nil {
+		return false, uc.retryReplaceSave(message, err)
+	}
+	replace := NewOrderReplace(*order, message.Price, message.Amount, response)
+	replace.FeeHold = feeHold
+	_, err = uc.db.Replace(replace)
+	if err != nil {
+		return false, uc.retryReplaceSave(message, err)
+	}
+	return true, uc.sentOutboxMessage(message)
+}
+
+// replaceFeeHold returns the fees held with the funds of the new terms of a replace (see feeHold).
+// The following errors can happen: money.ErrOverflow.
+func (uc OrderUseCases) replaceFeeHold(order Order, message OutboxMessage) (money.Money, error) {
+	order.Price = message.Price
+	order.Amount = message.Amount
+	funds, _, err := order.RequiredHolds()
+	if err != nil {
+		return 0, err
+	}
+	return uc.feeHold(order.UserID, order.AssetID, funds)
+}
+
+// retryReplaceSave schedules a new save of a replace accepted by the exchange, keeping its response.
+// Unlike retryOutboxMessage, it never fails the message: the old terms can not be restored.
+func (uc OrderUseCases) retryReplaceSave(message OutboxMessage, cause error) error {
+	message.Attempts++
+	message.LastError = cause.Error()
+	message.NextAttemptAt = time.Now().Add(message.Backoff(outboxBaseBackoff, outboxMaxBackoff))
+	err := uc.db.UpdateOutboxMessage(message)
+	if err != nil {
+		return err
+	}
+	return cause
+}
+
+// sentOutboxMessage marks an outbox message as delivered.
+func (uc OrderUseCases) sentOutboxMessage(message OutboxMessage) error {
+	message.Attempts++
+	message.Status = OutboxStatusSent
+	message.LastError = ""
+	return uc.db.UpdateOutboxMessage(message)
+}
+
+// retryOutboxMessage schedules a new attempt of a failed delivery.
+// The message fails when there are no attempts left (see failOutboxMessage).
+func (uc OrderUseCases) retryOutboxMessage(message OutboxMessage, order *Order, cause error) error {
+	message.Attempts++
+	if message.Attempts >= outboxMaxAttempts {
+		message.Attempts--
+		return uc.failOutboxMessage(message, order, cause)
+	}
+	message.LastError = cause.Error()
+	message.NextAttemptAt = time.Now().Add(message.Backoff(outboxBaseBackoff, outboxMaxBackoff))
+	err := uc.db.UpdateOutboxMessage(message)
+	if err != nil {
+		return err
+	}
+	return cause
+}
+
+// failOutboxMessage gives up a delivery.
+// A new order is denied, a canceling order goes back to its working status and
+// a replaced order keeps its old terms and holds.
+func (uc OrderUseCases) failOutboxMessage(message OutboxMessage, order *Order, cause error) error {
+	message.Attempts++
+	message.LastError = cause.Error()
+	message.Status = OutboxStatusFailed
+	if order != nil && message.Action == OutboxActionCancel {
+		err := uc.rejectCancel(order.ID, cause)
+		if err != nil {
+			return err
+		}
+	} else if order != nil && message.Action == OutboxActionReplace {
+		err := uc.restoreHolds(order.ID)
+		if err != nil {
+			return err
+		}
+	} else if order != nil {
+		change := NewOrderStatusChange(order.ID, OrderStatusDenied, OrderStatusSourceDispatcher, cause.Error())
+		err := uc.db.UpdateExternalResponse(order.ExternalID, time.Now(), change)
+		if err != nil {
+			return err
+		}
+		err = uc.db.ReleaseHolds(order.ID)
+		if err != nil {
+			return err
+		}
+		uc.syncOrderGroup(order.GroupID)
+	}
+	err := uc.db.UpdateOutboxMessage(message)
+	if err != nil {
+		return err
+	}
+	return cause
+}
+
+// exchangeClient returns the exchange client of the asset exchange.
+// The following errors can happen: ErrNoExchangeClient.
+func (uc OrderUseCases) exchangeClient(assetID assets.AssetID) (ExchangeClient, error) {
+	asset, err := uc.assetUC.GetAsset(assetID)
+	if err != nil {
+		return nil, err
+	}
+	if asset == nil {
+		return nil, ErrNoExchangeClient
 	}
+	return uc.exchangeClients.Get(asset.ExchangeID)
 }
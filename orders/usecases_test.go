@@ -0,0 +1,1132 @@
+package orders_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"home-broker/assets"
+	"home-broker/assetwallets"
+	"home-broker/calendars"
+	"home-broker/core"
+	"home-broker/fees"
+	"home-broker/money"
+	"home-broker/orders"
+	"home-broker/pricebands"
+	"home-broker/settlements"
+	assetsmocks "home-broker/tests/assets/mocks"
+	assetwalletsmocks "home-broker/tests/assetwallets/mocks"
+	feesmocks "home-broker/tests/fees/mocks"
+	orderstests "home-broker/tests/orders"
+	"home-broker/tests/orders/mocks"
+	pricebandsmocks "home-broker/tests/pricebands/mocks"
+	settlementsmocks "home-broker/tests/settlements/mocks"
+	"home-broker/users"
+	"home-broker/wallets"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+// unitOfWork runs the functions without a transaction (the mocked DBs ignore it).
+type unitOfWork struct{}
+
+func (unitOfWork) Do(fn func(tx core.Tx) error) error {
+	return fn(nil)
+}
+
+// newOrderUseCases returns order use cases with a DB. The other dependencies are empty.
+func newOrderUseCases(db orders.OrderDBInterface) orders.OrderUseCases {
+	return orders.NewOrderUseCases(db, nil, wallets.WalletUseCases{}, assetwallets.AssetWalletUseCases{}, assets.AssetUseCases{},
+		pricebands.PriceBandUseCases{}, fees.FeeUseCases{}, settlements.SettlementUseCases{}, calendars.CalendarUseCases{},
+		orders.ExchangeClients{}, "", core.NewWebhookSigner("secret"), core.NewMemoryEventBus(time.Second))
+}
+
+// newMarketUseCases returns order use cases with a DB and an exchange client for the PETR4 asset (exchange B3).
+// The asset has the price band "band" (nil for none).
+func newMarketUseCases(mockCtrl *gomock.Controller, db orders.OrderDBInterface, client orders.ExchangeClient, band *pricebands.PriceBand) orders.OrderUseCases {
+	assetDB := assetsmocks.NewMockAssetDBInterface(mockCtrl)
+	asset := assets.NewAsset("PETR4", "B3")
+	assetDB.EXPECT().GetByID(asset.ID).Return(&asset, nil).AnyTimes()
+	priceBandDB := pricebandsmocks.NewMockPriceBandDBInterface(mockCtrl)
+	priceBandDB.EXPECT().GetByAssetID(asset.ID).Return(band, nil).AnyTimes()
+	return orders.NewOrderUseCases(db, nil, wallets.WalletUseCases{}, assetwallets.AssetWalletUseCases{}, assets.NewAssetUseCases(assetDB),
+		pricebands.NewPriceBandUseCases(priceBandDB), fees.FeeUseCases{}, settlements.SettlementUseCases{}, calendars.CalendarUseCases{},
+		orders.ExchangeClients{"B3": client}, "", core.NewWebhookSigner("secret"), core.NewMemoryEventBus(time.Second))
+}
+
+// newTradeUseCases returns order use cases that settle the trades of the PETR4 asset (exchange B3)
+// with the fee components of all the users. The inserted settlements are added to "inserted" (optional).
+func newTradeUseCases(mockCtrl *gomock.Controller, db orders.OrderDBInterface, calendarUC calendars.CalendarUseCases, feeComponents []fees.FeeComponent, inserted *[]settlements.Settlement) orders.OrderUseCases {
+	asset := assets.NewAsset("PETR4", "B3")
+	assetDB := assetsmocks.NewMockAssetDBInterface(mockCtrl)
+	assetDB.EXPECT().GetByID(asset.ID).Return(&asset, nil).AnyTimes()
+	assetUC := assets.NewAssetUseCases(assetDB)
+	priceBandDB := pricebandsmocks.NewMockPriceBandDBInterface(mockCtrl)
+	priceBandDB.EXPECT().GetByAssetID(asset.ID).Return(nil, nil).AnyTimes()
+	assetWalletDB := assetwalletsmocks.NewMockAssetWalletDBInterface(mockCtrl)
+	assetWalletDB.EXPECT().GetByUserIDAssetID(gomock.Any(), asset.ID).Return(&assetwallets.AssetWallet{UserID: 999, AssetID: asset.ID}, nil).AnyTimes()
+	feeDB := feesmocks.NewMockFeeDBInterface(mockCtrl)
+	feeDB.EXPECT().GetUserTier(gomock.Any()).Return(fees.TierDefault, nil).AnyTimes()
+	feeDB.EXPECT().
+		GetSchedules(asset.ID, fees.TierDefault).
+		Return([]fees.FeeSchedule{fees.NewFeeSchedule("", "", feeComponents)}, nil).
+		AnyTimes()
+	settlementDB := settlementsmocks.NewMockSettlementDBInterface(mockCtrl)
+	settlementDB.EXPECT().WithTx(gomock.Any()).Return(settlementDB).AnyTimes()
+	settlementDB.EXPECT().
+		Insert(gomock.Any()).
+		DoAndReturn(func(entity settlements.Settlement) (*settlements.Settlement, error) {
+			if inserted != nil {
+				*inserted = append(*inserted, entity)
+			}
+			return &entity, nil
+		}).
+		AnyTimes()
+	return orders.NewOrderUseCases(db, unitOfWork{}, wallets.WalletUseCases{}, assetwallets.NewAssetWalletUseCases(assetWalletDB, users.UserUseCases{}),
+		assetUC, pricebands.NewPriceBandUseCases(priceBandDB), fees.NewFeeUseCases(feeDB, assetUC, users.UserUseCases{}),
+		settlements.NewSettlementUseCases(settlementDB, assetUC, calendarUC), calendarUC,
+		orders.ExchangeClients{}, "", core.NewWebhookSigner("secret"), core.NewMemoryEventBus(time.Second))
+}
+
+// newForwarderUseCases returns order use cases with a DB that forward the order book updates to "orderBookHost".
+func newForwarderUseCases(db orders.OrderDBInterface, orderBookHost string) orders.OrderUseCases {
+	return orders.NewOrderUseCases(db, nil, wallets.WalletUseCases{}, assetwallets.AssetWalletUseCases{}, assets.AssetUseCases{},
+		pricebands.PriceBandUseCases{}, fees.FeeUseCases{}, settlements.SettlementUseCases{}, calendars.CalendarUseCases{},
+		orders.ExchangeClients{}, orderBookHost, core.NewWebhookSigner("secret"), core.NewMemoryEventBus(time.Second))
+}
+
+// newOrderBookServer returns an order book server that answers the batches with "respond".
+// The IDs of the updates received by each asset are added to "received".
+func newOrderBookServer(t *testing.T, received map[assets.AssetID][][]orders.ExternalOrderID, respond func(assetID assets.AssetID, w http.ResponseWriter, updates []orders.ExternalUpdate)) *httptest.Server {
+	mu := &sync.Mutex{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/") // api/v1/orderbooks/ASSET_ID/webhook
+		assetID := assets.AssetID(parts[3])
+		updates := []orders.ExternalUpdate{}
+		err := json.NewDecoder(r.Body).Decode(&updates)
+		if err != nil {
+			t.Error(err)
+		}
+		ids := []orders.ExternalOrderID{}
+		for _, update := range updates {
+			ids = append(ids, update.ID)
+		}
+		mu.Lock()
+		received[assetID] = append(received[assetID], ids)
+		mu.Unlock()
+		respond(assetID, w, updates)
+	}))
+}
+
+// writeOrderBookResults answers a batch with the results of its updates. The updates of "refused" are not OK.
+func writeOrderBookResults(w http.ResponseWriter, updates []orders.ExternalUpdate, refused map[orders.ExternalOrderID]bool) {
+	results := []orders.ExternalUpdateResult{}
+	for i, update := range updates {
+		if refused[update.ID] {
+			results = append(results, orders.NewExternalUpdateResult(i, core.NewErrValidation("Order not found.")))
+			continue
+		}
+		results = append(results, orders.NewExternalUpdateResult(i, nil))
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+}
+
+// getOrderBookMessages returns a pending order book message of each update ID, in order.
+func getOrderBookMessages(assetID assets.AssetID, ids ...orders.ExternalOrderID) []orders.OrderBookMessage {
+	messages := []orders.OrderBookMessage{}
+	for i, id := range ids {
+		message := orders.NewOrderBookMessage(orders.ExternalUpdate{ID: id, AssetID: assetID, Action: orders.ExternalUpdateActionDeleted})
+		message.ID = orders.OrderBookMessageID(i + 1)
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// getSellOrder returns a working sell order (sell orders do not hold fees).
+func getSellOrder(id orders.OrderID) orders.Order {
+	entity := orderstests.GetOrder(id, orders.OrderTypeSell, 10000000, 2000000, orderstests.BaseTime)
+	entity.Status = orders.OrderStatusPartiallyFilled
+	entity.FilledAmount = 500000
+	entity.HeldAssets = 1500000
+	return entity
+}
+
+// mockOrders makes GetByID return the orders of a map, and the cancel status changes update them.
+func mockOrders(mockDB *mocks.MockOrderDBInterface, entities map[orders.OrderID]*orders.Order) {
+	mockDB.EXPECT().
+		GetByID(gomock.Any()).
+		DoAndReturn(func(id orders.OrderID) (*orders.Order, error) {
+			entity := *entities[id]
+			return &entity, nil
+		}).
+		AnyTimes()
+	changeStatus := func(change orders.OrderStatusChange) (*orders.Order, error) {
+		entity := entities[change.OrderID]
+		if change.FromStatus != entity.Status || !orders.CanChangeStatus(entity.Status, change.ToStatus) {
+			return nil, orders.ErrInvalidStatusTransition
+		}
+		entity.Status = change.ToStatus
+		updated := *entity
+		return &updated, nil
+	}
+	mockDB.EXPECT().
+		ChangeStatus(gomock.Any()).
+		DoAndReturn(changeStatus).
+		AnyTimes()
+	mockDB.EXPECT().
+		ChangeStatusWithOutbox(gomock.Any(), orders.OutboxActionCancel).
+		DoAndReturn(func(change orders.OrderStatusChange, action orders.OutboxAction) (*orders.Order, error) {
+			return changeStatus(change)
+		}).
+		AnyTimes()
+	mockDB.EXPECT().
+		ReleaseHolds(gomock.Any()).
+		Return(nil).
+		AnyTimes()
+}
+
+func TestCancelOrders_NoFilter_ErrValidation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	uc := newOrderUseCases(mocks.NewMockOrderDBInterface(mockCtrl))
+
+	_, err := uc.CancelOrders(orders.OrderFilter{Status: orders.OrderStatusAccepted})
+	if _, ok := err.(core.ErrValidation); !ok {
+		t.Errorf("received %v, expected ErrValidation", err)
+	}
+}
+
+func TestCancelOrders_WorkingPendingAndWaitingOrdersCanceled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+	uc := newOrderUseCases(mockDB)
+
+	entities := map[orders.OrderID]*orders.Order{}
+	byStatus := map[orders.OrderStatus][]orders.Order{}
+	add := func(id orders.OrderID, status orders.OrderStatus) {
+		entity := orderstests.GetOrder(id, orders.OrderTypeBuy, 10000000, 1000000, orderstests.BaseTime.Add(time.Duration(id)*time.Second))
+		entity.Status = status
+		entities[id] = &entity
+		byStatus[status] = append(byStatus[status], entity)
+	}
+	// The pending orders fill more than a page.
+	for id := orders.OrderID(1); id <= 201; id++ {
+		add(id, orders.OrderStatusPending)
+	}
+	add(300, orders.OrderStatusAccepted)
+	add(301, orders.OrderStatusPartiallyFilled)
+	add(302, orders.OrderStatusWaiting)
+	add(303, orders.OrderStatusAccepted)
+	mockOrders(mockDB, entities)
+
+	// The order 303 is filled after the search.
+	filled := *entities[303]
+	filled.Status = orders.OrderStatusFilled
+	byStatus[orders.OrderStatusAccepted][1] = filled
+	entities[303] = &filled
+
+	searched := []orders.OrderStatus{}
+	mockDB.EXPECT().
+		Search(gomock.Any()).
+		DoAndReturn(func(filter orders.OrderFilter) ([]orders.Order, error) {
+			if filter.UserID != 999 || filter.AssetID != "VIBR" || filter.Type != orders.OrderTypeBuy || !filter.From.IsZero() {
+				t.Errorf("invalid filter %+v", filter)
+			}
+			if filter.Sort != orders.OrderSortOldest || filter.Limit != 201 {
+				t.Errorf("invalid page %+v", filter)
+			}
+			searched = append(searched, filter.Status)
+			found := []orders.Order{}
+			for _, entity := range byStatus[filter.Status] {
+				if entity.ID > filter.After.ID {
+					found = append(found, entity)
+				}
+			}
+			if len(found) > filter.Limit {
+				found = found[:filter.Limit]
+			}
+			return found, nil
+		}).
+		AnyTimes()
+
+	result, err := uc.CancelOrders(orders.OrderFilter{UserID: 999, AssetID: "VIBR", Type: orders.OrderTypeBuy, From: orderstests.BaseTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedSearches := []orders.OrderStatus{
+		orders.OrderStatusPending, orders.OrderStatusPending, // 2 pages
+		orders.OrderStatusAccepted, orders.OrderStatusPartiallyFilled, orders.OrderStatusWaiting,
+	}
+	if len(searched) != len(expectedSearches) {
+		t.Fatalf("searched statuses are %v, expected %v", searched, expectedSearches)
+	}
+	for i, status := range expectedSearches {
+		if searched[i] != status {
+			t.Errorf("searched statuses are %v, expected %v", searched, expectedSearches)
+			break
+		}
+	}
+	if len(result.Sent) != 204 {
+		t.Errorf("sent count is %d, expected 204", len(result.Sent))
+	}
+	if len(result.Failed) != 1 || result.Failed[0].OrderID != 303 {
+		t.Errorf("failed is %v, expected the order 303", result.Failed)
+	}
+	for id, entity := range entities {
+		switch {
+		case id == 303:
+			if entity.Status != orders.OrderStatusFilled {
+				t.Errorf("order %d is %v, expected %v", id, entity.Status, orders.OrderStatusFilled)
+			}
+		case id == 302:
+			if entity.Status != orders.OrderStatusCanceled {
+				t.Errorf("order %d is %v, expected %v", id, entity.Status, orders.OrderStatusCanceled)
+			}
+		default:
+			if entity.Status != orders.OrderStatusCanceling {
+				t.Errorf("order %d is %v, expected %v", id, entity.Status, orders.OrderStatusCanceling)
+			}
+		}
+	}
+}
+
+func TestDispatchOutbox_PendingOrderCanceled_NotSent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+	uc := newOrderUseCases(mockDB)
+
+	entity := orderstests.GetOrder(1, orders.OrderTypeBuy, 10000000, 1000000, orderstests.BaseTime)
+	entity.ExternalID = ""
+	entity.Status = orders.OrderStatusCanceling
+	mockOrders(mockDB, map[orders.OrderID]*orders.Order{1: &entity})
+
+	submit := orders.NewOutboxMessage(1, orders.OutboxActionSubmit)
+	submit.ID = 10
+	mockDB.EXPECT().GetDueOutboxMessages(gomock.Any(), gomock.Any()).Return([]orders.OutboxMessage{submit}, nil)
+	mockDB.EXPECT().ClaimOutboxMessage(submit.ID, gomock.Any(), gomock.Any()).Return(true, nil)
+	sent := submit
+	sent.Status = orders.OutboxStatusSent
+	mockDB.EXPECT().UpdateOutboxMessage(sent).Return(nil)
+
+	_, err := uc.DispatchOutbox(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entity.Status != orders.OrderStatusCanceled {
+		t.Errorf("status is %v, expected %v", entity.Status, orders.OrderStatusCanceled)
+	}
+}
+
+func TestDispatchOutbox_CancelOfOrderBeingSent_Retried(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+	uc := newOrderUseCases(mockDB)
+
+	entity := orderstests.GetOrder(1, orders.OrderTypeBuy, 10000000, 1000000, orderstests.BaseTime)
+	entity.ExternalID = ""
+	entity.Status = orders.OrderStatusCanceling
+	mockOrders(mockDB, map[orders.OrderID]*orders.Order{1: &entity})
+
+	cancel := orders.NewOutboxMessage(1, orders.OutboxActionCancel)
+	cancel.ID = 11
+	mockDB.EXPECT().GetDueOutboxMessages(gomock.Any(), gomock.Any()).Return([]orders.OutboxMessage{cancel}, nil)
+	mockDB.EXPECT().ClaimOutboxMessage(cancel.ID, gomock.Any(), gomock.Any()).Return(true, nil)
+	mockDB.EXPECT().
+		UpdateOutboxMessage(gomock.Any()).
+		DoAndReturn(func(message orders.OutboxMessage) error {
+			if message.Status != orders.OutboxStatusPending || message.Attempts != 1 || message.LastError != orders.ErrOrderNotSent.Error() {
+				t.Errorf("invalid retry %+v", message)
+			}
+			return nil
+		})
+
+	uc.DispatchOutbox(10)
+	if entity.Status != orders.OrderStatusCanceling {
+		t.Errorf("status is %v, expected %v", entity.Status, orders.OrderStatusCanceling)
+	}
+}
+
+func TestDispatchOutbox_SubmitAnsweredFilled_Retried(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+	client := mocks.NewMockExchangeClient(mockCtrl)
+	uc := newMarketUseCases(mockCtrl, mockDB, client, nil)
+
+	// The order is not marked as filled by the response (there are no executions yet).
+	entity := orderstests.GetOrder(1, orders.OrderTypeBuy, 10000000, 1000000, orderstests.BaseTime)
+	entity.ExternalID = ""
+	entity.Status = orders.OrderStatusPending
+	mockOrders(mockDB, map[orders.OrderID]*orders.Order{1: &entity})
+
+	submit := orders.NewOutboxMessage(1, orders.OutboxActionSubmit)
+	submit.ID = 10
+	mockDB.EXPECT().GetDueOutboxMessages(gomock.Any(), gomock.Any()).Return([]orders.OutboxMessage{submit}, nil)
+	mockDB.EXPECT().ClaimOutboxMessage(submit.ID, gomock.Any(), gomock.Any()).Return(true, nil)
+	client.EXPECT().
+		SubmitOrder(gomock.Any()).
+		Return(orders.ExchangeResponse{ID: "SIM-1", Timestamp: orderstests.BaseTime, Status: orders.OrderStatusFilled}, nil)
+	mockDB.EXPECT().
+		UpdateOutboxMessage(gomock.Any()).
+		DoAndReturn(func(message orders.OutboxMessage) error {
+			if message.Status != orders.OutboxStatusPending || message.Attempts != 1 ||
+				!strings.HasPrefix(message.LastError, orders.ErrInvalidExchangeResponse.Error()) {
+				t.Errorf("invalid retry %+v", message)
+			}
+			return nil
+		})
+
+	sent, err := uc.DispatchOutbox(10)
+	if err != nil || sent != 0 {
+		t.Fatalf("received %v/%v, expected 0/nil", sent, err)
+	}
+	if entity.Status != orders.OrderStatusPending {
+		t.Errorf("status is %v, expected %v", entity.Status, orders.OrderStatusPending)
+	}
+}
+
+func TestReplaceOrder_RequestQueued(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+	// The replace is not sent to the exchange by the request.
+	uc := newMarketUseCases(mockCtrl, mockDB, mocks.NewMockExchangeClient(mockCtrl), nil)
+
+	entity := getSellOrder(1)
+	mockDB.EXPECT().GetByID(entity.ID).Return(&entity, nil)
+	message := orders.NewOutboxMessage(entity.ID, orders.OutboxActionReplace)
+	message.Price = 11000000
+	message.Amount = 3000000
+	updated := entity
+	updated.HeldAssets = 2500000
+	// The order holds the assets of the new terms.
+	mockDB.EXPECT().RequestReplace(message, money.Money(0), assets.AssetUnit(2500000)).Return(&updated, nil)
+
+	result, err := uc.ReplaceOrder(entity.ID, 11000000, 3000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The order keeps its terms until the exchange confirms the replace.
+	if result.Price != entity.Price || result.Amount != entity.Amount || result.HeldAssets != 2500000 {
+		t.Errorf("invalid order %+v", result)
+	}
+}
+
+func TestReplaceOrder_Invalid_ErrValidation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+	uc := newMarketUseCases(mockCtrl, mockDB, mocks.NewMockExchangeClient(mockCtrl), nil)
+
+	filled := getSellOrder(2)
+	filled.Status = orders.OrderStatusFilled
+	grouped := getSellOrder(3)
+	grouped.GroupID = 1
+	entities := map[orders.OrderID]*orders.Order{1: func() *orders.Order { e := getSellOrder(1); return &e }(), 2: &filled, 3: &grouped}
+	mockDB.EXPECT().
+		GetByID(gomock.Any()).
+		DoAndReturn(func(id orders.OrderID) (*orders.Order, error) {
+			entity := *entities[id]
+			return &entity, nil
+		}).
+		AnyTimes()
+
+	tests := []struct {
+		name    string
+		orderID orders.OrderID
+		amount  assets.AssetUnit
+		dbErr   error
+	}{
+		{"not working", 2, 3000000, nil},
+		{"group leg", 3, 3000000, nil},
+		{"amount not greater than the filled amount", 1, 500000, nil},
+		{"changed meanwhile", 1, 3000000, orders.ErrInvalidStatusTransition},
+		{"request pending", 1, 3000000, orders.ErrOutboxMessagePending},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.dbErr != nil {
+				mockDB.EXPECT().RequestReplace(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, test.dbErr)
+			}
+			_, err := uc.ReplaceOrder(test.orderID, 11000000, test.amount)
+			if _, ok := err.(core.ErrValidation); !ok {
+				t.Errorf("received %v, expected ErrValidation", err)
+			}
+		})
+	}
+}
+
+func TestDispatchOutbox_Replace_Confirmed(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+	client := mocks.NewMockExchangeClient(mockCtrl)
+	uc := newMarketUseCases(mockCtrl, mockDB, client, nil)
+
+	entity := getSellOrder(1)
+	mockDB.EXPECT().GetByID(entity.ID).Return(&entity, nil)
+	replace := orders.NewOutboxMessage(entity.ID, orders.OutboxActionReplace)
+	replace.ID = 12
+	replace.Price = 11000000
+	replace.Amount = 3000000
+	mockDB.EXPECT().GetDueOutboxMessages(gomock.Any(), gomock.Any()).Return([]orders.OutboxMessage{replace}, nil)
+	mockDB.EXPECT().ClaimOutboxMessage(replace.ID, gomock.Any(), gomock.Any()).Return(true, nil)
+
+	response := orders.ExchangeResponse{ID: "EXTERNAL-2", Timestamp: orderstests.BaseTime.Add(time.Second), Status: orders.OrderStatusAccepted}
+	client.EXPECT().ReplaceOrder(entity, replace.Price, replace.Amount).Return(response, nil)
+	mockDB.EXPECT().
+		Replace(orders.NewOrderReplace(entity, replace.Price, replace.Amount, response)).
+		DoAndReturn(func(r orders.OrderReplace) (*orders.Order, error) {
+			updated := entity
+			updated.Price = r.Price
+			updated.Amount = r.Amount
+			updated.ExternalID = r.ReplacementExternalID
+			return &updated, nil
+		})
+	sent := replace
+	sent.Attempts = 1
+	sent.Status = orders.OutboxStatusSent
+	mockDB.EXPECT().UpdateOutboxMessage(sent).Return(nil)
+
+	count, err := uc.DispatchOutbox(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("sent count is %d, expected 1", count)
+	}
+}
+
+func TestDispatchOutbox_Replace_SaveFailed_NotSentAgain(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+	client := mocks.NewMockExchangeClient(mockCtrl)
+	uc := newMarketUseCases(mockCtrl, mockDB, client, nil)
+
+	entity := getSellOrder(1)
+	mockDB.EXPECT().GetByID(entity.ID).Return(&entity, nil).AnyTimes()
+	replace := orders.NewOutboxMessage(entity.ID, orders.OutboxActionReplace)
+	replace.ID = 14
+	replace.Price = 11000000
+	replace.Amount = 3000000
+	mockDB.EXPECT().ClaimOutboxMessage(replace.ID, gomock.Any(), gomock.Any()).Return(true, nil).AnyTimes()
+
+	// The replace is sent once. The save is retried with the response, even after the max attempts (the holds are kept).
+	response := orders.ExchangeResponse{ID: "EXTERNAL-2", Timestamp: orderstests.BaseTime.Add(time.Second), Status: orders.OrderStatusAccepted}
+	client.EXPECT().ReplaceOrder(entity, replace.Price, replace.Amount).Return(response, nil).Times(1)
+	saved := orders.NewOrderReplace(entity, replace.Price, replace.Amount, response)
+	saveErr := errors.New("connection reset")
+	gomock.InOrder(
+		mockDB.EXPECT().Replace(saved).Return(nil, saveErr),
+		mockDB.EXPECT().Replace(saved).Return(nil, saveErr),
+		mockDB.EXPECT().Replace(saved).Return(&entity, nil),
+	)
+	mockDB.EXPECT().
+		UpdateOutboxMessage(gomock.Any()).
+		DoAndReturn(func(message orders.OutboxMessage) error {
+			if message.Status == orders.OutboxStatusFailed || message.ExternalID != response.ID || !message.ExternalTimestamp.Equal(response.Timestamp) {
+				t.Errorf("invalid message %+v", message)
+			}
+			replace = message
+			return nil
+		}).
+		Times(3)
+
+	for i := 0; i < 2; i++ {
+		mockDB.EXPECT().GetDueOutboxMessages(gomock.Any(), gomock.Any()).Return([]orders.OutboxMessage{replace}, nil)
+		count, _ := uc.DispatchOutbox(10)
+		if count != 0 || replace.Status != orders.OutboxStatusPending {
+			t.Fatalf("attempt %d: sent count is %d and message is %v, expected 0 and pending", i, count, replace.Status)
+		}
+		replace.Attempts = 9 // The next attempt is the last one of the other messages.
+	}
+	mockDB.EXPECT().GetDueOutboxMessages(gomock.Any(), gomock.Any()).Return([]orders.OutboxMessage{replace}, nil)
+	count, err := uc.DispatchOutbox(10)
+	if err != nil || count != 1 || replace.Status != orders.OutboxStatusSent {
+		t.Errorf("received %v/%v and message %v, expected 1/nil and sent", count, err, replace.Status)
+	}
+}
+
+func TestDispatchOutbox_Replace_Failed_HoldsRestored(t *testing.T) {
+	tests := []struct {
+		name   string
+		status orders.OrderStatus
+		err    error // Exchange error.
+	}{
+		{"rejected by the exchange", orders.OrderStatusPartiallyFilled, orders.ErrCancelRejected},
+		{"order filled meanwhile", orders.OrderStatusFilled, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+			client := mocks.NewMockExchangeClient(mockCtrl)
+			uc := newMarketUseCases(mockCtrl, mockDB, client, nil)
+
+			entity := getSellOrder(1)
+			entity.Status = test.status
+			if test.status == orders.OrderStatusFilled {
+				entity.FilledAmount = entity.Amount
+			}
+			// The order holds the assets of the old and the new terms.
+			entity.HeldAssets = 2500000
+			mockDB.EXPECT().GetByID(entity.ID).Return(&entity, nil).AnyTimes()
+			replace := orders.NewOutboxMessage(entity.ID, orders.OutboxActionReplace)
+			replace.ID = 13
+			replace.Price = 11000000
+			replace.Amount = 3000000
+			mockDB.EXPECT().GetDueOutboxMessages(gomock.Any(), gomock.Any()).Return([]orders.OutboxMessage{replace}, nil)
+			mockDB.EXPECT().ClaimOutboxMessage(replace.ID, gomock.Any(), gomock.Any()).Return(true, nil)
+			if test.err != nil {
+				client.EXPECT().ReplaceOrder(entity, replace.Price, replace.Amount).Return(orders.ExchangeResponse{}, test.err)
+			}
+			// The holds go back to the old terms.
+			mockDB.EXPECT().AdjustHolds(entity.ID, money.Money(0), entity.Amount-entity.FilledAmount).Return(nil)
+			mockDB.EXPECT().
+				UpdateOutboxMessage(gomock.Any()).
+				DoAndReturn(func(message orders.OutboxMessage) error {
+					if message.Status != orders.OutboxStatusFailed || message.Attempts != 1 {
+						t.Errorf("invalid message %+v", message)
+					}
+					return nil
+				})
+
+			uc.DispatchOutbox(10)
+		})
+	}
+}
+
+func TestProcessExternalUpdate_StopTriggered_MarketRulesChecked(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+	band := pricebands.NewPriceBand("PETR4", pricebands.ReferenceTypePreviousClose, 1000)
+	band.ReferencePrice = 10000000
+	uc := newMarketUseCases(mockCtrl, mockDB, mocks.NewMockExchangeClient(mockCtrl), &band)
+
+	// Both stop orders are triggered by a trade at 9.40, but the price of the first one is outside of the band (9.00 ~ 11.00).
+	refused := getSellOrder(1)
+	refused.Status = orders.OrderStatusWaiting
+	refused.FilledAmount = 0
+	refused.StopPrice = 9500000
+	refused.Price = 5000000
+	triggered := refused
+	triggered.ID = 2
+	triggered.Price = 9300000
+	mockOrders(mockDB, map[orders.OrderID]*orders.Order{1: &refused, 2: &triggered})
+	mockDB.EXPECT().
+		ChangeStatusWithOutbox(gomock.Any(), orders.OutboxActionSubmit).
+		DoAndReturn(func(change orders.OrderStatusChange, action orders.OutboxAction) (*orders.Order, error) {
+			if change.OrderID != triggered.ID || change.ToStatus != orders.OrderStatusPending {
+				t.Errorf("invalid change %+v", change)
+			}
+			updated := triggered
+			updated.Status = change.ToStatus
+			return &updated, nil
+		})
+
+	trade := orders.ExternalUpdate{ID: "EX-OTHER", AssetID: "PETR4", Price: 9400000, Amount: 100000, Type: orders.OrderTypeBuy, Action: orders.ExternalUpdateActionTraded}
+	mockDB.EXPECT().GetByExternalIDAssetID(trade.ID, trade.AssetID).Return(nil, nil)
+	mockDB.EXPECT().EnqueueOrderBookUpdates(gomock.Any()).Return(nil)
+	mockDB.EXPECT().GetWaitingStopOrders(trade.AssetID).Return([]orders.Order{refused, triggered}, nil)
+
+	err := uc.ProcessExternalUpdate(trade)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refused.Status != orders.OrderStatusCanceled {
+		t.Errorf("status is %v, expected %v", refused.Status, orders.OrderStatusCanceled)
+	}
+}
+
+func TestProcessExternalUpdates_FixedFeeMultipleFills_FeeChargedOnEachFill(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+
+	// A fixed fee of 5.00 is charged on each trade, but it is held only once:
+	// the fee of the second trade is paid from the available balance.
+	fee := fees.FeeComponent{Name: "brokerage", Type: fees.FeeTypeFixed, Amount: 5000000}
+	uc := newTradeUseCases(mockCtrl, mockDB, calendars.CalendarUseCases{}, []fees.FeeComponent{fee}, nil)
+
+	// The order holds 20.00 for 2 assets at 10.00 and 5.00 for the fee.
+	entity := orderstests.GetOrder(1, orders.OrderTypeBuy, 10000000, 2000000, orderstests.BaseTime)
+	entity.Status = orders.OrderStatusAccepted
+	entity.HeldFunds = 25000000
+	mockDB.EXPECT().GetByExternalIDAssetID(entity.ExternalID, entity.AssetID).
+		DoAndReturn(func(id orders.ExternalOrderID, assetID assets.AssetID) (*orders.Order, error) {
+			order := entity
+			return &order, nil
+		}).
+		AnyTimes()
+	mockDB.EXPECT().EnqueueOrderBookUpdates(gomock.Any()).Return(nil)
+	mockDB.EXPECT().GetWaitingStopOrders(entity.AssetID).Return(nil, nil).AnyTimes()
+	mockDB.EXPECT().WithTx(gomock.Any()).Return(mockDB).AnyTimes()
+	executions := []orders.Execution{}
+	mockDB.EXPECT().
+		AddExecution(gomock.Any()).
+		DoAndReturn(func(execution orders.Execution) (*orders.Order, *orders.Execution, error) {
+			entity.AddFill(execution.Price, execution.Amount)
+			executions = append(executions, execution)
+			order := entity
+			return &order, &execution, nil
+		}).
+		Times(2)
+	var charged money.Money
+	mockDB.EXPECT().
+		ConsumeHeldFunds(entity.ID, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(orderID orders.OrderID, amount money.Money, cost money.Money) error {
+			if amount > entity.HeldFunds {
+				t.Errorf("released %v, but the order holds only %v", amount, entity.HeldFunds)
+			}
+			entity.HeldFunds -= amount
+			charged += cost
+			return nil
+		}).
+		Times(2)
+	mockDB.EXPECT().ReleaseHolds(entity.ID).Return(nil)
+
+	trade := orders.ExternalUpdate{ID: entity.ExternalID, AssetID: entity.AssetID, Price: 10000000, Amount: 1000000, Type: orders.OrderTypeBuy, Action: orders.ExternalUpdateActionTraded}
+	first, second := trade, trade
+	first.TradeID = "T1"
+	second.TradeID = "T2"
+	for i, err := range uc.ProcessExternalUpdates([]orders.ExternalUpdate{first, second}) {
+		if err != nil {
+			t.Errorf("update %d failed: %v", i, err)
+		}
+	}
+
+	if len(executions) != 2 || executions[0].Fee != 5000000 || executions[1].Fee != 5000000 {
+		t.Errorf("executions are %+v, expected the fee charged on each one", executions)
+	}
+	if charged != 30000000 {
+		t.Errorf("charged %v, expected %v", charged, money.Money(30000000))
+	}
+	if entity.Status != orders.OrderStatusFilled || entity.HeldFunds != 0 {
+		t.Errorf("order is %+v, expected filled without holds", entity)
+	}
+}
+
+func TestProcessExternalUpdates_BracketEntryFilledBeforeSettlement_ExitsPlaced(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+
+	// The assets bought on B3 settle on T+2.
+	calendar, err := calendars.NewCalendar("B3", "UTC", nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendar.SettlementDays = 2
+	inserted := []settlements.Settlement{}
+	uc := newTradeUseCases(mockCtrl, mockDB, calendars.NewCalendarUseCases([]calendars.Calendar{calendar}), nil, &inserted)
+
+	entry := orderstests.GetOrder(1, orders.OrderTypeBuy, 10000000, 1000000, orderstests.BaseTime)
+	entry.Status = orders.OrderStatusAccepted
+	entry.GroupID = 7
+	entry.HeldFunds = 10000000
+	takeProfit := orderstests.GetOrder(2, orders.OrderTypeSell, 12000000, 1000000, orderstests.BaseTime)
+	takeProfit.ExternalID = ""
+	takeProfit.Status = orders.OrderStatusWaiting
+	takeProfit.GroupID = entry.GroupID
+	takeProfit.ParentID = entry.ID
+	stopLoss := takeProfit
+	stopLoss.ID = 3
+	stopLoss.Price = 8000000
+	stopLoss.StopPrice = 8500000
+	entities := map[orders.OrderID]*orders.Order{1: &entry, 2: &takeProfit, 3: &stopLoss}
+	mockDB.EXPECT().
+		GetOrderGroup(entry.GroupID).
+		DoAndReturn(func(id orders.OrderGroupID) (*orders.OrderGroup, error) {
+			group := orders.OrderGroup{ID: id, Type: orders.OrderGroupTypeBracket, UserID: 999, AssetID: entry.AssetID}
+			for _, id := range []orders.OrderID{1, 2, 3} {
+				group.Orders = append(group.Orders, *entities[id])
+			}
+			return &group, nil
+		}).
+		AnyTimes()
+	mockDB.EXPECT().GetByExternalIDAssetID(entry.ExternalID, entry.AssetID).
+		DoAndReturn(func(id orders.ExternalOrderID, assetID assets.AssetID) (*orders.Order, error) {
+			order := entry
+			return &order, nil
+		}).
+		AnyTimes()
+	mockDB.EXPECT().EnqueueOrderBookUpdates(gomock.Any()).Return(nil)
+	mockDB.EXPECT().GetWaitingStopOrders(entry.AssetID).Return(nil, nil)
+	mockDB.EXPECT().WithTx(gomock.Any()).Return(mockDB).AnyTimes()
+	mockDB.EXPECT().MoveGroupHolds(entry.ID).Return(nil)
+	mockDB.EXPECT().
+		AddExecution(gomock.Any()).
+		DoAndReturn(func(execution orders.Execution) (*orders.Order, *orders.Execution, error) {
+			entry.AddFill(execution.Price, execution.Amount)
+			order := entry
+			return &order, &execution, nil
+		})
+	mockDB.EXPECT().ConsumeHeldFunds(entry.ID, money.Money(10000000), money.Money(10000000)).Return(nil)
+	mockDB.EXPECT().ReleaseHolds(entry.ID).Return(nil)
+	// The exits hold the assets bought by the entry, which are still pending.
+	mockDB.EXPECT().AdjustExitHolds(takeProfit.ID, money.Money(0), assets.AssetUnit(1000000)).Return(nil)
+	mockDB.EXPECT().
+		ChangeStatusWithOutbox(gomock.Any(), orders.OutboxActionSubmit).
+		DoAndReturn(func(change orders.OrderStatusChange, action orders.OutboxAction) (*orders.Order, error) {
+			if change.OrderID != takeProfit.ID || change.FromStatus != orders.OrderStatusWaiting || change.ToStatus != orders.OrderStatusPending {
+				t.Errorf("invalid change %+v", change)
+			}
+			takeProfit.Status = change.ToStatus
+			updated := takeProfit
+			return &updated, nil
+		})
+
+	trade := orders.ExternalUpdate{
+		ID: entry.ExternalID, AssetID: entry.AssetID, Price: 10000000, Amount: 1000000, Type: orders.OrderTypeBuy,
+		Action: orders.ExternalUpdateActionTraded, TradeID: "T1", Timestamp: time.Now(),
+	}
+	err = uc.ProcessExternalUpdate(trade)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inserted) != 1 || inserted[0].Status != settlements.SettlementStatusPending || inserted[0].Assets != 1000000 {
+		t.Errorf("settlements are %+v, expected the assets pending", inserted)
+	}
+	if takeProfit.Status != orders.OrderStatusPending || stopLoss.Status != orders.OrderStatusWaiting {
+		t.Errorf("exits are %v/%v, expected %v/%v", takeProfit.Status, stopLoss.Status, orders.OrderStatusPending, orders.OrderStatusWaiting)
+	}
+}
+
+func TestProcessExternalUpdates_QueueFailed_NotProcessed(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+	uc := newOrderUseCases(mockDB)
+
+	// The trades are not processed (no stop orders are read), so the exchange can send them again.
+	updates := []orders.ExternalUpdate{
+		{ID: "EX-1", AssetID: "PETR4", Price: 9400000, Amount: 100000, Type: orders.OrderTypeBuy, Action: orders.ExternalUpdateActionTraded},
+		{ID: "EX-2", AssetID: "PETR4", Action: orders.ExternalUpdateActionDeleted},
+	}
+	queueErr := errors.New("connection refused")
+	mockDB.EXPECT().GetByExternalIDAssetID(gomock.Any(), gomock.Any()).Return(nil, nil).Times(len(updates))
+	mockDB.EXPECT().EnqueueOrderBookUpdates(gomock.Any()).Return(queueErr)
+
+	errs := uc.ProcessExternalUpdates(updates)
+	for i, err := range errs {
+		if !errors.Is(err, queueErr) {
+			t.Errorf("error of the update %d is %v, expected %v", i, err, queueErr)
+		}
+	}
+}
+
+func TestForwardOrderBookQueue_OrderBookUnavailable_RetriedInOrder(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+
+	received := map[assets.AssetID][][]orders.ExternalOrderID{}
+	available := false
+	server := newOrderBookServer(t, received, func(assetID assets.AssetID, w http.ResponseWriter, updates []orders.ExternalUpdate) {
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writeOrderBookResults(w, updates, nil)
+	})
+	defer server.Close()
+	uc := newForwarderUseCases(mockDB, server.URL)
+
+	messages := getOrderBookMessages("PETR4", "ex1", "ex2", "ex3")
+	mockDB.EXPECT().GetOrderBookQueueAssets().Return([]assets.AssetID{"PETR4"}, nil).Times(2)
+	gomock.InOrder(
+		mockDB.EXPECT().ClaimOrderBookBatch(assets.AssetID("PETR4"), gomock.Any(), gomock.Any(), 100).Return(messages, nil),
+		// Only the first message keeps the retry, the next ones wait for it.
+		mockDB.EXPECT().
+			UpdateOrderBookMessages(gomock.Any()).
+			Do(func(entities []orders.OrderBookMessage) {
+				if len(entities) != 1 || entities[0].ID != 1 || entities[0].Status != orders.OrderBookMessageStatusPending ||
+					entities[0].Attempts != 1 || !entities[0].NextAttemptAt.After(time.Now()) {
+					t.Errorf("invalid retry %+v", entities)
+				}
+				messages[0] = entities[0]
+			}).
+			Return(nil),
+		mockDB.EXPECT().
+			ClaimOrderBookBatch(assets.AssetID("PETR4"), gomock.Any(), gomock.Any(), 100).
+			DoAndReturn(func(assetID assets.AssetID, now time.Time, until time.Time, limit int) ([]orders.OrderBookMessage, error) {
+				return messages, nil
+			}),
+		mockDB.EXPECT().
+			UpdateOrderBookMessages(gomock.Any()).
+			Do(func(entities []orders.OrderBookMessage) {
+				for i, entity := range entities {
+					if entity.ID != orders.OrderBookMessageID(i+1) || entity.Status != orders.OrderBookMessageStatusSent {
+						t.Errorf("message %d is %+v, expected sent", i, entity)
+					}
+				}
+			}).
+			Return(nil),
+	)
+
+	sent, err := uc.ForwardOrderBookQueue(100)
+	if err != nil || sent != 0 {
+		t.Fatalf("received %v/%v, expected 0/nil", sent, err)
+	}
+	available = true
+	sent, err = uc.ForwardOrderBookQueue(100)
+	if err != nil || sent != 3 {
+		t.Fatalf("received %v/%v, expected 3/nil", sent, err)
+	}
+	expected := "[[ex1 ex2 ex3] [ex1 ex2 ex3]]"
+	if fmt.Sprint(received["PETR4"]) != expected {
+		t.Errorf("received %v, expected %v", received["PETR4"], expected)
+	}
+}
+
+func TestForwardOrderBookQueue_UpdateRefused_DeadLetter(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+
+	received := map[assets.AssetID][][]orders.ExternalOrderID{}
+	server := newOrderBookServer(t, received, func(assetID assets.AssetID, w http.ResponseWriter, updates []orders.ExternalUpdate) {
+		writeOrderBookResults(w, updates, map[orders.ExternalOrderID]bool{"ex2": true})
+	})
+	defer server.Close()
+	uc := newForwarderUseCases(mockDB, server.URL)
+
+	messages := getOrderBookMessages("PETR4", "ex1", "ex2", "ex3")
+	mockDB.EXPECT().GetOrderBookQueueAssets().Return([]assets.AssetID{"PETR4"}, nil)
+	mockDB.EXPECT().ClaimOrderBookBatch(assets.AssetID("PETR4"), gomock.Any(), gomock.Any(), 100).Return(messages, nil)
+	mockDB.EXPECT().
+		UpdateOrderBookMessages(gomock.Any()).
+		Do(func(entities []orders.OrderBookMessage) {
+			expected := []orders.OrderBookMessageStatus{orders.OrderBookMessageStatusSent, orders.OrderBookMessageStatusDead, orders.OrderBookMessageStatusSent}
+			for i, entity := range entities {
+				if entity.Status != expected[i] || entity.Attempts != 1 {
+					t.Errorf("message %d is %+v, expected %v", i, entity, expected[i])
+				}
+			}
+			if entities[1].LastError != "Order not found." {
+				t.Errorf("last error is %q, expected %q", entities[1].LastError, "Order not found.")
+			}
+		}).
+		Return(nil)
+
+	sent, err := uc.ForwardOrderBookQueue(100)
+	if err != nil || sent != 2 {
+		t.Fatalf("received %v/%v, expected 2/nil", sent, err)
+	}
+}
+
+func TestForwardOrderBookQueue_BatchRejected_AllDeadLetters(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+
+	received := map[assets.AssetID][][]orders.ExternalOrderID{}
+	server := newOrderBookServer(t, received, func(assetID assets.AssetID, w http.ResponseWriter, updates []orders.ExternalUpdate) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	})
+	defer server.Close()
+	uc := newForwarderUseCases(mockDB, server.URL)
+
+	messages := getOrderBookMessages("PETR4", "ex1", "ex2")
+	mockDB.EXPECT().GetOrderBookQueueAssets().Return([]assets.AssetID{"PETR4"}, nil)
+	mockDB.EXPECT().ClaimOrderBookBatch(assets.AssetID("PETR4"), gomock.Any(), gomock.Any(), 100).Return(messages, nil)
+	mockDB.EXPECT().
+		UpdateOrderBookMessages(gomock.Any()).
+		Do(func(entities []orders.OrderBookMessage) {
+			if len(entities) != len(messages) {
+				t.Fatalf("%d messages updated, expected %d", len(entities), len(messages))
+			}
+			for i, entity := range entities {
+				if entity.Status != orders.OrderBookMessageStatusDead || !strings.Contains(entity.LastError, "422") {
+					t.Errorf("message %d is %+v, expected dead", i, entity)
+				}
+			}
+		}).
+		Return(nil)
+
+	sent, err := uc.ForwardOrderBookQueue(100)
+	if err != nil || sent != 0 {
+		t.Fatalf("received %v/%v, expected 0/nil", sent, err)
+	}
+}
+
+func TestForwardOrderBookQueue_SlowOrderBook_OtherAssetsForwarded(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+
+	// The order book of PETR4 answers only after the one of VALE3 receives its batch.
+	received := map[assets.AssetID][][]orders.ExternalOrderID{}
+	valeReceived := make(chan struct{})
+	server := newOrderBookServer(t, received, func(assetID assets.AssetID, w http.ResponseWriter, updates []orders.ExternalUpdate) {
+		if assetID == "VALE3" {
+			close(valeReceived)
+		} else {
+			select {
+			case <-valeReceived:
+			case <-time.After(5 * time.Second):
+				t.Error("the assets were not forwarded concurrently")
+			}
+		}
+		writeOrderBookResults(w, updates, nil)
+	})
+	defer server.Close()
+	uc := newForwarderUseCases(mockDB, server.URL)
+
+	mockDB.EXPECT().GetOrderBookQueueAssets().Return([]assets.AssetID{"PETR4", "VALE3"}, nil)
+	for _, assetID := range []assets.AssetID{"PETR4", "VALE3"} {
+		mockDB.EXPECT().ClaimOrderBookBatch(assetID, gomock.Any(), gomock.Any(), 100).Return(getOrderBookMessages(assetID, "ex1"), nil)
+	}
+	mockDB.EXPECT().UpdateOrderBookMessages(gomock.Any()).Return(nil).Times(2)
+
+	sent, err := uc.ForwardOrderBookQueue(100)
+	if err != nil || sent != 2 {
+		t.Fatalf("received %v/%v, expected 2/nil", sent, err)
+	}
+}
+
+func TestPruneOrderBookQueue(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+	uc := newOrderUseCases(mockDB)
+
+	// The sent updates are kept for a day and the dead letters for 30 days.
+	now := orderstests.BaseTime
+	mockDB.EXPECT().DeleteOrderBookMessages(orders.OrderBookMessageStatusSent, now.Add(-24*time.Hour)).Return(int64(10), nil)
+	mockDB.EXPECT().DeleteOrderBookMessages(orders.OrderBookMessageStatusDead, now.Add(-30*24*time.Hour)).Return(int64(1), nil)
+
+	err := uc.PruneOrderBookQueue(now)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProcessExternalUpdate_TradeWithoutTradeID_ErrValidation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+	uc := newMarketUseCases(mockCtrl, mockDB, mocks.NewMockExchangeClient(mockCtrl), nil)
+
+	// Two fills of the order with the same timestamp must not be taken as a repeated trade, so no execution is added.
+	entity := orderstests.GetOrder(1, orders.OrderTypeBuy, 10000000, 2000000, orderstests.BaseTime)
+	entity.Status = orders.OrderStatusAccepted
+	trade := orders.ExternalUpdate{ID: entity.ExternalID, AssetID: entity.AssetID, Price: 10000000, Amount: 1000000, Type: orders.OrderTypeBuy,
+		Action: orders.ExternalUpdateActionTraded, Timestamp: orderstests.BaseTime}
+	mockDB.EXPECT().GetByExternalIDAssetID(entity.ExternalID, entity.AssetID).Return(&entity, nil).Times(2)
+	mockDB.EXPECT().EnqueueOrderBookUpdates(gomock.Any()).Return(nil)
+	mockDB.EXPECT().GetWaitingStopOrders(entity.AssetID).Return(nil, nil)
+
+	err := uc.ProcessExternalUpdate(trade)
+	if _, ok := err.(core.ErrValidation); !ok {
+		t.Errorf("received %v, expected ErrValidation", err)
+	}
+}
+
+func TestProcessExternalUpdate_TradeBeforeSubmitResponse_OrderFoundByClientOrderID(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+	uc := newTradeUseCases(mockCtrl, mockDB, calendars.CalendarUseCases{}, nil, nil)
+
+	// The order was sent, but its external ID was not saved yet.
+	entity := orderstests.GetOrder(1, orders.OrderTypeBuy, 10000000, 2000000, orderstests.BaseTime)
+	entity.ExternalID = ""
+	entity.Status = orders.OrderStatusPending
+	entity.HeldFunds = 20000000
+	trade := orders.ExternalUpdate{
+		ID: "EX-9", ClientOrderID: "1", AssetID: entity.AssetID, Price: 10000000, Amount: 1000000, Type: orders.OrderTypeBuy,
+		Action: orders.ExternalUpdateActionTraded, TradeID: "T1", Timestamp: orderstests.BaseTime,
+	}
+	mockDB.EXPECT().GetByExternalIDAssetID(trade.ID, trade.AssetID).
+		DoAndReturn(func(id orders.ExternalOrderID, assetID assets.AssetID) (*orders.Order, error) {
+			if entity.ExternalID != id {
+				return nil, nil
+			}
+			order := entity
+			return &order, nil
+		}).
+		Times(2)
+	mockDB.EXPECT().GetByID(entity.ID).DoAndReturn(func(id orders.OrderID) (*orders.Order, error) {
+		order := entity
+		return &order, nil
+	})
+	mockDB.EXPECT().
+		SetExternalID(entity.ID, trade.ID, trade.Timestamp).
+		DoAndReturn(func(id orders.OrderID, externalID orders.ExternalOrderID, timestamp time.Time) error {
+			entity.ExternalID = externalID
+			return nil
+		})
+	mockDB.EXPECT().
+		EnqueueOrderBookUpdates(gomock.Any()).
+		DoAndReturn(func(updates []orders.ExternalUpdate) error {
+			if !updates[0].Mine {
+				t.Errorf("update is %+v, expected as mine", updates[0])
+			}
+			return nil
+		})
+	mockDB.EXPECT().GetWaitingStopOrders(entity.AssetID).Return(nil, nil)
+	mockDB.EXPECT().WithTx(gomock.Any()).Return(mockDB).AnyTimes()
+	var executions []orders.Execution
+	mockDB.EXPECT().
+		AddExecution(gomock.Any()).
+		DoAndReturn(func(execution orders.Execution) (*orders.Order, *orders.Execution, error) {
+			entity.AddFill(execution.Price, execution.Amount)
+			executions = append(executions, execution)
+			order := entity
+			return &order, &execution, nil
+		})
+	mockDB.EXPECT().ConsumeHeldFunds(entity.ID, money.Money(10000000), money.Money(10000000)).Return(nil)
+
+	err := uc.ProcessExternalUpdate(trade)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(executions) != 1 || executions[0].OrderID != entity.ID {
+		t.Errorf("executions are %+v, expected the trade of the order %v", executions, entity.ID)
+	}
+}
+
+func TestProcessExternalUpdate_ClientOrderIDOfOrderWithExternalID_NotMine(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDB := mocks.NewMockOrderDBInterface(mockCtrl)
+	uc := newMarketUseCases(mockCtrl, mockDB, mocks.NewMockExchangeClient(mockCtrl), nil)
+
+	// The order 1 is already known by another external ID, so the update is of another client.
+	entity := orderstests.GetOrder(1, orders.OrderTypeBuy, 10000000, 2000000, orderstests.BaseTime)
+	entity.Status = orders.OrderStatusAccepted
+	trade := orders.ExternalUpdate{
+		ID: "EX-9", ClientOrderID: "1", AssetID: entity.AssetID, Price: 10000000, Amount: 1000000, Type: orders.OrderTypeBuy,
+		Action: orders.ExternalUpdateActionTraded, TradeID: "T1", Timestamp: orderstests.BaseTime,
+	}
+	mockDB.EXPECT().GetByExternalIDAssetID(trade.ID, trade.AssetID).Return(nil, nil)
+	mockDB.EXPECT().GetByID(entity.ID).Return(&entity, nil)
+	mockDB.EXPECT().
+		EnqueueOrderBookUpdates(gomock.Any()).
+		DoAndReturn(func(updates []orders.ExternalUpdate) error {
+			if updates[0].Mine {
+				t.Errorf("update is %+v, expected as not mine", updates[0])
+			}
+			return nil
+		})
+	mockDB.EXPECT().GetWaitingStopOrders(entity.AssetID).Return(nil, nil)
+
+	err := uc.ProcessExternalUpdate(trade)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,21 @@
+package pricebands
+
+import (
+	"home-broker/assets"
+	"home-broker/money"
+)
+
+// PriceBandDBInterface is an interface that handles database commands for PriceBand entity.
+type PriceBandDBInterface interface {
+	// GetByAssetID must return a price band by an asset ID.
+	// A nil entity will be returned if it does not exist.
+	GetByAssetID(assetID assets.AssetID) (*PriceBand, error)
+
+	// Upsert must insert a new price band or update the existing one of the same asset.
+	// A nil entity will be returned if an error occurs.
+	// The following errors can happen: ErrAssetDoesNotExist.
+	Upsert(entity PriceBand) (*PriceBand, error)
+
+	// UpdateReferencePrice must update the reference price of a price band.
+	UpdateReferencePrice(assetID assets.AssetID, price money.Money) error
+}
@@ -0,0 +1,61 @@
+package pricebands
+
+import (
+	"home-broker/assets"
+	"home-broker/money"
+	"time"
+)
+
+type (
+	// ReferenceType represents where the reference price of a band comes from.
+	// Use the value of ReferenceTypeLastTrade or ReferenceTypePreviousClose to set this data type.
+	ReferenceType string
+)
+
+const (
+	// ReferenceTypeLastTrade is a band that follows the last trade price.
+	// The reference price is updated on every trade received from the exchange.
+	ReferenceTypeLastTrade ReferenceType = "last_trade"
+
+	// ReferenceTypePreviousClose is a band that uses the previous close price.
+	// The reference price is only updated by an admin (ex: at the end of the day).
+	ReferenceTypePreviousClose ReferenceType = "previous_close"
+
+	// BasisPointsBase is the value of 100% in basis points.
+	BasisPointsBase int64 = 10000
+)
+
+// PriceBand represents a dynamic price collar around a reference price of an asset.
+// Orders with a price outside of the band must be rejected.
+type PriceBand struct {
+	AssetID        assets.AssetID `json:"asset_id"`
+	ReferencePrice money.Money    `json:"reference_price"` // A zero value means "no reference yet".
+	ReferenceType  ReferenceType  `json:"reference_type"`
+	BasisPoints    int64          `json:"basis_points"` // Band width for each side. Ex: 1000 = 10%.
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      time.Time      `json:"-"`
+}
+
+// NewPriceBand returns a new PriceBand.
+func NewPriceBand(assetID assets.AssetID, referenceType ReferenceType, basisPoints int64) PriceBand {
+	return PriceBand{AssetID: assetID, ReferenceType: referenceType, BasisPoints: basisPoints}
+}
+
+// Limits returns the lowest and highest prices accepted by the band.
+func (pb PriceBand) Limits() (low money.Money, high money.Money) {
+	ref := int64(pb.ReferencePrice)
+	// Splitting the multiplication avoids an int64 overflow with big prices.
+	delta := (ref/BasisPointsBase)*pb.BasisPoints + (ref%BasisPointsBase)*pb.BasisPoints/BasisPointsBase
+	return money.Money(ref - delta), money.Money(ref + delta)
+}
+
+// Allows returns true if the price is inside of the band.
+// A band without a reference price or width allows any price.
+func (pb PriceBand) Allows(price money.Money) bool {
+	if pb.ReferencePrice <= 0 || pb.BasisPoints <= 0 {
+		return true
+	}
+	low, high := pb.Limits()
+	return price >= low && price <= high
+}
@@ -0,0 +1,66 @@
+package pricebands_test
+
+import (
+	"home-broker/money"
+	"home-broker/pricebands"
+	"testing"
+)
+
+func TestPriceBandLimits(t *testing.T) {
+	testTable := []struct {
+		test         string
+		reference    money.Money
+		basisPoints  int64
+		expectedLow  money.Money
+		expectedHigh money.Money
+	}{
+		{test: "10%", reference: 100000000, basisPoints: 1000, expectedLow: 90000000, expectedHigh: 110000000},
+		{test: "0.5%", reference: 100000000, basisPoints: 50, expectedLow: 99500000, expectedHigh: 100500000},
+		{test: "NoReference", reference: 0, basisPoints: 1000, expectedLow: 0, expectedHigh: 0},
+		{test: "BigPrice", reference: 900000000000000000, basisPoints: 1000, expectedLow: 810000000000000000, expectedHigh: 990000000000000000},
+	}
+	for _, table := range testTable {
+		t.Run(table.test, func(t *testing.T) {
+			pb := pricebands.NewPriceBand("VIBR", pricebands.ReferenceTypeLastTrade, table.basisPoints)
+			pb.ReferencePrice = table.reference
+			low, high := pb.Limits()
+			if low != table.expectedLow {
+				t.Errorf("low is %v, expected %v", low, table.expectedLow)
+			}
+			if high != table.expectedHigh {
+				t.Errorf("high is %v, expected %v", high, table.expectedHigh)
+			}
+		})
+	}
+}
+
+func TestPriceBandAllows(t *testing.T) {
+	pb := pricebands.NewPriceBand("VIBR", pricebands.ReferenceTypeLastTrade, 1000)
+	pb.ReferencePrice = 100000000 // $100.00
+
+	testTable := []struct {
+		test     string
+		price    money.Money
+		expected bool
+	}{
+		{test: "Reference", price: 100000000, expected: true},
+		{test: "LowLimit", price: 90000000, expected: true},
+		{test: "HighLimit", price: 110000000, expected: true},
+		{test: "BelowLowLimit", price: 89999999, expected: false},
+		{test: "AboveHighLimit", price: 110000001, expected: false},
+	}
+	for _, table := range testTable {
+		t.Run(table.test, func(t *testing.T) {
+			if pb.Allows(table.price) != table.expected {
+				t.Errorf("Allows(%v) is %v, expected %v", table.price, !table.expected, table.expected)
+			}
+		})
+	}
+
+	t.Run("NoReference_AllowsAnyPrice", func(t *testing.T) {
+		pb := pricebands.NewPriceBand("VIBR", pricebands.ReferenceTypeLastTrade, 1000)
+		if !pb.Allows(1) {
+			t.Errorf("price not allowed, expected as allowed")
+		}
+	})
+}
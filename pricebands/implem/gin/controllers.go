@@ -0,0 +1,71 @@
+package pricebandsgin
+
+import (
+	"home-broker/assets"
+	"home-broker/core"
+	"home-broker/money"
+	"home-broker/pricebands"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	apiErrorInvalidJSON = core.NewAPIError("Invalid JSON.", 400)
+)
+
+// PriceBandController represents a price band controller.
+type PriceBandController struct {
+	uc pricebands.PriceBandUseCases
+}
+
+// NewPriceBandController creates a new PriceBandController.
+func NewPriceBandController(uc pricebands.PriceBandUseCases) PriceBandController {
+	return PriceBandController{uc: uc}
+}
+
+// SetPriceBandJSON is the JSON received on SetPriceBand.
+type SetPriceBandJSON struct {
+	ReferencePrice money.Money              `json:"reference_price"`
+	ReferenceType  pricebands.ReferenceType `json:"reference_type"`
+	BasisPoints    int64                    `json:"basis_points"`
+}
+
+// GetPriceBand returns the price band of an asset.
+func (priceBandC PriceBandController) GetPriceBand(c *gin.Context) {
+	entity, err := priceBandC.uc.GetPriceBand(assets.AssetID(c.Param("asset_id")))
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	if entity == nil {
+		c.Error(core.NewAPIError("Not found", 404))
+		return
+	}
+	c.JSON(http.StatusOK, entity)
+}
+
+// SetPriceBand creates or changes the price band of an asset.
+func (priceBandC PriceBandController) SetPriceBand(c *gin.Context) {
+	var json SetPriceBandJSON
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.Error(apiErrorInvalidJSON)
+		return
+	}
+	entity, err := priceBandC.uc.SetPriceBand(assets.AssetID(c.Param("asset_id")), json.ReferencePrice, json.ReferenceType, json.BasisPoints)
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, entity)
+}
@@ -0,0 +1,27 @@
+package pricebandsgin
+
+import (
+	"home-broker/pricebands"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PriceBandRouter represents a price bands router.
+type PriceBandRouter struct {
+	uc pricebands.PriceBandUseCases
+}
+
+// NewPriceBandRouter creates a new Router.
+func NewPriceBandRouter(uc pricebands.PriceBandUseCases) PriceBandRouter {
+	return PriceBandRouter{uc: uc}
+}
+
+// SetupRouter setups price bands router.
+func (wr PriceBandRouter) SetupRouter(router *gin.Engine) {
+	priceBandC := NewPriceBandController(wr.uc)
+	v1 := router.Group("/api/v1/pricebands")
+	{
+		v1.GET(":asset_id/", priceBandC.GetPriceBand)
+		v1.PUT(":asset_id/", priceBandC.SetPriceBand)
+	}
+}
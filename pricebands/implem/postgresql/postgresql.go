@@ -0,0 +1,134 @@
+package postgresql
+
+import (
+	"errors"
+	"home-broker/assets"
+	assetspostgresql "home-broker/assets/implem/postgresql"
+	"home-broker/core/implem/postgresql"
+	"home-broker/money"
+	"home-broker/pricebands"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PriceBandModel is the ORM version of PriceBand entity.
+type PriceBandModel struct {
+	gorm.Model
+	ID             int64          `gorm:"primaryKey;autoIncrement:true"`
+	AssetID        assets.AssetID `gorm:"unique;not null"`
+	Asset          assetspostgresql.AssetModel
+	ReferencePrice money.Money              `gorm:"not null"`
+	ReferenceType  pricebands.ReferenceType `gorm:"not null"`
+	BasisPoints    int64                    `gorm:"not null"`
+	CreatedAt      time.Time                `gorm:"not null;index:,sort:desc"`
+	UpdatedAt      time.Time                `gorm:"not null;index:,sort:desc"`
+	DeletedAt      gorm.DeletedAt           `gorm:"index:,sort:desc"`
+}
+
+// TableName returns the real table name of PriceBand.
+// It is used by GORM to perfom operations on price band table (queries, migrations, etc.).
+func (PriceBandModel) TableName() string {
+	return "priceband"
+}
+
+// PriceBandDB handles database commands for price band table.
+type PriceBandDB struct {
+	pricebands.PriceBandDBInterface
+	db postgresql.DB
+}
+
+// NewPriceBandDB creates a new PriceBandDB.
+func NewPriceBandDB(db postgresql.DB) PriceBandDB {
+	return PriceBandDB{db: db}
+}
+
+// ToEntity returns a PriceBand entity from the ORM model.
+func (PriceBandDB) ToEntity(model PriceBandModel) pricebands.PriceBand {
+	// "model.DeletedAt" is not a Time object. It is a struct with Time and Valid fields.
+	deletedAt := time.Time{} // A "time.Time" with zero value represents a "null".
+	if model.DeletedAt.Valid {
+		// "model.DeletedAt" is not a "null" value.
+		deletedAt = model.DeletedAt.Time
+	}
+	entity := pricebands.PriceBand{
+		AssetID:        model.AssetID,
+		ReferencePrice: model.ReferencePrice,
+		ReferenceType:  model.ReferenceType,
+		BasisPoints:    model.BasisPoints,
+		CreatedAt:      model.CreatedAt,
+		UpdatedAt:      model.UpdatedAt,
+		DeletedAt:      deletedAt,
+	}
+	return entity
+}
+
+// ToModel returns a GORM model from a price band entity.
+func (PriceBandDB) ToModel(entity pricebands.PriceBand) PriceBandModel {
+	deletedAt := gorm.DeletedAt{Time: entity.DeletedAt}
+	if !entity.DeletedAt.IsZero() {
+		deletedAt.Valid = true
+	}
+	model := PriceBandModel{
+		AssetID:        entity.AssetID,
+		ReferencePrice: entity.ReferencePrice,
+		ReferenceType:  entity.ReferenceType,
+		BasisPoints:    entity.BasisPoints,
+		CreatedAt:      entity.CreatedAt,
+		UpdatedAt:      entity.UpdatedAt,
+		DeletedAt:      deletedAt,
+	}
+	return model
+}
+
+// GetByAssetID returns a price band by an asset ID.
+// A nil entity will be returned if it does not exist.
+func (priceBandDB PriceBandDB) GetByAssetID(assetID assets.AssetID) (*pricebands.PriceBand, error) {
+	model := PriceBandModel{}
+	res := priceBandDB.db.GetDB().Where(`"asset_id"=?`, assetID).Take(&model)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	entity := priceBandDB.ToEntity(model)
+	return &entity, nil
+}
+
+// Upsert inserts a new price band or updates the existing one of the same asset.
+// A nil entity will be returned if an error occurs.
+// The following errors can happen: ErrAssetDoesNotExist.
+func (priceBandDB PriceBandDB) Upsert(entity pricebands.PriceBand) (*pricebands.PriceBand, error) {
+	model := priceBandDB.ToModel(entity)
+	res := priceBandDB.db.GetDB().
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "asset_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"reference_price", "reference_type", "basis_points", "updated_at", "deleted_at"}),
+		}).
+		Create(&model)
+	if res.Error != nil {
+		errMsg := res.Error.Error()
+		if strings.Contains(errMsg, "foreign key constraint") && strings.Contains(errMsg, "asset") {
+			// Original error: "ERROR: insert or update on table "priceband" violates foreign key constraint "fk_priceband_asset" (SQLSTATE 23503)"
+			return nil, assets.ErrAssetDoesNotExist
+		}
+		return nil, res.Error
+	}
+	return priceBandDB.GetByAssetID(entity.AssetID)
+}
+
+// UpdateReferencePrice updates the reference price of a price band.
+func (priceBandDB PriceBandDB) UpdateReferencePrice(assetID assets.AssetID, price money.Money) error {
+	updatedAt := time.Now()
+	res := priceBandDB.db.GetDB().
+		Table("priceband").
+		Where(`"asset_id"=? AND "deleted_at" IS NULL`, assetID).
+		Updates(map[string]interface{}{
+			"reference_price": price,
+			"updated_at":      updatedAt,
+		})
+	return res.Error
+}
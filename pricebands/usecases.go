@@ -0,0 +1,80 @@
+package pricebands
+
+import (
+	"fmt"
+	"home-broker/assets"
+	"home-broker/core"
+	"home-broker/money"
+)
+
+// PriceBandUseCases represents the price band use cases.
+type PriceBandUseCases struct {
+	db PriceBandDBInterface
+}
+
+// NewPriceBandUseCases returns a new PriceBandUseCases.
+func NewPriceBandUseCases(db PriceBandDBInterface) PriceBandUseCases {
+	return PriceBandUseCases{db: db}
+}
+
+// GetPriceBand returns the price band of an asset.
+// A nil entity will be returned if the asset has no band.
+func (uc PriceBandUseCases) GetPriceBand(assetID assets.AssetID) (*PriceBand, error) {
+	if assetID == "" {
+		return nil, core.NewErrValidation("Invalid asset ID.")
+	}
+	return uc.db.GetByAssetID(assetID)
+}
+
+// SetPriceBand creates or changes the price band of an asset.
+// This is an admin operation. It is also used to set the previous close price.
+func (uc PriceBandUseCases) SetPriceBand(assetID assets.AssetID, referencePrice money.Money, referenceType ReferenceType, basisPoints int64) (*PriceBand, error) {
+	if assetID == "" {
+		return nil, core.NewErrValidation("Invalid asset ID.")
+	}
+	if referencePrice < 0 {
+		return nil, core.NewErrValidation("Invalid reference price.")
+	}
+	if referenceType != ReferenceTypeLastTrade && referenceType != ReferenceTypePreviousClose {
+		return nil, core.NewErrValidation("Invalid reference type.")
+	}
+	if basisPoints < 0 {
+		return nil, core.NewErrValidation("Invalid basis points.")
+	}
+	entity := NewPriceBand(assetID, referenceType, basisPoints)
+	entity.ReferencePrice = referencePrice
+	newEntity, err := uc.db.Upsert(entity)
+	if err == assets.ErrAssetDoesNotExist {
+		return nil, core.NewErrValidation("Asset does not exist.")
+	}
+	return newEntity, err
+}
+
+// CheckPrice returns an ErrValidation if the price is outside of the asset price band.
+// Assets without a band accept any price.
+func (uc PriceBandUseCases) CheckPrice(assetID assets.AssetID, price money.Money) error {
+	entity, err := uc.db.GetByAssetID(assetID)
+	if err != nil {
+		return err
+	}
+	if entity == nil || entity.Allows(price) {
+		return nil
+	}
+	low, high := entity.Limits()
+	return core.NewErrValidation(fmt.Sprintf("Price out of the price band (%d ~ %d).", low, high))
+}
+
+// ProcessTrade updates the reference price of bands following the last trade.
+func (uc PriceBandUseCases) ProcessTrade(assetID assets.AssetID, price money.Money) error {
+	if price <= 0 {
+		return nil
+	}
+	entity, err := uc.db.GetByAssetID(assetID)
+	if err != nil {
+		return err
+	}
+	if entity == nil || entity.ReferenceType != ReferenceTypeLastTrade {
+		return nil
+	}
+	return uc.db.UpdateReferencePrice(assetID, price)
+}
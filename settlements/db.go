@@ -0,0 +1,33 @@
+package settlements
+
+import (
+	"home-broker/core"
+	"home-broker/users"
+	"time"
+)
+
+// SettlementDBInterface is an interface that handles database commands for Settlement entity.
+type SettlementDBInterface interface {
+	// Insert must insert a settlement and add its funds and assets to the pending balances of the user wallets,
+	// in the same transaction. The funds and assets of a "settled" entity must go straight to the balances.
+	// A nil entity will be returned if an error occurs (nothing is changed).
+	// The following errors can happen: ErrWalletDoesNotExist, ErrAssetWalletDoesNotExist.
+	Insert(entity Settlement) (*Settlement, error)
+
+	// GetDue must return up to "limit" pending settlements with a settlement date up to "now".
+	// The oldest settlement dates come first.
+	GetDue(now time.Time, limit int) ([]Settlement, error)
+
+	// GetByUserID must return up to "limit" settlements of an user, the newest first.
+	// An empty status returns all the settlements.
+	GetByUserID(userID users.UserID, status SettlementStatus, limit int) ([]Settlement, error)
+
+	// Settle must change a pending settlement to "settled" and move its funds and assets from the pending
+	// balances to the balances of the user wallets, in the same transaction.
+	// It returns false if the settlement is not pending anymore (ex: settled by another job).
+	Settle(id SettlementID, now time.Time) (bool, error)
+
+	// WithTx must return a copy of the handler that runs its commands inside a transaction (see core.UnitOfWork).
+	// The methods that use their own transaction must join it instead (ex: with a savepoint).
+	WithTx(tx core.Tx) SettlementDBInterface
+}
@@ -0,0 +1,62 @@
+package settlements
+
+import (
+	"home-broker/assets"
+	"home-broker/money"
+	"home-broker/users"
+	"time"
+)
+
+type (
+	// SettlementID represents the Settlement ID type.
+	SettlementID int64
+
+	// SettlementStatus represents the status of a settlement.
+	// Use the value of SettlementStatusPending or SettlementStatusSettled to set this data type.
+	SettlementStatus string
+)
+
+const (
+	// SettlementStatusPending is a settlement waiting for its settlement date.
+	// Its funds/assets are pending on the wallet/asset wallet.
+	SettlementStatusPending SettlementStatus = "pending"
+
+	// SettlementStatusSettled is a settlement whose funds/assets were moved to the balance.
+	SettlementStatusSettled SettlementStatus = "settled"
+)
+
+// Settlement is the cash or the assets that an user receives from a trade on its settlement date (ex: T+2).
+// Until then they are pending on the wallet (funds of a sell) or asset wallet (assets of a buy) and cannot be used.
+type Settlement struct {
+	ID             SettlementID     `json:"id"`
+	UserID         users.UserID     `json:"user_id"`
+	AssetID        assets.AssetID   `json:"asset_id"`
+	Funds          money.Money      `json:"funds"`     // Funds received (ex: a sell, less its fees).
+	Assets         assets.AssetUnit `json:"assets"`    // Assets received (ex: a buy).
+	Reference      string           `json:"reference"` // What generated the settlement (ex: a trade of an order).
+	TradeDate      time.Time        `json:"trade_date"`
+	SettlementDate time.Time        `json:"settlement_date"`
+	Status         SettlementStatus `json:"status"`
+	SettledAt      time.Time        `json:"settled_at"` // Zero while pending.
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+// NewSettlement returns a new pending Settlement.
+func NewSettlement(userID users.UserID, assetID assets.AssetID, funds money.Money, amount assets.AssetUnit, reference string, tradeDate time.Time, settlementDate time.Time) Settlement {
+	return Settlement{
+		UserID:         userID,
+		AssetID:        assetID,
+		Funds:          funds,
+		Assets:         amount,
+		Reference:      reference,
+		TradeDate:      tradeDate,
+		SettlementDate: settlementDate,
+		Status:         SettlementStatusPending,
+	}
+}
+
+// IsDue returns true if the settlement date was reached at "now".
+func (s Settlement) IsDue(now time.Time) bool {
+	return !s.SettlementDate.After(now)
+}
@@ -0,0 +1,40 @@
+package settlements_test
+
+import (
+	"home-broker/settlements"
+	"testing"
+	"time"
+)
+
+func TestNewSettlement(t *testing.T) {
+	tradeDate := time.Date(2026, 10, 16, 14, 0, 0, 0, time.UTC)
+	settlementDate := time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)
+	entity := settlements.NewSettlement(1, "VIBR", 0, 1000000, "order 1 trade 1", tradeDate, settlementDate)
+	if entity.Status != settlements.SettlementStatusPending {
+		t.Errorf("status is %v, expected %v", entity.Status, settlements.SettlementStatusPending)
+	}
+	if !entity.SettledAt.IsZero() {
+		t.Errorf("settled at is %v, expected as zero", entity.SettledAt)
+	}
+}
+
+func TestSettlementIsDue(t *testing.T) {
+	settlementDate := time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)
+	entity := settlements.NewSettlement(1, "VIBR", 1000000, 0, "", settlementDate.AddDate(0, 0, -4), settlementDate)
+	testTable := []struct {
+		test     string
+		now      time.Time
+		expected bool
+	}{
+		{test: "Before", now: settlementDate.Add(-time.Second), expected: false},
+		{test: "OnTheDate", now: settlementDate, expected: true},
+		{test: "After", now: settlementDate.Add(time.Hour), expected: true},
+	}
+	for _, table := range testTable {
+		t.Run(table.test, func(t *testing.T) {
+			if entity.IsDue(table.now) != table.expected {
+				t.Errorf("is due is %v, expected %v", !table.expected, table.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package settlementsgin
+
+import (
+	"home-broker/core"
+	"home-broker/settlements"
+	"home-broker/users"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	apiErrorInvalidUserID = core.NewAPIError("Invalid user ID.", 400)
+)
+
+// SettlementController represents a settlement controller.
+type SettlementController struct {
+	uc settlements.SettlementUseCases
+}
+
+// NewSettlementController creates a new SettlementController.
+func NewSettlementController(uc settlements.SettlementUseCases) SettlementController {
+	return SettlementController{uc: uc}
+}
+
+// GetUserSettlements returns the last settlements of an user, the newest first (query "status" filters them).
+func (settlementC SettlementController) GetUserSettlements(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.Error(apiErrorInvalidUserID)
+		return
+	}
+	entities, err := settlementC.uc.GetUserSettlements(users.UserID(userID), settlements.SettlementStatus(c.Query("status")))
+	if err != nil {
+		errVal, ok := err.(core.ErrValidation)
+		if ok {
+			c.Error(core.NewAPIErrorFromErrValidation(errVal))
+			return
+		}
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, entities)
+}
@@ -0,0 +1,26 @@
+package settlementsgin
+
+import (
+	"home-broker/settlements"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SettlementRouter represents a settlements router.
+type SettlementRouter struct {
+	uc settlements.SettlementUseCases
+}
+
+// NewSettlementRouter creates a new Router.
+func NewSettlementRouter(uc settlements.SettlementUseCases) SettlementRouter {
+	return SettlementRouter{uc: uc}
+}
+
+// SetupRouter setups settlements router.
+func (sr SettlementRouter) SetupRouter(router *gin.Engine) {
+	settlementC := NewSettlementController(sr.uc)
+	v1 := router.Group("/api/v1/settlements")
+	{
+		v1.GET("users/:user_id/", settlementC.GetUserSettlements)
+	}
+}
@@ -0,0 +1,234 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"home-broker/assets"
+	assetspostgresql "home-broker/assets/implem/postgresql"
+	assetwalletspostgresql "home-broker/assetwallets/implem/postgresql"
+	"home-broker/core"
+	"home-broker/core/implem/postgresql"
+	"home-broker/money"
+	"home-broker/settlements"
+	"home-broker/users"
+	userspostgresql "home-broker/users/implem/postgresql"
+	walletspostgresql "home-broker/wallets/implem/postgresql"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SettlementModel is the ORM version of Settlement entity.
+type SettlementModel struct {
+	gorm.Model
+	ID             int64        `gorm:"primaryKey;autoIncrement:true"`
+	UserID         users.UserID `gorm:"not null;index"`
+	User           userspostgresql.UserModel
+	AssetID        assets.AssetID `gorm:"not null"`
+	Asset          assetspostgresql.AssetModel
+	Funds          money.Money                  `gorm:"not null;default:0"` // Mind the money.MoneyDecimalPlaces.
+	Assets         assets.AssetUnit             `gorm:"not null;default:0"`
+	Reference      string                       `gorm:"not null;default:''"`
+	TradeDate      time.Time                    `gorm:"not null"`
+	SettlementDate time.Time                    `gorm:"not null;index:idx_settlement_due"`
+	Status         settlements.SettlementStatus `gorm:"not null;index:idx_settlement_due"`
+	SettledAt      *time.Time
+	CreatedAt      time.Time      `gorm:"not null;index:,sort:desc"`
+	UpdatedAt      time.Time      `gorm:"not null;index:,sort:desc"`
+	DeletedAt      gorm.DeletedAt `gorm:"index:,sort:desc"`
+}
+
+// TableName returns the real table name of Settlement.
+// It is used by GORM to perfom operations on settlement table (queries, migrations, etc.).
+func (SettlementModel) TableName() string {
+	return "settlement"
+}
+
+// SettlementDB handles database commands for settlement table.
+type SettlementDB struct {
+	settlements.SettlementDBInterface
+	db postgresql.DB
+}
+
+// NewSettlementDB creates a new SettlementDB.
+func NewSettlementDB(db postgresql.DB) SettlementDB {
+	return SettlementDB{db: db}
+}
+
+// WithTx returns a copy of the handler that runs its commands inside a transaction.
+func (settlementDB SettlementDB) WithTx(tx core.Tx) settlements.SettlementDBInterface {
+	return NewSettlementDB(settlementDB.db.WithTx(tx))
+}
+
+// ToEntity returns a Settlement entity from the ORM model.
+func (SettlementDB) ToEntity(model SettlementModel) settlements.Settlement {
+	settledAt := time.Time{} // A "time.Time" with zero value represents a "null".
+	if model.SettledAt != nil {
+		settledAt = *model.SettledAt
+	}
+	return settlements.Settlement{
+		ID:             settlements.SettlementID(model.ID),
+		UserID:         model.UserID,
+		AssetID:        model.AssetID,
+		Funds:          model.Funds,
+		Assets:         model.Assets,
+		Reference:      model.Reference,
+		TradeDate:      model.TradeDate,
+		SettlementDate: model.SettlementDate,
+		Status:         model.Status,
+		SettledAt:      settledAt,
+		CreatedAt:      model.CreatedAt,
+		UpdatedAt:      model.UpdatedAt,
+	}
+}
+
+// ToModel returns a GORM model from a Settlement entity.
+func (SettlementDB) ToModel(entity settlements.Settlement) SettlementModel {
+	var settledAt *time.Time
+	if !entity.SettledAt.IsZero() {
+		settledAt = &entity.SettledAt
+	}
+	return SettlementModel{
+		ID:             int64(entity.ID),
+		UserID:         entity.UserID,
+		AssetID:        entity.AssetID,
+		Funds:          entity.Funds,
+		Assets:         entity.Assets,
+		Reference:      entity.Reference,
+		TradeDate:      entity.TradeDate,
+		SettlementDate: entity.SettlementDate,
+		Status:         entity.Status,
+		SettledAt:      settledAt,
+		CreatedAt:      entity.CreatedAt,
+		UpdatedAt:      entity.UpdatedAt,
+	}
+}
+
+// addPending adds the funds and assets of a settlement to the pending balances of the user wallets.
+func addPending(tx *gorm.DB, entity settlements.Settlement) error {
+	if entity.Funds != 0 {
+		if err := walletspostgresql.AddPendingFunds(tx, entity.UserID, entity.Funds); err != nil {
+			return err
+		}
+	}
+	if entity.Assets != 0 {
+		if err := assetwalletspostgresql.AddPendingAssets(tx, entity.UserID, entity.AssetID, entity.Assets); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settlePending moves the funds and assets of a settlement from the pending balances to the balances of the user wallets.
+func settlePending(tx *gorm.DB, entity settlements.Settlement) error {
+	if entity.Funds != 0 {
+		if err := walletspostgresql.SettlePendingFunds(tx, entity.UserID, entity.Funds); err != nil {
+			return err
+		}
+	}
+	if entity.Assets != 0 {
+		if err := assetwalletspostgresql.SettlePendingAssets(tx, entity.UserID, entity.AssetID, entity.Assets); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Insert inserts a settlement and adds its funds and assets to the pending balances of the user wallets.
+// The funds and assets of a "settled" settlement go straight to the balances.
+// A nil entity will be returned if an error occurs (nothing is changed).
+// The following errors can happen: ErrWalletDoesNotExist, ErrAssetWalletDoesNotExist.
+func (settlementDB SettlementDB) Insert(entity settlements.Settlement) (*settlements.Settlement, error) {
+	model := settlementDB.ToModel(entity)
+	err := settlementDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if res := tx.Create(&model); res.Error != nil {
+			return res.Error
+		}
+		if err := addPending(tx, entity); err != nil {
+			return err
+		}
+		if entity.Status == settlements.SettlementStatusSettled {
+			return settlePending(tx, entity)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	newEntity := settlementDB.ToEntity(model)
+	return &newEntity, nil
+}
+
+// GetDue returns up to "limit" pending settlements with a settlement date up to "now", the oldest first.
+func (settlementDB SettlementDB) GetDue(now time.Time, limit int) ([]settlements.Settlement, error) {
+	models := []SettlementModel{}
+	res := settlementDB.db.GetDB().
+		Where(`"status"=? AND "settlement_date"<=?`, settlements.SettlementStatusPending, now).
+		Order(`"settlement_date", "id"`).
+		Limit(limit).
+		Find(&models)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	entities := make([]settlements.Settlement, 0, len(models))
+	for _, model := range models {
+		entities = append(entities, settlementDB.ToEntity(model))
+	}
+	return entities, nil
+}
+
+// GetByUserID returns up to "limit" settlements of an user, the newest first.
+// An empty status returns all the settlements.
+func (settlementDB SettlementDB) GetByUserID(userID users.UserID, status settlements.SettlementStatus, limit int) ([]settlements.Settlement, error) {
+	models := []SettlementModel{}
+	query := settlementDB.db.GetDB().Where(`"user_id"=?`, userID)
+	if status != "" {
+		query = query.Where(`"status"=?`, status)
+	}
+	res := query.Order(`"id" DESC`).Limit(limit).Find(&models)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	entities := make([]settlements.Settlement, 0, len(models))
+	for _, model := range models {
+		entities = append(entities, settlementDB.ToEntity(model))
+	}
+	return entities, nil
+}
+
+// Settle changes a pending settlement to "settled" and moves its funds and assets from the pending balances
+// to the balances of the user wallets. The settlement row is locked, so concurrent jobs settle it only once.
+// It returns false if the settlement is not pending anymore.
+func (settlementDB SettlementDB) Settle(id settlements.SettlementID, now time.Time) (bool, error) {
+	settled := false
+	err := settlementDB.db.GetDB().Transaction(func(tx *gorm.DB) error {
+		model := SettlementModel{}
+		res := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(`"id"=? AND "status"=?`, id, settlements.SettlementStatusPending).
+			Take(&model)
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if res.Error != nil {
+			return res.Error
+		}
+		res = tx.Model(&model).Updates(map[string]interface{}{
+			"status":     settlements.SettlementStatusSettled,
+			"settled_at": now,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if err := settlePending(tx, settlementDB.ToEntity(model)); err != nil {
+			return fmt.Errorf("settlement %d: %w", id, err)
+		}
+		settled = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return settled, nil
+}
@@ -0,0 +1,68 @@
+package postgresql_test
+
+import (
+	"home-broker/money"
+	"home-broker/settlements"
+	settlementspostgresql "home-broker/settlements/implem/postgresql"
+	postgresqltests "home-broker/tests/postgresql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSettle(t *testing.T) {
+	mainDB, mock, err := postgresqltests.GetMockedDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := settlementspostgresql.NewSettlementDB(mainDB)
+	now := time.Now()
+	columns := []string{"id", "user_id", "asset_id", "funds", "assets", "reference", "trade_date", "settlement_date", "status", "settled_at", "created_at", "updated_at", "deleted_at"}
+
+	t.Run("SettlementIsPending_FundsMovedToBalance", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT \* FROM "settlement" WHERE \("id"=\$1 AND "status"=\$2\) .+FOR UPDATE`).
+			WithArgs(settlements.SettlementID(1), settlements.SettlementStatusPending).
+			WillReturnRows(mock.NewRows(columns).
+				AddRow(1, 1, "VIBR", money.Money(1000000), 0, "", now, now, settlements.SettlementStatusPending, nil, now, now, nil))
+		mock.ExpectExec(`UPDATE "settlement" SET .+"status"=.+WHERE "id" = \$4`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE "wallet" SET "balance"="balance"\+\$1,"pending"="pending"-\$2,.+"user_id"=\$4`).
+			WithArgs(money.Money(1000000), money.Money(1000000), sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		settled, err := db.Settle(1, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !settled {
+			t.Error("settlement not settled, expected as settled")
+		}
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("SettlementIsNotPending_NothingChanged", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT \* FROM "settlement" WHERE \("id"=\$1 AND "status"=\$2\) .+FOR UPDATE`).
+			WithArgs(settlements.SettlementID(2), settlements.SettlementStatusPending).
+			WillReturnRows(mock.NewRows(columns))
+		mock.ExpectCommit()
+
+		settled, err := db.Settle(2, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if settled {
+			t.Error("settlement settled, expected as not settled")
+		}
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package settlements
+
+import (
+	"home-broker/assets"
+	"home-broker/calendars"
+	"home-broker/core"
+	"home-broker/money"
+	"home-broker/users"
+	"log"
+	"time"
+)
+
+const (
+	// settlementBatchSize is the number of settlements read on each run of the settlement job.
+	settlementBatchSize = 100
+
+	// userSettlementsLimit is the number of settlements returned for an user.
+	userSettlementsLimit = 100
+)
+
+// SettlementUseCases represents the settlement use cases.
+type SettlementUseCases struct {
+	db         SettlementDBInterface
+	assetUC    assets.AssetUseCases
+	calendarUC calendars.CalendarUseCases
+}
+
+// NewSettlementUseCases returns a new SettlementUseCases.
+func NewSettlementUseCases(db SettlementDBInterface, assetUC assets.AssetUseCases, calendarUC calendars.CalendarUseCases) SettlementUseCases {
+	return SettlementUseCases{db: db, assetUC: assetUC, calendarUC: calendarUC}
+}
+
+// WithTx returns a copy of the use cases whose settlement commands run inside a transaction (see core.UnitOfWork).
+func (uc SettlementUseCases) WithTx(tx core.Tx) SettlementUseCases {
+	return SettlementUseCases{db: uc.db.WithTx(tx), assetUC: uc.assetUC, calendarUC: uc.calendarUC}
+}
+
+// ScheduleTrade records the funds and assets that an user receives from a trade of an asset.
+// They settle on the settlement date of the asset exchange (see calendars.Calendar.SettlementDate)
+// and stay pending on the wallets until then. A trade already due (ex: T+0) is settled right away.
+func (uc SettlementUseCases) ScheduleTrade(userID users.UserID, assetID assets.AssetID, funds money.Money, amount assets.AssetUnit, tradeTime time.Time, reference string) (*Settlement, error) {
+	asset, err := uc.assetUC.GetAsset(assetID)
+	if err != nil {
+		return nil, err
+	}
+	if asset == nil {
+		return nil, core.NewErrValidation("Asset does not exist.")
+	}
+	now := time.Now()
+	if tradeTime.IsZero() {
+		tradeTime = now
+	}
+	entity := NewSettlement(userID, assetID, funds, amount, reference, tradeTime, uc.calendarUC.SettlementDate(asset.ExchangeID, tradeTime))
+	if entity.IsDue(now) {
+		entity.Status = SettlementStatusSettled
+		entity.SettledAt = now
+	}
+	return uc.db.Insert(entity)
+}
+
+// GetUserSettlements returns the last settlements of an user, the newest first.
+// An empty status returns all the settlements.
+func (uc SettlementUseCases) GetUserSettlements(userID users.UserID, status SettlementStatus) ([]Settlement, error) {
+	if userID <= 0 {
+		return nil, core.NewErrValidation("Invalid user ID.")
+	}
+	if status != "" && status != SettlementStatusPending && status != SettlementStatusSettled {
+		return nil, core.NewErrValidation("Invalid status.")
+	}
+	return uc.db.GetByUserID(userID, status, userSettlementsLimit)
+}
+
+// SettleDue settles up to "limit" pending settlements whose settlement date was reached at "now".
+// It returns the number of settled settlements.
+func (uc SettlementUseCases) SettleDue(now time.Time, limit int) (int, error) {
+	entities, err := uc.db.GetDue(now, limit)
+	if err != nil {
+		return 0, err
+	}
+	settled := 0
+	for _, entity := range entities {
+		ok, err := uc.db.Settle(entity.ID, now)
+		if err != nil {
+			log.Printf("error to settle the settlement %v (user %v): %v\n", entity.ID, entity.UserID, err)
+			continue
+		}
+		if ok {
+			settled++
+		}
+	}
+	return settled, nil
+}
+
+// RunSettlementJob settles the due settlements every "interval" until "stop" is closed.
+func (uc SettlementUseCases) RunSettlementJob(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			settled, err := uc.SettleDue(time.Now(), settlementBatchSize)
+			if err != nil {
+				log.Printf("error to read the due settlements: %v\n", err)
+			}
+			if settled < settlementBatchSize {
+				break
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
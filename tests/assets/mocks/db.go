@@ -0,0 +1,64 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./assets/db.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	gomock "github.com/golang/mock/gomock"
+	assets "home-broker/assets"
+	reflect "reflect"
+)
+
+// MockAssetDBInterface is a mock of AssetDBInterface interface
+type MockAssetDBInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockAssetDBInterfaceMockRecorder
+}
+
+// MockAssetDBInterfaceMockRecorder is the mock recorder for MockAssetDBInterface
+type MockAssetDBInterfaceMockRecorder struct {
+	mock *MockAssetDBInterface
+}
+
+// NewMockAssetDBInterface creates a new mock instance
+func NewMockAssetDBInterface(ctrl *gomock.Controller) *MockAssetDBInterface {
+	mock := &MockAssetDBInterface{ctrl: ctrl}
+	mock.recorder = &MockAssetDBInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockAssetDBInterface) EXPECT() *MockAssetDBInterfaceMockRecorder {
+	return m.recorder
+}
+
+// GetByID mocks base method
+func (m *MockAssetDBInterface) GetByID(id assets.AssetID) (*assets.Asset, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByID", id)
+	ret0, _ := ret[0].(*assets.Asset)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByID indicates an expected call of GetByID
+func (mr *MockAssetDBInterfaceMockRecorder) GetByID(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockAssetDBInterface)(nil).GetByID), id)
+}
+
+// Insert mocks base method
+func (m *MockAssetDBInterface) Insert(entity assets.Asset) (*assets.Asset, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Insert", entity)
+	ret0, _ := ret[0].(*assets.Asset)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Insert indicates an expected call of Insert
+func (mr *MockAssetDBInterfaceMockRecorder) Insert(entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockAssetDBInterface)(nil).Insert), entity)
+}
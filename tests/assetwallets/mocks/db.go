@@ -0,0 +1,152 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./assetwallets/db.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	gomock "github.com/golang/mock/gomock"
+	assets "home-broker/assets"
+	assetwallets "home-broker/assetwallets"
+	core "home-broker/core"
+	users "home-broker/users"
+	reflect "reflect"
+)
+
+// MockAssetWalletDBInterface is a mock of AssetWalletDBInterface interface
+type MockAssetWalletDBInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockAssetWalletDBInterfaceMockRecorder
+}
+
+// MockAssetWalletDBInterfaceMockRecorder is the mock recorder for MockAssetWalletDBInterface
+type MockAssetWalletDBInterfaceMockRecorder struct {
+	mock *MockAssetWalletDBInterface
+}
+
+// NewMockAssetWalletDBInterface creates a new mock instance
+func NewMockAssetWalletDBInterface(ctrl *gomock.Controller) *MockAssetWalletDBInterface {
+	mock := &MockAssetWalletDBInterface{ctrl: ctrl}
+	mock.recorder = &MockAssetWalletDBInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockAssetWalletDBInterface) EXPECT() *MockAssetWalletDBInterfaceMockRecorder {
+	return m.recorder
+}
+
+// GetByUserIDAssetID mocks base method
+func (m *MockAssetWalletDBInterface) GetByUserIDAssetID(userID users.UserID, assetID assets.AssetID) (*assetwallets.AssetWallet, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByUserIDAssetID", userID, assetID)
+	ret0, _ := ret[0].(*assetwallets.AssetWallet)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByUserIDAssetID indicates an expected call of GetByUserIDAssetID
+func (mr *MockAssetWalletDBInterfaceMockRecorder) GetByUserIDAssetID(userID, assetID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByUserIDAssetID", reflect.TypeOf((*MockAssetWalletDBInterface)(nil).GetByUserIDAssetID), userID, assetID)
+}
+
+// Insert mocks base method
+func (m *MockAssetWalletDBInterface) Insert(entity assetwallets.AssetWallet) (*assetwallets.AssetWallet, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Insert", entity)
+	ret0, _ := ret[0].(*assetwallets.AssetWallet)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Insert indicates an expected call of Insert
+func (mr *MockAssetWalletDBInterfaceMockRecorder) Insert(entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockAssetWalletDBInterface)(nil).Insert), entity)
+}
+
+// IncBalanceByUserIDAssetID mocks base method
+func (m *MockAssetWalletDBInterface) IncBalanceByUserIDAssetID(userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit) (*assetwallets.AssetWallet, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncBalanceByUserIDAssetID", userID, assetID, amount)
+	ret0, _ := ret[0].(*assetwallets.AssetWallet)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncBalanceByUserIDAssetID indicates an expected call of IncBalanceByUserIDAssetID
+func (mr *MockAssetWalletDBInterfaceMockRecorder) IncBalanceByUserIDAssetID(userID, assetID, amount interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncBalanceByUserIDAssetID", reflect.TypeOf((*MockAssetWalletDBInterface)(nil).IncBalanceByUserIDAssetID), userID, assetID, amount)
+}
+
+// HoldAssets mocks base method
+func (m *MockAssetWalletDBInterface) HoldAssets(userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HoldAssets", userID, assetID, amount)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HoldAssets indicates an expected call of HoldAssets
+func (mr *MockAssetWalletDBInterfaceMockRecorder) HoldAssets(userID, assetID, amount interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HoldAssets", reflect.TypeOf((*MockAssetWalletDBInterface)(nil).HoldAssets), userID, assetID, amount)
+}
+
+// HoldPendingAssets mocks base method
+func (m *MockAssetWalletDBInterface) HoldPendingAssets(userID users.UserID, assetID assets.AssetID, amount assets.AssetUnit) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HoldPendingAssets", userID, assetID, amount)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HoldPendingAssets indicates an expected call of HoldPendingAssets
+func (mr *MockAssetWalletDBInterfaceMockRecorder) HoldPendingAssets(userID, assetID, amount interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HoldPendingAssets", reflect.TypeOf((*MockAssetWalletDBInterface)(nil).HoldPendingAssets), userID, assetID, amount)
+}
+
+// ReleaseAssets mocks base method
+func (m *MockAssetWalletDBInterface) ReleaseAssets(userID users.UserID, assetID assets.AssetID, amount, debit assets.AssetUnit) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseAssets", userID, assetID, amount, debit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseAssets indicates an expected call of ReleaseAssets
+func (mr *MockAssetWalletDBInterfaceMockRecorder) ReleaseAssets(userID, assetID, amount, debit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseAssets", reflect.TypeOf((*MockAssetWalletDBInterface)(nil).ReleaseAssets), userID, assetID, amount, debit)
+}
+
+// ReleasePendingAssets mocks base method
+func (m *MockAssetWalletDBInterface) ReleasePendingAssets(userID users.UserID, assetID assets.AssetID, amount, debit assets.AssetUnit) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleasePendingAssets", userID, assetID, amount, debit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleasePendingAssets indicates an expected call of ReleasePendingAssets
+func (mr *MockAssetWalletDBInterfaceMockRecorder) ReleasePendingAssets(userID, assetID, amount, debit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleasePendingAssets", reflect.TypeOf((*MockAssetWalletDBInterface)(nil).ReleasePendingAssets), userID, assetID, amount, debit)
+}
+
+// WithTx mocks base method
+func (m *MockAssetWalletDBInterface) WithTx(tx core.Tx) assetwallets.AssetWalletDBInterface {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithTx", tx)
+	ret0, _ := ret[0].(assetwallets.AssetWalletDBInterface)
+	return ret0
+}
+
+// WithTx indicates an expected call of WithTx
+func (mr *MockAssetWalletDBInterfaceMockRecorder) WithTx(tx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithTx", reflect.TypeOf((*MockAssetWalletDBInterface)(nil).WithTx), tx)
+}
@@ -0,0 +1,110 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./fees/db.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	gomock "github.com/golang/mock/gomock"
+	assets "home-broker/assets"
+	fees "home-broker/fees"
+	users "home-broker/users"
+	reflect "reflect"
+)
+
+// MockFeeDBInterface is a mock of FeeDBInterface interface
+type MockFeeDBInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockFeeDBInterfaceMockRecorder
+}
+
+// MockFeeDBInterfaceMockRecorder is the mock recorder for MockFeeDBInterface
+type MockFeeDBInterfaceMockRecorder struct {
+	mock *MockFeeDBInterface
+}
+
+// NewMockFeeDBInterface creates a new mock instance
+func NewMockFeeDBInterface(ctrl *gomock.Controller) *MockFeeDBInterface {
+	mock := &MockFeeDBInterface{ctrl: ctrl}
+	mock.recorder = &MockFeeDBInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockFeeDBInterface) EXPECT() *MockFeeDBInterfaceMockRecorder {
+	return m.recorder
+}
+
+// GetSchedule mocks base method
+func (m *MockFeeDBInterface) GetSchedule(assetID assets.AssetID, tier fees.Tier) (*fees.FeeSchedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSchedule", assetID, tier)
+	ret0, _ := ret[0].(*fees.FeeSchedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSchedule indicates an expected call of GetSchedule
+func (mr *MockFeeDBInterfaceMockRecorder) GetSchedule(assetID, tier interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSchedule", reflect.TypeOf((*MockFeeDBInterface)(nil).GetSchedule), assetID, tier)
+}
+
+// GetSchedules mocks base method
+func (m *MockFeeDBInterface) GetSchedules(assetID assets.AssetID, tier fees.Tier) ([]fees.FeeSchedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSchedules", assetID, tier)
+	ret0, _ := ret[0].([]fees.FeeSchedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSchedules indicates an expected call of GetSchedules
+func (mr *MockFeeDBInterfaceMockRecorder) GetSchedules(assetID, tier interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSchedules", reflect.TypeOf((*MockFeeDBInterface)(nil).GetSchedules), assetID, tier)
+}
+
+// Upsert mocks base method
+func (m *MockFeeDBInterface) Upsert(entity fees.FeeSchedule) (*fees.FeeSchedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upsert", entity)
+	ret0, _ := ret[0].(*fees.FeeSchedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Upsert indicates an expected call of Upsert
+func (mr *MockFeeDBInterfaceMockRecorder) Upsert(entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upsert", reflect.TypeOf((*MockFeeDBInterface)(nil).Upsert), entity)
+}
+
+// GetUserTier mocks base method
+func (m *MockFeeDBInterface) GetUserTier(userID users.UserID) (fees.Tier, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserTier", userID)
+	ret0, _ := ret[0].(fees.Tier)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserTier indicates an expected call of GetUserTier
+func (mr *MockFeeDBInterfaceMockRecorder) GetUserTier(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserTier", reflect.TypeOf((*MockFeeDBInterface)(nil).GetUserTier), userID)
+}
+
+// SetUserTier mocks base method
+func (m *MockFeeDBInterface) SetUserTier(userID users.UserID, tier fees.Tier) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserTier", userID, tier)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserTier indicates an expected call of SetUserTier
+func (mr *MockFeeDBInterfaceMockRecorder) SetUserTier(userID, tier interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserTier", reflect.TypeOf((*MockFeeDBInterface)(nil).SetUserTier), userID, tier)
+}
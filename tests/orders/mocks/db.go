@@ -0,0 +1,553 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./orders/db.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	gomock "github.com/golang/mock/gomock"
+	assets "home-broker/assets"
+	core "home-broker/core"
+	money "home-broker/money"
+	orders "home-broker/orders"
+	users "home-broker/users"
+	reflect "reflect"
+	time "time"
+)
+
+// MockOrderDBInterface is a mock of OrderDBInterface interface
+type MockOrderDBInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockOrderDBInterfaceMockRecorder
+}
+
+// MockOrderDBInterfaceMockRecorder is the mock recorder for MockOrderDBInterface
+type MockOrderDBInterfaceMockRecorder struct {
+	mock *MockOrderDBInterface
+}
+
+// NewMockOrderDBInterface creates a new mock instance
+func NewMockOrderDBInterface(ctrl *gomock.Controller) *MockOrderDBInterface {
+	mock := &MockOrderDBInterface{ctrl: ctrl}
+	mock.recorder = &MockOrderDBInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockOrderDBInterface) EXPECT() *MockOrderDBInterfaceMockRecorder {
+	return m.recorder
+}
+
+// GetByID mocks base method
+func (m *MockOrderDBInterface) GetByID(id orders.OrderID) (*orders.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByID", id)
+	ret0, _ := ret[0].(*orders.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByID indicates an expected call of GetByID
+func (mr *MockOrderDBInterfaceMockRecorder) GetByID(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByID", reflect.TypeOf((*MockOrderDBInterface)(nil).GetByID), id)
+}
+
+// GetByExternalIDAssetID mocks base method
+func (m *MockOrderDBInterface) GetByExternalIDAssetID(externalID orders.ExternalOrderID, assetID assets.AssetID) (*orders.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByExternalIDAssetID", externalID, assetID)
+	ret0, _ := ret[0].(*orders.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByExternalIDAssetID indicates an expected call of GetByExternalIDAssetID
+func (mr *MockOrderDBInterfaceMockRecorder) GetByExternalIDAssetID(externalID, assetID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByExternalIDAssetID", reflect.TypeOf((*MockOrderDBInterface)(nil).GetByExternalIDAssetID), externalID, assetID)
+}
+
+// GetByUserIDClientOrderID mocks base method
+func (m *MockOrderDBInterface) GetByUserIDClientOrderID(userID users.UserID, clientOrderID string) (*orders.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByUserIDClientOrderID", userID, clientOrderID)
+	ret0, _ := ret[0].(*orders.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByUserIDClientOrderID indicates an expected call of GetByUserIDClientOrderID
+func (mr *MockOrderDBInterfaceMockRecorder) GetByUserIDClientOrderID(userID, clientOrderID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByUserIDClientOrderID", reflect.TypeOf((*MockOrderDBInterface)(nil).GetByUserIDClientOrderID), userID, clientOrderID)
+}
+
+// Search mocks base method
+func (m *MockOrderDBInterface) Search(filter orders.OrderFilter) ([]orders.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", filter)
+	ret0, _ := ret[0].([]orders.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search
+func (mr *MockOrderDBInterfaceMockRecorder) Search(filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockOrderDBInterface)(nil).Search), filter)
+}
+
+// Insert mocks base method
+func (m *MockOrderDBInterface) Insert(entity orders.Order) (*orders.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Insert", entity)
+	ret0, _ := ret[0].(*orders.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Insert indicates an expected call of Insert
+func (mr *MockOrderDBInterfaceMockRecorder) Insert(entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockOrderDBInterface)(nil).Insert), entity)
+}
+
+// InsertWithOutbox mocks base method
+func (m *MockOrderDBInterface) InsertWithOutbox(entity orders.Order, action orders.OutboxAction) (*orders.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertWithOutbox", entity, action)
+	ret0, _ := ret[0].(*orders.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertWithOutbox indicates an expected call of InsertWithOutbox
+func (mr *MockOrderDBInterfaceMockRecorder) InsertWithOutbox(entity, action interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertWithOutbox", reflect.TypeOf((*MockOrderDBInterface)(nil).InsertWithOutbox), entity, action)
+}
+
+// InsertGroup mocks base method
+func (m *MockOrderDBInterface) InsertGroup(entity orders.OrderGroup) (*orders.OrderGroup, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertGroup", entity)
+	ret0, _ := ret[0].(*orders.OrderGroup)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertGroup indicates an expected call of InsertGroup
+func (mr *MockOrderDBInterfaceMockRecorder) InsertGroup(entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertGroup", reflect.TypeOf((*MockOrderDBInterface)(nil).InsertGroup), entity)
+}
+
+// GetOrderGroup mocks base method
+func (m *MockOrderDBInterface) GetOrderGroup(id orders.OrderGroupID) (*orders.OrderGroup, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrderGroup", id)
+	ret0, _ := ret[0].(*orders.OrderGroup)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrderGroup indicates an expected call of GetOrderGroup
+func (mr *MockOrderDBInterfaceMockRecorder) GetOrderGroup(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderGroup", reflect.TypeOf((*MockOrderDBInterface)(nil).GetOrderGroup), id)
+}
+
+// GetWaitingStopOrders mocks base method
+func (m *MockOrderDBInterface) GetWaitingStopOrders(assetID assets.AssetID) ([]orders.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWaitingStopOrders", assetID)
+	ret0, _ := ret[0].([]orders.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWaitingStopOrders indicates an expected call of GetWaitingStopOrders
+func (mr *MockOrderDBInterfaceMockRecorder) GetWaitingStopOrders(assetID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWaitingStopOrders", reflect.TypeOf((*MockOrderDBInterface)(nil).GetWaitingStopOrders), assetID)
+}
+
+// MoveGroupHolds mocks base method
+func (m *MockOrderDBInterface) MoveGroupHolds(orderID orders.OrderID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MoveGroupHolds", orderID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MoveGroupHolds indicates an expected call of MoveGroupHolds
+func (mr *MockOrderDBInterfaceMockRecorder) MoveGroupHolds(orderID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MoveGroupHolds", reflect.TypeOf((*MockOrderDBInterface)(nil).MoveGroupHolds), orderID)
+}
+
+// ReleaseHolds mocks base method
+func (m *MockOrderDBInterface) ReleaseHolds(orderID orders.OrderID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseHolds", orderID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseHolds indicates an expected call of ReleaseHolds
+func (mr *MockOrderDBInterfaceMockRecorder) ReleaseHolds(orderID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseHolds", reflect.TypeOf((*MockOrderDBInterface)(nil).ReleaseHolds), orderID)
+}
+
+// ConsumeHeldFunds mocks base method
+func (m *MockOrderDBInterface) ConsumeHeldFunds(orderID orders.OrderID, amount, cost money.Money) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeHeldFunds", orderID, amount, cost)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConsumeHeldFunds indicates an expected call of ConsumeHeldFunds
+func (mr *MockOrderDBInterfaceMockRecorder) ConsumeHeldFunds(orderID, amount, cost interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeHeldFunds", reflect.TypeOf((*MockOrderDBInterface)(nil).ConsumeHeldFunds), orderID, amount, cost)
+}
+
+// ConsumeHeldAssets mocks base method
+func (m *MockOrderDBInterface) ConsumeHeldAssets(orderID orders.OrderID, amount assets.AssetUnit) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeHeldAssets", orderID, amount)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConsumeHeldAssets indicates an expected call of ConsumeHeldAssets
+func (mr *MockOrderDBInterfaceMockRecorder) ConsumeHeldAssets(orderID, amount interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeHeldAssets", reflect.TypeOf((*MockOrderDBInterface)(nil).ConsumeHeldAssets), orderID, amount)
+}
+
+// AdjustHolds mocks base method
+func (m *MockOrderDBInterface) AdjustHolds(orderID orders.OrderID, funds money.Money, assets assets.AssetUnit) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AdjustHolds", orderID, funds, assets)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AdjustHolds indicates an expected call of AdjustHolds
+func (mr *MockOrderDBInterfaceMockRecorder) AdjustHolds(orderID, funds, assets interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustHolds", reflect.TypeOf((*MockOrderDBInterface)(nil).AdjustHolds), orderID, funds, assets)
+}
+
+// AdjustExitHolds mocks base method
+func (m *MockOrderDBInterface) AdjustExitHolds(orderID orders.OrderID, funds money.Money, assets assets.AssetUnit) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AdjustExitHolds", orderID, funds, assets)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AdjustExitHolds indicates an expected call of AdjustExitHolds
+func (mr *MockOrderDBInterfaceMockRecorder) AdjustExitHolds(orderID, funds, assets interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustExitHolds", reflect.TypeOf((*MockOrderDBInterface)(nil).AdjustExitHolds), orderID, funds, assets)
+}
+
+// RequestReplace mocks base method
+func (m *MockOrderDBInterface) RequestReplace(message orders.OutboxMessage, funds money.Money, assets assets.AssetUnit) (*orders.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequestReplace", message, funds, assets)
+	ret0, _ := ret[0].(*orders.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RequestReplace indicates an expected call of RequestReplace
+func (mr *MockOrderDBInterfaceMockRecorder) RequestReplace(message, funds, assets interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestReplace", reflect.TypeOf((*MockOrderDBInterface)(nil).RequestReplace), message, funds, assets)
+}
+
+// Replace mocks base method
+func (m *MockOrderDBInterface) Replace(entity orders.OrderReplace) (*orders.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Replace", entity)
+	ret0, _ := ret[0].(*orders.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Replace indicates an expected call of Replace
+func (mr *MockOrderDBInterfaceMockRecorder) Replace(entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Replace", reflect.TypeOf((*MockOrderDBInterface)(nil).Replace), entity)
+}
+
+// UpdateExternalResponse mocks base method
+func (m *MockOrderDBInterface) UpdateExternalResponse(externalID orders.ExternalOrderID, externalTimestamp time.Time, change orders.OrderStatusChange) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateExternalResponse", externalID, externalTimestamp, change)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateExternalResponse indicates an expected call of UpdateExternalResponse
+func (mr *MockOrderDBInterfaceMockRecorder) UpdateExternalResponse(externalID, externalTimestamp, change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateExternalResponse", reflect.TypeOf((*MockOrderDBInterface)(nil).UpdateExternalResponse), externalID, externalTimestamp, change)
+}
+
+// SetExternalID mocks base method
+func (m *MockOrderDBInterface) SetExternalID(orderID orders.OrderID, externalID orders.ExternalOrderID, externalTimestamp time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetExternalID", orderID, externalID, externalTimestamp)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetExternalID indicates an expected call of SetExternalID
+func (mr *MockOrderDBInterfaceMockRecorder) SetExternalID(orderID, externalID, externalTimestamp interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetExternalID", reflect.TypeOf((*MockOrderDBInterface)(nil).SetExternalID), orderID, externalID, externalTimestamp)
+}
+
+// ChangeStatus mocks base method
+func (m *MockOrderDBInterface) ChangeStatus(change orders.OrderStatusChange) (*orders.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangeStatus", change)
+	ret0, _ := ret[0].(*orders.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ChangeStatus indicates an expected call of ChangeStatus
+func (mr *MockOrderDBInterfaceMockRecorder) ChangeStatus(change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeStatus", reflect.TypeOf((*MockOrderDBInterface)(nil).ChangeStatus), change)
+}
+
+// ChangeStatusWithOutbox mocks base method
+func (m *MockOrderDBInterface) ChangeStatusWithOutbox(change orders.OrderStatusChange, action orders.OutboxAction) (*orders.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangeStatusWithOutbox", change, action)
+	ret0, _ := ret[0].(*orders.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ChangeStatusWithOutbox indicates an expected call of ChangeStatusWithOutbox
+func (mr *MockOrderDBInterfaceMockRecorder) ChangeStatusWithOutbox(change, action interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeStatusWithOutbox", reflect.TypeOf((*MockOrderDBInterface)(nil).ChangeStatusWithOutbox), change, action)
+}
+
+// RestoreStatus mocks base method
+func (m *MockOrderDBInterface) RestoreStatus(change orders.OrderStatusChange) (*orders.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreStatus", change)
+	ret0, _ := ret[0].(*orders.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreStatus indicates an expected call of RestoreStatus
+func (mr *MockOrderDBInterfaceMockRecorder) RestoreStatus(change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreStatus", reflect.TypeOf((*MockOrderDBInterface)(nil).RestoreStatus), change)
+}
+
+// GetStatusHistory mocks base method
+func (m *MockOrderDBInterface) GetStatusHistory(orderID orders.OrderID) ([]orders.OrderStatusChange, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStatusHistory", orderID)
+	ret0, _ := ret[0].([]orders.OrderStatusChange)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStatusHistory indicates an expected call of GetStatusHistory
+func (mr *MockOrderDBInterfaceMockRecorder) GetStatusHistory(orderID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStatusHistory", reflect.TypeOf((*MockOrderDBInterface)(nil).GetStatusHistory), orderID)
+}
+
+// AddExecution mocks base method
+func (m *MockOrderDBInterface) AddExecution(entity orders.Execution) (*orders.Order, *orders.Execution, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddExecution", entity)
+	ret0, _ := ret[0].(*orders.Order)
+	ret1, _ := ret[1].(*orders.Execution)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// AddExecution indicates an expected call of AddExecution
+func (mr *MockOrderDBInterfaceMockRecorder) AddExecution(entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddExecution", reflect.TypeOf((*MockOrderDBInterface)(nil).AddExecution), entity)
+}
+
+// GetExecutionsByOrderID mocks base method
+func (m *MockOrderDBInterface) GetExecutionsByOrderID(orderID orders.OrderID) ([]orders.Execution, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExecutionsByOrderID", orderID)
+	ret0, _ := ret[0].([]orders.Execution)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExecutionsByOrderID indicates an expected call of GetExecutionsByOrderID
+func (mr *MockOrderDBInterfaceMockRecorder) GetExecutionsByOrderID(orderID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExecutionsByOrderID", reflect.TypeOf((*MockOrderDBInterface)(nil).GetExecutionsByOrderID), orderID)
+}
+
+// GetDueOutboxMessages mocks base method
+func (m *MockOrderDBInterface) GetDueOutboxMessages(now time.Time, limit int) ([]orders.OutboxMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDueOutboxMessages", now, limit)
+	ret0, _ := ret[0].([]orders.OutboxMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDueOutboxMessages indicates an expected call of GetDueOutboxMessages
+func (mr *MockOrderDBInterfaceMockRecorder) GetDueOutboxMessages(now, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDueOutboxMessages", reflect.TypeOf((*MockOrderDBInterface)(nil).GetDueOutboxMessages), now, limit)
+}
+
+// ClaimOutboxMessage mocks base method
+func (m *MockOrderDBInterface) ClaimOutboxMessage(id orders.OutboxMessageID, now, until time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimOutboxMessage", id, now, until)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimOutboxMessage indicates an expected call of ClaimOutboxMessage
+func (mr *MockOrderDBInterfaceMockRecorder) ClaimOutboxMessage(id, now, until interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimOutboxMessage", reflect.TypeOf((*MockOrderDBInterface)(nil).ClaimOutboxMessage), id, now, until)
+}
+
+// UpdateOutboxMessage mocks base method
+func (m *MockOrderDBInterface) UpdateOutboxMessage(entity orders.OutboxMessage) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOutboxMessage", entity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOutboxMessage indicates an expected call of UpdateOutboxMessage
+func (mr *MockOrderDBInterfaceMockRecorder) UpdateOutboxMessage(entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOutboxMessage", reflect.TypeOf((*MockOrderDBInterface)(nil).UpdateOutboxMessage), entity)
+}
+
+// EnqueueOrderBookUpdates mocks base method
+func (m *MockOrderDBInterface) EnqueueOrderBookUpdates(updates []orders.ExternalUpdate) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnqueueOrderBookUpdates", updates)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnqueueOrderBookUpdates indicates an expected call of EnqueueOrderBookUpdates
+func (mr *MockOrderDBInterfaceMockRecorder) EnqueueOrderBookUpdates(updates interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueOrderBookUpdates", reflect.TypeOf((*MockOrderDBInterface)(nil).EnqueueOrderBookUpdates), updates)
+}
+
+// GetOrderBookQueueAssets mocks base method
+func (m *MockOrderDBInterface) GetOrderBookQueueAssets() ([]assets.AssetID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrderBookQueueAssets")
+	ret0, _ := ret[0].([]assets.AssetID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrderBookQueueAssets indicates an expected call of GetOrderBookQueueAssets
+func (mr *MockOrderDBInterfaceMockRecorder) GetOrderBookQueueAssets() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderBookQueueAssets", reflect.TypeOf((*MockOrderDBInterface)(nil).GetOrderBookQueueAssets))
+}
+
+// ClaimOrderBookBatch mocks base method
+func (m *MockOrderDBInterface) ClaimOrderBookBatch(assetID assets.AssetID, now, until time.Time, limit int) ([]orders.OrderBookMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimOrderBookBatch", assetID, now, until, limit)
+	ret0, _ := ret[0].([]orders.OrderBookMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimOrderBookBatch indicates an expected call of ClaimOrderBookBatch
+func (mr *MockOrderDBInterfaceMockRecorder) ClaimOrderBookBatch(assetID, now, until, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimOrderBookBatch", reflect.TypeOf((*MockOrderDBInterface)(nil).ClaimOrderBookBatch), assetID, now, until, limit)
+}
+
+// UpdateOrderBookMessages mocks base method
+func (m *MockOrderDBInterface) UpdateOrderBookMessages(entities []orders.OrderBookMessage) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOrderBookMessages", entities)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOrderBookMessages indicates an expected call of UpdateOrderBookMessages
+func (mr *MockOrderDBInterfaceMockRecorder) UpdateOrderBookMessages(entities interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrderBookMessages", reflect.TypeOf((*MockOrderDBInterface)(nil).UpdateOrderBookMessages), entities)
+}
+
+// GetDeadOrderBookMessages mocks base method
+func (m *MockOrderDBInterface) GetDeadOrderBookMessages(assetID assets.AssetID, limit int) ([]orders.OrderBookMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeadOrderBookMessages", assetID, limit)
+	ret0, _ := ret[0].([]orders.OrderBookMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeadOrderBookMessages indicates an expected call of GetDeadOrderBookMessages
+func (mr *MockOrderDBInterfaceMockRecorder) GetDeadOrderBookMessages(assetID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeadOrderBookMessages", reflect.TypeOf((*MockOrderDBInterface)(nil).GetDeadOrderBookMessages), assetID, limit)
+}
+
+// DeleteOrderBookMessages mocks base method
+func (m *MockOrderDBInterface) DeleteOrderBookMessages(status orders.OrderBookMessageStatus, before time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteOrderBookMessages", status, before)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteOrderBookMessages indicates an expected call of DeleteOrderBookMessages
+func (mr *MockOrderDBInterfaceMockRecorder) DeleteOrderBookMessages(status, before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOrderBookMessages", reflect.TypeOf((*MockOrderDBInterface)(nil).DeleteOrderBookMessages), status, before)
+}
+
+// WithTx mocks base method
+func (m *MockOrderDBInterface) WithTx(tx core.Tx) orders.OrderDBInterface {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithTx", tx)
+	ret0, _ := ret[0].(orders.OrderDBInterface)
+	return ret0
+}
+
+// WithTx indicates an expected call of WithTx
+func (mr *MockOrderDBInterfaceMockRecorder) WithTx(tx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithTx", reflect.TypeOf((*MockOrderDBInterface)(nil).WithTx), tx)
+}
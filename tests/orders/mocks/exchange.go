@@ -0,0 +1,133 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./orders/exchange.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	gomock "github.com/golang/mock/gomock"
+	assets "home-broker/assets"
+	money "home-broker/money"
+	orders "home-broker/orders"
+	reflect "reflect"
+)
+
+// MockExchangeClient is a mock of ExchangeClient interface
+type MockExchangeClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockExchangeClientMockRecorder
+}
+
+// MockExchangeClientMockRecorder is the mock recorder for MockExchangeClient
+type MockExchangeClientMockRecorder struct {
+	mock *MockExchangeClient
+}
+
+// NewMockExchangeClient creates a new mock instance
+func NewMockExchangeClient(ctrl *gomock.Controller) *MockExchangeClient {
+	mock := &MockExchangeClient{ctrl: ctrl}
+	mock.recorder = &MockExchangeClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockExchangeClient) EXPECT() *MockExchangeClientMockRecorder {
+	return m.recorder
+}
+
+// SubmitOrder mocks base method
+func (m *MockExchangeClient) SubmitOrder(order orders.Order) (orders.ExchangeResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubmitOrder", order)
+	ret0, _ := ret[0].(orders.ExchangeResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SubmitOrder indicates an expected call of SubmitOrder
+func (mr *MockExchangeClientMockRecorder) SubmitOrder(order interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubmitOrder", reflect.TypeOf((*MockExchangeClient)(nil).SubmitOrder), order)
+}
+
+// CancelOrder mocks base method
+func (m *MockExchangeClient) CancelOrder(order orders.Order) (orders.ExchangeResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelOrder", order)
+	ret0, _ := ret[0].(orders.ExchangeResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CancelOrder indicates an expected call of CancelOrder
+func (mr *MockExchangeClientMockRecorder) CancelOrder(order interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelOrder", reflect.TypeOf((*MockExchangeClient)(nil).CancelOrder), order)
+}
+
+// ReplaceOrder mocks base method
+func (m *MockExchangeClient) ReplaceOrder(order orders.Order, price money.Money, amount assets.AssetUnit) (orders.ExchangeResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceOrder", order, price, amount)
+	ret0, _ := ret[0].(orders.ExchangeResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReplaceOrder indicates an expected call of ReplaceOrder
+func (mr *MockExchangeClientMockRecorder) ReplaceOrder(order, price, amount interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceOrder", reflect.TypeOf((*MockExchangeClient)(nil).ReplaceOrder), order, price, amount)
+}
+
+// GetOrderStatus mocks base method
+func (m *MockExchangeClient) GetOrderStatus(order orders.Order) (orders.ExchangeResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrderStatus", order)
+	ret0, _ := ret[0].(orders.ExchangeResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrderStatus indicates an expected call of GetOrderStatus
+func (mr *MockExchangeClientMockRecorder) GetOrderStatus(order interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderStatus", reflect.TypeOf((*MockExchangeClient)(nil).GetOrderStatus), order)
+}
+
+// MockExchangeUpdateSource is a mock of ExchangeUpdateSource interface
+type MockExchangeUpdateSource struct {
+	ctrl     *gomock.Controller
+	recorder *MockExchangeUpdateSourceMockRecorder
+}
+
+// MockExchangeUpdateSourceMockRecorder is the mock recorder for MockExchangeUpdateSource
+type MockExchangeUpdateSourceMockRecorder struct {
+	mock *MockExchangeUpdateSource
+}
+
+// NewMockExchangeUpdateSource creates a new mock instance
+func NewMockExchangeUpdateSource(ctrl *gomock.Controller) *MockExchangeUpdateSource {
+	mock := &MockExchangeUpdateSource{ctrl: ctrl}
+	mock.recorder = &MockExchangeUpdateSourceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockExchangeUpdateSource) EXPECT() *MockExchangeUpdateSourceMockRecorder {
+	return m.recorder
+}
+
+// Updates mocks base method
+func (m *MockExchangeUpdateSource) Updates() <-chan orders.ExternalUpdate {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Updates")
+	ret0, _ := ret[0].(<-chan orders.ExternalUpdate)
+	return ret0
+}
+
+// Updates indicates an expected call of Updates
+func (mr *MockExchangeUpdateSourceMockRecorder) Updates() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Updates", reflect.TypeOf((*MockExchangeUpdateSource)(nil).Updates))
+}
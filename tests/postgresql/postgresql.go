@@ -2,7 +2,9 @@ package postgresql
 
 import (
 	"fmt"
+	assetwalletspostgresql "home-broker/assetwallets/implem/postgresql"
 	"home-broker/core/implem/postgresql"
+	orderspostgresql "home-broker/orders/implem/postgresql"
 	testusers "home-broker/tests/users"
 	tests "home-broker/tests/wallets"
 	userspostgresql "home-broker/users/implem/postgresql"
@@ -93,6 +95,8 @@ func GetWalletModel() walletspostgresql.WalletModel {
 		ID:        entity.ID,
 		UserID:    entity.UserID,
 		Balance:   entity.Balance,
+		Held:      entity.Held,
+		Pending:   entity.Pending,
 		CreatedAt: entity.CreatedAt,
 		UpdatedAt: entity.UpdatedAt,
 		DeletedAt: gorm.DeletedAt{Time: time.Time{}, Valid: false},
@@ -119,6 +123,12 @@ func CheckWalletsModelEntity(model walletspostgresql.WalletModel, entity wallets
 	if entity.Balance != model.Balance {
 		return fmt.Errorf("model.Balance is %v, expected %v", model.Balance, entity.Balance)
 	}
+	if entity.Held != model.Held {
+		return fmt.Errorf("model.Held is %v, expected %v", model.Held, entity.Held)
+	}
+	if entity.Pending != model.Pending {
+		return fmt.Errorf("model.Pending is %v, expected %v", model.Pending, entity.Pending)
+	}
 	if model.CreatedAt != entity.CreatedAt {
 		return fmt.Errorf("model.CreatedAt is %v, expected %v", model.CreatedAt, entity.CreatedAt)
 	}
@@ -142,6 +152,15 @@ func CheckWalletsEntityModel(entity wallets.Wallet, model walletspostgresql.Wall
 	if entity.Balance != model.Balance {
 		return fmt.Errorf("wallet.Balance is %v, expected %v", entity.Balance, model.Balance)
 	}
+	if entity.Held != model.Held {
+		return fmt.Errorf("wallet.Held is %v, expected %v", entity.Held, model.Held)
+	}
+	if entity.Available != model.Balance-model.Held {
+		return fmt.Errorf("wallet.Available is %v, expected %v", entity.Available, model.Balance-model.Held)
+	}
+	if entity.Pending != model.Pending {
+		return fmt.Errorf("wallet.Pending is %v, expected %v", entity.Pending, model.Pending)
+	}
 	if entity.CreatedAt != model.CreatedAt {
 		return fmt.Errorf("user.CreatedAt is %v, expected %v", entity.CreatedAt, model.CreatedAt)
 	}
@@ -153,3 +172,14 @@ func CheckWalletsEntityModel(entity wallets.Wallet, model walletspostgresql.Wall
 	}
 	return nil
 }
+
+// GetMockedOrderDB returns a mocked PostgreSQL order DB.
+func GetMockedOrderDB() (orderspostgresql.OrderDB, sqlmock.Sqlmock, error) {
+	db, mock, err := GetMockedDB()
+	if err != nil {
+		return orderspostgresql.OrderDB{}, nil, err
+	}
+	walletDB := walletspostgresql.NewWalletDB(db)
+	assetWalletDB := assetwalletspostgresql.NewAssetWalletDB(db)
+	return orderspostgresql.NewOrderDB(db, walletDB, assetWalletDB), mock, nil
+}
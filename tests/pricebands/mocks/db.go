@@ -0,0 +1,80 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./pricebands/db.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	gomock "github.com/golang/mock/gomock"
+	assets "home-broker/assets"
+	money "home-broker/money"
+	pricebands "home-broker/pricebands"
+	reflect "reflect"
+)
+
+// MockPriceBandDBInterface is a mock of PriceBandDBInterface interface
+type MockPriceBandDBInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockPriceBandDBInterfaceMockRecorder
+}
+
+// MockPriceBandDBInterfaceMockRecorder is the mock recorder for MockPriceBandDBInterface
+type MockPriceBandDBInterfaceMockRecorder struct {
+	mock *MockPriceBandDBInterface
+}
+
+// NewMockPriceBandDBInterface creates a new mock instance
+func NewMockPriceBandDBInterface(ctrl *gomock.Controller) *MockPriceBandDBInterface {
+	mock := &MockPriceBandDBInterface{ctrl: ctrl}
+	mock.recorder = &MockPriceBandDBInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockPriceBandDBInterface) EXPECT() *MockPriceBandDBInterfaceMockRecorder {
+	return m.recorder
+}
+
+// GetByAssetID mocks base method
+func (m *MockPriceBandDBInterface) GetByAssetID(assetID assets.AssetID) (*pricebands.PriceBand, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByAssetID", assetID)
+	ret0, _ := ret[0].(*pricebands.PriceBand)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByAssetID indicates an expected call of GetByAssetID
+func (mr *MockPriceBandDBInterfaceMockRecorder) GetByAssetID(assetID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByAssetID", reflect.TypeOf((*MockPriceBandDBInterface)(nil).GetByAssetID), assetID)
+}
+
+// Upsert mocks base method
+func (m *MockPriceBandDBInterface) Upsert(entity pricebands.PriceBand) (*pricebands.PriceBand, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upsert", entity)
+	ret0, _ := ret[0].(*pricebands.PriceBand)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Upsert indicates an expected call of Upsert
+func (mr *MockPriceBandDBInterfaceMockRecorder) Upsert(entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upsert", reflect.TypeOf((*MockPriceBandDBInterface)(nil).Upsert), entity)
+}
+
+// UpdateReferencePrice mocks base method
+func (m *MockPriceBandDBInterface) UpdateReferencePrice(assetID assets.AssetID, price money.Money) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateReferencePrice", assetID, price)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateReferencePrice indicates an expected call of UpdateReferencePrice
+func (mr *MockPriceBandDBInterfaceMockRecorder) UpdateReferencePrice(assetID, price interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateReferencePrice", reflect.TypeOf((*MockPriceBandDBInterface)(nil).UpdateReferencePrice), assetID, price)
+}
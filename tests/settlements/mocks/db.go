@@ -0,0 +1,111 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./settlements/db.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	gomock "github.com/golang/mock/gomock"
+	core "home-broker/core"
+	settlements "home-broker/settlements"
+	users "home-broker/users"
+	reflect "reflect"
+	time "time"
+)
+
+// MockSettlementDBInterface is a mock of SettlementDBInterface interface
+type MockSettlementDBInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockSettlementDBInterfaceMockRecorder
+}
+
+// MockSettlementDBInterfaceMockRecorder is the mock recorder for MockSettlementDBInterface
+type MockSettlementDBInterfaceMockRecorder struct {
+	mock *MockSettlementDBInterface
+}
+
+// NewMockSettlementDBInterface creates a new mock instance
+func NewMockSettlementDBInterface(ctrl *gomock.Controller) *MockSettlementDBInterface {
+	mock := &MockSettlementDBInterface{ctrl: ctrl}
+	mock.recorder = &MockSettlementDBInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockSettlementDBInterface) EXPECT() *MockSettlementDBInterfaceMockRecorder {
+	return m.recorder
+}
+
+// Insert mocks base method
+func (m *MockSettlementDBInterface) Insert(entity settlements.Settlement) (*settlements.Settlement, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Insert", entity)
+	ret0, _ := ret[0].(*settlements.Settlement)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Insert indicates an expected call of Insert
+func (mr *MockSettlementDBInterfaceMockRecorder) Insert(entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockSettlementDBInterface)(nil).Insert), entity)
+}
+
+// GetDue mocks base method
+func (m *MockSettlementDBInterface) GetDue(now time.Time, limit int) ([]settlements.Settlement, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDue", now, limit)
+	ret0, _ := ret[0].([]settlements.Settlement)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDue indicates an expected call of GetDue
+func (mr *MockSettlementDBInterfaceMockRecorder) GetDue(now, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDue", reflect.TypeOf((*MockSettlementDBInterface)(nil).GetDue), now, limit)
+}
+
+// GetByUserID mocks base method
+func (m *MockSettlementDBInterface) GetByUserID(userID users.UserID, status settlements.SettlementStatus, limit int) ([]settlements.Settlement, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetByUserID", userID, status, limit)
+	ret0, _ := ret[0].([]settlements.Settlement)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetByUserID indicates an expected call of GetByUserID
+func (mr *MockSettlementDBInterfaceMockRecorder) GetByUserID(userID, status, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetByUserID", reflect.TypeOf((*MockSettlementDBInterface)(nil).GetByUserID), userID, status, limit)
+}
+
+// Settle mocks base method
+func (m *MockSettlementDBInterface) Settle(id settlements.SettlementID, now time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Settle", id, now)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Settle indicates an expected call of Settle
+func (mr *MockSettlementDBInterfaceMockRecorder) Settle(id, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Settle", reflect.TypeOf((*MockSettlementDBInterface)(nil).Settle), id, now)
+}
+
+// WithTx mocks base method
+func (m *MockSettlementDBInterface) WithTx(tx core.Tx) settlements.SettlementDBInterface {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithTx", tx)
+	ret0, _ := ret[0].(settlements.SettlementDBInterface)
+	return ret0
+}
+
+// WithTx indicates an expected call of WithTx
+func (mr *MockSettlementDBInterfaceMockRecorder) WithTx(tx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithTx", reflect.TypeOf((*MockSettlementDBInterface)(nil).WithTx), tx)
+}
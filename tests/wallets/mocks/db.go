@@ -6,6 +6,7 @@ package mocks
 
 import (
 	gomock "github.com/golang/mock/gomock"
+	core "home-broker/core"
 	money "home-broker/money"
 	users "home-broker/users"
 	wallets "home-broker/wallets"
@@ -79,3 +80,45 @@ func (mr *MockWalletDBInterfaceMockRecorder) IncBalanceByUserID(userID, amount i
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncBalanceByUserID", reflect.TypeOf((*MockWalletDBInterface)(nil).IncBalanceByUserID), userID, amount)
 }
+
+// HoldFunds mocks base method
+func (m *MockWalletDBInterface) HoldFunds(userID users.UserID, amount money.Money) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HoldFunds", userID, amount)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HoldFunds indicates an expected call of HoldFunds
+func (mr *MockWalletDBInterfaceMockRecorder) HoldFunds(userID, amount interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HoldFunds", reflect.TypeOf((*MockWalletDBInterface)(nil).HoldFunds), userID, amount)
+}
+
+// ReleaseFunds mocks base method
+func (m *MockWalletDBInterface) ReleaseFunds(userID users.UserID, amount, debit money.Money) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseFunds", userID, amount, debit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseFunds indicates an expected call of ReleaseFunds
+func (mr *MockWalletDBInterfaceMockRecorder) ReleaseFunds(userID, amount, debit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseFunds", reflect.TypeOf((*MockWalletDBInterface)(nil).ReleaseFunds), userID, amount, debit)
+}
+
+// WithTx mocks base method
+func (m *MockWalletDBInterface) WithTx(tx core.Tx) wallets.WalletDBInterface {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithTx", tx)
+	ret0, _ := ret[0].(wallets.WalletDBInterface)
+	return ret0
+}
+
+// WithTx indicates an expected call of WithTx
+func (mr *MockWalletDBInterfaceMockRecorder) WithTx(tx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithTx", reflect.TypeOf((*MockWalletDBInterface)(nil).WithTx), tx)
+}
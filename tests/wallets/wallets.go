@@ -17,10 +17,13 @@ var (
 func GetWallet() wallets.Wallet {
 	user := userstests.GetEntity()
 	balance := money.Money(999999999999999)
+	held := money.Money(111111111111)
 	entity := wallets.Wallet{
 		ID:        wallets.WalletID(9999),
 		UserID:    user.ID,
 		Balance:   balance,
+		Held:      held,
+		Available: balance - held,
 		CreatedAt: BaseTime,
 		UpdatedAt: BaseTime.Add(time.Hour * 2),
 		DeletedAt: time.Time{},
@@ -46,6 +49,15 @@ func CheckWallets(a wallets.Wallet, b wallets.Wallet) error {
 	if a.Balance != b.Balance {
 		return fmt.Errorf("wallet.Balance is %v, expected %v", a.Balance, b.Balance)
 	}
+	if a.Held != b.Held {
+		return fmt.Errorf("wallet.Held is %v, expected %v", a.Held, b.Held)
+	}
+	if a.Available != b.Available {
+		return fmt.Errorf("wallet.Available is %v, expected %v", a.Available, b.Available)
+	}
+	if a.Pending != b.Pending {
+		return fmt.Errorf("wallet.Pending is %v, expected %v", a.Pending, b.Pending)
+	}
 	if a.CreatedAt != b.CreatedAt {
 		return fmt.Errorf("wallet.CreatedAt is %v, expected %v", a.CreatedAt, b.CreatedAt)
 	}
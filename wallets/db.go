@@ -2,6 +2,7 @@ package wallets
 
 import (
 	"errors"
+	"home-broker/core"
 	"home-broker/money"
 	"home-broker/users"
 )
@@ -12,6 +13,9 @@ var (
 
 	// ErrWalletAlreadyExists happens when wallet record already exists.
 	ErrWalletAlreadyExists = errors.New("wallet already exists")
+
+	// ErrInsufficientFunds happens when the available balance does not cover a hold or a debit.
+	ErrInsufficientFunds = errors.New("insufficient funds")
 )
 
 // WalletDBInterface is an interface that handles database commands for Wallet entity.
@@ -28,4 +32,16 @@ type WalletDBInterface interface {
 	// IncBalanceByUserID must increment or decrement the balance field by a user ID.
 	// An updated entity entity will be returned or nil if it does not exist.
 	IncBalanceByUserID(userID users.UserID, amount money.Money) (*Wallet, error)
+
+	// HoldFunds must reserve funds of a wallet if the available balance (balance - held) covers them.
+	// The following errors can happen: ErrInsufficientFunds.
+	HoldFunds(userID users.UserID, amount money.Money) error
+
+	// ReleaseFunds must release held funds of a wallet and remove "debit" from its balance at the same time.
+	// Nothing must change if the balance would not cover the funds still held (balance - debit < held - amount).
+	// The following errors can happen: ErrInsufficientFunds.
+	ReleaseFunds(userID users.UserID, amount money.Money, debit money.Money) error
+
+	// WithTx must return a copy of the handler that runs its commands inside a transaction (see core.UnitOfWork).
+	WithTx(tx core.Tx) WalletDBInterface
 }
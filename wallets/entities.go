@@ -10,10 +10,15 @@ import (
 type WalletID int64
 
 // Wallet represents an user entity wallet for money.
+// The balance includes the funds held by open buying orders.
+// Only the available funds can be used for buying or withdrawal.
 type Wallet struct {
 	ID        WalletID     `json:"id"`
 	UserID    users.UserID `json:"user_id"`
-	Balance   money.Money  `json:"balance"`
+	Balance   money.Money  `json:"balance"`   // Settled funds. Usable for buying and withdrawal when not held.
+	Held      money.Money  `json:"held"`      // Funds reserved by open buying orders. Not usable for buying or withdrawal.
+	Available money.Money  `json:"available"` // Funds that can be used by new orders (balance - held). Usable for buying and withdrawal.
+	Pending   money.Money  `json:"pending"`   // Funds of trades not settled yet (see settlements). Not usable for buying or withdrawal.
 	CreatedAt time.Time    `json:"created_at"`
 	UpdatedAt time.Time    `json:"updated_at"`
 	DeletedAt time.Time    `json:"-"`
@@ -3,6 +3,7 @@ package postgresql
 import (
 	"errors"
 	"fmt"
+	"home-broker/core"
 	"home-broker/core/implem/postgresql"
 	"home-broker/money"
 	"home-broker/users"
@@ -21,6 +22,8 @@ type WalletModel struct {
 	UserID    users.UserID     `gorm:"unique;not null"`
 	User      userspostgresql.UserModel
 	Balance   money.Money    `gorm:"not null;index:,sort:desc"` // Mind the money.MoneyDecimalPlaces.
+	Held      money.Money    `gorm:"not null;default:0"`        // Funds reserved by open buying orders.
+	Pending   money.Money    `gorm:"not null;default:0"`        // Funds of trades not settled yet.
 	CreatedAt time.Time      `gorm:"not null;index:,sort:desc"`
 	UpdatedAt time.Time      `gorm:"not null;index:,sort:desc"`
 	DeletedAt gorm.DeletedAt `gorm:"index:,sort:desc"`
@@ -43,6 +46,11 @@ func NewWalletDB(db postgresql.DB) WalletDB {
 	return WalletDB{db: db}
 }
 
+// WithTx returns a copy of the WalletDB that runs its commands inside a transaction.
+func (walletDB WalletDB) WithTx(tx core.Tx) wallets.WalletDBInterface {
+	return NewWalletDB(walletDB.db.WithTx(tx))
+}
+
 // ToEntity returns a Wallet entity from the ORM model.
 func (WalletDB) ToEntity(model WalletModel) wallets.Wallet {
 	// "model.DeletedAt" is not a Time object. It is a struct with Time and Valid fields.
@@ -55,6 +63,9 @@ func (WalletDB) ToEntity(model WalletModel) wallets.Wallet {
 		ID:        model.ID,
 		UserID:    model.UserID,
 		Balance:   model.Balance,
+		Held:      model.Held,
+		Available: model.Balance - model.Held,
+		Pending:   model.Pending,
 		CreatedAt: model.CreatedAt,
 		UpdatedAt: model.UpdatedAt,
 		DeletedAt: deletedAt,
@@ -72,6 +83,8 @@ func (WalletDB) ToModel(entity wallets.Wallet) WalletModel {
 		ID:        entity.ID,
 		UserID:    entity.UserID,
 		Balance:   entity.Balance,
+		Held:      entity.Held,
+		Pending:   entity.Pending,
 		CreatedAt: entity.CreatedAt,
 		UpdatedAt: entity.UpdatedAt,
 		DeletedAt: deletedAt,
@@ -138,3 +151,84 @@ func (walletDB WalletDB) IncBalanceByUserID(userID users.UserID, amount money.Mo
 	entity, err := walletDB.GetByUserID(userID)
 	return entity, err
 }
+
+// HoldFunds reserves funds of a wallet.
+// The funds are only held if the available balance (balance - held) covers them.
+// The following errors can happen: ErrInsufficientFunds.
+func (walletDB WalletDB) HoldFunds(userID users.UserID, amount money.Money) error {
+	res := walletDB.db.GetDB().
+		Table("wallet").
+		Where(`"user_id"=? AND "deleted_at" IS NULL AND "balance"-"held">=?`, userID, amount).
+		Updates(map[string]interface{}{
+			"held":       gorm.Expr(`"held"+?`, amount),
+			"updated_at": time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: User ID %d", wallets.ErrInsufficientFunds, userID)
+	}
+	return nil
+}
+
+// ReleaseFunds releases held funds of a wallet.
+// The "debit" is removed from the balance at the same time (ex: the cost of a trade).
+// Nothing is changed if the balance would not cover the funds still held by other orders.
+// The following errors can happen: ErrInsufficientFunds.
+func (walletDB WalletDB) ReleaseFunds(userID users.UserID, amount money.Money, debit money.Money) error {
+	res := walletDB.db.GetDB().
+		Table("wallet").
+		Where(`"user_id"=? AND "deleted_at" IS NULL AND "balance"-?>="held"-?`, userID, debit, amount).
+		Updates(map[string]interface{}{
+			"held":       gorm.Expr(`"held"-?`, amount),
+			"balance":    gorm.Expr(`"balance"-?`, debit),
+			"updated_at": time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: User ID %d", wallets.ErrInsufficientFunds, userID)
+	}
+	return nil
+}
+
+// AddPendingFunds adds the funds of a trade not settled yet to a wallet inside a transaction.
+// The following errors can happen: ErrWalletDoesNotExist.
+func AddPendingFunds(tx *gorm.DB, userID users.UserID, amount money.Money) error {
+	res := tx.
+		Table("wallet").
+		Where(`"user_id"=? AND "deleted_at" IS NULL`, userID).
+		Updates(map[string]interface{}{
+			"pending":    gorm.Expr(`"pending"+?`, amount),
+			"updated_at": time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: User ID %d", wallets.ErrWalletDoesNotExist, userID)
+	}
+	return nil
+}
+
+// SettlePendingFunds moves pending funds of a wallet to its balance inside a transaction (ex: on the settlement date).
+// The following errors can happen: ErrWalletDoesNotExist.
+func SettlePendingFunds(tx *gorm.DB, userID users.UserID, amount money.Money) error {
+	res := tx.
+		Table("wallet").
+		Where(`"user_id"=? AND "deleted_at" IS NULL`, userID).
+		Updates(map[string]interface{}{
+			"pending":    gorm.Expr(`"pending"-?`, amount),
+			"balance":    gorm.Expr(`"balance"+?`, amount),
+			"updated_at": time.Now(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("%w: User ID %d", wallets.ErrWalletDoesNotExist, userID)
+	}
+	return nil
+}
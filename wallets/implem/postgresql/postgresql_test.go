@@ -2,11 +2,13 @@ package postgresql_test
 
 import (
 	"errors"
+	"home-broker/core"
 	"home-broker/money"
 	postgresqltests "home-broker/tests/postgresql"
 	walletstests "home-broker/tests/wallets"
 	"home-broker/users"
 	"home-broker/wallets"
+	walletspostgresql "home-broker/wallets/implem/postgresql"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -81,12 +83,12 @@ func TestGetByUserID_WalletWithUserIDExists_WalletReturned(t *testing.T) {
 	}
 	expectedEntity := walletstests.GetWallet()
 
-	columns := []string{"id", "user_id", "balance", "created_at", "updated_at", "deleted_at"}
+	columns := []string{"id", "user_id", "balance", "held", "created_at", "updated_at", "deleted_at"}
 	mock.ExpectQuery(`SELECT \* FROM "wallet" WHERE "wallet"\."user_id" = \$1 AND "wallet"\."deleted_at" IS NULL LIMIT 1`).
 		WithArgs(int64(expectedEntity.UserID)).
 		WillReturnRows(mock.NewRows(columns).
 			AddRow(
-				expectedEntity.ID, expectedEntity.UserID, expectedEntity.Balance,
+				expectedEntity.ID, expectedEntity.UserID, expectedEntity.Balance, expectedEntity.Held,
 				expectedEntity.CreatedAt, expectedEntity.UpdatedAt, nil))
 
 	entity, err := db.GetByUserID(expectedEntity.UserID)
@@ -111,13 +113,15 @@ func TestInsert_UserExists_NewWalletInserted(t *testing.T) {
 	expectedEntity := walletstests.GetWallet()
 	expectedEntity.ID = wallets.WalletID(9999) // future ID
 	mock.ExpectBegin()
-	mock.ExpectQuery(`INSERT INTO "wallet" \("created_at","updated_at","deleted_at","user_id","balance"\) VALUES \(\$1,\$2,\$3,\$4,\$5\) RETURNING "id"`).
+	mock.ExpectQuery(`INSERT INTO "wallet" \("created_at","updated_at","deleted_at","user_id","balance","held","pending"\) VALUES \(\$1,\$2,\$3,\$4,\$5,\$6,\$7\) RETURNING "id"`).
 		WithArgs(
 			sqlmock.AnyArg(),
 			sqlmock.AnyArg(),
 			nil,
 			int64(expectedEntity.UserID),
 			expectedEntity.Balance,
+			expectedEntity.Held,
+			expectedEntity.Pending,
 		).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(expectedEntity.ID))
 	mock.ExpectCommit()
 
@@ -145,13 +149,15 @@ func TestInsert_WalletIDExists_WalletIDAlreadyExistsError(t *testing.T) {
 	expectedEntity := walletstests.GetWallet()
 	expectedEntity.ID = wallets.WalletID(9999) // future ID
 	mock.ExpectBegin()
-	mock.ExpectQuery(`INSERT INTO "wallet" \("created_at","updated_at","deleted_at","user_id","balance","id"\) VALUES \(\$1,\$2,\$3,\$4,\$5,\$6\) RETURNING "id"`).
+	mock.ExpectQuery(`INSERT INTO "wallet" \("created_at","updated_at","deleted_at","user_id","balance","held","pending","id"\) VALUES \(\$1,\$2,\$3,\$4,\$5,\$6,\$7,\$8\) RETURNING "id"`).
 		WithArgs(
 			sqlmock.AnyArg(),
 			sqlmock.AnyArg(),
 			nil,
 			expectedEntity.UserID,
 			expectedEntity.Balance,
+			expectedEntity.Held,
+			expectedEntity.Pending,
 			expectedEntity.ID,
 		).WillReturnError(errors.New(`ERROR: duplicate key value violates unique constraint "wallet_pkey" (SQLSTATE 23505)`))
 	mock.ExpectRollback()
@@ -180,13 +186,15 @@ func TestInsert_WalletUserIDExists_WalletUserIDAlreadyExistsError(t *testing.T)
 	expectedEntity := walletstests.GetWallet()
 	expectedEntity.ID = wallets.WalletID(9999) // future ID
 	mock.ExpectBegin()
-	mock.ExpectQuery(`INSERT INTO "wallet" \("created_at","updated_at","deleted_at","user_id","balance","id"\) VALUES \(\$1,\$2,\$3,\$4,\$5\) RETURNING "id"`).
+	mock.ExpectQuery(`INSERT INTO "wallet" \("created_at","updated_at","deleted_at","user_id","balance","held","pending","id"\) VALUES \(\$1,\$2,\$3,\$4,\$5,\$6,\$7\) RETURNING "id"`).
 		WithArgs(
 			sqlmock.AnyArg(),
 			sqlmock.AnyArg(),
 			nil,
 			expectedEntity.UserID,
 			expectedEntity.Balance,
+			expectedEntity.Held,
+			expectedEntity.Pending,
 		).WillReturnError(errors.New(`ERROR: duplicate key value violates unique constraint "wallet_user_id_key" (SQLSTATE 23505)`))
 	mock.ExpectRollback()
 
@@ -215,13 +223,15 @@ func TestInsert_WalletUserIDDoesNotExist_UserDoesNotExistError(t *testing.T) {
 	expectedEntity.ID = wallets.WalletID(9999) // future ID
 
 	mock.ExpectBegin()
-	mock.ExpectQuery(`INSERT INTO "wallet" \("created_at","updated_at","deleted_at","user_id","balance","id"\) VALUES \(\$1,\$2,\$3,\$4,\$5,\$6\) RETURNING "id"`).
+	mock.ExpectQuery(`INSERT INTO "wallet" \("created_at","updated_at","deleted_at","user_id","balance","held","pending","id"\) VALUES \(\$1,\$2,\$3,\$4,\$5,\$6,\$7,\$8\) RETURNING "id"`).
 		WithArgs(
 			sqlmock.AnyArg(),
 			sqlmock.AnyArg(),
 			nil,
 			expectedEntity.UserID,
 			expectedEntity.Balance,
+			expectedEntity.Held,
+			expectedEntity.Pending,
 			expectedEntity.ID,
 		).WillReturnError(errors.New(`ERROR: insert or update on table "wallet" violates foreign key constraint "fk_wallet_user" (SQLSTATE 23503)`))
 	mock.ExpectRollback()
@@ -259,6 +269,7 @@ func TestIncBalanceByUserID(t *testing.T) {
 	}
 
 	expectedEntity.Balance += balance
+	expectedEntity.Available += balance
 
 	t.Run("WalletExists_WalletRetuned", func(t *testing.T) {
 		mock.ExpectExec(`UPDATE "wallet" SET .+ WHERE.+"user_id"\s*=\s*\$3`).
@@ -268,13 +279,13 @@ func TestIncBalanceByUserID(t *testing.T) {
 				expectedEntity.UserID,
 			).WillReturnResult(sqlmock.NewResult(0, 1))
 
-		columns := []string{"id", "user_id", "balance", "created_at", "updated_at", "deleted_at"}
+		columns := []string{"id", "user_id", "balance", "held", "created_at", "updated_at", "deleted_at"}
 
 		mock.ExpectQuery(`SELECT \* FROM "wallet".+WHERE.+"user_id"\s*=\s*\$1.*`).
 			WithArgs(expectedEntity.UserID).
 			WillReturnRows(mock.NewRows(columns).
 				AddRow(
-					expectedEntity.ID, expectedEntity.UserID, expectedEntity.Balance,
+					expectedEntity.ID, expectedEntity.UserID, expectedEntity.Balance, expectedEntity.Held,
 					expectedEntity.CreatedAt, expectedEntity.UpdatedAt, nil))
 
 		entity, err := db.IncBalanceByUserID(expectedEntity.UserID, value)
@@ -296,7 +307,7 @@ func TestIncBalanceByUserID(t *testing.T) {
 				expectedEntity.UserID,
 			).WillReturnResult(sqlmock.NewResult(0, 0))
 
-		columns := []string{"id", "user_id", "balance", "created_at", "updated_at", "deleted_at"}
+		columns := []string{"id", "user_id", "balance", "held", "created_at", "updated_at", "deleted_at"}
 
 		mock.ExpectQuery(`SELECT \* FROM "wallet".+WHERE.+"user_id"\s*=\s*\$1.*`).
 			WithArgs(expectedEntity.UserID).
@@ -311,3 +322,177 @@ func TestIncBalanceByUserID(t *testing.T) {
 		}
 	})
 }
+
+func TestHoldFunds(t *testing.T) {
+	db, mock, err := postgresqltests.GetMockedWalletDB()
+	if err != nil {
+		t.Error(err)
+	}
+	entity := walletstests.GetWallet()
+
+	value, err := money.NewMoneyFromFloatString("999.999999")
+	if err != nil {
+		t.Error(err)
+	}
+
+	t.Run("AvailableBalanceCoversHold_FundsHeld", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "wallet" SET "held"="held"\+\$1,"updated_at"=\$2 WHERE "user_id"=\$3 AND "deleted_at" IS NULL AND "balance"-"held">=\$4`).
+			WithArgs(
+				value,
+				sqlmock.AnyArg(),
+				entity.UserID,
+				value,
+			).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := db.HoldFunds(entity.UserID, value)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("AvailableBalanceDoesNotCoverHold_ErrInsufficientFunds", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "wallet" SET "held"="held"\+\$1,"updated_at"=\$2 WHERE "user_id"=\$3 AND "deleted_at" IS NULL AND "balance"-"held">=\$4`).
+			WithArgs(
+				value,
+				sqlmock.AnyArg(),
+				entity.UserID,
+				value,
+			).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		err := db.HoldFunds(entity.UserID, value)
+		if !errors.Is(err, wallets.ErrInsufficientFunds) {
+			t.Errorf("expected ErrInsufficientFunds, received \"%v\"", err)
+		}
+	})
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReleaseFunds(t *testing.T) {
+	db, mock, err := postgresqltests.GetMockedWalletDB()
+	if err != nil {
+		t.Error(err)
+	}
+	entity := walletstests.GetWallet()
+
+	held, err := money.NewMoneyFromFloatString("100.000000")
+	if err != nil {
+		t.Error(err)
+	}
+	debit, err := money.NewMoneyFromFloatString("105.000000")
+	if err != nil {
+		t.Error(err)
+	}
+
+	t.Run("BalanceCoversHeld_FundsReleased", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "wallet" SET "balance"="balance"-\$1,"held"="held"-\$2,"updated_at"=\$3 WHERE "user_id"=\$4 AND "deleted_at" IS NULL AND "balance"-\$5>="held"-\$6`).
+			WithArgs(
+				debit,
+				held,
+				sqlmock.AnyArg(),
+				entity.UserID,
+				debit,
+				held,
+			).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := db.ReleaseFunds(entity.UserID, held, debit)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("BalanceDoesNotCoverHeld_ErrInsufficientFunds", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "wallet" SET "balance"="balance"-\$1,"held"="held"-\$2,"updated_at"=\$3 WHERE "user_id"=\$4 AND "deleted_at" IS NULL AND "balance"-\$5>="held"-\$6`).
+			WithArgs(
+				debit,
+				held,
+				sqlmock.AnyArg(),
+				entity.UserID,
+				debit,
+				held,
+			).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		err := db.ReleaseFunds(entity.UserID, held, debit)
+		if !errors.Is(err, wallets.ErrInsufficientFunds) {
+			t.Errorf("expected ErrInsufficientFunds, received \"%v\"", err)
+		}
+	})
+
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	uow, mock, err := postgresqltests.GetMockedDB()
+	if err != nil {
+		t.Error(err)
+	}
+	db := walletspostgresql.NewWalletDB(uow)
+	entity := walletstests.GetWallet()
+	errFailed := errors.New("failed")
+	columns := []string{"id", "user_id", "balance", "held", "created_at", "updated_at", "deleted_at"}
+
+	t.Run("TransactionFails_BalanceRolledBack", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "wallet" SET .+ WHERE.+"user_id"\s*=\s*\$3`).
+			WithArgs(money.Money(1), sqlmock.AnyArg(), entity.UserID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`SELECT \* FROM "wallet".+WHERE.+"user_id"\s*=\s*\$1.*`).
+			WithArgs(entity.UserID).
+			WillReturnRows(mock.NewRows(columns).
+				AddRow(entity.ID, entity.UserID, entity.Balance, entity.Held, entity.CreatedAt, entity.UpdatedAt, nil))
+		mock.ExpectRollback()
+
+		err := uow.Do(func(tx core.Tx) error {
+			_, err := db.WithTx(tx).IncBalanceByUserID(entity.UserID, 1)
+			if err != nil {
+				return err
+			}
+			return errFailed
+		})
+		if !errors.Is(err, errFailed) {
+			t.Errorf("err is %v, expected %v", err, errFailed)
+		}
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("TransactionSucceeds_BalanceCommitted", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "wallet" SET .+ WHERE.+"user_id"\s*=\s*\$3`).
+			WithArgs(money.Money(1), sqlmock.AnyArg(), entity.UserID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`SELECT \* FROM "wallet".+WHERE.+"user_id"\s*=\s*\$1.*`).
+			WithArgs(entity.UserID).
+			WillReturnRows(mock.NewRows(columns).
+				AddRow(entity.ID, entity.UserID, entity.Balance, entity.Held, entity.CreatedAt, entity.UpdatedAt, nil))
+		mock.ExpectCommit()
+
+		err := uow.Do(func(tx core.Tx) error {
+			_, err := db.WithTx(tx).IncBalanceByUserID(entity.UserID, 1)
+			return err
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -23,6 +23,11 @@ func NewWalletUseCases(db WalletDBInterface, userUC users.UserUseCases) WalletUs
 	return WalletUseCases{db: db, userUC: userUC}
 }
 
+// WithTx returns a copy of the use cases whose wallet commands run inside a transaction (see core.UnitOfWork).
+func (uc WalletUseCases) WithTx(tx core.Tx) WalletUseCases {
+	return WalletUseCases{db: uc.db.WithTx(tx), userUC: uc.userUC}
+}
+
 // GetWallet returns a wallet by an user ID.
 // A new empty wallet is created if the wallet does not exist.
 // In this case the user is also created because a missing wallet can be a missing user as well.